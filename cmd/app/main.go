@@ -1,12 +1,16 @@
 package main
 
-import "github.com/CyganFx/table-reservation/internal/app"
+import (
+	"github.com/CyganFx/table-reservation/internal/app"
+	_ "time/tzdata" // cafes' time zones do not depend on tz database of the host
+)
 
 const (
-	configsDir   = "./configs/main.yaml"
-	templatesDir = "./ui/html/"
+	configsDir       = "./configs/main.yaml"
+	templatesDir     = "./ui/html/"
+	notificationsDir = "./ui/notifications/"
 )
 
 func main() {
-	app.Run(configsDir, templatesDir)
+	app.Run(configsDir, templatesDir, notificationsDir)
 }
@@ -4,11 +4,13 @@ import (
 	"context"
 	"github.com/CyganFx/table-reservation/internal/app/config"
 	"github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/delivery/http-v2"
 	"github.com/CyganFx/table-reservation/internal/repository/postgres"
 	"github.com/CyganFx/table-reservation/internal/service"
 	"github.com/CyganFx/table-reservation/pkg/cache"
 	"github.com/CyganFx/table-reservation/pkg/notificator"
 	"github.com/CyganFx/table-reservation/pkg/rest-errors"
+	"github.com/CyganFx/table-reservation/pkg/signer"
 	"github.com/joho/godotenv"
 	"log"
 	"net/http"
@@ -18,8 +20,11 @@ import (
 	"time"
 )
 
+// outboxInterval is how often due notifications are looked for
+const outboxInterval = 15 * time.Second
+
 // Run initializes whole application
-func Run(configsDir, templatesDir string) {
+func Run(configsDir, templatesDir, notificationsDir string) {
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime)
 
@@ -37,6 +42,10 @@ func Run(configsDir, templatesDir string) {
 	if err != nil {
 		errorLog.Fatal(err)
 	}
+	notificationTemplates, err := notificator.LoadTemplates(notificationsDir)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
 	dbPool, err := postgres.InitPool(cfg)
 	if err != nil {
 		errorLog.Fatal(err)
@@ -46,18 +55,43 @@ func Run(configsDir, templatesDir string) {
 	userRepo := postgres.NewUser(dbPool)
 	reservationRepo := postgres.NewReservation(dbPool)
 	cafeRepo := postgres.NewCafe(dbPool)
-	userService := service.NewUser(userRepo)
-	reservationService := service.NewReservation(reservationRepo)
+	waitlistRepo := postgres.NewWaitlist(dbPool)
+	tokenRepo := postgres.NewRefreshToken(dbPool)
+	passwordResetRepo := postgres.NewPasswordReset(dbPool)
+	twoFactorRepo := postgres.NewTwoFactor(dbPool)
+	loginThrottleRepo := postgres.NewLoginThrottle(dbPool)
+	sessionRepo := postgres.NewSession(dbPool)
+	roleRepo := postgres.NewRole(dbPool)
+	staffRepo := postgres.NewStaff(dbPool)
+	auditRepo := postgres.NewAudit(dbPool)
+	outboxRepo := postgres.NewOutbox(dbPool)
+	preferenceRepo := postgres.NewPreference(dbPool)
+	linkSigner := signer.New(cfg.Web.LinkSecret)
+	userService := service.NewUser(userRepo, passwordResetRepo, loginThrottleRepo, linkSigner)
+	tokenService := service.NewToken(tokenRepo, userRepo, signer.New(cfg.Web.AccessTokenSecret))
+	twoFactorService := service.NewTwoFactor(twoFactorRepo, userRepo, loginThrottleRepo)
+	sessionService := service.NewSession(sessionRepo)
+	roleService := service.NewRole(roleRepo, userRepo)
+	staffService := service.NewStaff(staffRepo, userRepo)
+	auditService := service.NewAudit(auditRepo)
+	reservationService := service.NewReservation(reservationRepo, linkSigner)
 	cafeService := service.NewCafe(cafeRepo)
-	notifier := notificator.New(cfg)
+	waitlistService := service.NewWaitlist(waitlistRepo, reservationService, linkSigner)
+	outboxService := service.NewOutbox(outboxRepo, reservationService)
+	preferenceService := service.NewPreference(preferenceRepo, userRepo, linkSigner)
+	notifier := notificator.New(cfg, notificationTemplates, preferenceService)
 	restErrorsResponser := rest_errors.NewHttpResponser(errorLog)
-	handler := http_v1.NewHandler(userService, reservationService, cafeService, notifier, restErrorsResponser, infoLog, templateCache)
+	handler := http_v1.NewHandler(userService, tokenService, twoFactorService, sessionService, roleService, staffService,
+		auditService, reservationService, cafeService, waitlistService, outboxService, preferenceService, notifier, restErrorsResponser,
+		infoLog, templateCache)
+	apiV2 := http_v2.NewHandler(userService, tokenService, twoFactorService, staffService, reservationService, cafeService,
+		waitlistService, notifier, errorLog, infoLog)
 
 	//Server
 	srv := &http.Server{
 		Addr:         ":" + cfg.Web.APIPort,
 		ErrorLog:     errorLog,
-		Handler:      handler.Init(cfg),
+		Handler:      handler.Init(cfg, apiV2),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
@@ -73,11 +107,37 @@ func Run(configsDir, templatesDir string) {
 		serverErrors <- srv.ListenAndServe()
 	}()
 
-	//Notificator
+	// Outbox worker, jobs are claimed in db, so any number of instances can run it
+	go func() {
+		ticker := time.NewTicker(outboxInterval)
+		for range ticker.C {
+			if err := outboxService.DeliverDue(time.Now(), notifier); err != nil {
+				errorLog.Printf("main: %v", err)
+			}
+		}
+	}()
+
+	//Cleanup
 	go func() {
 		ticker := time.NewTicker(time.Minute)
 		for range ticker.C {
-			err := reservationService.CheckNotifyDate(time.Now(), notifier)
+			err := reservationService.ExpireHolds(time.Now())
+			if err != nil {
+				errorLog.Printf("main: %v", err)
+			}
+			err = waitlistService.ExpireOffers(time.Now(), notifier)
+			if err != nil {
+				errorLog.Printf("main: %v", err)
+			}
+			err = tokenService.ExpireRefreshTokens(time.Now())
+			if err != nil {
+				errorLog.Printf("main: %v", err)
+			}
+			err = userService.ExpireLoginFailures(time.Now())
+			if err != nil {
+				errorLog.Printf("main: %v", err)
+			}
+			err = sessionService.ExpireSessions(time.Now())
 			if err != nil {
 				errorLog.Printf("main: %v", err)
 			}
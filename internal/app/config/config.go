@@ -8,6 +8,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"log"
+	"net"
 	_ "net/http/pprof"
 	"os"
 	"time"
@@ -15,15 +16,24 @@ import (
 
 var build = "develop"
 
+// minSecretLength keeps keys that sign links and tokens out of reach of guessing
+const minSecretLength = 32
+
 type Config struct {
 	conf.Version
 	Web struct {
-		APIHost         string        `conf:"default:127.0.0.1" yaml:"host"`
-		APIPort         string        `conf:"default:4000" yaml:"port"`
-		ReadTimeout     time.Duration `conf:"default:5s"`
-		WriteTimeout    time.Duration `conf:"default:10s"`
-		IdleTimeout     time.Duration `conf:"default:5s"`
-		ShutdownTimeout time.Duration `conf:"default:5s"`
+		APIHost           string        `conf:"default:127.0.0.1" yaml:"host"`
+		APIPort           string        `conf:"default:4000" yaml:"port"`
+		ReadTimeout       time.Duration `conf:"default:5s"`
+		WriteTimeout      time.Duration `conf:"default:10s"`
+		IdleTimeout       time.Duration `conf:"default:5s"`
+		ShutdownTimeout   time.Duration `conf:"default:5s"`
+		BaseURL           string        `conf:"default:http://127.0.0.1:8000" yaml:"baseURL"`
+		LinkSecret        string        `conf:"noprint"`
+		AccessTokenSecret string        `conf:"noprint"`
+		// TrustedProxies are addresses or CIDR ranges of load balancers in front of the app,
+		// client's address is taken from X-Forwarded-For only when request comes from one of them
+		TrustedProxies []string `yaml:"trustedProxies"`
 	} `yaml:"web"`
 
 	Database struct {
@@ -48,6 +58,18 @@ type Config struct {
 		From string `conf:"default:duman070601@gmail.com" yaml:"from"`
 		Pass string `conf:"default:secret,noprint"`
 	}
+
+	// SMS and Webhook channels are off until their urls are set
+	SMS struct {
+		URL    string `yaml:"url"`
+		Sender string `conf:"default:CheckPlease" yaml:"sender"`
+		Token  string `conf:"default:secret,noprint"`
+	} `yaml:"sms"`
+
+	Webhook struct {
+		URL    string `yaml:"url"`
+		Secret string `conf:"default:secret,noprint"`
+	} `yaml:"webhook"`
 }
 
 func Init(cfg *Config, configsDir string) error {
@@ -76,6 +98,18 @@ func Init(cfg *Config, configsDir string) error {
 
 	setEnvVariables(cfg)
 
+	// anybody who knows the key can forge links sent by email, so there is no default for it
+	if len(cfg.Web.LinkSecret) < minSecretLength {
+		return errors.Errorf("LINK_SECRET must be set to at least %d characters", minSecretLength)
+	}
+	if len(cfg.Web.AccessTokenSecret) < minSecretLength {
+		return errors.Errorf("ACCESS_TOKEN_SECRET must be set to at least %d characters", minSecretLength)
+	}
+	// access tokens have a key of their own, so that links sent by email and api access never share one
+	if cfg.Web.AccessTokenSecret == cfg.Web.LinkSecret {
+		return errors.New("ACCESS_TOKEN_SECRET must differ from LINK_SECRET")
+	}
+
 	content, err := ioutil.ReadFile(configsDir)
 	if err != nil {
 		return errors.Wrap(err, "reading file")
@@ -85,6 +119,12 @@ func Init(cfg *Config, configsDir string) error {
 		return errors.Wrap(err, "unmarshalling config")
 	}
 
+	for _, proxy := range cfg.Web.TrustedProxies {
+		if !validProxy(proxy) {
+			return errors.Errorf("trusted proxy %q is neither ip address nor cidr range", proxy)
+		}
+	}
+
 	// App Starting
 	expvar.NewString("build").Set(build)
 	log.Printf("main: Started: Application initializing: version %q", build)
@@ -98,8 +138,19 @@ func Init(cfg *Config, configsDir string) error {
 	return nil
 }
 
+func validProxy(proxy string) bool {
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return true
+	}
+	return net.ParseIP(proxy) != nil
+}
+
 func setEnvVariables(cfg *Config) {
 	cfg.Database.Password = os.Getenv("POSTGRES_PASSWORD")
 	cfg.FileStorage.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
 	cfg.SMTP.Pass = os.Getenv("GMAIL_PASSWORD")
+	cfg.Web.LinkSecret = os.Getenv("LINK_SECRET")
+	cfg.Web.AccessTokenSecret = os.Getenv("ACCESS_TOKEN_SECRET")
+	cfg.SMS.Token = os.Getenv("SMS_TOKEN")
+	cfg.Webhook.Secret = os.Getenv("WEBHOOK_SECRET")
 }
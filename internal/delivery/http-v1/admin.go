@@ -1,7 +1,9 @@
 package http_v1
 
 import (
+	"errors"
 	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -9,12 +11,40 @@ import (
 )
 
 func (h *handler) initAdminRoutes(api *gin.RouterGroup) {
-	admin := api.Group("/admin", h.RequireRole(adminRoleID))
+	admin := api.Group("/admin", h.RequireAuthentication(), h.RequirePermission(domain.AdminPermissions...),
+		h.RequireTwoFactorEnrollment())
 	{
 		admin.GET("/", h.AdminPage)
-		admin.GET("/collabs", h.CollabRequestsPage)
-		admin.POST("/approve", h.ApproveCollabRequest)
-		admin.POST("/disapprove", h.DisapproveCollabRequest)
+
+		collabs := admin.Group("", h.RequirePermission(domain.PermissionCafeApprove))
+		{
+			collabs.GET("/collabs", h.CollabRequestsPage)
+			collabs.POST("/approve", h.ApproveCollabRequest)
+			collabs.POST("/disapprove", h.DisapproveCollabRequest)
+		}
+
+		security := admin.Group("", h.RequirePermission(domain.PermissionSecurityManage))
+		{
+			security.GET("/security", h.SecurityPage)
+			security.POST("/security/two-factor", h.SetTwoFactorRequired)
+			security.GET("/locked", h.LockedAccountsPage)
+			security.POST("/unlock", h.UnlockAccount)
+		}
+
+		roles := admin.Group("", h.RequirePermission(domain.PermissionRoleManage))
+		{
+			roles.GET("/roles", h.RolesPage)
+			roles.POST("/roles/permissions/:id", h.SetRolePermissions)
+			roles.POST("/roles/assign", h.AssignRole)
+		}
+
+		admin.GET("/audit", h.RequirePermission(domain.PermissionAuditView), h.AuditPage)
+
+		notifications := admin.Group("", h.RequirePermission(domain.PermissionNotificationRetry))
+		{
+			notifications.GET("/notifications", h.FailedNotificationsPage)
+			notifications.POST("/notifications/retry", h.RetryNotification)
+		}
 	}
 }
 
@@ -39,21 +69,60 @@ func (h *handler) CollabRequestsPage(c *gin.Context) {
 	h.render(c, "admin-collabRequests.page.html", &templateData{Cafes: cafes})
 }
 
+// collabRequest finds cafe that waits for approval, ErrNoRecord is returned for the rest
+func (h *handler) collabRequest(cafeID int) (*domain.Cafe, error) {
+	cafes, err := h.cafeService.GetCollabRequests()
+	if err != nil {
+		return nil, err
+	}
+	for i := range cafes {
+		if cafes[i].ID == cafeID {
+			return &cafes[i], nil
+		}
+	}
+
+	return nil, domain.ErrNoRecord
+}
+
 func (h *handler) ApproveCollabRequest(c *gin.Context) {
 	cafeID, _ := strconv.Atoi(c.Request.FormValue("cafeID"))
 	partnerID, _ := strconv.Atoi(c.Request.FormValue("adminID"))
 	email := c.Request.FormValue("email")
 
+	cafe, err := h.collabRequest(cafeID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
 	if err := h.cafeService.Approve(cafeID); err != nil {
 		h.errors.ServerError(c, err)
 		return
 	}
 
-	if err := h.userService.UpdateUserRole(partnerID, partnerRoleID); err != nil {
+	partnerRole, err := h.roleService.GetRoleByName(domain.RolePartner)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+	if err = h.userService.UpdateUserRole(partnerID, partnerRole.ID); err != nil {
 		h.errors.ServerError(c, err)
 		return
 	}
 
+	h.audit(c, &domain.AuditEntry{
+		Action:     domain.AuditCafeApprove,
+		TargetType: domain.AuditTargetCafe,
+		TargetID:   cafe.ID,
+		CafeID:     cafe.ID,
+		Before:     domain.AuditData{"status": "pending"},
+		After:      domain.AuditData{"status": "approved", "partner": strconv.Itoa(partnerID), "role": partnerRole.Name},
+	})
+
 	if err := h.notificatorService.AdminResponseToPartnership(email, true); err != nil {
 		h.errors.ServerError(c, err)
 		return
@@ -70,11 +139,30 @@ func (h *handler) DisapproveCollabRequest(c *gin.Context) {
 	cafeID, _ := strconv.Atoi(c.Request.FormValue("cafeID"))
 	email := c.Request.FormValue("email")
 
+	cafe, err := h.collabRequest(cafeID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
 	if err := h.cafeService.Disapprove(cafeID); err != nil {
 		h.errors.ServerError(c, err)
 		return
 	}
 
+	// the cafe is deleted, the log is the only place it is left in
+	h.audit(c, &domain.AuditEntry{
+		Action:     domain.AuditCafeDisapprove,
+		TargetType: domain.AuditTargetCafe,
+		TargetID:   cafe.ID,
+		CafeID:     cafe.ID,
+		Before:     auditCafe(cafe),
+	})
+
 	if err := h.notificatorService.AdminResponseToPartnership(email, false); err != nil {
 		h.errors.ServerError(c, err)
 		return
@@ -86,3 +174,36 @@ func (h *handler) DisapproveCollabRequest(c *gin.Context) {
 
 	http.Redirect(c.Writer, c.Request, "/api/admin/collabs", http.StatusSeeOther)
 }
+
+func (h *handler) LockedAccountsPage(c *gin.Context) {
+	users, err := h.userService.GetLockedAccounts()
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "admin.locked.page.html", &templateData{Users: users})
+}
+
+func (h *handler) UnlockAccount(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Request.FormValue("userID"))
+	if err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	if err = h.userService.UnlockAccount(userID); err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", "The account is unlocked")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/admin/locked", http.StatusSeeOther)
+}
@@ -0,0 +1,79 @@
+package http_v1
+
+import (
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+)
+
+type AuditService interface {
+	Record(entry *domain.AuditEntry) error
+	Search(form *forms.FormValidator, filter *domain.AuditFilter) ([]domain.AuditEntry, bool, error)
+}
+
+// audit records privileged action on behalf of authenticated user once the action is done.
+// The action can not be undone when the log fails, therefore failure is only logged
+func (h *handler) audit(c *gin.Context, entry *domain.AuditEntry) {
+	entry.Actor.ID = AuthenticatedUserID(c).(int)
+	entry.IP = c.ClientIP()
+
+	if err := h.auditService.Record(entry); err != nil {
+		h.infoLog.Printf("failed to write %s of %s #%d to audit log: %v", entry.Action, entry.TargetType,
+			entry.TargetID, err)
+	}
+}
+
+// auditCafe keeps what admins saw in collaboration request
+func auditCafe(cafe *domain.Cafe) domain.AuditData {
+	return domain.AuditData{
+		"name":    cafe.Name,
+		"address": cafe.Address,
+		"city":    cafe.City.Name,
+		"email":   cafe.Email,
+		"mobile":  cafe.Mobile,
+		"partner": strconv.Itoa(cafe.AdminID),
+	}
+}
+
+func auditPermissions(permissions []domain.Permission) domain.AuditData {
+	names := make([]string, len(permissions))
+	for i, p := range permissions {
+		names[i] = string(p)
+	}
+	return domain.AuditData{"permissions": strings.Join(names, ", ")}
+}
+
+// auditTable keeps period partner set table busy or free for
+func auditTable(userChoice UserChoice) domain.AuditData {
+	return domain.AuditData{"date": userChoice.Date, "time": userChoice.BookTime}
+}
+
+// AuditPage lets admins filter the whole log by action, actor's email, cafe and dates
+func (h *handler) AuditPage(c *gin.Context) {
+	h.renderAuditPage(c, &domain.AuditFilter{}, nil)
+}
+
+// PartnerAuditPage shows only the log of the selected cafe
+func (h *handler) PartnerAuditPage(c *gin.Context) {
+	member := selectedCafe(c)
+	h.renderAuditPage(c, &domain.AuditFilter{CafeID: member.Cafe.ID}, member)
+}
+
+func (h *handler) renderAuditPage(c *gin.Context, filter *domain.AuditFilter, member *domain.CafeMember) {
+	form := forms.New(c.Request.URL.Query())
+
+	entries, _, err := h.auditService.Search(form, filter)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "audit.page.html", &templateData{
+		AuditEntries: entries,
+		AuditActions: domain.AuditActions,
+		CafeMember:   member,
+		Form:         form,
+	})
+}
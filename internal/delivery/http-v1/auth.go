@@ -0,0 +1,95 @@
+package http_v1
+
+import (
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type TokenService interface {
+	Issue(userID int) (*domain.TokenPair, error)
+	Refresh(refreshToken string) (*domain.TokenPair, error)
+	Revoke(refreshToken string) error
+	Authenticate(accessToken string) (userID, roleID int, err error)
+}
+
+// keys of gin context, Identify puts there user of the request either from session or from access token
+const (
+	identityUserID = "identityUserID"
+	identityRole   = "identityRole"
+	// identityUser is *domain.User loaded by permission checks
+	identityUser = "identityUser"
+)
+
+// BearerToken returns access token from Authorization header
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")), true
+}
+
+// Identify authenticates requests with Authorization header by access token and the rest by session.
+// Requests with bearer token are exempt from csrf check, therefore invalid token is rejected
+// instead of falling back to session cookie. Sessions started before user's sessions were revoked,
+// e.g. by password reset, are logged out. Session middleware must run before it
+func Identify(users UserService, tokens TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			session := sessions.Default(c)
+			if userID := session.Get("authenticatedUserID"); userID != nil {
+				// sessions started before authenticatedAt was stored count as started at unix epoch
+				authenticatedAt, _ := session.Get("authenticatedAt").(int64)
+				valid, err := users.IsSessionValid(userID.(int), time.Unix(0, authenticatedAt))
+				if err != nil {
+					c.AbortWithError(http.StatusInternalServerError, err)
+					return
+				}
+
+				if valid {
+					c.Set(identityUserID, userID)
+					c.Set(identityRole, session.Get("role"))
+				} else {
+					session.Delete("authenticatedUserID")
+					session.Delete("role")
+					session.Delete("authenticatedAt")
+					session.Save()
+				}
+			}
+			c.Next()
+			return
+		}
+
+		token, ok := BearerToken(c.Request)
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization must be a bearer token"})
+			return
+		}
+		userID, roleID, err := tokens.Authenticate(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired access token"})
+			return
+		}
+
+		c.Set(identityUserID, userID)
+		c.Set(identityRole, roleID)
+		c.Next()
+	}
+}
+
+// AuthenticatedUserID returns nil for guests, the same way services expect it
+func AuthenticatedUserID(c *gin.Context) interface{} {
+	userID, _ := c.Get(identityUserID)
+	return userID
+}
+
+func AuthenticatedRole(c *gin.Context) interface{} {
+	role, _ := c.Get(identityRole)
+	return role
+}
@@ -20,8 +20,11 @@ func (h *handler) initCafeRoutes(api *gin.RouterGroup) {
 
 		authenticated := cafe.Group("/", h.RequireAuthentication())
 		{
-			authenticated.GET("/collaborate", h.CollaboratePage)
-			authenticated.POST("/collaborate", h.Collaborate)
+			verified := authenticated.Group("/", h.RequireVerifiedEmail())
+			{
+				verified.GET("/collaborate", h.CollaboratePage)
+				verified.POST("/collaborate", h.Collaborate)
+			}
 		}
 	}
 	gob.Register([]domain.Cafe{})
@@ -42,7 +45,10 @@ type CafeService interface {
 	GetCollabRequests() ([]domain.Cafe, error)
 	Approve(cafeID int) error
 	Disapprove(cafeID int) error
-	GetCafeIDByAdminID(adminID int) (int, error)
+	GetBookingPolicy(cafeID int) (*domain.BookingPolicy, error)
+	SaveBookingPolicy(form *forms.FormValidator, policy *domain.BookingPolicy) (bool, error)
+	GetTableJoins(cafeID int) ([]domain.TableJoin, error)
+	SaveTableJoins(cafeID int, values []string) error
 }
 
 type CollaborateData struct {
@@ -0,0 +1,67 @@
+package http_v1
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func (h *handler) VerifyEmail(c *gin.Context) {
+	session := sessions.Default(c)
+
+	err := h.userService.VerifyEmail(c.Query("token"))
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidToken) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", "The verification link is invalid or has expired, you can request a new one from the banner on top")
+	} else {
+		session.Set("flash", "Thank you, your email address is verified")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+}
+
+func (h *handler) ResendEmailVerification(c *gin.Context) {
+	user, err := h.userService.FindById(AuthenticatedUserID(c).(int))
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	if err = h.userService.SendEmailVerification(user.Email, h.notificatorService); err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", "We have sent a new verification link to "+user.Email)
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+}
+
+// RequireVerifiedEmail goes after RequireAuthentication
+func (h *handler) RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := h.userService.FindById(AuthenticatedUserID(c).(int))
+		if err != nil {
+			h.errors.ServerError(c, err)
+			c.Abort()
+			return
+		}
+		if !user.IsEmailVerified() {
+			session := sessions.Default(c)
+			session.Set("flash", "Please verify your email address first")
+			session.Save()
+
+			http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+			c.Abort()
+			return
+		}
+	}
+}
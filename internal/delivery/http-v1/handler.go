@@ -8,7 +8,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	aws_session "github.com/aws/aws-sdk-go/aws/session"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/nosurf"
 	"html/template"
@@ -26,16 +25,19 @@ var (
 	MyBucket        string
 )
 
-const (
-	adminRoleID   = 1
-	userRoleID    = 2
-	partnerRoleID = 3
-)
-
 type handler struct {
 	userService        UserService
+	tokenService       TokenService
+	twoFactorService   TwoFactorService
+	sessionService     SessionService
+	roleService        RoleService
+	staffService       StaffService
+	auditService       AuditService
 	reservationService ReservationService
 	cafeService        CafeService
+	waitlistService    WaitlistService
+	outboxService      OutboxService
+	preferenceService  PreferenceService
 	notificatorService NotificatorService
 	errors             Responser
 	infoLog            *log.Logger
@@ -57,22 +59,58 @@ type templateData struct {
 	Users           []domain.User
 	ReservationData *ReservationData
 	CollaborateData *CollaborateData
+	BookingPolicy   *domain.BookingPolicy
+	TableJoins      []domain.TableJoin
+	WaitlistEntry   *domain.WaitlistEntry
+	WaitlistEntries []domain.WaitlistEntry
 	Cafes           []domain.Cafe
 	Types           []domain.Type
 	Cities          []domain.City
+	Reservation     *domain.Reservation
 	Reservations    []domain.Reservation
+	ManageToken     string
+	Reply           string // answer guest chose by link of reminder, "confirm" or "cancel"
+	TwoFactor       *TwoFactorData
+	Roles           []domain.Role
+	Permissions     []domain.PermissionInfo
+	// UserPermissions are permissions of authenticated user, see Can
+	UserPermissions []domain.Permission
+	Sessions        []domain.Session
+	// SessionID marks session of this browser among Sessions
+	SessionID       int
+	NotifyChannels  []domain.NotifyChannel
+	NotifyTopics    []domain.NotifyTopic
+	CafeMember      *domain.CafeMember // authenticated user in the cafe selected on partner routes
+	CafeMembers     []domain.CafeMember
+	StaffInvite     *domain.StaffInvite
+	StaffInvites    []domain.StaffInvite
+	StaffRoles      []domain.StaffRole
+	AuditEntries    []domain.AuditEntry
+	AuditActions    []domain.AuditAction
+	Notifications   []domain.Notification
 	Form            *forms.FormValidator
 	CurrentYear     int
 	Flash           string
 	IsAuthenticated bool
+	EmailUnverified bool
 }
 
-func NewHandler(userService UserService, reservationService ReservationService, cafeService CafeService, notificatorService NotificatorService, errors Responser,
+func NewHandler(userService UserService, tokenService TokenService, twoFactorService TwoFactorService, sessionService SessionService,
+	roleService RoleService, staffService StaffService, auditService AuditService, reservationService ReservationService, cafeService CafeService, waitlistService WaitlistService, outboxService OutboxService, preferenceService PreferenceService, notificatorService NotificatorService, errors Responser,
 	infoLog *log.Logger, templateCache map[string]*template.Template) *handler {
 	return &handler{
 		userService:        userService,
+		tokenService:       tokenService,
+		twoFactorService:   twoFactorService,
+		sessionService:     sessionService,
+		roleService:        roleService,
+		staffService:       staffService,
+		auditService:       auditService,
 		reservationService: reservationService,
 		cafeService:        cafeService,
+		waitlistService:    waitlistService,
+		outboxService:      outboxService,
+		preferenceService:  preferenceService,
 		notificatorService: notificatorService,
 		errors:             errors,
 		infoLog:            infoLog,
@@ -80,15 +118,27 @@ func NewHandler(userService UserService, reservationService ReservationService,
 	}
 }
 
+// JSONAPI is a versioned api mounted under /api next to html pages, its clients send json
+// instead of forms with csrf token, therefore its routes are exempt from csrf check
+type JSONAPI interface {
+	Version() string
+	InitRoutes(api *gin.RouterGroup)
+}
+
 //Init set ups router and routes and wraps it in csrf middleware that checks for csrf token in every request
-func (h *handler) Init(cfg config.Config) http.Handler {
+func (h *handler) Init(cfg config.Config, apis ...JSONAPI) http.Handler {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	// X-Forwarded-For is set by clients as they like, only proxies in front of the app are trusted with it,
+	// so that login throttling and audit log get the real address. Config checked the list already
+	if err := router.SetTrustedProxies(cfg.Web.TrustedProxies); err != nil {
+		panic(err)
+	}
 
 	csrfHandler := nosurf.New(router)
 	csrfHandler.SetFailureHandler(http.HandlerFunc(csrfFailHandler))
 
-	sessionStore := cookie.NewStore([]byte(os.Getenv("SESSION_SECRET")))
+	sessionStore := NewSessionStore(h.sessionService)
 	sessionStore.Options(sessions.Options{
 		Path:     "/",
 		HttpOnly: true,
@@ -99,7 +149,7 @@ func (h *handler) Init(cfg config.Config) http.Handler {
 	awsSession := connectAws(cfg)
 
 	router.Use(sessions.Sessions("mySessionStore", sessionStore),
-		gin.Logger(), gin.Recovery(), h.SecureHeaders(),
+		gin.Logger(), gin.Recovery(), h.SecureHeaders(), Identify(h.userService, h.tokenService),
 		func(c *gin.Context) {
 			c.Set("awsSession", awsSession)
 			c.Next()
@@ -112,10 +162,27 @@ func (h *handler) Init(cfg config.Config) http.Handler {
 		h.initAdminRoutes(api)
 		h.initUserRoutes(api)
 		h.initReservationRoutes(api)
+		h.initWaitlistRoutes(api)
 		h.initCafeRoutes(api)
 		h.initPartnerRoutes(api)
+		h.initStaffRoutes(api)
+		h.initPreferenceRoutes(api)
+
+		for _, a := range apis {
+			a.InitRoutes(api.Group("/" + a.Version()))
+			csrfHandler.ExemptRegexp("^/api/" + a.Version() + "/")
+		}
 	}
 
+	// one-click unsubscribe is posted by mail clients, the signed token in the link is what protects it
+	csrfHandler.ExemptPath("/api/unsubscribe")
+
+	// browsers do not attach bearer tokens on their own, so forged requests can not carry them
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		_, ok := BearerToken(r)
+		return ok
+	})
+
 	router.Static("/static/", StaticFilesDir)
 
 	return csrfHandler
@@ -0,0 +1,28 @@
+package http_v1_test
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/CyganFx/table-reservation/internal/app/config"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	http_v2 "github.com/CyganFx/table-reservation/internal/delivery/http-v2"
+)
+
+// TestInit registers every route of html pages and of json api the way app does,
+// gin panics on conflicting routes, e.g. a wildcard next to a static segment
+func TestInit(t *testing.T) {
+	discard := log.New(ioutil.Discard, "", 0)
+	h := http_v1.NewHandler(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, discard, nil)
+	apiV2 := http_v2.NewHandler(nil, nil, nil, nil, nil, nil, nil, nil, discard, discard)
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("registering routes: %v", r)
+		}
+	}()
+	if h.Init(config.Config{}, apiV2) == nil {
+		t.Fatal("want handler")
+	}
+}
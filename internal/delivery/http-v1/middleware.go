@@ -20,18 +20,15 @@ func (h *handler) SecureHeaders() gin.HandlerFunc {
 }
 
 func isAuthenticated(c *gin.Context) bool {
-	session := sessions.Default(c)
-	if session.Get("authenticatedUserID") == nil {
-		return false
-	}
-	return true
+	return AuthenticatedUserID(c) != nil
 }
 
 func (h *handler) RequireAuthentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if !isAuthenticated(c) {
 			session := sessions.Default(c)
-			session.Set("redirectPathAfterLogin", c.Request.URL.Path)
+			// query is kept for emailed links that carry token in it
+			session.Set("redirectPathAfterLogin", c.Request.URL.RequestURI())
 			session.Save()
 
 			http.Redirect(c.Writer, c.Request, "/api/users/login", http.StatusSeeOther)
@@ -42,11 +39,32 @@ func (h *handler) RequireAuthentication() gin.HandlerFunc {
 	}
 }
 
-func (h *handler) RequireRole(roleID int) gin.HandlerFunc {
+// identityUser loads authenticated user once for all middlewares of the request
+func (h *handler) identityUser(c *gin.Context) (*domain.User, error) {
+	if user, ok := c.Get(identityUser); ok {
+		return user.(*domain.User), nil
+	}
+
+	user, err := h.userService.FindById(AuthenticatedUserID(c).(int))
+	if err != nil {
+		return nil, err
+	}
+	c.Set(identityUser, user)
+
+	return user, nil
+}
+
+// RequirePermission goes after RequireAuthentication, it lets in users whose role has any of permissions
+func (h *handler) RequirePermission(permissions ...domain.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		if session.Get("role") != roleID {
-			http.Redirect(c.Writer, c.Request, "/api/users/login", http.StatusSeeOther)
+		user, err := h.identityUser(c)
+		if err != nil {
+			h.errors.ServerError(c, err)
+			c.Abort()
+			return
+		}
+		if !user.Role.Can(permissions...) {
+			h.errors.ClientError(c, http.StatusForbidden)
 			c.Abort()
 			return
 		}
@@ -73,29 +91,43 @@ func (h *handler) addDefaultData(td *templateData, c *gin.Context) *templateData
 		session.Delete("flash")
 	}
 
-	if session.Get("authenticatedUserID") != nil {
+	if userID := AuthenticatedUserID(c); userID != nil {
 		if td.User == nil {
 			td.User = domain.NewUser()
 		}
 		if td.User.ID == 0 {
-			td.User.ID = session.Get("authenticatedUserID").(int)
+			td.User.ID = userID.(int)
 		}
 	}
-	if session.Get("role") != nil {
+	if role := AuthenticatedRole(c); role != nil {
 		if td.User == nil {
 			td.User = domain.NewUser()
 		}
 		if td.User.Role.ID == 0 {
-			td.User.Role.ID = session.Get("role").(int)
+			td.User.Role.ID = role.(int)
 		}
 	}
 
 	td.IsAuthenticated = isAuthenticated(c)
+	if td.IsAuthenticated {
+		// banner is not worth failing the page
+		if user, err := h.userService.FindById(td.User.ID); err != nil {
+			h.infoLog.Printf("checking email verification of user %d: %v", td.User.ID, err)
+		} else {
+			td.EmailUnverified = !user.IsEmailVerified()
+			td.UserPermissions = user.Role.Permissions
+		}
+	}
 	session.Save()
 
 	return td
 }
 
+// Can tells templates whether authenticated user has any of permissions
+func (td *templateData) Can(permissions ...domain.Permission) bool {
+	return domain.Role{Permissions: td.UserPermissions}.Can(permissions...)
+}
+
 func (h *handler) render(c *gin.Context, name string, td *templateData) {
 	ts, ok := h.templateCache[name]
 	if !ok {
@@ -0,0 +1,52 @@
+package http_v1
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// OutboxService delivers notifications that are queued rather than sent right away
+type OutboxService interface {
+	DeliverDue(now time.Time, notificator NotificatorService) error //handler not using
+	GetFailed() ([]domain.Notification, error)
+	Retry(jobID int) error
+}
+
+// FailedNotificationsPage lists notifications that ran out of attempts along with the last error
+func (h *handler) FailedNotificationsPage(c *gin.Context) {
+	jobs, err := h.outboxService.GetFailed()
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "admin.notifications.page.html", &templateData{Notifications: jobs})
+}
+
+func (h *handler) RetryNotification(c *gin.Context) {
+	jobID, err := strconv.Atoi(c.Request.FormValue("notificationID"))
+	if err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	if err = h.outboxService.Retry(jobID); err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", "The notification is queued again")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/admin/notifications", http.StatusSeeOther)
+}
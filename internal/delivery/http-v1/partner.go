@@ -1,7 +1,10 @@
 package http_v1
 
 import (
+	"errors"
 	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -9,39 +12,70 @@ import (
 )
 
 func (h *handler) initPartnerRoutes(api *gin.RouterGroup) {
-	admin := api.Group("/partner", h.RequireRole(partnerRoleID))
+	partner := api.Group("/partner", h.RequireAuthentication(), h.RequirePermission(domain.PartnerPermissions...),
+		h.RequireTwoFactorEnrollment())
 	{
-		admin.GET("/", h.PartnerPage)
-
-		admin.GET("/busy/user/:id", h.PartnerBusyReservationPage)
-		admin.POST("/reservation/available/tables", h.GetAvailableTablesForPartner)
-		admin.POST("/reservation/busy/confirm", h.PartnerBusyTableConfirm)
-
-		admin.GET("/free/user/:id", h.PartnerFreeReservationPage)
-		admin.POST("/reservation/reserved/tables", h.GetReservedTablesForPartner)
-		admin.POST("/reservation/free/confirm", h.PartnerFreeTableConfirm)
-
-		admin.GET("/reportPage/:id", h.ReportPage)
-		admin.POST("/report", h.Report)
+		partner.GET("/cafes", h.CafesPage)
+		partner.POST("/cafes", h.SelectCafe)
+
+		admin := partner.Group("", h.RequireCafe())
+		{
+			admin.GET("/", h.PartnerPage)
+
+			busy := admin.Group("", h.RequireCafePermission(domain.PermissionReservationBook))
+			{
+				busy.GET("/busy", h.PartnerBusyReservationPage)
+				busy.POST("/reservation/available/tables", h.GetAvailableTablesForPartner)
+				busy.POST("/reservation/busy/confirm", h.PartnerBusyTableConfirm)
+			}
+
+			free := admin.Group("", h.RequireCafePermission(domain.PermissionReservationFree))
+			{
+				free.GET("/free", h.PartnerFreeReservationPage)
+				free.POST("/reservation/reserved/tables", h.GetReservedTablesForPartner)
+				free.POST("/reservation/free/confirm", h.PartnerFreeTableConfirm)
+			}
+
+			report := admin.Group("/report", h.RequireCafePermission(domain.PermissionBlacklistManage))
+			{
+				report.GET("", h.ReportPage)
+				report.POST("", h.Report)
+			}
+
+			admin.GET("/reservations", h.RequireCafePermission(domain.PermissionReservationView), h.PartnerReservationsPage)
+			admin.POST("/reservations/:id/status", h.RequireCafePermission(domain.PermissionReservationStatus),
+				h.ChangeReservationStatus)
+
+			settings := admin.Group("", h.RequireCafePermission(domain.PermissionCafeSettings))
+			{
+				settings.GET("/policy", h.BookingPolicyPage)
+				settings.POST("/policy", h.UpdateBookingPolicy)
+				settings.GET("/tables", h.TableJoinsPage)
+				settings.POST("/tables", h.UpdateTableJoins)
+			}
+
+			admin.GET("/waitlist", h.RequireCafePermission(domain.PermissionWaitlistManage), h.PartnerWaitlistPage)
+			admin.POST("/waitlist/:id/remove", h.RequireCafePermission(domain.PermissionWaitlistManage),
+				h.RemoveFromWaitlist)
+
+			admin.GET("/audit", h.RequireCafePermission(domain.PermissionCafeAudit), h.PartnerAuditPage)
+
+			staff := admin.Group("/staff", h.RequireCafePermission(domain.PermissionStaffManage))
+			{
+				staff.GET("", h.StaffPage)
+				staff.POST("/invite", h.InviteStaff)
+				staff.POST("/members/:id/remove", h.RemoveStaff)
+			}
+		}
 	}
 }
 
 func (h *handler) PartnerPage(c *gin.Context) {
-	h.render(c, "partner.admin.page.html", &templateData{})
+	h.render(c, "partner.admin.page.html", &templateData{CafeMember: selectedCafe(c)})
 }
 
 func (h *handler) ReportPage(c *gin.Context) {
-	adminID, err := strconv.Atoi(c.Param("id"))
-	if err != nil || adminID < 1 {
-		h.errors.NotFound(c)
-		return
-	}
-
-	cafeID, err := h.cafeService.GetCafeIDByAdminID(adminID)
-	if err != nil {
-		h.errors.ServerError(c, err)
-		return
-	}
+	cafeID := selectedCafe(c).Cafe.ID
 
 	users, err := h.userService.GetAll(cafeID)
 	if err != nil {
@@ -58,41 +92,37 @@ func (h *handler) Report(c *gin.Context) {
 		return
 	}
 
-	adminID, _ := strconv.Atoi(c.Request.FormValue("adminID"))
 	userID, _ := strconv.Atoi(c.Request.FormValue("userID"))
-	cafeID, err := h.cafeService.GetCafeIDByAdminID(adminID)
-	if err != nil {
-		h.errors.ServerError(c, err)
-		return
-	}
+	member := selectedCafe(c)
 
-	if err := h.userService.AddToBlacklist(userID, cafeID); err != nil {
+	if err := h.userService.AddToBlacklist(member, userID); err != nil {
+		if errors.Is(err, domain.ErrAccessDenied) {
+			h.errors.ClientError(c, http.StatusForbidden)
+			return
+		}
 		h.errors.ServerError(c, err)
 		return
 	}
 
+	h.audit(c, &domain.AuditEntry{
+		Action:     domain.AuditBlacklistAdd,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   userID,
+		CafeID:     member.Cafe.ID,
+	})
+
 	session := sessions.Default(c)
 	session.Set("flash", "Reported successfully!")
 	session.Save()
 
-	http.Redirect(c.Writer, c.Request, fmt.Sprintf("/api/partner/reportPage/%d", adminID), http.StatusSeeOther)
+	http.Redirect(c.Writer, c.Request, "/api/partner/report", http.StatusSeeOther)
 }
 
 func (h *handler) PartnerBusyReservationPage(c *gin.Context) {
-	adminID, err := strconv.Atoi(c.Param("id"))
-	if err != nil || adminID < 1 {
-		h.errors.NotFound(c)
-		return
-	}
-
-	cafeID, err := h.cafeService.GetCafeIDByAdminID(adminID)
-	if err != nil {
-		h.errors.ServerError(c, err)
-		return
-	}
+	cafeID := selectedCafe(c).Cafe.ID
 
 	reservationData := &ReservationData{}
-	err = h.reservationService.SetDefaultReservationData(reservationData, cafeID)
+	err := h.reservationService.SetDefaultReservationData(reservationData, cafeID)
 	if err != nil {
 		h.errors.ServerError(c, err)
 		return
@@ -104,20 +134,10 @@ func (h *handler) PartnerBusyReservationPage(c *gin.Context) {
 }
 
 func (h *handler) PartnerFreeReservationPage(c *gin.Context) {
-	adminID, err := strconv.Atoi(c.Param("id"))
-	if err != nil || adminID < 1 {
-		h.errors.NotFound(c)
-		return
-	}
-
-	cafeID, err := h.cafeService.GetCafeIDByAdminID(adminID)
-	if err != nil {
-		h.errors.ServerError(c, err)
-		return
-	}
+	cafeID := selectedCafe(c).Cafe.ID
 
 	reservationData := &ReservationData{}
-	err = h.reservationService.SetDefaultReservationData(reservationData, cafeID)
+	err := h.reservationService.SetDefaultReservationData(reservationData, cafeID)
 	if err != nil {
 		h.errors.ServerError(c, err)
 		return
@@ -136,23 +156,54 @@ func (h *handler) PartnerBusyTableConfirm(c *gin.Context) {
 	}
 
 	tableID, _ := strconv.Atoi(c.Request.FormValue("table_id"))
-	adminID, _ := strconv.Atoi(c.Request.FormValue("userID"))
 
 	session := sessions.Default(c)
-	userChoice := session.Get("userChoice").(UserChoice)
+	userChoice, ok := session.Get("userChoice").(UserChoice)
+	if !ok {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
 	userChoice.TableID = tableID
 
-	_, err := h.reservationService.BookTableManually(userChoice, adminID)
-	if err != nil {
-		h.errors.ServerError(c, err)
-		return
+	// choice is in session, it might have been made for another cafe on guest's booking pages
+	form := forms.New(c.Request.PostForm)
+	reservationID, formValidator, err := h.reservationService.BookTableManually(selectedCafe(c), form, userChoice)
+	if formValidator != nil {
+		session.Set("flash", "Guest's name, mobile or email is invalid, the table is not set as busy")
+	} else if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.errors.ClientError(c, http.StatusForbidden)
+			return
+		case errors.Is(err, domain.ErrTableTaken):
+			session.Set("flash", "This table is already busy at this time")
+		case errors.Is(err, domain.ErrBookingNotAllowed):
+			session.Set("flash", bookingNotAllowedMessage)
+		default:
+			h.errors.ServerError(c, err)
+			return
+		}
+	} else {
+		// reservation belongs to no account, the log keeps who made it
+		after := auditTable(userChoice)
+		after["reservation"] = strconv.Itoa(reservationID)
+		h.audit(c, &domain.AuditEntry{
+			Action:     domain.AuditTableBusy,
+			TargetType: domain.AuditTargetTable,
+			TargetID:   userChoice.TableID,
+			CafeID:     userChoice.CafeID,
+			After:      after,
+		})
+		if form.Get("email") != "" || form.Get("mobile") != "" {
+			h.sendCafeBookingConfirmation(reservationID)
+		}
+		session.Set("flash", "Set as busy successfully!")
 	}
 
 	session.Delete("userChoice")
-	session.Set("flash", "Set as busy successfully!")
 	session.Save()
 
-	http.Redirect(c.Writer, c.Request, fmt.Sprintf("/api/partner/busy/user/%d", adminID), http.StatusSeeOther)
+	http.Redirect(c.Writer, c.Request, "/api/partner/busy", http.StatusSeeOther)
 }
 
 func (h *handler) PartnerFreeTableConfirm(c *gin.Context) {
@@ -162,22 +213,42 @@ func (h *handler) PartnerFreeTableConfirm(c *gin.Context) {
 	}
 
 	tableID, _ := strconv.Atoi(c.Request.FormValue("table_id"))
-	adminID, _ := strconv.Atoi(c.Request.FormValue("userID"))
 
 	session := sessions.Default(c)
-	userChoice := session.Get("userChoice").(UserChoice)
+	userChoice, ok := session.Get("userChoice").(UserChoice)
+	if !ok {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
 	userChoice.TableID = tableID
 
-	err := h.reservationService.FreeTableManually(userChoice, adminID)
+	cancelled, err := h.reservationService.FreeTableManually(selectedCafe(c), userChoice)
 	if err != nil {
-		h.errors.ServerError(c, err)
-		return
+		switch {
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.errors.ClientError(c, http.StatusForbidden)
+			return
+		case errors.Is(err, domain.ErrBookingNotAllowed):
+			session.Set("flash", bookingNotAllowedMessage)
+		default:
+			h.errors.ServerError(c, err)
+			return
+		}
+	} else {
+		h.audit(c, &domain.AuditEntry{
+			Action:     domain.AuditTableFree,
+			TargetType: domain.AuditTargetTable,
+			TargetID:   userChoice.TableID,
+			CafeID:     userChoice.CafeID,
+			After:      auditTable(userChoice),
+		})
+		h.offerFreedTables(userChoice.CafeID)
+		h.sendBookingCancellations(cancelled)
+		session.Set("flash", "Freed table successfully!")
 	}
-
-	session.Set("flash", "Freed table successfully!")
 	session.Save()
 
-	http.Redirect(c.Writer, c.Request, fmt.Sprintf("/api/partner/free/user/%d", adminID), http.StatusSeeOther)
+	http.Redirect(c.Writer, c.Request, "/api/partner/free", http.StatusSeeOther)
 }
 
 func (h *handler) GetAvailableTablesForPartner(c *gin.Context) {
@@ -187,7 +258,7 @@ func (h *handler) GetAvailableTablesForPartner(c *gin.Context) {
 		return
 	}
 
-	cafeID, _ := strconv.Atoi(c.Request.FormValue("cafe_id"))
+	cafeID := selectedCafe(c).Cafe.ID
 	date := c.Request.FormValue("date")
 	bookTime := c.Request.FormValue("bookTime")
 	locationID, _ := strconv.Atoi(c.Request.FormValue("location_id"))
@@ -207,10 +278,14 @@ func (h *handler) GetAvailableTablesForPartner(c *gin.Context) {
 
 	reservationData := &ReservationData{}
 	reservationData.UserChoice = *userChoice
+	td := &templateData{}
 	reservationData.Tables, err = h.reservationService.GetAvailableTables(cafeID, partySize, locationID, date, bookTime)
 	if err != nil {
-		h.errors.ServerError(c, err)
-		return
+		if !errors.Is(err, domain.ErrBookingNotAllowed) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		td.Flash = bookingNotAllowedMessage
 	}
 
 	err = h.reservationService.SetDefaultReservationData(reservationData, cafeID)
@@ -220,10 +295,9 @@ func (h *handler) GetAvailableTablesForPartner(c *gin.Context) {
 	}
 
 	reservationData.CurrentDate = date
+	td.ReservationData = reservationData
 
-	h.render(c, "partner.busy.reservation.page.html", &templateData{
-		ReservationData: reservationData,
-	})
+	h.render(c, "partner.busy.reservation.page.html", td)
 }
 
 func (h *handler) GetReservedTablesForPartner(c *gin.Context) {
@@ -233,7 +307,7 @@ func (h *handler) GetReservedTablesForPartner(c *gin.Context) {
 		return
 	}
 
-	cafeID, _ := strconv.Atoi(c.Request.FormValue("cafe_id"))
+	cafeID := selectedCafe(c).Cafe.ID
 	date := c.Request.FormValue("date")
 	bookTime := c.Request.FormValue("bookTime")
 	locationID, _ := strconv.Atoi(c.Request.FormValue("location_id"))
@@ -253,10 +327,14 @@ func (h *handler) GetReservedTablesForPartner(c *gin.Context) {
 
 	reservationData := &ReservationData{}
 	reservationData.UserChoice = *userChoice
+	td := &templateData{}
 	reservationData.Tables, err = h.reservationService.GetBusyTables(cafeID, partySize, locationID, date, bookTime)
 	if err != nil {
-		h.errors.ServerError(c, err)
-		return
+		if !errors.Is(err, domain.ErrBookingNotAllowed) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		td.Flash = bookingNotAllowedMessage
 	}
 
 	err = h.reservationService.SetDefaultReservationData(reservationData, cafeID)
@@ -266,8 +344,150 @@ func (h *handler) GetReservedTablesForPartner(c *gin.Context) {
 	}
 
 	reservationData.CurrentDate = date
+	td.ReservationData = reservationData
 
-	h.render(c, "partner.free.reservation.page.html", &templateData{
-		ReservationData: reservationData,
+	h.render(c, "partner.free.reservation.page.html", td)
+}
+
+func (h *handler) BookingPolicyPage(c *gin.Context) {
+	cafeID := selectedCafe(c).Cafe.ID
+
+	policy, err := h.cafeService.GetBookingPolicy(cafeID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "partner.policy.page.html", &templateData{
+		BookingPolicy: policy,
+		Form:          forms.New(nil),
 	})
 }
+
+func (h *handler) UpdateBookingPolicy(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	session := sessions.Default(c)
+	cafeID := selectedCafe(c).Cafe.ID
+
+	form := forms.New(c.Request.PostForm)
+	policy := &domain.BookingPolicy{CafeID: cafeID}
+
+	valid, err := h.cafeService.SaveBookingPolicy(form, policy)
+	if !valid {
+		h.render(c, "partner.policy.page.html", &templateData{
+			BookingPolicy: policy,
+			Form:          form,
+		})
+		return
+	}
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session.Set("flash", "Booking policy updated successfully!")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/policy", http.StatusSeeOther)
+}
+
+// TableJoinsPage lets partner choose tables of the same location that can be put together for large parties
+func (h *handler) TableJoinsPage(c *gin.Context) {
+	cafeID := selectedCafe(c).Cafe.ID
+
+	joins, err := h.cafeService.GetTableJoins(cafeID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "partner.tables.page.html", &templateData{TableJoins: joins})
+}
+
+func (h *handler) UpdateTableJoins(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	session := sessions.Default(c)
+	cafeID := selectedCafe(c).Cafe.ID
+
+	if err := h.cafeService.SaveTableJoins(cafeID, c.Request.PostForm["join"]); err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session.Set("flash", "Joinable tables updated successfully!")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/tables", http.StatusSeeOther)
+}
+
+// PartnerReservationsPage shows cafe's reservations history including cancelled ones
+func (h *handler) PartnerReservationsPage(c *gin.Context) {
+	cafeID := selectedCafe(c).Cafe.ID
+
+	reservations, err := h.reservationService.GetCafeBookings(cafeID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "partner.reservations.page.html", &templateData{Reservations: reservations})
+}
+
+// ChangeReservationStatus lets partner mark guests as seated, completed or no-show
+func (h *handler) ChangeReservationStatus(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	reservationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || reservationID < 1 {
+		h.errors.NotFound(c)
+		return
+	}
+
+	session := sessions.Default(c)
+	member := selectedCafe(c)
+
+	reservation, err := h.reservationService.GetCafeReservation(member, reservationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.errors.NotFound(c)
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.errors.ClientError(c, http.StatusForbidden)
+		default:
+			h.errors.ServerError(c, err)
+		}
+		return
+	}
+
+	status := domain.ReservationStatus(c.Request.FormValue("status"))
+	err = h.reservationService.ChangeStatus(reservation, status, member.User.ID)
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidTransition) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", fmt.Sprintf("Reservation #%d can not become %s", reservationID, status))
+	} else {
+		if !status.OccupiesTable() {
+			h.offerFreedTables(reservation.Cafe.ID)
+		}
+		if status == domain.StatusCancelled {
+			h.sendBookingCancellation(reservation)
+		}
+		session.Set("flash", fmt.Sprintf("Reservation #%d is %s now", reservationID, status))
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/reservations", http.StatusSeeOther)
+}
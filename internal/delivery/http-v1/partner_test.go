@@ -0,0 +1,337 @@
+package http_v1
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// fakes embed service interfaces, calling a method a test does not expect panics
+
+type fakeUsers struct {
+	UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUsers) FindById(id int) (*domain.User, error) {
+	if u, ok := f.users[id]; ok {
+		return u, nil
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeUsers) IsSessionValid(userID int, authenticatedAt time.Time) (bool, error) {
+	return true, nil
+}
+
+type fakeStaff struct {
+	StaffService
+	members []domain.CafeMember
+}
+
+func (f *fakeStaff) GetUserCafes(userID int) ([]domain.CafeMember, error) {
+	var cafes []domain.CafeMember
+	for _, m := range f.members {
+		if m.User.ID == userID {
+			cafes = append(cafes, m)
+		}
+	}
+	return cafes, nil
+}
+
+func (f *fakeStaff) GetMember(cafeID, userID int) (*domain.CafeMember, error) {
+	for _, m := range f.members {
+		if m.Cafe.ID == cafeID && m.User.ID == userID {
+			return &m, nil
+		}
+	}
+	return nil, domain.ErrNoRecord
+}
+
+type fakeReservations struct {
+	ReservationService
+	reservations map[int]*domain.Reservation
+	busy         []UserChoice
+}
+
+func (f *fakeReservations) GetCafeReservation(actor *domain.CafeMember, reservationID int) (*domain.Reservation, error) {
+	r, ok := f.reservations[reservationID]
+	if !ok {
+		return nil, domain.ErrNoRecord
+	}
+	if err := actor.Authorize(r.Cafe.ID, domain.PermissionReservationView, domain.PermissionReservationStatus); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (f *fakeReservations) ChangeStatus(reservation *domain.Reservation, next domain.ReservationStatus, changedBy int) error {
+	reservation.Status = next
+	return nil
+}
+
+func (f *fakeReservations) BookTableManually(actor *domain.CafeMember, form *forms.FormValidator, userChoice UserChoice) (int, *forms.FormValidator, error) {
+	if err := actor.Authorize(userChoice.CafeID, domain.PermissionReservationBook); err != nil {
+		return -1, nil, err
+	}
+	f.busy = append(f.busy, userChoice)
+	// ids of tables set busy come after the reservations test site starts with
+	id := 100 + len(f.busy)
+	f.reservations[id] = &domain.Reservation{ID: id, Cafe: domain.Cafe{ID: userChoice.CafeID},
+		CustName: form.Get("name"), CustEmail: form.Get("email"), Status: domain.StatusConfirmed}
+	return id, nil, nil
+}
+
+func (f *fakeReservations) GetReservation(reservationID int) (*domain.Reservation, error) {
+	r, ok := f.reservations[reservationID]
+	if !ok {
+		return nil, domain.ErrNoRecord
+	}
+	return r, nil
+}
+
+func (f *fakeReservations) ManageToken(reservationID int) string {
+	return "token-" + strconv.Itoa(reservationID)
+}
+
+// fakeNotificator keeps ids of reservations guests were notified of
+type fakeNotificator struct {
+	NotificatorService
+	booked, cancelled []int
+}
+
+func (f *fakeNotificator) CafeBookingConfirmation(data domain.Reservation, manageToken string) error {
+	f.booked = append(f.booked, data.ID)
+	return nil
+}
+
+func (f *fakeNotificator) BookingCancellation(data domain.Reservation) error {
+	f.cancelled = append(f.cancelled, data.ID)
+	return nil
+}
+
+// FreeTableManually cancels every confirmed reservation of the cafe, as if they all were at the freed table
+func (f *fakeReservations) FreeTableManually(actor *domain.CafeMember, userChoice UserChoice) ([]int, error) {
+	if err := actor.Authorize(userChoice.CafeID, domain.PermissionReservationFree); err != nil {
+		return nil, err
+	}
+	var cancelled []int
+	for id, r := range f.reservations {
+		if r.Cafe.ID == userChoice.CafeID && r.Status == domain.StatusConfirmed {
+			r.Status = domain.StatusCancelled
+			cancelled = append(cancelled, id)
+		}
+	}
+	return cancelled, nil
+}
+
+type fakeWaitlist struct {
+	WaitlistService
+	entries map[int]*domain.WaitlistEntry
+}
+
+func (f *fakeWaitlist) OfferFreedTables(cafeID int, notificator NotificatorService) error {
+	return nil
+}
+
+func (f *fakeWaitlist) GetCafeEntry(actor *domain.CafeMember, entryID int) (*domain.WaitlistEntry, error) {
+	e, ok := f.entries[entryID]
+	if !ok {
+		return nil, domain.ErrNoRecord
+	}
+	if err := actor.Authorize(e.Cafe.ID, domain.PermissionWaitlistManage); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+type fakeAudit struct {
+	AuditService
+	entries []domain.AuditEntry
+}
+
+func (f *fakeAudit) Record(entry *domain.AuditEntry) error {
+	f.entries = append(f.entries, *entry)
+	return nil
+}
+
+// fakeErrors responds with bare status, so that tests need no templates
+type fakeErrors struct{}
+
+func (fakeErrors) ServerError(c *gin.Context, err error) {
+	c.String(http.StatusInternalServerError, err.Error())
+}
+
+func (fakeErrors) ClientError(c *gin.Context, status int) {
+	c.Status(status)
+}
+
+func (fakeErrors) NotFound(c *gin.Context) {
+	c.Status(http.StatusNotFound)
+}
+
+const partnerID = 20
+
+type testSite struct {
+	*httptest.Server
+	client       *http.Client
+	reservations *fakeReservations
+	audit        *fakeAudit
+	notificator  *fakeNotificator
+}
+
+// newTestSite serves partner routes to partner who owns cafe 1, cafe 2 belongs to someone else
+func newTestSite(t *testing.T) *testSite {
+	gin.SetMode(gin.TestMode)
+
+	users := &fakeUsers{users: map[int]*domain.User{
+		partnerID: {ID: partnerID, Role: domain.Role{Name: domain.RolePartner, Permissions: domain.PartnerPermissions}},
+	}}
+	staff := &fakeStaff{members: []domain.CafeMember{
+		{Cafe: domain.Cafe{ID: 1}, User: domain.User{ID: partnerID}, Role: domain.StaffOwner},
+	}}
+	site := &testSite{reservations: &fakeReservations{reservations: map[int]*domain.Reservation{
+		1: {ID: 1, Cafe: domain.Cafe{ID: 1}, Status: domain.StatusConfirmed},
+		2: {ID: 2, Cafe: domain.Cafe{ID: 2}, Status: domain.StatusConfirmed},
+		3: {ID: 3, Cafe: domain.Cafe{ID: 1}, Status: domain.StatusConfirmed, CustEmail: "guest@mail.kz"},
+	}}, audit: &fakeAudit{}, notificator: &fakeNotificator{}}
+	waitlist := &fakeWaitlist{entries: map[int]*domain.WaitlistEntry{
+		5: {ID: 5, Cafe: domain.Cafe{ID: 2}, Status: domain.WaitlistWaiting},
+	}}
+
+	discard := log.New(ioutil.Discard, "", 0)
+	h := NewHandler(users, nil, nil, nil, nil, staff, site.audit, site.reservations, nil, waitlist, nil, nil,
+		site.notificator, fakeErrors{}, discard, nil)
+
+	router := gin.New()
+	router.Use(sessions.Sessions("test", cookie.NewStore([]byte("secret"))), Identify(users, nil))
+	// signs partner in with choice of cafe to book at, the way guest's booking pages leave it in session
+	router.POST("/test/login", func(c *gin.Context) {
+		cafeID, _ := strconv.Atoi(c.Query("cafe_id"))
+		session := sessions.Default(c)
+		session.Set("authenticatedUserID", partnerID)
+		session.Set("userChoice", UserChoice{CafeID: cafeID, Date: "2021-06-04", BookTime: "19:00"})
+		session.Save()
+	})
+	api := router.Group("/api")
+	h.initReservationRoutes(api) // registers UserChoice kept in session
+	h.initPartnerRoutes(api)
+
+	site.Server = httptest.NewServer(router)
+	t.Cleanup(site.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site.client = &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	return site
+}
+
+func (s *testSite) post(t *testing.T, path string, form url.Values) int {
+	t.Helper()
+
+	res, err := s.client.Post(s.URL+path, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestPartnerCrossCafeAccess(t *testing.T) {
+	site := newTestSite(t)
+	site.post(t, "/test/login?cafe_id=2", nil)
+
+	tests := []struct {
+		name string
+		path string
+		form url.Values
+	}{
+		{"select another cafe", "/api/partner/cafes", url.Values{"cafeID": {"2"}}},
+		{"change status of another cafe's reservation", "/api/partner/reservations/2/status",
+			url.Values{"status": {string(domain.StatusSeated)}}},
+		{"remove guest from another cafe's waitlist", "/api/partner/waitlist/5/remove", nil},
+		{"set table of another cafe busy", "/api/partner/reservation/busy/confirm", url.Values{"table_id": {"1"}}},
+		{"free table of another cafe", "/api/partner/reservation/free/confirm", url.Values{"table_id": {"1"}}},
+	}
+
+	for _, tt := range tests {
+		if status := site.post(t, tt.path, tt.form); status != http.StatusForbidden {
+			t.Errorf("%s: want %d; got %d", tt.name, http.StatusForbidden, status)
+		}
+	}
+	if site.reservations.reservations[2].Status != domain.StatusConfirmed || len(site.reservations.busy) != 0 {
+		t.Errorf("want another cafe unchanged; got %s, %+v", site.reservations.reservations[2].Status, site.reservations.busy)
+	}
+	if len(site.audit.entries) != 0 {
+		t.Errorf("want no denied action in audit log; got %+v", site.audit.entries)
+	}
+
+	site.post(t, "/test/login?cafe_id=1", nil)
+	if status := site.post(t, "/api/partner/reservation/busy/confirm", url.Values{"table_id": {"1"}}); status != http.StatusSeeOther {
+		t.Fatalf("want table of own cafe set busy; got %d", status)
+	}
+	if len(site.audit.entries) != 1 || site.audit.entries[0].Action != domain.AuditTableBusy ||
+		site.audit.entries[0].Actor.ID != partnerID || site.audit.entries[0].CafeID != 1 {
+		t.Errorf("want busy table of own cafe in audit log; got %+v", site.audit.entries)
+	}
+	if status := site.post(t, "/api/partner/reservations/1/status",
+		url.Values{"status": {string(domain.StatusSeated)}}); status != http.StatusSeeOther {
+		t.Errorf("want status of own reservation changed; got %d", status)
+	}
+}
+
+func TestPartnerNotifiesGuest(t *testing.T) {
+	site := newTestSite(t)
+	site.post(t, "/test/login?cafe_id=1", nil)
+
+	site.post(t, "/api/partner/reservation/busy/confirm", url.Values{"table_id": {"1"}})
+	site.post(t, "/test/login?cafe_id=1", nil)
+	site.post(t, "/api/partner/reservation/busy/confirm",
+		url.Values{"table_id": {"2"}, "name": {"Aigerim"}, "email": {"guest@mail.kz"}})
+	if len(site.reservations.busy) != 2 {
+		t.Fatalf("want both tables set busy; got %+v", site.reservations.busy)
+	}
+	if booked := site.notificator.booked; len(booked) != 1 || booked[0] != 102 {
+		t.Errorf("want confirmation of the booking with guest's contacts only; got %v", booked)
+	}
+
+	site.post(t, "/api/partner/reservations/1/status", url.Values{"status": {string(domain.StatusCancelled)}})
+	site.post(t, "/api/partner/reservations/3/status", url.Values{"status": {string(domain.StatusCancelled)}})
+	if cancelled := site.notificator.cancelled; len(cancelled) != 1 || cancelled[0] != 3 {
+		t.Errorf("want cancellation sent to guest with contacts only; got %v", cancelled)
+	}
+}
+
+func TestPartnerFreeTableNotifiesGuests(t *testing.T) {
+	site := newTestSite(t)
+	site.post(t, "/test/login?cafe_id=1", nil)
+
+	if status := site.post(t, "/api/partner/reservation/free/confirm", url.Values{"table_id": {"1"}}); status != http.StatusSeeOther {
+		t.Fatalf("want table freed; got %d", status)
+	}
+	if cancelled := site.notificator.cancelled; len(cancelled) != 1 || cancelled[0] != 3 {
+		t.Errorf("want cancellation sent to guest with contacts only; got %v", cancelled)
+	}
+	if site.reservations.reservations[2].Status != domain.StatusConfirmed {
+		t.Errorf("want reservation of another cafe kept; got %s", site.reservations.reservations[2].Status)
+	}
+}
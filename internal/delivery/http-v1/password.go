@@ -0,0 +1,102 @@
+package http_v1
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+)
+
+const invalidResetLinkMessage = "The link is invalid or has expired, please request a new one"
+
+func (h *handler) ForgotPasswordPage(c *gin.Context) {
+	h.render(c, "password.forgot.page.html", &templateData{Form: forms.New(nil)})
+}
+
+// ForgotPassword answers the same whether the email is registered or not
+func (h *handler) ForgotPassword(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(c.Request.PostForm)
+	form.Required("email")
+	form.MatchesPattern("email", forms.EmailRX)
+	if !form.Valid() {
+		h.render(c, "password.forgot.page.html", &templateData{Form: form})
+		return
+	}
+
+	if err := h.userService.RequestPasswordReset(form.Get("email"), h.notificatorService); err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", "If an account with this email exists, we have sent a link to reset the password")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/login", http.StatusSeeOther)
+}
+
+func (h *handler) redirectToForgotPassword(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Set("flash", invalidResetLinkMessage)
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/password/forgot", http.StatusSeeOther)
+}
+
+// ResetPasswordPage takes one-time token from "token" query parameter of emailed link
+func (h *handler) ResetPasswordPage(c *gin.Context) {
+	token := c.Query("token")
+
+	err := h.userService.CheckPasswordReset(token)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			h.redirectToForgotPassword(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "password.reset.page.html", &templateData{Form: forms.New(url.Values{"token": {token}})})
+}
+
+func (h *handler) ResetPassword(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(c.Request.PostForm)
+
+	ok, err := h.userService.ResetPassword(form)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			h.redirectToForgotPassword(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+	if !ok {
+		h.render(c, "password.reset.page.html", &templateData{Form: form})
+		return
+	}
+
+	// sessions are revoked anyway, logging out here keeps the page from showing user as logged in
+	session := sessions.Default(c)
+	session.Delete("authenticatedUserID")
+	session.Delete("role")
+	session.Delete("authenticatedAt")
+	session.Set("flash", "Your password has been changed, please log in")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/login", http.StatusSeeOther)
+}
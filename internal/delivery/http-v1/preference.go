@@ -0,0 +1,136 @@
+package http_v1
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (h *handler) initPreferenceRoutes(api *gin.RouterGroup) {
+	unsubscribe := api.Group("/unsubscribe")
+	{
+		unsubscribe.GET("", h.Unsubscribe)
+		// mail clients post here without csrf token when user presses their unsubscribe button
+		unsubscribe.POST("", h.OneClickUnsubscribe)
+		unsubscribe.GET("/email", h.UnsubscribeEmailPage)
+		unsubscribe.POST("/email", h.UnsubscribeEmail)
+	}
+}
+
+type PreferenceService interface {
+	Unsubscribe(token string) ([]domain.NotifyTopic, error)
+	RequestEmailUnsubscribe(email string, notificator NotificatorService) error
+	GetPreferences(userID int) (domain.NotifyPreferences, error)
+	UpdatePreferences(userID int, preferences domain.NotifyPreferences) error
+}
+
+// Unsubscribe follows the link at the bottom of a message, token comes in "token" query parameter
+func (h *handler) Unsubscribe(c *gin.Context) {
+	session := sessions.Default(c)
+
+	topics, err := h.preferenceService.Unsubscribe(c.Query("token"))
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidToken) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", "The unsubscribe link is invalid or has expired, you can request a new one by email")
+		session.Save()
+
+		http.Redirect(c.Writer, c.Request, "/api/unsubscribe/email", http.StatusSeeOther)
+		return
+	}
+
+	titles := make([]string, len(topics))
+	for i, topic := range topics {
+		titles[i] = strings.ToLower(topic.Title())
+	}
+	session.Set("flash", "You are unsubscribed from "+strings.Join(titles, ", "))
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+}
+
+// OneClickUnsubscribe is List-Unsubscribe-Post of RFC 8058, mail client shows nothing but the status
+func (h *handler) OneClickUnsubscribe(c *gin.Context) {
+	_, err := h.preferenceService.Unsubscribe(c.Query("token"))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			h.errors.ClientError(c, http.StatusBadRequest)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (h *handler) UnsubscribeEmailPage(c *gin.Context) {
+	h.render(c, "unsubscribe.email.page.html", &templateData{Form: forms.New(nil)})
+}
+
+// UnsubscribeEmail lets guests without account unsubscribe by email address, the address gets a link
+// to confirm, so nobody can unsubscribe others. It answers the same whether anybody booked with the address or not
+func (h *handler) UnsubscribeEmail(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(c.Request.PostForm)
+	form.Required("email")
+	form.MatchesPattern("email", forms.EmailRX)
+	if !form.Valid() {
+		h.render(c, "unsubscribe.email.page.html", &templateData{Form: form})
+		return
+	}
+
+	if err := h.preferenceService.RequestEmailUnsubscribe(form.Get("email"), h.notificatorService); err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", "If we have sent anything to this email, we have sent a link to unsubscribe it")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+}
+
+// UpdateNotifyPreferences saves checkboxes of the profile page, checkbox of topic and channel is named "topic.channel"
+func (h *handler) UpdateNotifyPreferences(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	userID := AuthenticatedUserID(c).(int)
+	session := sessions.Default(c)
+
+	preferences := domain.NotifyPreferences{}
+	for _, topic := range domain.NotifyTopics {
+		for _, channel := range domain.NotifyChannels {
+			preferences.Set(topic, channel, c.Request.PostForm.Get(string(topic)+"."+string(channel)) != "")
+		}
+	}
+
+	err := h.preferenceService.UpdatePreferences(userID, preferences)
+	switch {
+	case errors.Is(err, domain.ErrNoMobile):
+		session.Set("flash", "Please add your mobile number first")
+	case err != nil:
+		h.errors.ServerError(c, err)
+		return
+	default:
+		session.Set("flash", "Notification preferences are saved")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/profile/"+strconv.Itoa(userID), http.StatusSeeOther)
+}
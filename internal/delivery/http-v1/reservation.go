@@ -2,12 +2,16 @@ package http_v1
 
 import (
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"github.com/CyganFx/table-reservation/internal/domain"
 	"github.com/CyganFx/table-reservation/pkg/validator/forms"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,29 +22,60 @@ func (h *handler) initReservationRoutes(api *gin.RouterGroup) {
 		reservation.POST("/tables", h.GetAvailableTables)
 		reservation.POST("/confirm", h.Confirm)
 		reservation.POST("/submit", h.BookTable)
+
+		manage := reservation.Group("/manage")
+		{
+			manage.GET("/:id", h.ManageReservationPage)
+			manage.POST("/:id/confirm", h.ConfirmVisit)
+			manage.POST("/:id/cancel", h.CancelReservation)
+			manage.POST("/:id/reschedule", h.RescheduleReservation)
+		}
 	}
 	gob.RegisterName("github.com/CyganFx/table-reservation/ez-booking/internal/delivery/http-v1.UserChoice",
 		UserChoice{}) // in order to put struct in session
 }
 
+const bookingNotAllowedMessage = "Sorry, the cafe does not accept bookings for this date, time or party size"
+
 type ReservationService interface {
 	GetAvailableTables(cafeID, partySize, locationID int, date, bookTime string) ([]domain.Table, error)
+	GetTableCombinations(cafeID, partySize, locationID int, date, bookTime string) ([]domain.TableCombination, error)
 	GetLocationsByCafeID(cafeID int) ([]domain.Location, error)
 	GetEventsByCafeID(cafeID int) ([]domain.Event, error)
 	BookTable(form *forms.FormValidator, userChoice UserChoice, userID interface{}) (int, *forms.FormValidator, error)
-	BookTableManually(userChoice UserChoice, userID interface{}) (int, error)
+	BookTableManually(actor *domain.CafeMember, form *forms.FormValidator, userChoice UserChoice) (int, *forms.FormValidator, error)
+	HoldTables(userChoice UserChoice) (*domain.TableHold, error)
+	ReleaseHold(holdID int) error
 	GetUserBookings(userID int) ([]domain.Reservation, error)
 	SetDefaultReservationData(data *ReservationData, cafeID int) error
 
-	CheckNotifyDate(now time.Time, notificator NotificatorService) error //handler not using
-	FreeTableManually(userChoice UserChoice, userID interface{}) error
+	ExpireHolds(now time.Time) error //handler not using
+	FreeTableManually(actor *domain.CafeMember, userChoice UserChoice) ([]int, error)
 	GetBusyTables(cafeID, partySize, locationID int, date, bookTime string) ([]domain.Table, error)
+	GetCafeBookings(cafeID int) ([]domain.Reservation, error)
+	GetReservation(reservationID int) (*domain.Reservation, error)
+	GetCafeReservation(actor *domain.CafeMember, reservationID int) (*domain.Reservation, error)
+	ManageToken(reservationID int) string
+	GetManageableReservation(reservationID int, userID interface{}, token string) (*domain.Reservation, error)
+	Cancel(reservation *domain.Reservation, userID interface{}) error
+	ConfirmVisit(reservation *domain.Reservation) error
+	ChangeStatus(reservation *domain.Reservation, next domain.ReservationStatus, changedBy int) error
+	Reschedule(reservation *domain.Reservation, date, bookTime string) error
 }
 
 type NotificatorService interface {
-	UsersBooking(data []domain.Reservation) error
+	Reminder(data domain.Reservation, manageToken string) error
+	BookingConfirmation(data domain.Reservation, manageToken string) error
+	CafeBookingConfirmation(data domain.Reservation, manageToken string) error
+	BookingCancellation(data domain.Reservation) error
+	WaitlistOffer(entry domain.WaitlistEntry, claimToken string) error
+	PasswordReset(user domain.User, token string) error
+	EmailVerification(user domain.User, token string) error
+	AccountLocked(user domain.User, until time.Time) error
 	CollaborationNotify(cafe domain.Cafe) error
 	AdminResponseToPartnership(email string, decision bool) error
+	StaffInvite(invite domain.StaffInvite, token string) error
+	UnsubscribeConfirmation(email, token string) error
 }
 
 type ReservationData struct {
@@ -55,18 +90,22 @@ type ReservationData struct {
 	LocationSelector  []domain.Location
 	EventSelector     []domain.Event
 	Tables            []domain.Table
+	Combinations      []domain.TableCombination // offered when no single table seats the party
+	HoldExpiresAt     time.Time
 	UserChoice        UserChoice
 }
 
 type UserChoice struct {
 	CafeID           int
 	TableID          int
+	JoinedTableIDs   []int
 	EventID          int
 	LocationID       int
 	PartySize        int
 	EventDescription string
 	Date             string
 	BookTime         string
+	HoldID           int // tables are held for the guest while they fill in the confirmation form
 }
 
 func (h *handler) ReservationPage(c *gin.Context) {
@@ -79,6 +118,10 @@ func (h *handler) ReservationPage(c *gin.Context) {
 	reservationData := &ReservationData{}
 	err = h.reservationService.SetDefaultReservationData(reservationData, cafeID)
 	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
 		h.errors.ServerError(c, err)
 		return
 	}
@@ -110,15 +153,27 @@ func (h *handler) GetAvailableTables(c *gin.Context) {
 	}
 
 	session := sessions.Default(c)
+	h.releaseHold(session)
 	session.Set("userChoice", userChoice)
 	session.Save()
 
 	reservationData := &ReservationData{}
 	reservationData.UserChoice = *userChoice
+	td := &templateData{}
 	reservationData.Tables, err = h.reservationService.GetAvailableTables(cafeID, partySize, locationID, date, bookTime)
 	if err != nil {
-		h.errors.ServerError(c, err)
-		return
+		if !errors.Is(err, domain.ErrBookingNotAllowed) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		td.Flash = bookingNotAllowedMessage
+	} else if len(reservationData.Tables) == 0 {
+		reservationData.Combinations, err =
+			h.reservationService.GetTableCombinations(cafeID, partySize, locationID, date, bookTime)
+		if err != nil {
+			h.errors.ServerError(c, err)
+			return
+		}
 	}
 
 	err = h.reservationService.SetDefaultReservationData(reservationData, cafeID)
@@ -127,10 +182,9 @@ func (h *handler) GetAvailableTables(c *gin.Context) {
 		return
 	}
 	reservationData.CurrentDate = date
+	td.ReservationData = reservationData
 
-	h.render(c, "reservation.page.html", &templateData{
-		ReservationData: reservationData,
-	})
+	h.render(c, "reservation.page.html", td)
 }
 
 func (h *handler) Confirm(c *gin.Context) {
@@ -139,17 +193,62 @@ func (h *handler) Confirm(c *gin.Context) {
 		return
 	}
 
-	tableID, _ := strconv.Atoi(c.Request.FormValue("table_id"))
+	// single table comes as "3", combination of tables as "3,4"
+	var tableIDs []int
+	for _, value := range strings.Split(c.Request.FormValue("table_id"), ",") {
+		if value == "" {
+			continue
+		}
+		tableID, err := strconv.Atoi(value)
+		if err != nil {
+			h.errors.ClientError(c, http.StatusBadRequest)
+			return
+		}
+		tableIDs = append(tableIDs, tableID)
+	}
 	eventID, _ := strconv.Atoi(c.Request.FormValue("event_id"))
 	eventDescription := c.Request.FormValue("event_description")
 
+	// guest may come back and choose other tables
+	session := sessions.Default(c)
+	h.releaseHold(session)
+
 	reservationData := &ReservationData{}
-	form, err := h.userService.SetConfirmData(c, reservationData, tableID, eventID, eventDescription)
+	form, err := h.userService.SetConfirmData(c, reservationData, tableIDs, eventID, eventDescription)
 	if err != nil {
 		h.errors.NotFound(c)
 		return
 	}
 
+	cafePath := fmt.Sprintf("/api/reservation/cafe/%d", reservationData.UserChoice.CafeID)
+	if len(tableIDs) == 0 {
+		session.Set("flash", "Please choose a table")
+		session.Save()
+		http.Redirect(c.Writer, c.Request, cafePath, http.StatusSeeOther)
+		return
+	}
+
+	hold, err := h.reservationService.HoldTables(reservationData.UserChoice)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrTableTaken):
+			session.Set("flash", "Sorry, someone just took this table, please choose another one")
+		case errors.Is(err, domain.ErrBookingNotAllowed):
+			session.Set("flash", bookingNotAllowedMessage)
+		default:
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Save()
+		http.Redirect(c.Writer, c.Request, cafePath, http.StatusSeeOther)
+		return
+	}
+
+	reservationData.UserChoice.HoldID = hold.ID
+	reservationData.HoldExpiresAt = hold.ExpiresAt
+	session.Set("userChoice", reservationData.UserChoice)
+	session.Save()
+
 	h.render(c, "confirm.page.html", &templateData{
 		ReservationData: reservationData,
 		Form:            form,
@@ -164,7 +263,7 @@ func (h *handler) BookTable(c *gin.Context) {
 
 	session := sessions.Default(c)
 	userChoice := session.Get("userChoice").(UserChoice)
-	userID := session.Get("authenticatedUserID")
+	userID := AuthenticatedUserID(c)
 
 	if userID != nil {
 		yes, err := h.userService.InBlacklist(userID.(int), userChoice.CafeID)
@@ -183,21 +282,252 @@ func (h *handler) BookTable(c *gin.Context) {
 
 	form := forms.New(c.Request.PostForm)
 
-	_, formValidator, err := h.reservationService.BookTable(form, userChoice, userID)
+	reservationID, formValidator, err := h.reservationService.BookTable(form, userChoice, userID)
 	if formValidator != nil {
 		h.render(c, "confirm.page.html", &templateData{
 			ReservationData: reservationData,
 			Form:            form,
 		})
 		return
+	} else if errors.Is(err, domain.ErrTableTaken) {
+		session.Set("flash", "Sorry, someone just took this table, please choose another one")
+		session.Save()
+		http.Redirect(c.Writer, c.Request, fmt.Sprintf("/api/reservation/cafe/%d", userChoice.CafeID), http.StatusSeeOther)
+		return
+	} else if errors.Is(err, domain.ErrBookingNotAllowed) {
+		session.Set("flash", bookingNotAllowedMessage)
+		session.Save()
+		http.Redirect(c.Writer, c.Request, fmt.Sprintf("/api/reservation/cafe/%d", userChoice.CafeID), http.StatusSeeOther)
+		return
 	} else if err != nil {
 		h.errors.ServerError(c, err)
 		return
 	}
 
+	h.sendBookingConfirmation(reservationID)
+
 	session.Delete("userChoice")
 	session.Set("flash", "Booked successfully! You will get notifications as your time comes")
 	session.Save()
 
 	http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
 }
+
+// releaseHold frees tables held for guest's previous choice, the hold expires anyway if it fails
+func (h *handler) releaseHold(session sessions.Session) {
+	userChoice, ok := session.Get("userChoice").(UserChoice)
+	if !ok || userChoice.HoldID == 0 {
+		return
+	}
+
+	if err := h.reservationService.ReleaseHold(userChoice.HoldID); err != nil {
+		h.infoLog.Printf("failed to release table hold #%d: %v", userChoice.HoldID, err)
+	}
+	userChoice.HoldID = 0
+	session.Set("userChoice", userChoice)
+}
+
+// sendBookingConfirmation does not fail the request, reservation is already made at this point
+func (h *handler) sendBookingConfirmation(reservationID int) {
+	token := h.reservationService.ManageToken(reservationID)
+	reservation, err := h.reservationService.GetReservation(reservationID)
+	if err != nil {
+		h.infoLog.Printf("failed to get reservation #%d for confirmation: %v", reservationID, err)
+		return
+	}
+
+	if err = h.notificatorService.BookingConfirmation(*reservation, token); err != nil {
+		h.infoLog.Printf("failed to send confirmation of reservation #%d: %v", reservationID, err)
+	}
+}
+
+// sendCafeBookingConfirmation lets guest who booked through the cafe manage reservation the way they would
+// have if they booked themselves
+func (h *handler) sendCafeBookingConfirmation(reservationID int) {
+	token := h.reservationService.ManageToken(reservationID)
+	reservation, err := h.reservationService.GetReservation(reservationID)
+	if err != nil {
+		h.infoLog.Printf("failed to get reservation #%d for confirmation: %v", reservationID, err)
+		return
+	}
+
+	if err = h.notificatorService.CafeBookingConfirmation(*reservation, token); err != nil {
+		h.infoLog.Printf("failed to send confirmation of reservation #%d: %v", reservationID, err)
+	}
+}
+
+// sendBookingCancellation does not fail the request either, tables set busy by staff have no guest to notify
+func (h *handler) sendBookingCancellation(reservation *domain.Reservation) {
+	if reservation.CustEmail == "" && reservation.CustMobile == "" {
+		return
+	}
+	if err := h.notificatorService.BookingCancellation(*reservation); err != nil {
+		h.infoLog.Printf("failed to send cancellation of reservation #%d: %v", reservation.ID, err)
+	}
+}
+
+// sendBookingCancellations notifies guests of reservations cancelled together, e.g. when staff free a table
+func (h *handler) sendBookingCancellations(reservationIDs []int) {
+	for _, id := range reservationIDs {
+		reservation, err := h.reservationService.GetReservation(id)
+		if err != nil {
+			h.infoLog.Printf("failed to get reservation #%d for cancellation: %v", id, err)
+			continue
+		}
+		h.sendBookingCancellation(reservation)
+	}
+}
+
+// manageableReservation loads reservation from url, guest is identified either by session
+// or by token from the emailed link; writes error response itself when it returns false
+func (h *handler) manageableReservation(c *gin.Context) (*domain.Reservation, string, bool) {
+	reservationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || reservationID < 1 {
+		h.errors.NotFound(c)
+		return nil, "", false
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		token = c.Request.PostFormValue("token")
+	}
+	userID := AuthenticatedUserID(c)
+
+	reservation, err := h.reservationService.GetManageableReservation(reservationID, userID, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.errors.NotFound(c)
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.errors.ClientError(c, http.StatusForbidden)
+		default:
+			h.errors.ServerError(c, err)
+		}
+		return nil, "", false
+	}
+
+	return reservation, token, true
+}
+
+func manageReservationPath(reservationID int, token string) string {
+	path := fmt.Sprintf("/api/reservation/manage/%d", reservationID)
+	if token != "" {
+		path += "?token=" + url.QueryEscape(token)
+	}
+	return path
+}
+
+func (h *handler) ManageReservationPage(c *gin.Context) {
+	reservation, token, ok := h.manageableReservation(c)
+	if !ok {
+		return
+	}
+
+	reservationData := &ReservationData{}
+	reservationData.UserChoice.Date = reservation.Date.Format("2006-01-02")
+	reservationData.UserChoice.BookTime = reservation.Date.Format("15:04")
+	err := h.reservationService.SetDefaultReservationData(reservationData, reservation.Cafe.ID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "reservation.manage.page.html", &templateData{
+		Reservation:     reservation,
+		ReservationData: reservationData,
+		ManageToken:     token,
+		Reply:           c.Query("reply"),
+	})
+}
+
+// ConfirmVisit is what guest answers to reminder asking whether they are coming
+func (h *handler) ConfirmVisit(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	reservation, token, ok := h.manageableReservation(c)
+	if !ok {
+		return
+	}
+
+	session := sessions.Default(c)
+	err := h.reservationService.ConfirmVisit(reservation)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotChangeable) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", "This reservation can not be confirmed anymore")
+	} else {
+		session.Set("flash", "Thank you for confirming, see you soon!")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, manageReservationPath(reservation.ID, token), http.StatusSeeOther)
+}
+
+func (h *handler) CancelReservation(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	reservation, token, ok := h.manageableReservation(c)
+	if !ok {
+		return
+	}
+
+	session := sessions.Default(c)
+	err := h.reservationService.Cancel(reservation, AuthenticatedUserID(c))
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotChangeable) && !errors.Is(err, domain.ErrInvalidTransition) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", "This reservation can not be cancelled anymore")
+	} else {
+		h.offerFreedTables(reservation.Cafe.ID)
+		h.sendBookingCancellation(reservation)
+		session.Set("flash", "Your reservation is cancelled")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, manageReservationPath(reservation.ID, token), http.StatusSeeOther)
+}
+
+func (h *handler) RescheduleReservation(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	reservation, token, ok := h.manageableReservation(c)
+	if !ok {
+		return
+	}
+
+	date := c.Request.FormValue("date")
+	bookTime := c.Request.FormValue("bookTime")
+
+	session := sessions.Default(c)
+	err := h.reservationService.Reschedule(reservation, date, bookTime)
+	switch {
+	case err == nil:
+		h.offerFreedTables(reservation.Cafe.ID)
+		session.Set("flash", fmt.Sprintf("Your reservation is moved to %s %s", date, bookTime))
+	case errors.Is(err, domain.ErrNotChangeable):
+		session.Set("flash", "This reservation can not be rescheduled anymore")
+	case errors.Is(err, domain.ErrBookingNotAllowed):
+		session.Set("flash", bookingNotAllowedMessage)
+	case errors.Is(err, domain.ErrNoAvailableTables), errors.Is(err, domain.ErrTableTaken):
+		session.Set("flash", "Sorry, there are no free tables at this time, please choose another one")
+	default:
+		h.errors.ServerError(c, err)
+		return
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, manageReservationPath(reservation.ID, token), http.StatusSeeOther)
+}
@@ -0,0 +1,18 @@
+package http_v1
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestConfirmRejectsBadTableID(t *testing.T) {
+	site := newTestSite(t)
+
+	// booking only the tables before the bad one would seat party at a part of what they chose
+	for _, tableIDs := range []string{"3,x", "x,3", "3,,4;"} {
+		if status := site.post(t, "/api/reservation/confirm", url.Values{"table_id": {tableIDs}}); status != http.StatusBadRequest {
+			t.Errorf("table_id %q: want %d; got %d", tableIDs, http.StatusBadRequest, status)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package http_v1
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type RoleService interface {
+	GetRoles() ([]domain.Role, error)
+	GetRoleByName(name string) (*domain.Role, error)
+	GetStaff() ([]domain.User, error)
+	SetPermissions(actorID, roleID int, permissions []string) (*domain.Role, error)
+	AssignRole(actorID int, email string, roleID int) (*domain.User, *domain.Role, error)
+}
+
+// RolesPage shows permissions of every role and users who have any permission
+func (h *handler) RolesPage(c *gin.Context) {
+	roles, err := h.roleService.GetRoles()
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	staff, err := h.roleService.GetStaff()
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "admin.roles.page.html", &templateData{
+		Roles:       roles,
+		Permissions: domain.Permissions,
+		Users:       staff,
+	})
+}
+
+func (h *handler) SetRolePermissions(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.errors.NotFound(c)
+		return
+	}
+
+	session := sessions.Default(c)
+	before, err := h.roleService.SetPermissions(AuthenticatedUserID(c).(int), roleID, c.Request.PostForm["permission"])
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.errors.NotFound(c)
+			return
+		case errors.Is(err, domain.ErrUnknownPermission):
+			h.errors.ClientError(c, http.StatusBadRequest)
+			return
+		case errors.Is(err, domain.ErrAccessDenied):
+			session.Set("flash", "You can not take role management away from your own role")
+		default:
+			h.errors.ServerError(c, err)
+			return
+		}
+	} else {
+		after := make([]domain.Permission, len(c.Request.PostForm["permission"]))
+		for i, name := range c.Request.PostForm["permission"] {
+			after[i] = domain.Permission(name)
+		}
+		h.audit(c, &domain.AuditEntry{
+			Action:     domain.AuditRolePermissions,
+			TargetType: domain.AuditTargetRole,
+			TargetID:   roleID,
+			Before:     auditPermissions(before.Permissions),
+			After:      auditPermissions(after),
+		})
+		session.Set("flash", "Permissions are updated")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/admin/roles", http.StatusSeeOther)
+}
+
+// AssignRole ends sessions of the user, so that the new role is in effect right away
+func (h *handler) AssignRole(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	roleID, err := strconv.Atoi(c.Request.PostForm.Get("roleID"))
+	if err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	session := sessions.Default(c)
+	user, role, err := h.roleService.AssignRole(AuthenticatedUserID(c).(int), c.Request.PostForm.Get("email"), roleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			session.Set("flash", "There is no user with this email")
+		case errors.Is(err, domain.ErrAccessDenied):
+			session.Set("flash", "You can not change your own role")
+		default:
+			h.errors.ServerError(c, err)
+			return
+		}
+	} else {
+		h.audit(c, &domain.AuditEntry{
+			Action:     domain.AuditRoleAssign,
+			TargetType: domain.AuditTargetUser,
+			TargetID:   user.ID,
+			Before:     domain.AuditData{"role": user.Role.Name},
+			After:      domain.AuditData{"role": role.Name},
+		})
+		session.Set("flash", "The role is assigned")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/admin/roles", http.StatusSeeOther)
+}
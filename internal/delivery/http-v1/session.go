@@ -0,0 +1,69 @@
+package http_v1
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type SessionService interface {
+	Start(session *domain.Session) (string, error)
+	Find(token string) (*domain.Session, error)
+	Save(session *domain.Session) error
+	End(sessionID int) error
+	GetUserSessions(userID int) ([]domain.Session, error)
+	Revoke(userID, sessionID int) error
+	RevokeOthers(userID, currentSessionID int) error
+}
+
+// CurrentSessionID returns ID of stored session of the request, 0 when the session is not saved yet
+func CurrentSessionID(c *gin.Context) int {
+	stored, _ := sessions.Default(c).Get(storedSessionKey{}).(*domain.Session)
+	if stored == nil {
+		return 0
+	}
+	return stored.ID
+}
+
+func (h *handler) RevokeSession(c *gin.Context) {
+	userID := AuthenticatedUserID(c).(int)
+	sessionID, err := strconv.Atoi(c.Request.FormValue("sessionID"))
+	if err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	if err = h.sessionService.Revoke(userID, sessionID); err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", "The session is ended")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/profile/"+strconv.Itoa(userID), http.StatusSeeOther)
+}
+
+// RevokeOtherSessions logs user out everywhere except this browser
+func (h *handler) RevokeOtherSessions(c *gin.Context) {
+	userID := AuthenticatedUserID(c).(int)
+
+	if err := h.sessionService.RevokeOthers(userID, CurrentSessionID(c)); err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", "You've been logged out on other devices")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/profile/"+strconv.Itoa(userID), http.StatusSeeOther)
+}
@@ -0,0 +1,148 @@
+package http_v1
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-contrib/sessions"
+	gsessions "github.com/gorilla/sessions"
+	"net"
+	"net/http"
+	"time"
+)
+
+// storedSessionKey keeps *domain.Session among values of gorilla session, it is not saved with them
+type storedSessionKey struct{}
+
+// maxUserAgentLength is the size of user_agent column
+const maxUserAgentLength = 255
+
+// sessionStore keeps sessions in database, the cookie holds only the token of session.
+// Unlike cookie store it lets users end their sessions on other devices
+// and lets the app end sessions of user whose role or password was changed
+type sessionStore struct {
+	sessions SessionService
+	options  *gsessions.Options
+}
+
+func NewSessionStore(sessions SessionService) *sessionStore {
+	return &sessionStore{sessions: sessions, options: &gsessions.Options{Path: "/"}}
+}
+
+func (s *sessionStore) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+}
+
+func (s *sessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of cookie or returns a new one when there is no such session anymore
+func (s *sessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	stored, err := s.sessions.Find(cookie.Value)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return session, nil
+		}
+		return session, err
+	}
+	if err = gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+
+	session.ID = cookie.Value
+	session.Values[storedSessionKey{}] = stored
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save starts a new session with a new token whenever user logs in or out,
+// so that the token known before login is of no use after it
+func (s *sessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	stored, _ := session.Values[storedSessionKey{}].(*domain.Session)
+	userID, _ := session.Values["authenticatedUserID"].(int)
+
+	if stored != nil && (session.Options.MaxAge < 0 || stored.UserID != userID) {
+		if err := s.sessions.End(stored.ID); err != nil {
+			return err
+		}
+		stored = nil
+		delete(session.Values, storedSessionKey{})
+	}
+	// guest's session without values, e.g. right after logout, is not worth a row
+	if session.Options.MaxAge < 0 || (stored == nil && len(session.Values) == 0) {
+		expireSessionCookie(w, session)
+		return nil
+	}
+
+	data, err := encodeSessionValues(session.Values)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second)
+
+	if stored == nil {
+		stored = &domain.Session{UserID: userID, Data: data, IP: remoteIP(r), UserAgent: r.UserAgent(), ExpiresAt: expiresAt}
+		if len(stored.UserAgent) > maxUserAgentLength {
+			stored.UserAgent = stored.UserAgent[:maxUserAgentLength]
+		}
+		if session.ID, err = s.sessions.Start(stored); err != nil {
+			return err
+		}
+		session.Values[storedSessionKey{}] = stored
+	} else {
+		stored.Data, stored.ExpiresAt = data, expiresAt
+		if err = s.sessions.Save(stored); err != nil {
+			if !errors.Is(err, domain.ErrNoRecord) {
+				return err
+			}
+			// the session was revoked while the request was handled
+			expireSessionCookie(w, session)
+			return nil
+		}
+	}
+
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+func expireSessionCookie(w http.ResponseWriter, session *gsessions.Session) {
+	options := *session.Options
+	options.MaxAge = -1
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), "", &options))
+}
+
+func encodeSessionValues(values map[interface{}]interface{}) ([]byte, error) {
+	saved := make(map[interface{}]interface{}, len(values))
+	for k, v := range values {
+		if _, ok := k.(storedSessionKey); !ok {
+			saved[k] = v
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(saved); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,282 @@
+package http_v1
+
+import (
+	"errors"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type StaffService interface {
+	GetMember(cafeID, userID int) (*domain.CafeMember, error)
+	GetUserCafes(userID int) ([]domain.CafeMember, error)
+	GetStaff(cafeID int) ([]domain.CafeMember, error)
+	GetPendingInvites(cafeID int) ([]domain.StaffInvite, error)
+	Invite(actor *domain.CafeMember, form *forms.FormValidator, notificator NotificatorService) (bool, error)
+	CheckInvite(token string) (*domain.StaffInvite, error)
+	AcceptInvite(token string, userID int) (*domain.StaffInvite, error)
+	RemoveMember(actor *domain.CafeMember, userID int) error
+}
+
+// cafeMember is gin context key of *domain.CafeMember put by RequireCafe
+const cafeMember = "cafeMember"
+
+const invalidInviteMessage = "The invite is invalid or has expired, please ask the cafe for a new one"
+
+func (h *handler) initStaffRoutes(api *gin.RouterGroup) {
+	staff := api.Group("/staff", h.RequireAuthentication())
+	{
+		staff.GET("/invite", h.StaffInvitePage)
+		staff.POST("/invite", h.AcceptStaffInvite)
+	}
+}
+
+// RequireCafe goes after RequireAuthentication, it puts authenticated user's membership in the cafe
+// selected in session to the context. Users who work at a single cafe have it selected on their own,
+// the rest are sent to choose one
+func (h *handler) RequireCafe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := h.identityUser(c)
+		if err != nil {
+			h.errors.ServerError(c, err)
+			c.Abort()
+			return
+		}
+
+		session := sessions.Default(c)
+		cafeID, ok := session.Get("cafeID").(int)
+		if !ok {
+			cafes, err := h.staffService.GetUserCafes(user.ID)
+			if err != nil {
+				h.errors.ServerError(c, err)
+				c.Abort()
+				return
+			}
+			if len(cafes) == 0 {
+				h.errors.ClientError(c, http.StatusForbidden)
+				c.Abort()
+				return
+			}
+			if len(cafes) > 1 {
+				http.Redirect(c.Writer, c.Request, "/api/partner/cafes", http.StatusSeeOther)
+				c.Abort()
+				return
+			}
+			cafeID = cafes[0].Cafe.ID
+			session.Set("cafeID", cafeID)
+			session.Save()
+		}
+
+		member, err := h.staffService.GetMember(cafeID, user.ID)
+		if err != nil {
+			if !errors.Is(err, domain.ErrNoRecord) {
+				h.errors.ServerError(c, err)
+				c.Abort()
+				return
+			}
+			// user was removed from staff of the selected cafe meanwhile
+			session.Delete("cafeID")
+			session.Save()
+			http.Redirect(c.Writer, c.Request, "/api/partner/cafes", http.StatusSeeOther)
+			c.Abort()
+			return
+		}
+		member.User = *user
+		c.Set(cafeMember, member)
+	}
+}
+
+// RequireCafePermission goes after RequireCafe, it lets in staff who may do any of permissions in the selected cafe
+func (h *handler) RequireCafePermission(permissions ...domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !selectedCafe(c).Can(permissions...) {
+			h.errors.ClientError(c, http.StatusForbidden)
+			c.Abort()
+			return
+		}
+	}
+}
+
+// selectedCafe returns membership put by RequireCafe
+func selectedCafe(c *gin.Context) *domain.CafeMember {
+	return c.MustGet(cafeMember).(*domain.CafeMember)
+}
+
+// CafesPage lets staff of several cafes choose the one partner's panel works with
+func (h *handler) CafesPage(c *gin.Context) {
+	cafes, err := h.staffService.GetUserCafes(AuthenticatedUserID(c).(int))
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "partner.cafes.page.html", &templateData{CafeMembers: cafes})
+}
+
+func (h *handler) SelectCafe(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	cafeID, err := strconv.Atoi(c.Request.PostForm.Get("cafeID"))
+	if err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.staffService.GetMember(cafeID, AuthenticatedUserID(c).(int))
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.ClientError(c, http.StatusForbidden)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("cafeID", member.Cafe.ID)
+	session.Set("flash", fmt.Sprintf("You are working with %s now", member.Cafe.Name))
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/", http.StatusSeeOther)
+}
+
+func (h *handler) StaffPage(c *gin.Context) {
+	h.renderStaffPage(c, forms.New(nil))
+}
+
+func (h *handler) renderStaffPage(c *gin.Context, form *forms.FormValidator) {
+	member := selectedCafe(c)
+
+	staff, err := h.staffService.GetStaff(member.Cafe.ID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	invites, err := h.staffService.GetPendingInvites(member.Cafe.ID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "partner.staff.page.html", &templateData{
+		CafeMember:   member,
+		CafeMembers:  staff,
+		StaffInvites: invites,
+		StaffRoles:   domain.StaffRoles,
+		Form:         form,
+	})
+}
+
+func (h *handler) InviteStaff(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(c.Request.PostForm)
+	valid, err := h.staffService.Invite(selectedCafe(c), form, h.notificatorService)
+	if !valid {
+		h.renderStaffPage(c, form)
+		return
+	}
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("flash", fmt.Sprintf("Invite is sent to %s", form.Get("email")))
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/staff", http.StatusSeeOther)
+}
+
+func (h *handler) RemoveStaff(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID < 1 {
+		h.errors.NotFound(c)
+		return
+	}
+
+	session := sessions.Default(c)
+	err = h.staffService.RemoveMember(selectedCafe(c), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.errors.NotFound(c)
+			return
+		case errors.Is(err, domain.ErrAccessDenied):
+			session.Set("flash", "You can not remove yourself from staff")
+		default:
+			h.errors.ServerError(c, err)
+			return
+		}
+	} else {
+		session.Set("flash", "Removed from staff")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/staff", http.StatusSeeOther)
+}
+
+// StaffInvitePage takes token from "token" query parameter of emailed link
+func (h *handler) StaffInvitePage(c *gin.Context) {
+	token := c.Query("token")
+
+	invite, err := h.staffService.CheckInvite(token)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			h.redirectHome(c, invalidInviteMessage)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	form := forms.New(url.Values{"token": []string{token}})
+	h.render(c, "staff.invite.page.html", &templateData{StaffInvite: invite, Form: form})
+}
+
+func (h *handler) AcceptStaffInvite(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	invite, err := h.staffService.AcceptInvite(c.Request.PostForm.Get("token"), AuthenticatedUserID(c).(int))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidToken):
+			h.redirectHome(c, invalidInviteMessage)
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.redirectHome(c, "The invite was sent to another email, please sign in with it")
+		default:
+			h.errors.ServerError(c, err)
+		}
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("cafeID", invite.Cafe.ID)
+	session.Set("flash", fmt.Sprintf("Welcome to %s!", invite.Cafe.Name))
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/", http.StatusSeeOther)
+}
+
+func (h *handler) redirectHome(c *gin.Context, flash string) {
+	session := sessions.Default(c)
+	session.Set("flash", flash)
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+}
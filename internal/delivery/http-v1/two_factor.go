@@ -0,0 +1,271 @@
+package http_v1
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// twoFactorLoginTTL is how long the password step of login is remembered while user looks for the phone
+const twoFactorLoginTTL = 5 * time.Minute
+
+type TwoFactorService interface {
+	BeginEnrollment(userID int) (*domain.TOTPEnrollment, error)
+	PendingEnrollment(userID int) (*domain.TOTPEnrollment, error)
+	ConfirmEnrollment(userID int, code string) ([]string, error)
+	Verify(userID int, code, ip string, notificator NotificatorService) error
+	Disable(userID int, code string) error
+	SetRequired(roleID int, required bool) error
+}
+
+type TwoFactorData struct {
+	Enabled    bool
+	Required   bool
+	Enrollment *domain.TOTPEnrollment
+	// QRCode is Enrollment.QRCode as data url for img tag
+	QRCode        template.URL
+	RecoveryCodes []string
+}
+
+// logIn starts the session of user who passed all login steps
+func (h *handler) logIn(c *gin.Context, user *domain.User) {
+	session := sessions.Default(c)
+	session.Delete("twoFactorUserID")
+	session.Delete("twoFactorStartedAt")
+	session.Set("authenticatedUserID", user.ID)
+	session.Set("role", user.Role.ID)
+	session.Set("authenticatedAt", time.Now().UnixNano())
+	session.Set("flash", "loginned successfully!")
+
+	if session.Get("redirectPathAfterLogin") == nil {
+		session.Save()
+		http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+		return
+	}
+
+	path := session.Get("redirectPathAfterLogin").(string)
+	session.Delete("redirectPathAfterLogin")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, path, http.StatusSeeOther)
+}
+
+// pendingTwoFactorUserID returns user who entered the password and is yet to enter the code
+func pendingTwoFactorUserID(c *gin.Context) (int, bool) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("twoFactorUserID").(int)
+	if !ok {
+		return 0, false
+	}
+	startedAt, _ := session.Get("twoFactorStartedAt").(int64)
+	if time.Since(time.Unix(startedAt, 0)) > twoFactorLoginTTL {
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *handler) redirectToLogin(c *gin.Context, flash string) {
+	session := sessions.Default(c)
+	session.Delete("twoFactorUserID")
+	session.Delete("twoFactorStartedAt")
+	session.Set("flash", flash)
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/login", http.StatusSeeOther)
+}
+
+func (h *handler) TwoFactorLoginPage(c *gin.Context) {
+	if _, ok := pendingTwoFactorUserID(c); !ok {
+		h.redirectToLogin(c, "Please log in again")
+		return
+	}
+
+	h.render(c, "login.two-factor.page.html", &templateData{Form: forms.New(nil)})
+}
+
+func (h *handler) TwoFactorLogin(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := pendingTwoFactorUserID(c)
+	if !ok {
+		h.redirectToLogin(c, "Please log in again")
+		return
+	}
+
+	form := forms.New(c.Request.PostForm)
+	form.Required("code")
+	if !form.Valid() {
+		h.render(c, "login.two-factor.page.html", &templateData{Form: form})
+		return
+	}
+
+	err := h.twoFactorService.Verify(userID, form.Get("code"), c.ClientIP(), h.notificatorService)
+	if err != nil {
+		var throttled *domain.LoginThrottledError
+		if errors.Is(err, domain.ErrInvalidCode) {
+			if err != domain.ErrInvalidCode {
+				h.infoLog.Printf("failed two-factor code of user %d: %v", userID, err)
+			}
+			form.Errors.Add("code", "The code is incorrect or was already used")
+			h.render(c, "login.two-factor.page.html", &templateData{Form: form})
+			return
+		}
+		if errors.As(err, &throttled) {
+			form.Errors.Add("code", LoginThrottledMessage(throttled, time.Now()))
+			h.render(c, "login.two-factor.page.html", &templateData{Form: form})
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	user, err := h.userService.FindById(userID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.logIn(c, user)
+}
+
+func (h *handler) TwoFactorPage(c *gin.Context) {
+	userID := AuthenticatedUserID(c).(int)
+	user, err := h.userService.FindById(userID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	data := &TwoFactorData{Enabled: user.IsTwoFactorEnabled(), Required: user.Role.RequireTwoFactor}
+	if !data.Enabled {
+		data.Enrollment, err = h.twoFactorService.PendingEnrollment(userID)
+		if err != nil && !errors.Is(err, domain.ErrNoRecord) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		if data.Enrollment != nil {
+			data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(data.Enrollment.QRCode))
+		}
+	}
+
+	h.render(c, "two-factor.page.html", &templateData{Form: forms.New(nil), TwoFactor: data})
+}
+
+func (h *handler) BeginTwoFactorSetup(c *gin.Context) {
+	if _, err := h.twoFactorService.BeginEnrollment(AuthenticatedUserID(c).(int)); err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	http.Redirect(c.Writer, c.Request, "/api/users/two-factor", http.StatusSeeOther)
+}
+
+// EnableTwoFactor shows recovery codes, it is the only time they are visible
+func (h *handler) EnableTwoFactor(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.twoFactorService.ConfirmEnrollment(AuthenticatedUserID(c).(int), c.Request.PostForm.Get("code"))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			session := sessions.Default(c)
+			session.Set("flash", "The code is incorrect, check the time on your phone and try again")
+			session.Save()
+			http.Redirect(c.Writer, c.Request, "/api/users/two-factor", http.StatusSeeOther)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "two-factor.page.html", &templateData{
+		Form:      forms.New(nil),
+		TwoFactor: &TwoFactorData{Enabled: true, RecoveryCodes: codes},
+	})
+}
+
+func (h *handler) DisableTwoFactor(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	session := sessions.Default(c)
+	err := h.twoFactorService.Disable(AuthenticatedUserID(c).(int), c.Request.PostForm.Get("code"))
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidCode) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", "The code is incorrect or was already used")
+	} else {
+		session.Set("flash", "Two-factor authentication is turned off")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/two-factor", http.StatusSeeOther)
+}
+
+// RequireTwoFactorEnrollment goes after RequirePermission, it sends users of roles
+// that require second factor to set it up before anything else
+func (h *handler) RequireTwoFactorEnrollment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := h.identityUser(c)
+		if err != nil {
+			h.errors.ServerError(c, err)
+			c.Abort()
+			return
+		}
+		if user.MustEnrollTwoFactor() {
+			session := sessions.Default(c)
+			session.Set("flash", "Your account requires two-factor authentication, please set it up first")
+			session.Save()
+
+			http.Redirect(c.Writer, c.Request, "/api/users/two-factor", http.StatusSeeOther)
+			c.Abort()
+			return
+		}
+	}
+}
+
+func (h *handler) SecurityPage(c *gin.Context) {
+	roles, err := h.roleService.GetRoles()
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "admin.security.page.html", &templateData{Roles: roles})
+}
+
+func (h *handler) SetTwoFactorRequired(c *gin.Context) {
+	roleID, err := strconv.Atoi(c.Request.FormValue("roleID"))
+	if err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+	required := c.Request.FormValue("required") == "true"
+
+	if err = h.twoFactorService.SetRequired(roleID, required); err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	http.Redirect(c.Writer, c.Request, "/api/admin/security", http.StatusSeeOther)
+}
@@ -12,6 +12,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 var (
@@ -27,6 +28,13 @@ func (h *handler) initUserRoutes(api *gin.RouterGroup) {
 		users.POST("/sign-up", h.SignUp)
 		users.GET("/login", h.LoginPage)
 		users.POST("/login", h.Login)
+		users.GET("/login/two-factor", h.TwoFactorLoginPage)
+		users.POST("/login/two-factor", h.TwoFactorLogin)
+		users.GET("/password/forgot", h.ForgotPasswordPage)
+		users.POST("/password/forgot", h.ForgotPassword)
+		users.GET("/password/reset", h.ResetPasswordPage)
+		users.POST("/password/reset", h.ResetPassword)
+		users.GET("/verify-email", h.VerifyEmail)
 
 		authenticated := users.Group("/", h.RequireAuthentication())
 		{
@@ -34,23 +42,41 @@ func (h *handler) initUserRoutes(api *gin.RouterGroup) {
 			authenticated.POST("/logout", h.Logout)
 			authenticated.POST("/set-image", h.UpdateImage)
 			authenticated.POST("/update/:id", h.Update)
+			authenticated.POST("/verify-email/resend", h.ResendEmailVerification)
+			authenticated.POST("/notifications", h.UpdateNotificationSettings)
+			authenticated.POST("/notifications/topics", h.UpdateNotifyPreferences)
+			authenticated.GET("/two-factor", h.TwoFactorPage)
+			authenticated.POST("/two-factor/setup", h.BeginTwoFactorSetup)
+			authenticated.POST("/two-factor/enable", h.EnableTwoFactor)
+			authenticated.POST("/two-factor/disable", h.DisableTwoFactor)
+			authenticated.POST("/sessions/revoke", h.RevokeSession)
+			authenticated.POST("/sessions/revoke-others", h.RevokeOtherSessions)
 		}
 	}
 }
 
 type UserService interface {
 	Save(form *forms.FormValidator) (bool, error)
-	SignIn(email, password string) (int, error)
+	SignIn(email, password, ip string, notificator NotificatorService) (int, error)
 	FindById(id int) (*domain.User, error)
 	Update(user *domain.User) error
 	GetAll(cafeID int) ([]domain.User, error)
 	UpdateImage(filePath string, userID int) error
+	UpdateNotificationSettings(userID int, channel domain.NotifyChannel, locale domain.Locale) error
 	UploadImageToAWSBucket(awsSession *aws_session.Session, MyBucket, filename string, file multipart.File) error
 	DeleteImageFromAWSBucket(awsSession *aws_session.Session, imageURL, myBucket, objectsLocationURL string, infoLog *log.Logger) error
-	SetConfirmData(ctx *gin.Context, reservationData *ReservationData, tableID, eventID int, eventDescription string) (*forms.FormValidator, error)
+	SetConfirmData(ctx *gin.Context, reservationData *ReservationData, tableIDs []int, eventID int, eventDescription string) (*forms.FormValidator, error)
 	UpdateUserRole(userID, roleID int) error
-	AddToBlacklist(userID, cafeID int) error
+	AddToBlacklist(actor *domain.CafeMember, userID int) error
 	InBlacklist(userID, cafeID int) (bool, error)
+	RequestPasswordReset(email string, notificator NotificatorService) error
+	CheckPasswordReset(token string) error
+	ResetPassword(form *forms.FormValidator) (bool, error)
+	IsSessionValid(userID int, authenticatedAt time.Time) (bool, error)
+	SendEmailVerification(email string, notificator NotificatorService) error
+	VerifyEmail(token string) error
+	GetLockedAccounts() ([]domain.User, error)
+	UnlockAccount(userID int) error
 }
 
 func (h *handler) ProfilePage(c *gin.Context) {
@@ -77,10 +103,52 @@ func (h *handler) ProfilePage(c *gin.Context) {
 		return
 	}
 
-	h.render(c, "profile.page.html", &templateData{
+	data := &templateData{
 		User:         user,
 		Reservations: bookings,
-	})
+	}
+	// sessions are shown only to their owner
+	if id == AuthenticatedUserID(c).(int) {
+		data.Sessions, err = h.sessionService.GetUserSessions(id)
+		if err != nil {
+			h.errors.ServerError(c, err)
+			return
+		}
+		data.SessionID = CurrentSessionID(c)
+		data.NotifyChannels = domain.NotifyChannels
+		data.NotifyTopics = domain.NotifyTopics
+		user.NotifyPreferences, err = h.preferenceService.GetPreferences(id)
+		if err != nil {
+			h.errors.ServerError(c, err)
+			return
+		}
+	}
+
+	h.render(c, "profile.page.html", data)
+}
+
+// UpdateNotificationSettings saves the way user prefers to get notifications and their language
+func (h *handler) UpdateNotificationSettings(c *gin.Context) {
+	userID := AuthenticatedUserID(c).(int)
+	session := sessions.Default(c)
+
+	err := h.userService.UpdateNotificationSettings(userID, domain.NotifyChannel(c.Request.FormValue("channel")),
+		domain.Locale(c.Request.FormValue("locale")))
+	switch {
+	case errors.Is(err, domain.ErrUnknownChannel), errors.Is(err, domain.ErrUnknownLocale):
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	case errors.Is(err, domain.ErrNoMobile):
+		session.Set("flash", "Please add your mobile number first")
+	case err != nil:
+		h.errors.ServerError(c, err)
+		return
+	default:
+		session.Set("flash", "Notification settings are saved")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/users/profile/"+strconv.Itoa(userID), http.StatusSeeOther)
 }
 
 func (h *handler) ContributorsPage(c *gin.Context) {
@@ -114,8 +182,13 @@ func (h *handler) SignUp(c *gin.Context) {
 		return
 	}
 
+	if err = h.userService.SendEmailVerification(form.Get("email"), h.notificatorService); err != nil {
+		// account is already created at this point, the link can be sent again after login
+		h.infoLog.Printf("failed to send verification link to new user %s: %v", form.Get("email"), err)
+	}
+
 	session := sessions.Default(c)
-	session.Set("flash", "Your sign up was successful. Please login.")
+	session.Set("flash", "Your sign up was successful. We have sent a verification link to your email. Please login.")
 	session.Save()
 
 	http.Redirect(c.Writer, c.Request, "/api/users/login", http.StatusSeeOther)
@@ -133,11 +206,18 @@ func (h *handler) Login(c *gin.Context) {
 
 	form := forms.New(c.Request.PostForm)
 
-	id, err := h.userService.SignIn(form.Get("email"), form.Get("password"))
+	id, err := h.userService.SignIn(form.Get("email"), form.Get("password"), c.ClientIP(), h.notificatorService)
 	if err != nil {
+		var throttled *domain.LoginThrottledError
 		if errors.Is(err, domain.ErrInvalidCredentials) {
+			if err != domain.ErrInvalidCredentials {
+				h.infoLog.Printf("failed login of %s: %v", form.Get("email"), err)
+			}
 			form.Errors.Add("generic", "Email or Password is incorrect")
 			h.render(c, "login.page.html", &templateData{Form: form})
+		} else if errors.As(err, &throttled) {
+			form.Errors.Add("generic", LoginThrottledMessage(throttled, time.Now()))
+			h.render(c, "login.page.html", &templateData{Form: form})
 		} else {
 			h.errors.ServerError(c, err)
 		}
@@ -150,28 +230,33 @@ func (h *handler) Login(c *gin.Context) {
 		return
 	}
 
-	session := sessions.Default(c)
-	session.Set("authenticatedUserID", id)
-	session.Set("role", user.Role.ID)
-	session.Set("flash", "loginned successfully!")
-
-	if session.Get("redirectPathAfterLogin") == nil {
+	if user.IsTwoFactorEnabled() {
+		session := sessions.Default(c)
+		session.Set("twoFactorUserID", id)
+		session.Set("twoFactorStartedAt", time.Now().Unix())
 		session.Save()
-		http.Redirect(c.Writer, c.Request, "/", http.StatusSeeOther)
+
+		http.Redirect(c.Writer, c.Request, "/api/users/login/two-factor", http.StatusSeeOther)
 		return
 	}
 
-	path := session.Get("redirectPathAfterLogin").(string)
-	session.Delete("redirectPathAfterLogin")
-	session.Save()
+	h.logIn(c, user)
+}
 
-	http.Redirect(c.Writer, c.Request, path, http.StatusSeeOther)
+// LoginThrottledMessage tells user how long to wait before the next login attempt
+func LoginThrottledMessage(err *domain.LoginThrottledError, now time.Time) string {
+	wait := err.RetryAt.Sub(now)
+	if err.Locked || wait > time.Minute {
+		return fmt.Sprintf("Too many failed login attempts, please try again in %d minutes", int(wait.Minutes())+1)
+	}
+	return fmt.Sprintf("Too many failed login attempts, please try again in %d seconds", int(wait.Seconds())+1)
 }
 
 func (h *handler) Logout(c *gin.Context) {
 	session := sessions.Default(c)
 	session.Delete("authenticatedUserID")
 	session.Delete("role")
+	session.Delete("authenticatedAt")
 	session.Set("flash", "You've been logged out successfully!")
 	session.Save()
 
@@ -0,0 +1,326 @@
+package http_v1
+
+import (
+	"errors"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func (h *handler) initWaitlistRoutes(api *gin.RouterGroup) {
+	waitlist := api.Group("/waitlist")
+	{
+		waitlist.GET("/cafe/:id", h.WaitlistPage)
+		waitlist.POST("/cafe/:id", h.JoinWaitlist)
+
+		offer := waitlist.Group("/offer")
+		{
+			offer.GET("/:id", h.WaitlistOfferPage)
+			offer.POST("/:id/claim", h.ClaimWaitlistOffer)
+			offer.POST("/:id/decline", h.DeclineWaitlistOffer)
+		}
+	}
+}
+
+type WaitlistService interface {
+	Join(form *forms.FormValidator, cafeID int, userID interface{}) (bool, error)
+	OfferFreedTables(cafeID int, notificator NotificatorService) error
+	ExpireOffers(now time.Time, notificator NotificatorService) error //handler not using
+	GetOffer(entryID int, token string) (*domain.WaitlistEntry, error)
+	GetCafeEntry(actor *domain.CafeMember, entryID int) (*domain.WaitlistEntry, error)
+	GetCafeWaitlist(cafeID int) ([]domain.WaitlistEntry, error)
+	Claim(entry *domain.WaitlistEntry, userID interface{}) error
+	Cancel(entry *domain.WaitlistEntry, changedBy int) error
+}
+
+// offerFreedTables does not fail the request, waiting guests get their offers when the next table frees up
+func (h *handler) offerFreedTables(cafeID int) {
+	if err := h.waitlistService.OfferFreedTables(cafeID, h.notificatorService); err != nil {
+		h.infoLog.Printf("failed to offer freed tables of cafe #%d to waitlist: %v", cafeID, err)
+	}
+}
+
+// WaitlistPage is opened from reservation page when there are no free tables,
+// chosen date, time, location and party size come in query
+func (h *handler) WaitlistPage(c *gin.Context) {
+	cafeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || cafeID < 1 {
+		h.errors.NotFound(c)
+		return
+	}
+
+	query := c.Request.URL.Query()
+	form := forms.New(url.Values{})
+	for _, field := range []string{"date", "from", "until", "party_size", "location_id"} {
+		form.Set(field, query.Get(field))
+	}
+	if form.Get("until") == "" {
+		form.Set("until", form.Get("from"))
+	}
+
+	userID := AuthenticatedUserID(c)
+	if userID != nil {
+		u, err := h.userService.FindById(userID.(int))
+		if err != nil {
+			h.errors.ServerError(c, err)
+			return
+		}
+		form.Set("name", u.Name)
+		form.Set("mobile", u.Mobile)
+		form.Set("email", u.Email)
+	}
+
+	h.renderWaitlistPage(c, cafeID, form)
+}
+
+func (h *handler) renderWaitlistPage(c *gin.Context, cafeID int, form *forms.FormValidator) {
+	reservationData := &ReservationData{}
+	reservationData.UserChoice.Date = form.Get("date")
+	reservationData.UserChoice.PartySize, _ = strconv.Atoi(form.Get("party_size"))
+	reservationData.UserChoice.LocationID, _ = strconv.Atoi(form.Get("location_id"))
+
+	err := h.reservationService.SetDefaultReservationData(reservationData, cafeID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+	if reservationData.UserChoice.Date != "" {
+		reservationData.CurrentDate = reservationData.UserChoice.Date
+	}
+
+	h.render(c, "waitlist.page.html", &templateData{
+		ReservationData: reservationData,
+		Form:            form,
+	})
+}
+
+func (h *handler) JoinWaitlist(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	cafeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || cafeID < 1 {
+		h.errors.NotFound(c)
+		return
+	}
+
+	session := sessions.Default(c)
+	userID := AuthenticatedUserID(c)
+
+	if userID != nil {
+		yes, err := h.userService.InBlacklist(userID.(int), cafeID)
+		if err != nil {
+			h.errors.ServerError(c, err)
+			return
+		}
+		if yes {
+			h.errors.ClientError(c, http.StatusForbidden)
+			return
+		}
+	}
+
+	form := forms.New(c.Request.PostForm)
+	ok, err := h.waitlistService.Join(form, cafeID, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.errors.NotFound(c)
+			return
+		}
+		h.errors.ServerError(c, err)
+		return
+	}
+	if !ok {
+		h.renderWaitlistPage(c, cafeID, form)
+		return
+	}
+
+	// a table within guest's time window may be free already
+	h.offerFreedTables(cafeID)
+
+	session.Set("flash", "You are on the waitlist! We will email you as soon as a table frees up")
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, fmt.Sprintf("/api/reservation/cafe/%d", cafeID), http.StatusSeeOther)
+}
+
+// waitlistOffer loads waitlist entry from url, guest is identified by token from the emailed link;
+// writes error response itself when it returns false
+func (h *handler) waitlistOffer(c *gin.Context) (*domain.WaitlistEntry, string, bool) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || entryID < 1 {
+		h.errors.NotFound(c)
+		return nil, "", false
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		token = c.Request.PostFormValue("token")
+	}
+
+	entry, err := h.waitlistService.GetOffer(entryID, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.errors.NotFound(c)
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.errors.ClientError(c, http.StatusForbidden)
+		default:
+			h.errors.ServerError(c, err)
+		}
+		return nil, "", false
+	}
+
+	return entry, token, true
+}
+
+func waitlistOfferPath(entryID int, token string) string {
+	return fmt.Sprintf("/api/waitlist/offer/%d?token=%s", entryID, url.QueryEscape(token))
+}
+
+func (h *handler) WaitlistOfferPage(c *gin.Context) {
+	entry, token, ok := h.waitlistOffer(c)
+	if !ok {
+		return
+	}
+
+	h.render(c, "waitlist.offer.page.html", &templateData{
+		WaitlistEntry: entry,
+		ManageToken:   token,
+	})
+}
+
+func (h *handler) ClaimWaitlistOffer(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	entry, token, ok := h.waitlistOffer(c)
+	if !ok {
+		return
+	}
+
+	session := sessions.Default(c)
+	err := h.waitlistService.Claim(entry, AuthenticatedUserID(c))
+	if err != nil {
+		if !errors.Is(err, domain.ErrOfferExpired) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", "Sorry, this offer has expired")
+		session.Save()
+		http.Redirect(c.Writer, c.Request, waitlistOfferPath(entry.ID, token), http.StatusSeeOther)
+		return
+	}
+
+	h.sendBookingConfirmation(entry.Reservation.ID)
+
+	session.Set("flash", "Booked successfully! You will get notifications as your time comes")
+	session.Save()
+
+	manageToken := h.reservationService.ManageToken(entry.Reservation.ID)
+	http.Redirect(c.Writer, c.Request, manageReservationPath(entry.Reservation.ID, manageToken), http.StatusSeeOther)
+}
+
+func (h *handler) DeclineWaitlistOffer(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	entry, token, ok := h.waitlistOffer(c)
+	if !ok {
+		return
+	}
+
+	session := sessions.Default(c)
+	changedBy := -1
+	if userID := AuthenticatedUserID(c); userID != nil {
+		changedBy = userID.(int)
+	}
+
+	err := h.waitlistService.Cancel(entry, changedBy)
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidTransition) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", "You are not on the waitlist anymore")
+	} else {
+		h.offerFreedTables(entry.Cafe.ID)
+		session.Set("flash", "You have left the waitlist")
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, waitlistOfferPath(entry.ID, token), http.StatusSeeOther)
+}
+
+// PartnerWaitlistPage shows guests waiting for a table in partner's cafe and offers made to them
+func (h *handler) PartnerWaitlistPage(c *gin.Context) {
+	cafeID := selectedCafe(c).Cafe.ID
+
+	entries, err := h.waitlistService.GetCafeWaitlist(cafeID)
+	if err != nil {
+		h.errors.ServerError(c, err)
+		return
+	}
+
+	h.render(c, "partner.waitlist.page.html", &templateData{WaitlistEntries: entries})
+}
+
+// RemoveFromWaitlist lets partner take guest off the waitlist, the table offered to them goes to the next guest
+func (h *handler) RemoveFromWaitlist(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		h.errors.ClientError(c, http.StatusBadRequest)
+		return
+	}
+
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || entryID < 1 {
+		h.errors.NotFound(c)
+		return
+	}
+
+	session := sessions.Default(c)
+	member := selectedCafe(c)
+
+	entry, err := h.waitlistService.GetCafeEntry(member, entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.errors.NotFound(c)
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.errors.ClientError(c, http.StatusForbidden)
+		default:
+			h.errors.ServerError(c, err)
+		}
+		return
+	}
+
+	err = h.waitlistService.Cancel(entry, member.User.ID)
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidTransition) {
+			h.errors.ServerError(c, err)
+			return
+		}
+		session.Set("flash", fmt.Sprintf("%s is not on the waitlist anymore", entry.CustName))
+	} else {
+		h.offerFreedTables(entry.Cafe.ID)
+		session.Set("flash", fmt.Sprintf("%s is removed from the waitlist", entry.CustName))
+	}
+	session.Save()
+
+	http.Redirect(c.Writer, c.Request, "/api/partner/waitlist", http.StatusSeeOther)
+}
@@ -0,0 +1,80 @@
+package http_v2
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func (h *handler) initAuthRoutes(api *gin.RouterGroup) {
+	auth := api.Group("/auth")
+	{
+		auth.POST("/token", h.IssueToken)
+		auth.POST("/refresh", h.RefreshToken)
+		auth.POST("/revoke", h.RevokeToken)
+	}
+}
+
+// IssueToken is login for clients that can not keep cookie session,
+// access token is sent back in "Authorization: Bearer" header
+func (h *handler) IssueToken(c *gin.Context) {
+	var req loginRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	user := h.authenticate(c, req)
+	if user == nil {
+		return
+	}
+
+	pair, err := h.tokenService.Issue(user.ID)
+	if err != nil {
+		h.serverError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, newTokenResponse(*pair))
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken exchanges refresh token for a new pair, the used refresh token stops working
+func (h *handler) RefreshToken(c *gin.Context) {
+	var req refreshRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	pair, err := h.tokenService.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			h.clientError(c, http.StatusUnauthorized, "invalid or expired refresh token")
+			return
+		}
+		h.serverError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, newTokenResponse(*pair))
+}
+
+// RevokeToken is logout for token clients, issued access token expires on its own shortly
+func (h *handler) RevokeToken(c *gin.Context) {
+	var req refreshRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.tokenService.Revoke(req.RefreshToken); err != nil {
+		h.serverError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package http_v2
+
+import (
+	"errors"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+func (h *handler) initCafeRoutes(api *gin.RouterGroup) {
+	cafes := api.Group("/cafes")
+	{
+		cafes.GET("", h.ListCafes)
+		cafes.GET("/:id/booking-options", h.BookingOptions)
+		cafes.GET("/:id/availability", h.Availability)
+	}
+}
+
+// ListCafes searches cafes by name with "search" query parameter
+// or filters them by "type" and "city" ids, all cafes are listed without parameters
+func (h *handler) ListCafes(c *gin.Context) {
+	var cafes []domain.Cafe
+	var err error
+
+	search := c.Query("search")
+	typeID, _ := strconv.Atoi(c.Query("type"))
+	cityID, _ := strconv.Atoi(c.Query("city"))
+
+	switch {
+	case search != "":
+		cafes, err = h.cafeService.Search(search)
+	case typeID != 0 || cityID != 0:
+		cafes, err = h.cafeService.GetCafesFiltered(typeID, cityID)
+	default:
+		cafes, err = h.cafeService.GetCafes()
+	}
+	if err != nil {
+		h.serverError(c, err)
+		return
+	}
+
+	res := make([]cafeResponse, 0, len(cafes))
+	for _, cafe := range cafes {
+		res = append(res, newCafeResponse(cafe))
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// cafeID writes not found response itself when it returns false
+func (h *handler) cafeID(c *gin.Context) (int, bool) {
+	cafeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || cafeID < 1 {
+		h.notFound(c)
+		return 0, false
+	}
+	return cafeID, true
+}
+
+// BookingOptions lists what guest can choose from when booking, times are for the "date" query parameter,
+// today in cafe's time zone by default
+func (h *handler) BookingOptions(c *gin.Context) {
+	cafeID, ok := h.cafeID(c)
+	if !ok {
+		return
+	}
+
+	data := &http_v1.ReservationData{}
+	data.UserChoice.Date = c.Query("date")
+	if err := h.reservationService.SetDefaultReservationData(data, cafeID); err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.notFound(c)
+			return
+		}
+		h.serverError(c, err)
+		return
+	}
+
+	res := bookingOptionsResponse{
+		MinDate:    data.CurrentDate,
+		MaxDate:    data.MaxBookingDate,
+		Times:      data.TimeSelector,
+		PartySizes: data.PartySizeSelector,
+	}
+	for _, l := range data.LocationSelector {
+		res.Locations = append(res.Locations, idName{ID: l.ID, Name: l.Name})
+	}
+	for _, e := range data.EventSelector {
+		res.Events = append(res.Events, idName{ID: e.ID, Name: e.Name})
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Availability looks up free tables by "date", "time", "party_size" and "location_id" query parameters
+func (h *handler) Availability(c *gin.Context) {
+	cafeID, ok := h.cafeID(c)
+	if !ok {
+		return
+	}
+
+	date := c.Query("date")
+	bookTime := c.Query("time")
+	partySize, _ := strconv.Atoi(c.Query("party_size"))
+	locationID, _ := strconv.Atoi(c.Query("location_id"))
+	if date == "" || bookTime == "" || partySize < 1 || locationID < 1 {
+		h.clientError(c, http.StatusBadRequest, "date, time, party_size and location_id are required")
+		return
+	}
+
+	tables, err := h.reservationService.GetAvailableTables(cafeID, partySize, locationID, date, bookTime)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrBookingNotAllowed):
+			h.clientError(c, http.StatusUnprocessableEntity, bookingNotAllowedMessage)
+		case errors.Is(err, domain.ErrNoRecord):
+			h.notFound(c)
+		default:
+			h.serverError(c, err)
+		}
+		return
+	}
+
+	res := availabilityResponse{
+		Tables:       newTableResponses(tables),
+		Combinations: []combinationResponse{},
+	}
+	if len(tables) == 0 {
+		combinations, err := h.reservationService.GetTableCombinations(cafeID, partySize, locationID, date, bookTime)
+		if err != nil {
+			h.serverError(c, err)
+			return
+		}
+		for _, comb := range combinations {
+			cr := combinationResponse{Capacity: comb.Capacity()}
+			for _, t := range comb.Tables {
+				cr.TableIDs = append(cr.TableIDs, t.ID)
+			}
+			res.Combinations = append(res.Combinations, cr)
+		}
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,173 @@
+package http_v2
+
+import (
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"time"
+)
+
+// api responses are separate from domain structs, so that internal fields
+// like password hashes never leak and renaming a field does not break clients
+
+type idName struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type cityResponse struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	TimeZone string `json:"time_zone"`
+}
+
+type cafeResponse struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Address     string       `json:"address"`
+	ImageURL    string       `json:"image_url"`
+	Mobile      string       `json:"mobile"`
+	Email       string       `json:"email"`
+	Description string       `json:"description"`
+	City        cityResponse `json:"city"`
+	Type        idName       `json:"type"`
+}
+
+func newCafeResponse(c domain.Cafe) cafeResponse {
+	return cafeResponse{
+		ID:          c.ID,
+		Name:        c.Name,
+		Address:     c.Address,
+		ImageURL:    c.ImageURL,
+		Mobile:      c.Mobile,
+		Email:       c.Email,
+		Description: c.Description,
+		City:        cityResponse{ID: c.City.ID, Name: c.City.Name, TimeZone: c.City.TimeZone},
+		Type:        idName{ID: c.Type.ID, Name: c.Type.Name},
+	}
+}
+
+type tableResponse struct {
+	ID       int    `json:"id"`
+	Capacity int    `json:"capacity"`
+	Location idName `json:"location"`
+}
+
+func newTableResponses(tables []domain.Table) []tableResponse {
+	res := make([]tableResponse, 0, len(tables))
+	for _, t := range tables {
+		res = append(res, tableResponse{
+			ID:       t.ID,
+			Capacity: t.Capacity,
+			Location: idName{ID: t.Location.ID, Name: t.Location.Name},
+		})
+	}
+	return res
+}
+
+type combinationResponse struct {
+	TableIDs []int `json:"table_ids"`
+	Capacity int   `json:"capacity"`
+}
+
+type availabilityResponse struct {
+	Tables []tableResponse `json:"tables"`
+	// Combinations are looked up only when no single table seats the party
+	Combinations []combinationResponse `json:"combinations"`
+}
+
+type bookingOptionsResponse struct {
+	MinDate    string   `json:"min_date"`
+	MaxDate    string   `json:"max_date"`
+	Times      []string `json:"times"`
+	PartySizes []int    `json:"party_sizes"`
+	Locations  []idName `json:"locations"`
+	Events     []idName `json:"events"`
+}
+
+type reservationResponse struct {
+	ID               int       `json:"id"`
+	Cafe             idName    `json:"cafe"`
+	TableIDs         []int     `json:"table_ids"`
+	Location         idName    `json:"location"`
+	Event            idName    `json:"event"`
+	EventDescription string    `json:"event_description,omitempty"`
+	PartySize        int       `json:"party_size"`
+	Date             time.Time `json:"date"` // in cafe's time zone
+	Status           string    `json:"status"`
+	IsChangeable     bool      `json:"is_changeable"`
+	CustName         string    `json:"cust_name,omitempty"`
+	CustMobile       string    `json:"cust_mobile,omitempty"`
+	CustEmail        string    `json:"cust_email,omitempty"`
+	// ManageToken is returned once after booking, guests without account need it to cancel
+	ManageToken string `json:"manage_token,omitempty"`
+}
+
+func newReservationResponse(r domain.Reservation) reservationResponse {
+	tableIDs := []int{r.Table.ID}
+	for _, t := range r.JoinedTables {
+		tableIDs = append(tableIDs, t.ID)
+	}
+
+	return reservationResponse{
+		ID:               r.ID,
+		Cafe:             idName{ID: r.Cafe.ID, Name: r.Cafe.Name},
+		TableIDs:         tableIDs,
+		Location:         idName{ID: r.Table.Location.ID, Name: r.Table.Location.Name},
+		Event:            idName{ID: r.Event.ID, Name: r.Event.Name},
+		EventDescription: r.EventDescription,
+		PartySize:        r.PartySize,
+		Date:             r.Date,
+		Status:           string(r.Status),
+		IsChangeable:     r.IsChangeable(),
+		CustName:         r.CustName,
+		CustMobile:       r.CustMobile,
+		CustEmail:        r.CustEmail,
+	}
+}
+
+func newReservationResponses(rr []domain.Reservation) []reservationResponse {
+	res := make([]reservationResponse, 0, len(rr))
+	for _, r := range rr {
+		res = append(res, newReservationResponse(r))
+	}
+	return res
+}
+
+type userResponse struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Mobile        string `json:"mobile"`
+	ImageURL      string `json:"image_url"`
+	Role          idName `json:"role"`
+}
+
+func newUserResponse(u domain.User) userResponse {
+	return userResponse{
+		ID:            u.ID,
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: u.IsEmailVerified(),
+		Mobile:        u.Mobile,
+		ImageURL:      u.ImageURL,
+		Role:          idName{ID: u.Role.ID, Name: u.Role.Name},
+	}
+}
+
+type tokenResponse struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+func newTokenResponse(p domain.TokenPair) tokenResponse {
+	return tokenResponse{
+		AccessToken:      p.AccessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        p.AccessExpiresAt,
+		RefreshToken:     p.RefreshToken,
+		RefreshExpiresAt: p.RefreshExpiresAt,
+	}
+}
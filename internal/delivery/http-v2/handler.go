@@ -0,0 +1,55 @@
+package http_v2
+
+import (
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/gin-gonic/gin"
+	"log"
+)
+
+// handler serves json api for mobile app and partner integrations,
+// it reuses services of html handlers, so that both behave the same
+type handler struct {
+	userService        http_v1.UserService
+	tokenService       http_v1.TokenService
+	twoFactorService   http_v1.TwoFactorService
+	staffService       http_v1.StaffService
+	reservationService http_v1.ReservationService
+	cafeService        http_v1.CafeService
+	waitlistService    http_v1.WaitlistService
+	notificatorService http_v1.NotificatorService
+	errorLog           *log.Logger
+	infoLog            *log.Logger
+}
+
+func NewHandler(userService http_v1.UserService, tokenService http_v1.TokenService, twoFactorService http_v1.TwoFactorService,
+	staffService http_v1.StaffService, reservationService http_v1.ReservationService, cafeService http_v1.CafeService,
+	waitlistService http_v1.WaitlistService, notificatorService http_v1.NotificatorService, errorLog, infoLog *log.Logger) *handler {
+	return &handler{
+		userService:        userService,
+		tokenService:       tokenService,
+		twoFactorService:   twoFactorService,
+		staffService:       staffService,
+		reservationService: reservationService,
+		cafeService:        cafeService,
+		waitlistService:    waitlistService,
+		notificatorService: notificatorService,
+		errorLog:           errorLog,
+		infoLog:            infoLog,
+	}
+}
+
+func (h *handler) Version() string {
+	return "v2"
+}
+
+// InitRoutes registers api routes, the group is expected to have sessions and http_v1.Identify middlewares
+func (h *handler) InitRoutes(api *gin.RouterGroup) {
+	api.Use(h.RequireJSON())
+
+	api.GET("/openapi.json", h.OpenAPI)
+	h.initAuthRoutes(api)
+	h.initCafeRoutes(api)
+	h.initReservationRoutes(api)
+	h.initUserRoutes(api)
+	h.initPartnerRoutes(api)
+}
@@ -0,0 +1,902 @@
+package http_v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// fakes embed service interfaces, calling a method a test does not expect panics
+
+type fakeUsers struct {
+	http_v1.UserService
+	users       map[int]*domain.User
+	blacklisted bool
+	throttled   *domain.LoginThrottledError
+}
+
+func (f *fakeUsers) SignIn(email, password, ip string, notificator http_v1.NotificatorService) (int, error) {
+	if f.throttled != nil {
+		return 0, f.throttled
+	}
+	for _, u := range f.users {
+		if u.Email == email && password == "secret" {
+			return u.ID, nil
+		}
+	}
+	return 0, domain.ErrInvalidCredentials
+}
+
+func (f *fakeUsers) FindById(id int) (*domain.User, error) {
+	if u, ok := f.users[id]; ok {
+		return u, nil
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeUsers) IsSessionValid(userID int, authenticatedAt time.Time) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeUsers) InBlacklist(userID, cafeID int) (bool, error) {
+	return f.blacklisted, nil
+}
+
+// fakeTokens issues tokens named after user and sequence number
+type fakeTokens struct {
+	http_v1.TokenService
+	users   *fakeUsers
+	issued  int
+	access  map[string]int
+	refresh map[string]int
+}
+
+func (f *fakeTokens) Issue(userID int) (*domain.TokenPair, error) {
+	f.issued++
+	n := strconv.Itoa(userID) + "-" + strconv.Itoa(f.issued)
+	f.access["access-"+n] = userID
+	f.refresh["refresh-"+n] = userID
+	return &domain.TokenPair{AccessToken: "access-" + n, RefreshToken: "refresh-" + n,
+		AccessExpiresAt: time.Now().Add(time.Minute), RefreshExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func (f *fakeTokens) Refresh(refreshToken string) (*domain.TokenPair, error) {
+	userID, ok := f.refresh[refreshToken]
+	if !ok {
+		return nil, domain.ErrInvalidToken
+	}
+	delete(f.refresh, refreshToken)
+	return f.Issue(userID)
+}
+
+func (f *fakeTokens) Revoke(refreshToken string) error {
+	delete(f.refresh, refreshToken)
+	return nil
+}
+
+func (f *fakeTokens) Authenticate(accessToken string) (int, int, error) {
+	userID, ok := f.access[accessToken]
+	if !ok {
+		return 0, 0, domain.ErrInvalidToken
+	}
+	return userID, f.users.users[userID].Role.ID, nil
+}
+
+// fakeTwoFactor accepts each of codes once
+type fakeTwoFactor struct {
+	http_v1.TwoFactorService
+	codes map[string]bool
+}
+
+func (f *fakeTwoFactor) Verify(userID int, code, ip string, notificator http_v1.NotificatorService) error {
+	if !f.codes[code] {
+		return domain.ErrInvalidCode
+	}
+	delete(f.codes, code)
+	return nil
+}
+
+type fakeReservations struct {
+	http_v1.ReservationService
+	reservations map[int]*domain.Reservation
+	tables       []domain.Table
+	combinations []domain.TableCombination
+	bookErr      error
+	booked       http_v1.UserChoice
+}
+
+func (f *fakeReservations) GetAvailableTables(cafeID, partySize, locationID int, date, bookTime string) ([]domain.Table, error) {
+	if bookTime == "03:00" {
+		return nil, domain.ErrBookingNotAllowed
+	}
+	return f.tables, nil
+}
+
+func (f *fakeReservations) GetTableCombinations(cafeID, partySize, locationID int, date, bookTime string) ([]domain.TableCombination, error) {
+	return f.combinations, nil
+}
+
+func (f *fakeReservations) BookTable(form *forms.FormValidator, userChoice http_v1.UserChoice, userID interface{}) (int, *forms.FormValidator, error) {
+	form.MatchesPattern("email", forms.EmailRX)
+	if !form.Valid() {
+		return -1, form, nil
+	}
+	if f.bookErr != nil {
+		return -1, nil, f.bookErr
+	}
+
+	f.booked = userChoice
+	id := len(f.reservations) + 1
+	f.reservations[id] = &domain.Reservation{ID: id, Cafe: domain.Cafe{ID: userChoice.CafeID},
+		Table: domain.Table{ID: userChoice.TableID}, Status: domain.StatusConfirmed,
+		Date: time.Now().Add(24 * time.Hour), CustEmail: form.Get("email")}
+	return id, nil, nil
+}
+
+func (f *fakeReservations) GetReservation(reservationID int) (*domain.Reservation, error) {
+	if r, ok := f.reservations[reservationID]; ok {
+		return r, nil
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeReservations) GetCafeReservation(actor *domain.CafeMember, reservationID int) (*domain.Reservation, error) {
+	r, err := f.GetReservation(reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if err = actor.Authorize(r.Cafe.ID, domain.PermissionReservationView, domain.PermissionReservationStatus); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (f *fakeReservations) ManageToken(reservationID int) string {
+	return "token-" + strconv.Itoa(reservationID)
+}
+
+func (f *fakeReservations) GetManageableReservation(reservationID int, userID interface{}, token string) (*domain.Reservation, error) {
+	r, err := f.GetReservation(reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if (userID != nil && r.User.ID == userID.(int)) || token == f.ManageToken(reservationID) {
+		return r, nil
+	}
+	return nil, domain.ErrAccessDenied
+}
+
+func (f *fakeReservations) Cancel(reservation *domain.Reservation, userID interface{}) error {
+	if !reservation.IsChangeable() {
+		return domain.ErrNotChangeable
+	}
+	reservation.Status = domain.StatusCancelled
+	return nil
+}
+
+func (f *fakeReservations) ChangeStatus(reservation *domain.Reservation, next domain.ReservationStatus, changedBy int) error {
+	if !reservation.Status.CanBecome(next) {
+		return domain.ErrInvalidTransition
+	}
+	reservation.Status = next
+	return nil
+}
+
+func (f *fakeReservations) GetCafeBookings(cafeID int) ([]domain.Reservation, error) {
+	var rr []domain.Reservation
+	for _, r := range f.reservations {
+		if r.Cafe.ID == cafeID {
+			rr = append(rr, *r)
+		}
+	}
+	return rr, nil
+}
+
+func (f *fakeReservations) GetUserBookings(userID int) ([]domain.Reservation, error) {
+	var rr []domain.Reservation
+	for _, r := range f.reservations {
+		if r.User.ID == userID {
+			rr = append(rr, *r)
+		}
+	}
+	return rr, nil
+}
+
+type fakeCafes struct {
+	http_v1.CafeService
+	cafes []domain.Cafe
+	calls []string
+}
+
+func (f *fakeCafes) GetCafes() ([]domain.Cafe, error) {
+	f.calls = append(f.calls, "all")
+	return f.cafes, nil
+}
+
+func (f *fakeCafes) Search(name string) ([]domain.Cafe, error) {
+	f.calls = append(f.calls, "search "+name)
+	return f.cafes[:1], nil
+}
+
+func (f *fakeCafes) GetCafesFiltered(typeID, cityID int) ([]domain.Cafe, error) {
+	f.calls = append(f.calls, "filter "+strconv.Itoa(typeID)+" "+strconv.Itoa(cityID))
+	return f.cafes[1:], nil
+}
+
+type fakeStaff struct {
+	http_v1.StaffService
+	members []domain.CafeMember
+}
+
+func (f *fakeStaff) GetUserCafes(userID int) ([]domain.CafeMember, error) {
+	var cafes []domain.CafeMember
+	for _, m := range f.members {
+		if m.User.ID == userID {
+			cafes = append(cafes, m)
+		}
+	}
+	return cafes, nil
+}
+
+func (f *fakeStaff) GetMember(cafeID, userID int) (*domain.CafeMember, error) {
+	for _, m := range f.members {
+		if m.Cafe.ID == cafeID && m.User.ID == userID {
+			return &m, nil
+		}
+	}
+	return nil, domain.ErrNoRecord
+}
+
+type fakeWaitlist struct {
+	http_v1.WaitlistService
+	offered []int
+}
+
+func (f *fakeWaitlist) OfferFreedTables(cafeID int, notificator http_v1.NotificatorService) error {
+	f.offered = append(f.offered, cafeID)
+	return nil
+}
+
+type fakeNotificator struct {
+	http_v1.NotificatorService
+	confirmed []string
+	cancelled []int
+}
+
+func (f *fakeNotificator) BookingConfirmation(data domain.Reservation, manageToken string) error {
+	f.confirmed = append(f.confirmed, manageToken)
+	return nil
+}
+
+func (f *fakeNotificator) BookingCancellation(data domain.Reservation) error {
+	f.cancelled = append(f.cancelled, data.ID)
+	return nil
+}
+
+// fakeSessions keeps sessions in memory by token
+type fakeSessions struct {
+	http_v1.SessionService
+	sessions map[string]*domain.Session
+}
+
+func (f *fakeSessions) Start(session *domain.Session) (string, error) {
+	session.ID = len(f.sessions) + 1
+	token := "session-" + strconv.Itoa(session.ID)
+	copied := *session
+	f.sessions[token] = &copied
+	return token, nil
+}
+
+func (f *fakeSessions) Find(token string) (*domain.Session, error) {
+	if s, ok := f.sessions[token]; ok {
+		copied := *s
+		return &copied, nil
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeSessions) Save(session *domain.Session) error {
+	for token, s := range f.sessions {
+		if s.ID == session.ID {
+			copied := *session
+			f.sessions[token] = &copied
+			return nil
+		}
+	}
+	return domain.ErrNoRecord
+}
+
+func (f *fakeSessions) End(sessionID int) error {
+	for token, s := range f.sessions {
+		if s.ID == sessionID {
+			delete(f.sessions, token)
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessions) ofUser(userID int) int {
+	n := 0
+	for _, s := range f.sessions {
+		if s.UserID == userID {
+			n++
+		}
+	}
+	return n
+}
+
+const (
+	guestID   = 10
+	partnerID = 20
+)
+
+type testAPI struct {
+	*httptest.Server
+	client       *http.Client
+	bearer       string // access token sent with requests when set
+	users        *fakeUsers
+	tokens       *fakeTokens
+	twoFactor    *fakeTwoFactor
+	reservations *fakeReservations
+	cafes        *fakeCafes
+	staff        *fakeStaff
+	waitlist     *fakeWaitlist
+	notificator  *fakeNotificator
+	sessions     *fakeSessions
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	gin.SetMode(gin.TestMode)
+
+	api := &testAPI{
+		users: &fakeUsers{users: map[int]*domain.User{
+			guestID: {ID: guestID, Name: "guest", Email: "guest@example.com", Password: []byte("hash"), Role: domain.Role{ID: 2}},
+			partnerID: {ID: partnerID, Name: "partner", Email: "partner@example.com",
+				Role: domain.Role{ID: 3, Name: domain.RolePartner, Permissions: domain.PartnerPermissions}},
+		}},
+		reservations: &fakeReservations{reservations: map[int]*domain.Reservation{}},
+		cafes: &fakeCafes{cafes: []domain.Cafe{
+			{ID: 1, Name: "Del Papa", City: domain.City{ID: 1, Name: "Almaty", TimeZone: "Asia/Almaty"}},
+			{ID: 2, Name: "Navat", City: domain.City{ID: 2, Name: "Nur-Sultan", TimeZone: "Asia/Almaty"}},
+		}},
+		staff: &fakeStaff{members: []domain.CafeMember{
+			{Cafe: domain.Cafe{ID: 1}, User: domain.User{ID: partnerID}, Role: domain.StaffOwner},
+		}},
+		twoFactor:   &fakeTwoFactor{codes: map[string]bool{}},
+		waitlist:    &fakeWaitlist{},
+		notificator: &fakeNotificator{},
+		sessions:    &fakeSessions{sessions: map[string]*domain.Session{}},
+	}
+	api.tokens = &fakeTokens{users: api.users, access: map[string]int{}, refresh: map[string]int{}}
+
+	discard := log.New(ioutil.Discard, "", 0)
+	h := NewHandler(api.users, api.tokens, api.twoFactor, api.staff, api.reservations, api.cafes, api.waitlist, api.notificator,
+		discard, discard)
+
+	router := gin.New()
+	router.Use(sessions.Sessions("test", http_v1.NewSessionStore(api.sessions)), http_v1.Identify(api.users, api.tokens))
+	h.InitRoutes(router.Group("/api/v2"))
+
+	api.Server = httptest.NewServer(router)
+	t.Cleanup(api.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.client = &http.Client{Jar: jar}
+
+	return api
+}
+
+// do sends body as json unless it is already a reader, response body is decoded into out
+func (a *testAPI) do(t *testing.T, method, path string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, a.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+a.bearer)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusNoContent && ct != "application/json; charset=utf-8" {
+		t.Errorf("%s %s: want json response; got %q", method, path, ct)
+	}
+	if out != nil {
+		if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+
+	return res.StatusCode
+}
+
+func (a *testAPI) login(t *testing.T, email string) {
+	t.Helper()
+	if status := a.do(t, http.MethodPost, "/api/v2/users/login",
+		loginRequest{Email: email, Password: "secret"}, nil); status != http.StatusOK {
+		t.Fatalf("want login to succeed; got %d", status)
+	}
+}
+
+func TestListCafes(t *testing.T) {
+	api := newTestAPI(t)
+
+	tests := []struct {
+		query    string
+		wantCall string
+		wantIDs  []int
+	}{
+		{"", "all", []int{1, 2}},
+		{"?search=del", "search del", []int{1}},
+		{"?type=2&city=3", "filter 2 3", []int{2}},
+	}
+
+	for _, tt := range tests {
+		var cafes []cafeResponse
+		if status := api.do(t, http.MethodGet, "/api/v2/cafes"+tt.query, nil, &cafes); status != http.StatusOK {
+			t.Fatalf("%q: want %d; got %d", tt.query, http.StatusOK, status)
+		}
+
+		if got := api.cafes.calls[len(api.cafes.calls)-1]; got != tt.wantCall {
+			t.Errorf("%q: want %q call; got %q", tt.query, tt.wantCall, got)
+		}
+		if len(cafes) != len(tt.wantIDs) {
+			t.Fatalf("%q: want cafes %v; got %v", tt.query, tt.wantIDs, cafes)
+		}
+		for i := range cafes {
+			if cafes[i].ID != tt.wantIDs[i] {
+				t.Errorf("%q: want cafes %v; got %v", tt.query, tt.wantIDs, cafes)
+			}
+		}
+	}
+}
+
+func TestAvailability(t *testing.T) {
+	api := newTestAPI(t)
+	api.reservations.combinations = []domain.TableCombination{
+		{Tables: []domain.Table{{ID: 3, Capacity: 4}, {ID: 4, Capacity: 4}}},
+	}
+
+	var errRes errorResponse
+	status := api.do(t, http.MethodGet, "/api/v2/cafes/1/availability?date=2021-06-04", nil, &errRes)
+	if status != http.StatusBadRequest || errRes.Error == "" {
+		t.Errorf("want %d with error message; got %d %+v", http.StatusBadRequest, status, errRes)
+	}
+
+	status = api.do(t, http.MethodGet,
+		"/api/v2/cafes/1/availability?date=2021-06-04&time=03:00&party_size=2&location_id=1", nil, &errRes)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("want %d; got %d", http.StatusUnprocessableEntity, status)
+	}
+
+	var res availabilityResponse
+	status = api.do(t, http.MethodGet,
+		"/api/v2/cafes/1/availability?date=2021-06-04&time=19:00&party_size=8&location_id=1", nil, &res)
+	if status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if len(res.Tables) != 0 || len(res.Combinations) != 1 || res.Combinations[0].Capacity != 8 {
+		t.Errorf("want a single combination of 8 seats; got %+v", res)
+	}
+}
+
+func TestCreateReservation(t *testing.T) {
+	api := newTestAPI(t)
+
+	req := reservationRequest{CafeID: 1, Date: "2021-06-04", Time: "19:00", PartySize: 8, LocationID: 1,
+		TableIDs: []int{3, 4}, Name: "guest", Mobile: "87770000000", Email: "guest@example.com"}
+
+	// html forms can not be sent to api
+	httpReq, _ := http.NewRequest(http.MethodPost, api.URL+"/api/v2/reservations", bytes.NewReader([]byte("name=guest")))
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := api.client.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("want %d for form body; got %d", http.StatusUnsupportedMediaType, res.StatusCode)
+	}
+
+	invalid := req
+	invalid.Email = "not an email"
+	var errRes errorResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/reservations", invalid, &errRes); status != http.StatusUnprocessableEntity {
+		t.Errorf("want %d; got %d", http.StatusUnprocessableEntity, status)
+	}
+	if errRes.Fields["email"] == "" {
+		t.Errorf("want error for email field; got %+v", errRes)
+	}
+
+	var created reservationResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/reservations", req, &created); status != http.StatusCreated {
+		t.Fatalf("want %d; got %d", http.StatusCreated, status)
+	}
+	if created.ManageToken == "" || len(api.notificator.confirmed) != 1 {
+		t.Errorf("want manage token returned and confirmation sent; got %+v, %v", created, api.notificator.confirmed)
+	}
+	if b := api.reservations.booked; b.TableID != 3 || len(b.JoinedTableIDs) != 1 || b.JoinedTableIDs[0] != 4 || b.EventID != 1 {
+		t.Errorf("want table 3 joined with 4 and default event; got %+v", b)
+	}
+
+	api.reservations.bookErr = domain.ErrTableTaken
+	if status := api.do(t, http.MethodPost, "/api/v2/reservations", req, &errRes); status != http.StatusConflict {
+		t.Errorf("want %d; got %d", http.StatusConflict, status)
+	}
+}
+
+func TestCancelReservation(t *testing.T) {
+	api := newTestAPI(t)
+	api.reservations.reservations[1] = &domain.Reservation{ID: 1, Cafe: domain.Cafe{ID: 1}, User: domain.User{ID: -1},
+		Status: domain.StatusConfirmed, Date: time.Now().Add(24 * time.Hour), CustEmail: "guest@mail.kz"}
+	api.reservations.reservations[2] = &domain.Reservation{ID: 2, Cafe: domain.Cafe{ID: 1}, User: domain.User{ID: -1},
+		Status: domain.StatusConfirmed, Date: time.Now().Add(-time.Hour)}
+
+	var errRes errorResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/reservations/1/cancel", cancelRequest{Token: "token-2"}, &errRes); status != http.StatusForbidden {
+		t.Errorf("want %d for token of another reservation; got %d", http.StatusForbidden, status)
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/reservations/2/cancel", cancelRequest{Token: "token-2"}, &errRes); status != http.StatusConflict {
+		t.Errorf("want %d for past reservation; got %d", http.StatusConflict, status)
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/reservations/9/cancel", cancelRequest{}, &errRes); status != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, status)
+	}
+
+	var cancelled reservationResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/reservations/1/cancel", cancelRequest{Token: "token-1"}, &cancelled); status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if cancelled.Status != string(domain.StatusCancelled) {
+		t.Errorf("want cancelled reservation; got %+v", cancelled)
+	}
+	if len(api.waitlist.offered) != 1 {
+		t.Errorf("want freed table offered to waitlist; got %v", api.waitlist.offered)
+	}
+	if len(api.notificator.cancelled) != 1 || api.notificator.cancelled[0] != 1 {
+		t.Errorf("want guest notified of cancellation; got %v", api.notificator.cancelled)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	api := newTestAPI(t)
+	api.reservations.reservations[1] = &domain.Reservation{ID: 1, User: domain.User{ID: guestID}, Status: domain.StatusConfirmed}
+
+	var errRes errorResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &errRes); status != http.StatusUnauthorized {
+		t.Errorf("want %d; got %d", http.StatusUnauthorized, status)
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/users/login",
+		loginRequest{Email: "guest@example.com", Password: "wrong"}, &errRes); status != http.StatusUnauthorized {
+		t.Errorf("want %d; got %d", http.StatusUnauthorized, status)
+	}
+
+	api.login(t, "guest@example.com")
+
+	var profile map[string]interface{}
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &profile); status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if profile["email"] != "guest@example.com" {
+		t.Errorf("want guest's profile; got %v", profile)
+	}
+	if _, ok := profile["password"]; ok {
+		t.Errorf("password must not be returned; got %v", profile)
+	}
+
+	var reservations []reservationResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me/reservations", nil, &reservations); status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if len(reservations) != 1 || reservations[0].ID != 1 {
+		t.Errorf("want guest's reservation; got %+v", reservations)
+	}
+
+	if status := api.do(t, http.MethodPost, "/api/v2/users/logout", nil, nil); status != http.StatusNoContent {
+		t.Errorf("want %d; got %d", http.StatusNoContent, status)
+	}
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &errRes); status != http.StatusUnauthorized {
+		t.Errorf("want %d after logout; got %d", http.StatusUnauthorized, status)
+	}
+}
+
+func TestPartnerReservations(t *testing.T) {
+	api := newTestAPI(t)
+	api.reservations.reservations[1] = &domain.Reservation{ID: 1, Cafe: domain.Cafe{ID: 1}, Status: domain.StatusConfirmed}
+	api.reservations.reservations[2] = &domain.Reservation{ID: 2, Cafe: domain.Cafe{ID: 2}, Status: domain.StatusConfirmed}
+
+	var errRes errorResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, &errRes); status != http.StatusUnauthorized {
+		t.Errorf("want %d for guest; got %d", http.StatusUnauthorized, status)
+	}
+
+	api.login(t, "guest@example.com")
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, &errRes); status != http.StatusForbidden {
+		t.Errorf("want %d for user; got %d", http.StatusForbidden, status)
+	}
+
+	api.login(t, "partner@example.com")
+
+	var reservations []reservationResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, &reservations); status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if len(reservations) != 1 || reservations[0].ID != 1 {
+		t.Errorf("want only reservations of partner's cafe; got %+v", reservations)
+	}
+
+	if status := api.do(t, http.MethodPost, "/api/v2/partner/reservations/2/status",
+		statusRequest{Status: domain.StatusSeated}, &errRes); status != http.StatusForbidden {
+		t.Errorf("want %d for another cafe's reservation; got %d", http.StatusForbidden, status)
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/partner/reservations/1/status",
+		statusRequest{Status: domain.StatusCompleted}, &errRes); status != http.StatusConflict {
+		t.Errorf("want %d for invalid transition; got %d", http.StatusConflict, status)
+	}
+
+	var changed reservationResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/partner/reservations/1/status",
+		statusRequest{Status: domain.StatusNoShow}, &changed); status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if changed.Status != string(domain.StatusNoShow) || len(api.waitlist.offered) != 1 {
+		t.Errorf("want no-show reservation with its table offered to waitlist; got %+v, %v", changed, api.waitlist.offered)
+	}
+}
+
+func TestPartnerPermissions(t *testing.T) {
+	api := newTestAPI(t)
+	api.reservations.reservations[1] = &domain.Reservation{ID: 1, Cafe: domain.Cafe{ID: 1}, Status: domain.StatusConfirmed}
+	api.users.users[partnerID].Role.Permissions = []domain.Permission{domain.PermissionReservationView}
+
+	api.login(t, "partner@example.com")
+
+	var reservations []reservationResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, &reservations); status != http.StatusOK {
+		t.Errorf("want %d with reservation.view; got %d", http.StatusOK, status)
+	}
+
+	var errRes errorResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/partner/reservations/1/status",
+		statusRequest{Status: domain.StatusSeated}, &errRes); status != http.StatusForbidden {
+		t.Errorf("want %d without reservation.status; got %d", http.StatusForbidden, status)
+	}
+	if api.reservations.reservations[1].Status != domain.StatusConfirmed {
+		t.Errorf("want reservation unchanged; got %s", api.reservations.reservations[1].Status)
+	}
+}
+
+func TestPartnerCafeSelection(t *testing.T) {
+	api := newTestAPI(t)
+	api.staff.members = append(api.staff.members,
+		domain.CafeMember{Cafe: domain.Cafe{ID: 2}, User: domain.User{ID: partnerID}, Role: domain.StaffHost})
+	api.reservations.reservations[1] = &domain.Reservation{ID: 1, Cafe: domain.Cafe{ID: 1}, Status: domain.StatusConfirmed}
+	api.reservations.reservations[2] = &domain.Reservation{ID: 2, Cafe: domain.Cafe{ID: 2}, Status: domain.StatusConfirmed}
+	api.reservations.reservations[3] = &domain.Reservation{ID: 3, Cafe: domain.Cafe{ID: 3}, Status: domain.StatusConfirmed}
+
+	api.login(t, "partner@example.com")
+
+	var errRes errorResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, &errRes); status != http.StatusBadRequest {
+		t.Errorf("want %d without cafe_id for staff of two cafes; got %d", http.StatusBadRequest, status)
+	}
+
+	var reservations []reservationResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations?cafe_id=2", nil, &reservations); status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if len(reservations) != 1 || reservations[0].ID != 2 {
+		t.Errorf("want only reservations of the selected cafe; got %+v", reservations)
+	}
+
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations?cafe_id=3", nil, &errRes); status != http.StatusForbidden {
+		t.Errorf("want %d for cafe partner does not work at; got %d", http.StatusForbidden, status)
+	}
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations/1?cafe_id=2", nil, &errRes); status != http.StatusForbidden {
+		t.Errorf("want %d for reservation of another selected cafe; got %d", http.StatusForbidden, status)
+	}
+
+	var changed reservationResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/partner/reservations/2/status?cafe_id=2",
+		statusRequest{Status: domain.StatusSeated}, &changed); status != http.StatusOK {
+		t.Errorf("want host to seat guests; got %d", status)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	api := newTestAPI(t)
+
+	var res errorResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/token",
+		loginRequest{Email: "guest@example.com", Password: "wrong"}, &res); status != http.StatusUnauthorized {
+		t.Errorf("want status %d for wrong password; got %d", http.StatusUnauthorized, status)
+	}
+
+	var pair tokenResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/token",
+		loginRequest{Email: "partner@example.com", Password: "secret"}, &pair); status != http.StatusOK {
+		t.Fatalf("want status %d; got %d", http.StatusOK, status)
+	}
+	if pair.TokenType != "Bearer" || pair.AccessToken == "" || pair.RefreshToken == "" {
+		t.Fatalf("unexpected tokens %+v", pair)
+	}
+
+	// token does not start a session
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &res); status != http.StatusUnauthorized {
+		t.Errorf("want status %d without token; got %d", http.StatusUnauthorized, status)
+	}
+
+	api.bearer = pair.AccessToken
+	var user userResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &user); status != http.StatusOK || user.ID != partnerID {
+		t.Errorf("want partner's profile; got status %d, user %d", status, user.ID)
+	}
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, nil); status != http.StatusOK {
+		t.Errorf("want role from token to be accepted; got status %d", status)
+	}
+
+	// invalid token does not fall back to session
+	api.bearer = ""
+	api.login(t, "guest@example.com")
+	api.bearer = "forged"
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &res); status != http.StatusUnauthorized {
+		t.Errorf("want status %d for invalid token; got %d", http.StatusUnauthorized, status)
+	}
+	api.bearer = ""
+
+	var rotated tokenResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/refresh",
+		refreshRequest{RefreshToken: pair.RefreshToken}, &rotated); status != http.StatusOK {
+		t.Fatalf("want status %d; got %d", http.StatusOK, status)
+	}
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Error("want refresh token to be rotated")
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/refresh",
+		refreshRequest{RefreshToken: pair.RefreshToken}, &res); status != http.StatusUnauthorized {
+		t.Errorf("want used refresh token to be rejected; got %d", status)
+	}
+
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/revoke",
+		refreshRequest{RefreshToken: rotated.RefreshToken}, nil); status != http.StatusNoContent {
+		t.Errorf("want status %d; got %d", http.StatusNoContent, status)
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/refresh",
+		refreshRequest{RefreshToken: rotated.RefreshToken}, &res); status != http.StatusUnauthorized {
+		t.Errorf("want revoked refresh token to be rejected; got %d", status)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	api := newTestAPI(t)
+	api.users.users[partnerID].TOTPEnabledAt = time.Now()
+	api.twoFactor.codes["123456"] = true
+	api.twoFactor.codes["ABCDE-FGHIJ"] = true
+
+	var res errorResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/users/login",
+		loginRequest{Email: "partner@example.com", Password: "secret"}, &res); status != http.StatusUnauthorized {
+		t.Errorf("want status %d without code; got %d", http.StatusUnauthorized, status)
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/users/login",
+		loginRequest{Email: "partner@example.com", Password: "secret", OTP: "654321"}, &res); status != http.StatusUnauthorized {
+		t.Errorf("want status %d for wrong code; got %d", http.StatusUnauthorized, status)
+	}
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &res); status != http.StatusUnauthorized {
+		t.Errorf("want no session after failed second step; got %d", status)
+	}
+
+	var user userResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/users/login",
+		loginRequest{Email: "partner@example.com", Password: "secret", OTP: "123456"}, &user); status != http.StatusOK {
+		t.Fatalf("want status %d with valid code; got %d", http.StatusOK, status)
+	}
+
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/token",
+		loginRequest{Email: "partner@example.com", Password: "secret", OTP: "123456"}, &res); status != http.StatusUnauthorized {
+		t.Errorf("want used code to be rejected; got %d", status)
+	}
+	var pair tokenResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/token",
+		loginRequest{Email: "partner@example.com", Password: "secret", OTP: "ABCDE-FGHIJ"}, &pair); status != http.StatusOK {
+		t.Errorf("want recovery code to be accepted; got %d", status)
+	}
+}
+
+func TestLoginThrottled(t *testing.T) {
+	api := newTestAPI(t)
+	api.users.throttled = &domain.LoginThrottledError{RetryAt: time.Now().Add(time.Minute), Locked: true}
+
+	var res errorResponse
+	if status := api.do(t, http.MethodPost, "/api/v2/users/login",
+		loginRequest{Email: "guest@example.com", Password: "secret"}, &res); status != http.StatusTooManyRequests {
+		t.Errorf("want status %d; got %d", http.StatusTooManyRequests, status)
+	}
+	if status := api.do(t, http.MethodPost, "/api/v2/auth/token",
+		loginRequest{Email: "guest@example.com", Password: "secret"}, &res); status != http.StatusTooManyRequests {
+		t.Errorf("want status %d; got %d", http.StatusTooManyRequests, status)
+	}
+}
+
+func TestSessionRevoked(t *testing.T) {
+	api := newTestAPI(t)
+	api.login(t, "guest@example.com")
+	if n := api.sessions.ofUser(guestID); n != 1 {
+		t.Fatalf("want one stored session of user after login; got %d", n)
+	}
+
+	var user userResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &user); status != http.StatusOK {
+		t.Fatalf("want status %d; got %d", http.StatusOK, status)
+	}
+
+	// e.g. user ended the session on profile page of another browser
+	for token, s := range api.sessions.sessions {
+		if s.UserID == guestID {
+			delete(api.sessions.sessions, token)
+		}
+	}
+	var res errorResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/users/me", nil, &res); status != http.StatusUnauthorized {
+		t.Errorf("want status %d after the session is revoked; got %d", http.StatusUnauthorized, status)
+	}
+
+	api.login(t, "guest@example.com")
+	if status := api.do(t, http.MethodPost, "/api/v2/users/logout", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("want status %d; got %d", http.StatusNoContent, status)
+	}
+	if n := api.sessions.ofUser(guestID); n != 0 {
+		t.Errorf("want stored session to be ended on logout; got %d", n)
+	}
+}
+
+func TestTwoFactorRequiredForRole(t *testing.T) {
+	api := newTestAPI(t)
+	api.users.users[partnerID].Role.RequireTwoFactor = true
+	api.login(t, "partner@example.com")
+
+	var res errorResponse
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, &res); status != http.StatusForbidden {
+		t.Errorf("want status %d until second factor is set up; got %d", http.StatusForbidden, status)
+	}
+
+	api.users.users[partnerID].TOTPEnabledAt = time.Now()
+	if status := api.do(t, http.MethodGet, "/api/v2/partner/reservations", nil, nil); status != http.StatusOK {
+		t.Errorf("want status %d once second factor is enabled; got %d", http.StatusOK, status)
+	}
+}
@@ -0,0 +1,126 @@
+package http_v2
+
+import (
+	"errors"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// RequireJSON rejects changing requests that are not json. Browsers can not send json
+// to another site without asking it first, so api needs no csrf token
+func (h *handler) RequireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.ContentType() != "application/json" {
+			h.clientError(c, http.StatusUnsupportedMediaType, "request body must be application/json")
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *handler) RequireAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID(c) == nil {
+			h.clientError(c, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Next()
+	}
+}
+
+// keys of gin context put by permission checks
+const (
+	permittedUser = "permittedUser"
+	partnerCafe   = "partnerCafe"
+)
+
+// RequirePermission lets in users whose role has any of permissions
+func (h *handler) RequirePermission(permissions ...domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID(c) == nil {
+			h.clientError(c, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		user, err := h.userService.FindById(userID(c).(int))
+		if err != nil {
+			h.serverError(c, err)
+			return
+		}
+		if !user.Role.Can(permissions...) {
+			h.clientError(c, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+		if user.MustEnrollTwoFactor() {
+			h.clientError(c, http.StatusForbidden, "two-factor authentication must be set up for this account in profile settings")
+			return
+		}
+		c.Set(permittedUser, user)
+		c.Header("Cache-Control", "no-store")
+		c.Next()
+	}
+}
+
+// RequireCafePermission goes after RequirePermission, it lets in staff who may do any of permissions
+// in the cafe from "cafe_id" query parameter. Staff of a single cafe may leave the parameter out
+func (h *handler) RequireCafePermission(permissions ...domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(permittedUser).(*domain.User)
+
+		var cafeID int
+		if v := c.Query("cafe_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id < 1 {
+				h.clientError(c, http.StatusBadRequest, "cafe_id must be a positive integer")
+				return
+			}
+			cafeID = id
+		} else {
+			cafes, err := h.staffService.GetUserCafes(user.ID)
+			if err != nil {
+				h.serverError(c, err)
+				return
+			}
+			switch len(cafes) {
+			case 0:
+				h.clientError(c, http.StatusForbidden, "you do not work at any cafe")
+				return
+			case 1:
+				cafeID = cafes[0].Cafe.ID
+			default:
+				h.clientError(c, http.StatusBadRequest, "cafe_id is required for staff of several cafes")
+				return
+			}
+		}
+
+		member, err := h.staffService.GetMember(cafeID, user.ID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNoRecord) {
+				h.clientError(c, http.StatusForbidden, "you do not work at this cafe")
+				return
+			}
+			h.serverError(c, err)
+			return
+		}
+		member.User = *user
+		if !member.Can(permissions...) {
+			h.clientError(c, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+		c.Set(partnerCafe, member)
+		c.Next()
+	}
+}
+
+// partnerCafeMember returns membership put by RequireCafePermission
+func partnerCafeMember(c *gin.Context) *domain.CafeMember {
+	return c.MustGet(partnerCafe).(*domain.CafeMember)
+}
+
+// userID returns nil for guests, the same way services expect it
+func userID(c *gin.Context) interface{} {
+	return http_v1.AuthenticatedUserID(c)
+}
@@ -0,0 +1,442 @@
+package http_v2
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// OpenAPISpec describes every route of InitRoutes, handler tests fail when they differ.
+// pkg/apiclient is generated from it with go generate
+var OpenAPISpec = []byte(`{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Table Reservation API",
+    "version": "2.0.0",
+    "description": "JSON API for mobile app and partner integrations. Changing requests must be sent as application/json. Guests and partners authenticate either with the session cookie set by login or with bearer access token issued by /auth/token."
+  },
+  "servers": [{"url": "/api/v2"}],
+  "paths": {
+    "/openapi.json": {
+      "get": {
+        "operationId": "getOpenAPI",
+        "summary": "OpenAPI document of this api",
+        "responses": {
+          "200": {"description": "OpenAPI document", "content": {"application/json": {"schema": {"type": "object"}}}}
+        }
+      }
+    },
+    "/auth/token": {
+      "post": {
+        "operationId": "issueToken",
+        "summary": "Login for clients without cookies, access token is sent in Authorization: Bearer header",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LoginRequest"}}}},
+        "responses": {
+          "200": {"description": "Tokens", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Token"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/TooManyAttempts"}
+        }
+      }
+    },
+    "/auth/refresh": {
+      "post": {
+        "operationId": "refreshToken",
+        "summary": "Exchange refresh token for a new pair, the used refresh token stops working",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RefreshRequest"}}}},
+        "responses": {
+          "200": {"description": "Tokens", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Token"}}}},
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/auth/revoke": {
+      "post": {
+        "operationId": "revokeToken",
+        "summary": "Revoke refresh token, issued access token expires on its own",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RefreshRequest"}}}},
+        "responses": {
+          "204": {"description": "Revoked"}
+        }
+      }
+    },
+    "/cafes": {
+      "get": {
+        "operationId": "listCafes",
+        "summary": "Search cafes by name, filter them by type and city or list all of them",
+        "parameters": [
+          {"name": "search", "in": "query", "schema": {"type": "string"}},
+          {"name": "type", "in": "query", "schema": {"type": "integer"}},
+          {"name": "city", "in": "query", "schema": {"type": "integer"}}
+        ],
+        "responses": {
+          "200": {"description": "Cafes", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Cafe"}}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/cafes/{id}/booking-options": {
+      "get": {
+        "operationId": "getBookingOptions",
+        "summary": "Dates, times, party sizes, locations and events guest can choose from",
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "date", "in": "query", "description": "times are listed for this date, today in cafe's time zone by default", "schema": {"type": "string", "format": "date"}}
+        ],
+        "responses": {
+          "200": {"description": "Booking options", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BookingOptions"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/cafes/{id}/availability": {
+      "get": {
+        "operationId": "getAvailability",
+        "summary": "Free tables, combinations of joinable tables are looked up when no single table seats the party",
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "date", "in": "query", "required": true, "schema": {"type": "string", "format": "date"}},
+          {"name": "time", "in": "query", "required": true, "description": "wall clock in cafe's time zone, e.g. 19:30", "schema": {"type": "string"}},
+          {"name": "party_size", "in": "query", "required": true, "schema": {"type": "integer"}},
+          {"name": "location_id", "in": "query", "required": true, "schema": {"type": "integer"}}
+        ],
+        "responses": {
+          "200": {"description": "Free tables", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Availability"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/reservations": {
+      "post": {
+        "operationId": "createReservation",
+        "summary": "Book tables, manage token of the new reservation is returned once",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReservationRequest"}}}},
+        "responses": {
+          "201": {"description": "Reservation", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Reservation"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/reservations/{id}": {
+      "get": {
+        "operationId": "getReservation",
+        "summary": "Reservation of the logged in guest or the one the manage token was issued for",
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "token", "in": "query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Reservation", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Reservation"}}}},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/reservations/{id}/cancel": {
+      "post": {
+        "operationId": "cancelReservation",
+        "summary": "Cancel reservation, logged in guests do not need manage token",
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}
+        ],
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/CancelRequest"}}}},
+        "responses": {
+          "200": {"description": "Cancelled reservation", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Reservation"}}}},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/users/login": {
+      "post": {
+        "operationId": "login",
+        "summary": "Start a session, the session cookie authenticates next requests",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LoginRequest"}}}},
+        "responses": {
+          "200": {"description": "Logged in user", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/TooManyAttempts"}
+        }
+      }
+    },
+    "/users/logout": {
+      "post": {
+        "operationId": "logout",
+        "security": [{"sessionCookie": []}, {"bearerAuth": []}],
+        "responses": {
+          "204": {"description": "Logged out"},
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/users/me": {
+      "get": {
+        "operationId": "getProfile",
+        "security": [{"sessionCookie": []}, {"bearerAuth": []}],
+        "responses": {
+          "200": {"description": "Logged in user", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/TooManyAttempts"}
+        }
+      }
+    },
+    "/users/me/reservations": {
+      "get": {
+        "operationId": "listUserReservations",
+        "security": [{"sessionCookie": []}, {"bearerAuth": []}],
+        "responses": {
+          "200": {"description": "Reservations of logged in user", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Reservation"}}}}},
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/partner/reservations": {
+      "get": {
+        "operationId": "listPartnerReservations",
+        "summary": "Reservations history of partner's cafe including cancelled ones",
+        "security": [{"sessionCookie": []}, {"bearerAuth": []}],
+        "parameters": [
+          {"name": "cafe_id", "in": "query", "description": "cafe among those the user works at, may be left out by staff of a single cafe", "schema": {"type": "integer"}}
+        ],
+        "responses": {
+          "200": {"description": "Reservations", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Reservation"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/partner/reservations/{id}": {
+      "get": {
+        "operationId": "getPartnerReservation",
+        "security": [{"sessionCookie": []}, {"bearerAuth": []}],
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "cafe_id", "in": "query", "description": "cafe among those the user works at, may be left out by staff of a single cafe", "schema": {"type": "integer"}}
+        ],
+        "responses": {
+          "200": {"description": "Reservation", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Reservation"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/partner/reservations/{id}/status": {
+      "post": {
+        "operationId": "changeReservationStatus",
+        "summary": "Mark guests as seated, completed or no-show",
+        "security": [{"sessionCookie": []}, {"bearerAuth": []}],
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "cafe_id", "in": "query", "description": "cafe among those the user works at, may be left out by staff of a single cafe", "schema": {"type": "integer"}}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/StatusRequest"}}}},
+        "responses": {
+          "200": {"description": "Changed reservation", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Reservation"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "sessionCookie": {"type": "apiKey", "in": "cookie", "name": "mySessionStore"},
+      "bearerAuth": {"type": "http", "scheme": "bearer"}
+    },
+    "responses": {
+      "Error": {"description": "Error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "TooManyAttempts": {
+        "description": "Too many failed login attempts from the address or to the account",
+        "headers": {"Retry-After": {"description": "seconds until the next attempt is allowed", "schema": {"type": "integer"}}},
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "required": ["error"],
+        "properties": {
+          "error": {"type": "string"},
+          "fields": {"type": "object", "description": "message per invalid field", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "IDName": {
+        "type": "object",
+        "required": ["id", "name"],
+        "properties": {
+          "id": {"type": "integer"},
+          "name": {"type": "string"}
+        }
+      },
+      "City": {
+        "type": "object",
+        "required": ["id", "name", "time_zone"],
+        "properties": {
+          "id": {"type": "integer"},
+          "name": {"type": "string"},
+          "time_zone": {"type": "string", "description": "IANA name, e.g. Asia/Almaty"}
+        }
+      },
+      "Cafe": {
+        "type": "object",
+        "required": ["id", "name", "address", "image_url", "mobile", "email", "description", "city", "type"],
+        "properties": {
+          "id": {"type": "integer"},
+          "name": {"type": "string"},
+          "address": {"type": "string"},
+          "image_url": {"type": "string"},
+          "mobile": {"type": "string"},
+          "email": {"type": "string"},
+          "description": {"type": "string"},
+          "city": {"$ref": "#/components/schemas/City"},
+          "type": {"$ref": "#/components/schemas/IDName"}
+        }
+      },
+      "Table": {
+        "type": "object",
+        "required": ["id", "capacity", "location"],
+        "properties": {
+          "id": {"type": "integer"},
+          "capacity": {"type": "integer"},
+          "location": {"$ref": "#/components/schemas/IDName"}
+        }
+      },
+      "Combination": {
+        "type": "object",
+        "required": ["table_ids", "capacity"],
+        "properties": {
+          "table_ids": {"type": "array", "items": {"type": "integer"}},
+          "capacity": {"type": "integer"}
+        }
+      },
+      "Availability": {
+        "type": "object",
+        "required": ["tables", "combinations"],
+        "properties": {
+          "tables": {"type": "array", "items": {"$ref": "#/components/schemas/Table"}},
+          "combinations": {"type": "array", "items": {"$ref": "#/components/schemas/Combination"}}
+        }
+      },
+      "BookingOptions": {
+        "type": "object",
+        "required": ["min_date", "max_date", "times", "party_sizes", "locations", "events"],
+        "properties": {
+          "min_date": {"type": "string", "format": "date"},
+          "max_date": {"type": "string", "format": "date"},
+          "times": {"type": "array", "items": {"type": "string"}},
+          "party_sizes": {"type": "array", "items": {"type": "integer"}},
+          "locations": {"type": "array", "items": {"$ref": "#/components/schemas/IDName"}},
+          "events": {"type": "array", "items": {"$ref": "#/components/schemas/IDName"}}
+        }
+      },
+      "Reservation": {
+        "type": "object",
+        "required": ["id", "cafe", "table_ids", "location", "event", "party_size", "date", "status", "is_changeable"],
+        "properties": {
+          "id": {"type": "integer"},
+          "cafe": {"$ref": "#/components/schemas/IDName"},
+          "table_ids": {"type": "array", "items": {"type": "integer"}},
+          "location": {"$ref": "#/components/schemas/IDName"},
+          "event": {"$ref": "#/components/schemas/IDName"},
+          "event_description": {"type": "string"},
+          "party_size": {"type": "integer"},
+          "date": {"type": "string", "format": "date-time", "description": "in cafe's time zone"},
+          "status": {"type": "string", "enum": ["pending", "confirmed", "seated", "completed", "cancelled", "no_show"]},
+          "is_changeable": {"type": "boolean"},
+          "cust_name": {"type": "string"},
+          "cust_mobile": {"type": "string"},
+          "cust_email": {"type": "string"},
+          "manage_token": {"type": "string", "description": "returned once after booking"}
+        }
+      },
+      "ReservationRequest": {
+        "type": "object",
+        "required": ["cafe_id", "date", "time", "party_size", "location_id", "table_ids", "name", "mobile", "email"],
+        "properties": {
+          "cafe_id": {"type": "integer"},
+          "date": {"type": "string", "format": "date"},
+          "time": {"type": "string"},
+          "party_size": {"type": "integer"},
+          "location_id": {"type": "integer"},
+          "table_ids": {"type": "array", "description": "the first table and tables joined to it", "items": {"type": "integer"}},
+          "event_id": {"type": "integer"},
+          "event_description": {"type": "string"},
+          "name": {"type": "string"},
+          "mobile": {"type": "string"},
+          "email": {"type": "string"}
+        }
+      },
+      "CancelRequest": {
+        "type": "object",
+        "properties": {
+          "token": {"type": "string"}
+        }
+      },
+      "LoginRequest": {
+        "type": "object",
+        "required": ["email", "password"],
+        "properties": {
+          "email": {"type": "string"},
+          "password": {"type": "string"},
+          "otp": {"type": "string", "description": "code from authenticator app or a recovery code, required when two-factor authentication is enabled"}
+        }
+      },
+      "RefreshRequest": {
+        "type": "object",
+        "required": ["refresh_token"],
+        "properties": {
+          "refresh_token": {"type": "string"}
+        }
+      },
+      "Token": {
+        "type": "object",
+        "required": ["access_token", "token_type", "expires_at", "refresh_token", "refresh_expires_at"],
+        "properties": {
+          "access_token": {"type": "string"},
+          "token_type": {"type": "string", "enum": ["Bearer"]},
+          "expires_at": {"type": "string", "format": "date-time"},
+          "refresh_token": {"type": "string"},
+          "refresh_expires_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "StatusRequest": {
+        "type": "object",
+        "required": ["status"],
+        "properties": {
+          "status": {"type": "string", "enum": ["pending", "confirmed", "seated", "completed", "cancelled", "no_show"]}
+        }
+      },
+      "User": {
+        "type": "object",
+        "required": ["id", "name", "email", "email_verified", "mobile", "image_url", "role"],
+        "properties": {
+          "id": {"type": "integer"},
+          "name": {"type": "string"},
+          "email": {"type": "string"},
+          "email_verified": {"type": "boolean"},
+          "mobile": {"type": "string"},
+          "image_url": {"type": "string"},
+          "role": {"$ref": "#/components/schemas/IDName"}
+        }
+      }
+    }
+  }
+}
+`)
+
+func (h *handler) OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", OpenAPISpec)
+}
@@ -0,0 +1,112 @@
+package http_v2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]json.RawMessage `json:"schemas"`
+		Responses map[string]json.RawMessage `json:"responses"`
+	} `json:"components"`
+}
+
+func parseSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(OpenAPISpec, &doc); err != nil {
+		t.Fatalf("spec is not valid json: %v", err)
+	}
+	return doc
+}
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+// TestOpenAPIMatchesRoutes mounts api the same way handler.Init does,
+// every registered route must be documented and every documented route must exist
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	discard := log.New(ioutil.Discard, "", 0)
+	h := NewHandler(nil, nil, nil, nil, nil, nil, nil, nil, discard, discard)
+
+	router := gin.New()
+	prefix := "/api/" + h.Version()
+	h.InitRoutes(router.Group(prefix))
+
+	registered := map[string]bool{}
+	for _, r := range router.Routes() {
+		path := ginParam.ReplaceAllString(strings.TrimPrefix(r.Path, prefix), "{$1}")
+		registered[r.Method+" "+path] = true
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range parseSpec(t).Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var missing, stale []string
+	for route := range registered {
+		if !documented[route] {
+			missing = append(missing, route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			stale = append(stale, route)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+
+	if len(missing) > 0 {
+		t.Errorf("routes missing in OpenAPISpec: %v", missing)
+	}
+	if len(stale) > 0 {
+		t.Errorf("OpenAPISpec documents routes that are not registered: %v", stale)
+	}
+}
+
+var specRef = regexp.MustCompile(`"\$ref":\s*"#/components/(schemas|responses)/(\w+)"`)
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+	doc := parseSpec(t)
+
+	for _, m := range specRef.FindAllSubmatch(OpenAPISpec, -1) {
+		kind, name := string(m[1]), string(m[2])
+		var ok bool
+		if kind == "schemas" {
+			_, ok = doc.Components.Schemas[name]
+		} else {
+			_, ok = doc.Components.Responses[name]
+		}
+		if !ok {
+			t.Errorf("#/components/%s/%s is not defined", kind, name)
+		}
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	var doc openAPIDoc
+	if status := api.do(t, http.MethodGet, "/api/v2/openapi.json", nil, &doc); status != http.StatusOK {
+		t.Fatalf("want status %d; got %d", http.StatusOK, status)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Paths) == 0 {
+		t.Errorf("unexpected document: version %q, %d paths", doc.OpenAPI, len(doc.Paths))
+	}
+}
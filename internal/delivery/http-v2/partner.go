@@ -0,0 +1,103 @@
+package http_v2
+
+import (
+	"errors"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+func (h *handler) initPartnerRoutes(api *gin.RouterGroup) {
+	partner := api.Group("/partner", h.RequirePermission(domain.PartnerPermissions...))
+	{
+		partner.GET("/reservations", h.RequireCafePermission(domain.PermissionReservationView), h.PartnerReservations)
+		partner.GET("/reservations/:id", h.RequireCafePermission(domain.PermissionReservationView), h.PartnerReservation)
+		partner.POST("/reservations/:id/status", h.RequireCafePermission(domain.PermissionReservationStatus),
+			h.ChangeReservationStatus)
+	}
+}
+
+// partnerReservation loads reservation from url, only reservations of partner's cafe are returned;
+// writes error response itself when it returns false
+func (h *handler) partnerReservation(c *gin.Context) (*domain.Reservation, bool) {
+	reservationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || reservationID < 1 {
+		h.notFound(c)
+		return nil, false
+	}
+
+	reservation, err := h.reservationService.GetCafeReservation(partnerCafeMember(c), reservationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.notFound(c)
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.clientError(c, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		default:
+			h.serverError(c, err)
+		}
+		return nil, false
+	}
+
+	return reservation, true
+}
+
+// PartnerReservations lists cafe's reservations history including cancelled ones
+func (h *handler) PartnerReservations(c *gin.Context) {
+	cafeID := partnerCafeMember(c).Cafe.ID
+
+	reservations, err := h.reservationService.GetCafeBookings(cafeID)
+	if err != nil {
+		h.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newReservationResponses(reservations))
+}
+
+func (h *handler) PartnerReservation(c *gin.Context) {
+	reservation, ok := h.partnerReservation(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newReservationResponse(*reservation))
+}
+
+type statusRequest struct {
+	Status domain.ReservationStatus `json:"status"`
+}
+
+// ChangeReservationStatus lets partner mark guests as seated, completed or no-show
+func (h *handler) ChangeReservationStatus(c *gin.Context) {
+	var req statusRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	reservation, ok := h.partnerReservation(c)
+	if !ok {
+		return
+	}
+
+	err := h.reservationService.ChangeStatus(reservation, req.Status, partnerCafeMember(c).User.ID)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidTransition) {
+			h.clientError(c, http.StatusConflict,
+				"reservation can not become "+string(req.Status)+" from "+string(reservation.Status))
+			return
+		}
+		h.serverError(c, err)
+		return
+	}
+
+	if !req.Status.OccupiesTable() {
+		h.offerFreedTables(reservation.Cafe.ID)
+	}
+	if req.Status == domain.StatusCancelled {
+		h.sendBookingCancellation(reservation)
+	}
+
+	c.JSON(http.StatusOK, newReservationResponse(*reservation))
+}
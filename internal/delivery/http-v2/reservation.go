@@ -0,0 +1,204 @@
+package http_v2
+
+import (
+	"errors"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+func (h *handler) initReservationRoutes(api *gin.RouterGroup) {
+	reservations := api.Group("/reservations")
+	{
+		reservations.POST("", h.CreateReservation)
+		reservations.GET("/:id", h.GetReservation)
+		reservations.POST("/:id/cancel", h.CancelReservation)
+	}
+}
+
+const bookingNotAllowedMessage = "the cafe does not accept bookings for this date, time or party size"
+
+type reservationRequest struct {
+	CafeID           int    `json:"cafe_id"`
+	Date             string `json:"date"`
+	Time             string `json:"time"`
+	PartySize        int    `json:"party_size"`
+	LocationID       int    `json:"location_id"`
+	TableIDs         []int  `json:"table_ids"` // the first table and tables joined to it
+	EventID          int    `json:"event_id"`
+	EventDescription string `json:"event_description"`
+	Name             string `json:"name"`
+	Mobile           string `json:"mobile"`
+	Email            string `json:"email"`
+}
+
+// CreateReservation books tables for the guest, guest's contacts are validated
+// the same way as on the confirmation page
+func (h *handler) CreateReservation(c *gin.Context) {
+	var req reservationRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+	if req.CafeID < 1 || len(req.TableIDs) == 0 {
+		h.clientError(c, http.StatusBadRequest, "cafe_id and table_ids are required")
+		return
+	}
+
+	userID := userID(c)
+	if userID != nil {
+		yes, err := h.userService.InBlacklist(userID.(int), req.CafeID)
+		if err != nil {
+			h.serverError(c, err)
+			return
+		}
+		if yes {
+			h.clientError(c, http.StatusForbidden, "you can not book tables in this cafe")
+			return
+		}
+	}
+
+	userChoice := http_v1.UserChoice{
+		CafeID:           req.CafeID,
+		TableID:          req.TableIDs[0],
+		JoinedTableIDs:   req.TableIDs[1:],
+		EventID:          req.EventID,
+		LocationID:       req.LocationID,
+		PartySize:        req.PartySize,
+		EventDescription: req.EventDescription,
+		Date:             req.Date,
+		BookTime:         req.Time,
+	}
+	if userChoice.EventID == 0 {
+		userChoice.EventID = 1 // default value
+	}
+
+	form := forms.New(url.Values{})
+	form.Set("name", req.Name)
+	form.Set("mobile", req.Mobile)
+	form.Set("email", req.Email)
+
+	reservationID, formValidator, err := h.reservationService.BookTable(form, userChoice, userID)
+	switch {
+	case formValidator != nil && err == nil:
+		h.validationError(c, formValidator)
+		return
+	case errors.Is(err, domain.ErrTableTaken):
+		h.clientError(c, http.StatusConflict, "the table is already taken for this time")
+		return
+	case errors.Is(err, domain.ErrBookingNotAllowed):
+		h.clientError(c, http.StatusUnprocessableEntity, bookingNotAllowedMessage)
+		return
+	case errors.Is(err, domain.ErrNoRecord):
+		h.notFound(c)
+		return
+	case err != nil:
+		h.serverError(c, err)
+		return
+	}
+
+	reservation, err := h.reservationService.GetReservation(reservationID)
+	if err != nil {
+		h.serverError(c, err)
+		return
+	}
+	token := h.reservationService.ManageToken(reservationID)
+
+	if err = h.notificatorService.BookingConfirmation(*reservation, token); err != nil {
+		// reservation is already made at this point
+		h.infoLog.Printf("failed to send confirmation of reservation #%d: %v", reservationID, err)
+	}
+
+	res := newReservationResponse(*reservation)
+	res.ManageToken = token
+	c.JSON(http.StatusCreated, res)
+}
+
+// manageableReservation loads reservation from url, guest is identified either by session
+// or by manage token; writes error response itself when it returns false
+func (h *handler) manageableReservation(c *gin.Context, token string) (*domain.Reservation, bool) {
+	reservationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || reservationID < 1 {
+		h.notFound(c)
+		return nil, false
+	}
+
+	reservation, err := h.reservationService.GetManageableReservation(reservationID, userID(c), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNoRecord):
+			h.notFound(c)
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.clientError(c, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		default:
+			h.serverError(c, err)
+		}
+		return nil, false
+	}
+
+	return reservation, true
+}
+
+// GetReservation takes manage token from "token" query parameter for guests without account
+func (h *handler) GetReservation(c *gin.Context) {
+	reservation, ok := h.manageableReservation(c, c.Query("token"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newReservationResponse(*reservation))
+}
+
+type cancelRequest struct {
+	Token string `json:"token"`
+}
+
+// CancelReservation body is optional, logged in guests do not need manage token
+func (h *handler) CancelReservation(c *gin.Context) {
+	var req cancelRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.clientError(c, http.StatusBadRequest, "malformed json body")
+		return
+	}
+
+	reservation, ok := h.manageableReservation(c, req.Token)
+	if !ok {
+		return
+	}
+
+	err := h.reservationService.Cancel(reservation, userID(c))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotChangeable) || errors.Is(err, domain.ErrInvalidTransition) {
+			h.clientError(c, http.StatusConflict, "the reservation can not be cancelled anymore")
+			return
+		}
+		h.serverError(c, err)
+		return
+	}
+
+	h.offerFreedTables(reservation.Cafe.ID)
+	h.sendBookingCancellation(reservation)
+
+	c.JSON(http.StatusOK, newReservationResponse(*reservation))
+}
+
+// offerFreedTables does not fail the request, waiting guests get their offers when the next table frees up
+func (h *handler) offerFreedTables(cafeID int) {
+	if err := h.waitlistService.OfferFreedTables(cafeID, h.notificatorService); err != nil {
+		h.infoLog.Printf("failed to offer freed tables of cafe #%d to waitlist: %v", cafeID, err)
+	}
+}
+
+// sendBookingCancellation does not fail the request either, tables set busy by staff have no guest to notify
+func (h *handler) sendBookingCancellation(reservation *domain.Reservation) {
+	if reservation.CustEmail == "" && reservation.CustMobile == "" {
+		return
+	}
+	if err := h.notificatorService.BookingCancellation(*reservation); err != nil {
+		h.infoLog.Printf("failed to send cancellation of reservation #%d: %v", reservation.ID, err)
+	}
+}
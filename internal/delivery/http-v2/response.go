@@ -0,0 +1,53 @@
+package http_v2
+
+import (
+	"fmt"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"runtime/debug"
+)
+
+// errorResponse is the body of every failed request,
+// Fields has a message per invalid field of the request
+type errorResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func (h *handler) clientError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, errorResponse{Error: message})
+}
+
+func (h *handler) notFound(c *gin.Context) {
+	h.clientError(c, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+}
+
+func (h *handler) serverError(c *gin.Context, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	h.errorLog.Output(2, trace)
+
+	h.clientError(c, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+// validationError reports form errors the same way html pages show them next to the fields
+func (h *handler) validationError(c *gin.Context, form *forms.FormValidator) {
+	fields := make(map[string]string, len(form.Errors))
+	for field := range form.Errors {
+		fields[field] = form.Errors.Get(field)
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, errorResponse{
+		Error:  "invalid request",
+		Fields: fields,
+	})
+}
+
+// bindJSON writes bad request response itself when it returns false
+func (h *handler) bindJSON(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.clientError(c, http.StatusBadRequest, "malformed json body")
+		return false
+	}
+	return true
+}
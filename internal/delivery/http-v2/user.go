@@ -0,0 +1,138 @@
+package http_v2
+
+import (
+	"errors"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (h *handler) initUserRoutes(api *gin.RouterGroup) {
+	users := api.Group("/users")
+	{
+		users.POST("/login", h.Login)
+
+		authenticated := users.Group("", h.RequireAuthentication())
+		{
+			authenticated.POST("/logout", h.Logout)
+			authenticated.GET("/me", h.Profile)
+			authenticated.GET("/me/reservations", h.UserReservations)
+		}
+	}
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// OTP is a code from authenticator app or a recovery code, required when user has enabled two-factor authentication
+	OTP string `json:"otp"`
+}
+
+// authenticate checks password and second factor of login and token requests,
+// it writes error response and returns nil when user is not let in
+func (h *handler) authenticate(c *gin.Context, req loginRequest) *domain.User {
+	id, err := h.userService.SignIn(req.Email, req.Password, c.ClientIP(), h.notificatorService)
+	if err != nil {
+		h.loginError(c, err, "email or password is incorrect")
+		return nil
+	}
+
+	user, err := h.userService.FindById(id)
+	if err != nil {
+		h.serverError(c, err)
+		return nil
+	}
+	if !user.IsTwoFactorEnabled() {
+		return user
+	}
+	if req.OTP == "" {
+		h.clientError(c, http.StatusUnauthorized, "two-factor code is required")
+		return nil
+	}
+
+	err = h.twoFactorService.Verify(user.ID, req.OTP, c.ClientIP(), h.notificatorService)
+	if err != nil {
+		h.loginError(c, err, "two-factor code is incorrect or was already used")
+		return nil
+	}
+
+	return user
+}
+
+// loginError answers 429 with Retry-After header when login attempts are throttled
+func (h *handler) loginError(c *gin.Context, err error, invalidMessage string) {
+	var throttled *domain.LoginThrottledError
+	switch {
+	case errors.Is(err, domain.ErrInvalidCredentials), errors.Is(err, domain.ErrInvalidCode):
+		if err != domain.ErrInvalidCredentials && err != domain.ErrInvalidCode {
+			h.infoLog.Printf("failed login: %v", err)
+		}
+		h.clientError(c, http.StatusUnauthorized, invalidMessage)
+	case errors.As(err, &throttled):
+		now := time.Now()
+		c.Header("Retry-After", strconv.Itoa(int(throttled.RetryAt.Sub(now).Seconds())+1))
+		h.clientError(c, http.StatusTooManyRequests, strings.ToLower(http_v1.LoginThrottledMessage(throttled, now)))
+	default:
+		h.serverError(c, err)
+	}
+}
+
+// Login starts the same session as html login page does
+func (h *handler) Login(c *gin.Context) {
+	var req loginRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	user := h.authenticate(c, req)
+	if user == nil {
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("authenticatedUserID", user.ID)
+	session.Set("role", user.Role.ID)
+	session.Set("authenticatedAt", time.Now().UnixNano())
+	session.Save()
+
+	c.JSON(http.StatusOK, newUserResponse(*user))
+}
+
+func (h *handler) Logout(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Delete("authenticatedUserID")
+	session.Delete("role")
+	session.Delete("authenticatedAt")
+	session.Save()
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) Profile(c *gin.Context) {
+	user, err := h.userService.FindById(userID(c).(int))
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			h.notFound(c)
+			return
+		}
+		h.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserResponse(*user))
+}
+
+func (h *handler) UserReservations(c *gin.Context) {
+	reservations, err := h.reservationService.GetUserBookings(userID(c).(int))
+	if err != nil {
+		h.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newReservationResponses(reservations))
+}
@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// AuditAction names a privileged change that is written to the audit log
+type AuditAction string
+
+const (
+	AuditCafeApprove     AuditAction = "cafe.approve"
+	AuditCafeDisapprove  AuditAction = "cafe.disapprove"
+	AuditBlacklistAdd    AuditAction = "blacklist.add"
+	AuditRolePermissions AuditAction = "role.permissions"
+	AuditRoleAssign      AuditAction = "role.assign"
+	AuditTableBusy       AuditAction = "table.busy"
+	AuditTableFree       AuditAction = "table.free"
+)
+
+// AuditActions lists every action in the order audit filters show them
+var AuditActions = []AuditAction{AuditCafeApprove, AuditCafeDisapprove, AuditRolePermissions, AuditRoleAssign,
+	AuditBlacklistAdd, AuditTableBusy, AuditTableFree}
+
+// kinds of entities audit entries point at
+const (
+	AuditTargetCafe  = "cafe"
+	AuditTargetRole  = "role"
+	AuditTargetUser  = "user"
+	AuditTargetTable = "table"
+)
+
+// AuditData keeps fields of the target that the action changed, values are formatted for people to read
+type AuditData map[string]string
+
+// AuditEntry is a record of the append-only audit log, it is never changed once written
+type AuditEntry struct {
+	ID         int
+	Actor      User // only ID is written, name and email are read with the log
+	Action     AuditAction
+	TargetType string
+	TargetID   int
+	CafeID     int // 0 for actions that concern no cafe
+	Before     AuditData
+	After      AuditData
+	IP         string
+	Created    time.Time
+}
+
+// AuditFilter narrows audit log down, zero fields match every entry
+type AuditFilter struct {
+	Action     AuditAction
+	ActorEmail string
+	CafeID     int
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
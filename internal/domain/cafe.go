@@ -2,6 +2,7 @@ package domain
 
 import (
 	"github.com/gin-gonic/gin"
+	"sync"
 	"time"
 )
 
@@ -24,7 +25,7 @@ type Cafe struct {
 	City        City
 	Type        Type
 	Created     time.Time
-	AdminID     int
+	AdminID     int // partner who sent collaboration request, owns the cafe once it is approved
 }
 
 type Type struct {
@@ -33,8 +34,25 @@ type Type struct {
 }
 
 type City struct {
-	ID   int
-	Name string
+	ID       int
+	Name     string
+	TimeZone string // IANA name, e.g. Asia/Almaty
+}
+
+// locations caches loaded time zones, time.LoadLocation reads tz database on every call
+var locations sync.Map
+
+// Location of the city, reservation dates are shown and booked in it
+func (c City) Location() (*time.Location, error) {
+	if loc, ok := locations.Load(c.TimeZone); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(c.TimeZone, loc)
+	return loc, nil
 }
 
 type Location struct {
@@ -46,3 +64,80 @@ type Event struct {
 	ID   int
 	Name string
 }
+
+// BookingPolicy describes when and how a cafe accepts reservations
+type BookingPolicy struct {
+	CafeID              int
+	ReservationInterval int // minutes a single reservation occupies a table
+	MaxDaysInAdvance    int
+	MaxPartySize        int
+	OpeningHours        []OpeningHours // one entry per weekday, Sunday first
+	Location            *time.Location // time zone of the cafe's city, opening hours are wall clock in it
+	ReminderOffsets     []int          // minutes before the visit guests are reminded at, the earliest reminder first
+}
+
+// OpeningHours are stored as minutes since midnight,
+// ClosesAt less than or equal to OpensAt means that cafe closes after midnight
+type OpeningHours struct {
+	Weekday  time.Weekday
+	OpensAt  int
+	ClosesAt int
+	IsClosed bool
+}
+
+// DefaultBookingPolicy is used for cafes that did not set their own policy,
+// every day from 11:00 to 2:00 with 90 minutes reservations
+func DefaultBookingPolicy(cafeID int) *BookingPolicy {
+	p := &BookingPolicy{
+		CafeID:              cafeID,
+		ReservationInterval: 90,
+		MaxDaysInAdvance:    7,
+		MaxPartySize:        8,
+		Location:            time.UTC,
+		ReminderOffsets:     []int{60},
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		p.OpeningHours = append(p.OpeningHours, OpeningHours{
+			Weekday:  day,
+			OpensAt:  11 * 60,
+			ClosesAt: 2 * 60,
+		})
+	}
+	return p
+}
+
+// WantsReminder tells whether reminder scheduled for the moment still makes sense at now:
+// the cafe did not drop its offset and reservation was not moved since it was scheduled,
+// and the next reminder is not due yet, otherwise guest would get both at once
+func (p *BookingPolicy) WantsReminder(visit, scheduledFor, now time.Time) bool {
+	wanted := false
+	for _, minutes := range p.ReminderOffsets {
+		offset := time.Duration(minutes) * time.Minute
+		if visit.Add(-offset).Equal(scheduledFor) {
+			wanted = true
+		} else if visit.Add(-offset).After(scheduledFor) && !visit.Add(-offset).After(now) {
+			return false
+		}
+	}
+	return wanted
+}
+
+func (p *BookingPolicy) HoursOn(weekday time.Weekday) OpeningHours {
+	for _, h := range p.OpeningHours {
+		if h.Weekday == weekday {
+			return h
+		}
+	}
+	return OpeningHours{Weekday: weekday, IsClosed: true}
+}
+
+// WorkingMinutes returns how long the cafe works starting from OpensAt
+func (h OpeningHours) WorkingMinutes() int {
+	if h.IsClosed {
+		return 0
+	}
+	if h.ClosesAt <= h.OpensAt {
+		return h.ClosesAt + 24*60 - h.OpensAt
+	}
+	return h.ClosesAt - h.OpensAt
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBookingPolicyWantsReminder(t *testing.T) {
+	policy := BookingPolicy{ReminderOffsets: []int{24 * 60, 60}}
+	visit := time.Date(2021, 6, 4, 19, 0, 0, 0, time.UTC)
+	dayBefore, hourBefore := visit.Add(-24*time.Hour), visit.Add(-time.Hour)
+
+	tests := []struct {
+		name              string
+		scheduledFor, now time.Time
+		want              bool
+	}{
+		{"day before", dayBefore, dayBefore, true},
+		{"hour before", hourBefore, hourBefore.Add(time.Minute), true},
+		{"day before once hour before is due", dayBefore, hourBefore, false},
+		{"offset cafe dropped", visit.Add(-2 * time.Hour), visit.Add(-2 * time.Hour), false},
+		{"reservation moved", hourBefore.Add(-30 * time.Minute), hourBefore.Add(-30 * time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.WantsReminder(visit, tt.scheduledFor, tt.now); got != tt.want {
+			t.Errorf("%s: want %v; got %v", tt.name, tt.want, got)
+		}
+	}
+}
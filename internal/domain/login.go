@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrLoginThrottled = errors.New("domain: too many failed login attempts")
+
+// LoginFailures counts failed logins in a row of an account or of a client address
+type LoginFailures struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+func (f LoginFailures) IsLocked(now time.Time) bool {
+	return f.LockedUntil.After(now)
+}
+
+// LoginThrottledError tells when the next login attempt will be considered,
+// it matches ErrLoginThrottled with errors.Is
+type LoginThrottledError struct {
+	RetryAt time.Time
+	// Locked is true for lockout and false for a short delay between attempts
+	Locked bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry at %s", ErrLoginThrottled, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
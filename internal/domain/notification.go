@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownChannel = errors.New("domain: unknown notification channel")
+	ErrNoMobile       = errors.New("domain: mobile number is required for the channel")
+	ErrUnknownLocale  = errors.New("domain: unknown locale")
+	ErrUnknownTopic   = errors.New("domain: unknown notification topic")
+)
+
+// NotifyChannel is the way user prefers to get notifications
+type NotifyChannel string
+
+const (
+	NotifyEmail NotifyChannel = "email"
+	NotifySMS   NotifyChannel = "sms"
+	// NotifyWebhook hands messages over to messenger gateway, it finds recipient by mobile number
+	NotifyWebhook NotifyChannel = "webhook"
+)
+
+// NotifyChannels lists every channel in the order profile page shows them
+var NotifyChannels = []NotifyChannel{NotifyEmail, NotifySMS, NotifyWebhook}
+
+func (c NotifyChannel) IsValid() bool {
+	for _, channel := range NotifyChannels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsMobile tells whether recipient is addressed by mobile number rather than email
+func (c NotifyChannel) NeedsMobile() bool {
+	return c == NotifySMS || c == NotifyWebhook
+}
+
+// NotifyTopic groups messages user can subscribe to and unsubscribe from,
+// messages about the account or the booking itself are sent regardless
+type NotifyTopic string
+
+const (
+	TopicReminders NotifyTopic = "reminders"
+	TopicMarketing NotifyTopic = "marketing"
+	// TopicAnnouncements are news partners send to guests of their cafes
+	TopicAnnouncements NotifyTopic = "announcements"
+)
+
+// NotifyTopics lists every topic in the order profile page shows them
+var NotifyTopics = []NotifyTopic{TopicReminders, TopicMarketing, TopicAnnouncements}
+
+func (t NotifyTopic) IsValid() bool {
+	for _, topic := range NotifyTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (t NotifyTopic) Title() string {
+	switch t {
+	case TopicReminders:
+		return "Reservation reminders"
+	case TopicMarketing:
+		return "News and special offers"
+	case TopicAnnouncements:
+		return "Announcements of cafes"
+	}
+	return string(t)
+}
+
+// NotifyPreferences keeps channels user turned topics on or off for, choices user did not make are default
+type NotifyPreferences map[NotifyTopic]map[NotifyChannel]bool
+
+// Subscribed tells whether topic is on for the channel. Marketing is opt-in,
+// the other topics come by the channel user prefers until they choose otherwise
+func (p NotifyPreferences) Subscribed(topic NotifyTopic, channel, preferred NotifyChannel) bool {
+	if subscribed, ok := p[topic][channel]; ok {
+		return subscribed
+	}
+	return topic != TopicMarketing && channel == preferred
+}
+
+// Set records user's choice for topic and channel
+func (p NotifyPreferences) Set(topic NotifyTopic, channel NotifyChannel, subscribed bool) {
+	if p[topic] == nil {
+		p[topic] = map[NotifyChannel]bool{}
+	}
+	p[topic][channel] = subscribed
+}
+
+// Subscriber is whoever gets messages of a topic, guests without account are known by email only
+// and have UserID -1. Preferred is the channel messages actually go by when user made no choice
+type Subscriber struct {
+	UserID    int
+	Email     string
+	Preferred NotifyChannel
+}
+
+// Locale is the language notifications are written in
+type Locale string
+
+const (
+	LocaleEN Locale = "en"
+	LocaleRU Locale = "ru"
+	LocaleKK Locale = "kk"
+	// DefaultLocale is for guests without account and for admins
+	DefaultLocale = LocaleEN
+)
+
+// Locales lists every locale in the order profile page shows them
+var Locales = []Locale{LocaleEN, LocaleRU, LocaleKK}
+
+func (l Locale) IsValid() bool {
+	for _, locale := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationKind tells what outbox job delivers
+type NotificationKind string
+
+const NotificationReminder NotificationKind = "reminder"
+
+type NotificationStatus string
+
+const (
+	NotificationPending NotificationStatus = "pending"
+	NotificationSent    NotificationStatus = "sent"
+	// NotificationFailed job is out of attempts, it stays until admin retries it
+	NotificationFailed NotificationStatus = "failed"
+	// NotificationCancelled job is of reservation that is cancelled, moved or already passed by the time it is due
+	NotificationCancelled NotificationStatus = "cancelled"
+)
+
+// Notification is a job of the outbox, worker delivers it once NextAttemptAt comes
+type Notification struct {
+	ID            int
+	Kind          NotificationKind
+	Reservation   Reservation
+	ScheduledFor  time.Time // reminder's offset is how long before the reservation's date it is scheduled
+	Status        NotificationStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	Created       time.Time
+	SentAt        time.Time
+}
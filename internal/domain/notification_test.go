@@ -0,0 +1,29 @@
+package domain
+
+import "testing"
+
+func TestNotifyPreferencesSubscribed(t *testing.T) {
+	preferences := NotifyPreferences{}
+	preferences.Set(TopicReminders, NotifyEmail, false)
+	preferences.Set(TopicMarketing, NotifySMS, true)
+
+	tests := []struct {
+		topic   NotifyTopic
+		channel NotifyChannel
+		want    bool
+	}{
+		{TopicReminders, NotifyEmail, false},
+		{TopicReminders, NotifySMS, true},
+		{TopicReminders, NotifyWebhook, false},
+		{TopicMarketing, NotifySMS, true},
+		{TopicMarketing, NotifyEmail, false},
+		{TopicAnnouncements, NotifySMS, true},
+	}
+
+	// user prefers sms, topics without choice come by it except marketing
+	for _, tt := range tests {
+		if got := preferences.Subscribed(tt.topic, tt.channel, NotifySMS); got != tt.want {
+			t.Errorf("%s by %s: want %v; got %v", tt.topic, tt.channel, tt.want, got)
+		}
+	}
+}
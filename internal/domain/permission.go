@@ -0,0 +1,85 @@
+package domain
+
+import "errors"
+
+var ErrUnknownPermission = errors.New("domain: unknown permission")
+
+// Permission names an action that is not open to everyone, roles are granted permissions
+// in role_permissions table and handlers check permissions instead of roles
+type Permission string
+
+const (
+	PermissionCafeApprove       Permission = "cafe.approve"
+	PermissionRoleManage        Permission = "role.manage"
+	PermissionSecurityManage    Permission = "security.manage"
+	PermissionReservationView   Permission = "reservation.view"
+	PermissionReservationStatus Permission = "reservation.status"
+	PermissionReservationBook   Permission = "reservation.book"
+	PermissionReservationFree   Permission = "reservation.free"
+	PermissionBlacklistManage   Permission = "blacklist.manage"
+	PermissionCafeSettings      Permission = "cafe.settings"
+	PermissionWaitlistManage    Permission = "waitlist.manage"
+	PermissionStaffManage       Permission = "staff.manage"
+	PermissionAuditView         Permission = "audit.view"
+	PermissionCafeAudit         Permission = "cafe.audit"
+	PermissionNotificationRetry Permission = "notification.retry"
+)
+
+// names of roles created by the schema, sign up and approved collaboration request grant them
+const (
+	RoleUser    = "user"
+	RolePartner = "partner"
+)
+
+type PermissionInfo struct {
+	Name        Permission
+	Description string
+}
+
+// Permissions lists every permission in the order admin screens show them
+var Permissions = []PermissionInfo{
+	{PermissionCafeApprove, "Approve and decline collaboration requests"},
+	{PermissionRoleManage, "Assign roles to users and change permissions of roles"},
+	{PermissionSecurityManage, "Require two-factor authentication and unlock accounts"},
+	{PermissionReservationView, "See reservations of own cafe"},
+	{PermissionReservationStatus, "Mark guests of own cafe as seated, completed or no-show"},
+	{PermissionReservationBook, "Mark tables of own cafe as busy"},
+	{PermissionReservationFree, "Free tables of own cafe"},
+	{PermissionBlacklistManage, "Report guests of own cafe"},
+	{PermissionCafeSettings, "Change opening hours, booking rules and joinable tables of own cafe"},
+	{PermissionWaitlistManage, "Manage waitlist of own cafe"},
+	{PermissionStaffManage, "Invite and remove staff of own cafe"},
+	{PermissionAuditView, "See audit log of the whole site"},
+	{PermissionCafeAudit, "See audit log of own cafe"},
+	{PermissionNotificationRetry, "See notifications that failed to deliver and send them again"},
+}
+
+// AdminPermissions open admin panel, PartnerPermissions open cafe's panel
+var (
+	AdminPermissions = []Permission{PermissionCafeApprove, PermissionRoleManage, PermissionSecurityManage,
+		PermissionAuditView, PermissionNotificationRetry}
+	PartnerPermissions = []Permission{PermissionReservationView, PermissionReservationStatus, PermissionReservationBook,
+		PermissionReservationFree, PermissionBlacklistManage, PermissionCafeSettings, PermissionWaitlistManage,
+		PermissionStaffManage, PermissionCafeAudit}
+)
+
+func IsKnownPermission(p Permission) bool {
+	for _, info := range Permissions {
+		if info.Name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Can tells whether the role was granted at least one of permissions
+func (r Role) Can(permissions ...Permission) bool {
+	for _, p := range permissions {
+		for _, granted := range r.Permissions {
+			if granted == p {
+				return true
+			}
+		}
+	}
+	return false
+}
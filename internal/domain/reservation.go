@@ -2,6 +2,8 @@ package domain
 
 import (
 	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,42 @@ type ReservationHandler interface {
 	ReservationPage(c *gin.Context)
 }
 
+type ReservationStatus string
+
+const (
+	StatusPending   ReservationStatus = "pending"
+	StatusConfirmed ReservationStatus = "confirmed"
+	StatusSeated    ReservationStatus = "seated"
+	StatusCompleted ReservationStatus = "completed"
+	StatusCancelled ReservationStatus = "cancelled"
+	StatusNoShow    ReservationStatus = "no_show"
+)
+
+// SeatingGrace is how long before the start guest may be seated, e.g. when they come early and the table is free
+const SeatingGrace = 30 * time.Minute
+
+// reservationTransitions lists statuses that reservation can move to,
+// completed, cancelled and no_show are final
+var reservationTransitions = map[ReservationStatus][]ReservationStatus{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusSeated, StatusNoShow, StatusCancelled},
+	StatusSeated:    {StatusCompleted},
+}
+
+func (s ReservationStatus) CanBecome(next ReservationStatus) bool {
+	for _, status := range reservationTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OccupiesTable tells whether reservation in this status keeps its table busy
+func (s ReservationStatus) OccupiesTable() bool {
+	return s == StatusPending || s == StatusConfirmed || s == StatusSeated
+}
+
 type Reservation struct {
 	ID                      int
 	PartySize               int
@@ -19,9 +57,13 @@ type Reservation struct {
 	CustEmail               string
 	EventDescription        string
 	Date                    time.Time
-	NotifyDate              time.Time
+	EndDate                 time.Time // table is occupied from Date until EndDate
+	Status                  ReservationStatus
+	CancelledAt             time.Time
+	GuestConfirmedAt        time.Time // guest replied to reminder that they are coming
 	Cafe                    Cafe
 	Table                   Table
+	JoinedTables            []Table // other tables put together with Table for a large party
 	Event                   Event
 	User                    User
 	HoursUntilReservation   int  // not in db
@@ -33,6 +75,49 @@ func NewReservation() *Reservation {
 	return &Reservation{}
 }
 
+// IsChangeable tells whether guest can still cancel or reschedule the reservation
+func (r *Reservation) IsChangeable() bool {
+	return (r.Status == StatusPending || r.Status == StatusConfirmed) && r.Date.After(time.Now())
+}
+
+// TableNumbers lists every table of the reservation, e.g. "3 + 4" for joined tables
+func (r *Reservation) TableNumbers() string {
+	numbers := []string{strconv.Itoa(r.Table.ID)}
+	for _, t := range r.JoinedTables {
+		numbers = append(numbers, strconv.Itoa(t.ID))
+	}
+	return strings.Join(numbers, " + ")
+}
+
+// CanBecome checks the transition and whether it is time for it,
+// guest is seated at the earliest SeatingGrace before the start and can not miss reservation before it starts
+func (r *Reservation) CanBecome(next ReservationStatus, now time.Time) bool {
+	if !r.Status.CanBecome(next) {
+		return false
+	}
+
+	switch next {
+	case StatusSeated:
+		return !now.Before(r.Date.Add(-SeatingGrace))
+	case StatusNoShow:
+		return !now.Before(r.Date)
+	}
+	return true
+}
+
+// NextStatuses are offered to partner as actions on reservation
+func (r *Reservation) NextStatuses() []ReservationStatus {
+	now := time.Now()
+
+	var next []ReservationStatus
+	for _, status := range reservationTransitions[r.Status] {
+		if r.CanBecome(status, now) {
+			next = append(next, status)
+		}
+	}
+	return next
+}
+
 //just for benchmarks
 func (r *Reservation) Reset() {
 	r.ID = 0
@@ -42,9 +127,13 @@ func (r *Reservation) Reset() {
 	r.CustEmail = ""
 	r.EventDescription = ""
 	r.Date = time.Time{}
-	r.NotifyDate = time.Time{}
+	r.EndDate = time.Time{}
+	r.Status = ""
+	r.CancelledAt = time.Time{}
+	r.GuestConfirmedAt = time.Time{}
 	r.Cafe = Cafe{}
 	r.Table = Table{}
+	r.JoinedTables = nil
 	r.Event = Event{}
 	r.User = User{}
 	r.User.Role = Role{}
@@ -59,3 +148,44 @@ type Table struct {
 func NewTable() *Table {
 	return &Table{}
 }
+
+// TableJoin is a pair of tables of the same location,
+// partner marks pairs that can be put together for a large party
+type TableJoin struct {
+	Table       Table // the one with smaller ID
+	JoinedTable Table
+	IsJoined    bool
+}
+
+// TableCombination is a set of joinable tables booked as a single reservation
+type TableCombination struct {
+	Tables []Table
+}
+
+func (c TableCombination) Capacity() int {
+	capacity := 0
+	for _, t := range c.Tables {
+		capacity += t.Capacity
+	}
+	return capacity
+}
+
+// Value identifies combination in html forms, e.g. "3,4"
+func (c TableCombination) Value() string {
+	ids := make([]string, 0, len(c.Tables))
+	for _, t := range c.Tables {
+		ids = append(ids, strconv.Itoa(t.ID))
+	}
+	return strings.Join(ids, ",")
+}
+
+// TableHold keeps tables for a guest filling in the confirmation form,
+// availability searches treat held tables as busy until the hold expires
+type TableHold struct {
+	ID        int
+	CafeID    int
+	Tables    []Table
+	Start     time.Time
+	End       time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReservationStatusCanBecome(t *testing.T) {
+	tests := []struct {
+		from, to ReservationStatus
+		want     bool
+	}{
+		{StatusPending, StatusConfirmed, true},
+		{StatusPending, StatusSeated, false},
+		{StatusConfirmed, StatusSeated, true},
+		{StatusConfirmed, StatusNoShow, true},
+		{StatusConfirmed, StatusCancelled, true},
+		{StatusConfirmed, StatusCompleted, false},
+		{StatusSeated, StatusCompleted, true},
+		{StatusSeated, StatusCancelled, false},
+		{StatusCompleted, StatusSeated, false},
+		{StatusCancelled, StatusConfirmed, false},
+		{StatusNoShow, StatusSeated, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.CanBecome(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: want %v; got %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
+
+func TestReservationCanBecome(t *testing.T) {
+	start := time.Date(2021, 5, 10, 19, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		to   ReservationStatus
+		want bool
+	}{
+		{"seated hours before", start.Add(-3 * time.Hour), StatusSeated, false},
+		{"seated within grace", start.Add(-SeatingGrace), StatusSeated, true},
+		{"seated late", start.Add(20 * time.Minute), StatusSeated, true},
+		{"no-show before start", start.Add(-time.Minute), StatusNoShow, false},
+		{"no-show after start", start.Add(15 * time.Minute), StatusNoShow, true},
+		{"cancelled before start", start.Add(-24 * time.Hour), StatusCancelled, true},
+	}
+
+	for _, tt := range tests {
+		r := &Reservation{Status: StatusConfirmed, Date: start}
+		if got := r.CanBecome(tt.to, tt.now); got != tt.want {
+			t.Errorf("%s: want %v; got %v", tt.name, tt.want, got)
+		}
+	}
+
+	r := &Reservation{Status: StatusConfirmed, Date: time.Now().Add(24 * time.Hour)}
+	for _, next := range r.NextStatuses() {
+		if next == StatusSeated || next == StatusNoShow {
+			t.Errorf("want %s not offered for tomorrow's reservation", next)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package domain
+
+import "time"
+
+// StaffRole is the position of user in a cafe, partner routes let in only permissions
+// that both user's role and staff role in the selected cafe grant
+type StaffRole string
+
+const (
+	StaffOwner   StaffRole = "owner"
+	StaffManager StaffRole = "manager"
+	StaffHost    StaffRole = "host"
+)
+
+// StaffRoles lists positions in the order staff screens show them
+var StaffRoles = []StaffRole{StaffOwner, StaffManager, StaffHost}
+
+var staffPermissions = map[StaffRole][]Permission{
+	StaffOwner: PartnerPermissions,
+	StaffManager: {PermissionReservationView, PermissionReservationStatus, PermissionReservationBook,
+		PermissionReservationFree, PermissionBlacklistManage, PermissionCafeSettings, PermissionWaitlistManage,
+		PermissionCafeAudit},
+	StaffHost: {PermissionReservationView, PermissionReservationStatus, PermissionReservationBook,
+		PermissionReservationFree, PermissionWaitlistManage},
+}
+
+func (r StaffRole) IsValid() bool {
+	_, ok := staffPermissions[r]
+	return ok
+}
+
+func (r StaffRole) Can(permissions ...Permission) bool {
+	return Role{Permissions: staffPermissions[r]}.Can(permissions...)
+}
+
+// CafeMember is user who works at the cafe
+type CafeMember struct {
+	Cafe    Cafe
+	User    User
+	Role    StaffRole
+	Created time.Time
+}
+
+// Can tells whether member may do any of permissions in the cafe
+func (m CafeMember) Can(permissions ...Permission) bool {
+	for _, p := range permissions {
+		if m.User.Role.Can(p) && m.Role.Can(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize fails with ErrAccessDenied unless thing of cafeID belongs to member's cafe
+// and member may do any of permissions there. Partner operations go through it,
+// so that ids coming from requests never reach another cafe
+func (m CafeMember) Authorize(cafeID int, permissions ...Permission) error {
+	if m.Cafe.ID != cafeID || !m.Can(permissions...) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// StaffInvite is emailed by cafe owner, the user with the email becomes staff once they follow the link
+type StaffInvite struct {
+	ID         int
+	Cafe       Cafe
+	Email      string
+	Role       StaffRole
+	Hash       []byte
+	InvitedBy  int
+	ExpiresAt  time.Time
+	AcceptedAt *time.Time
+	Created    time.Time
+}
+
+func (i *StaffInvite) IsActive(now time.Time) bool {
+	return i.AcceptedAt == nil && now.Before(i.ExpiresAt)
+}
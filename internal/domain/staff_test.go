@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCafeMemberCan(t *testing.T) {
+	partner := User{Role: Role{Permissions: PartnerPermissions}}
+	viewer := User{Role: Role{Permissions: []Permission{PermissionReservationView}}}
+
+	tests := []struct {
+		member     CafeMember
+		permission Permission
+		want       bool
+	}{
+		{CafeMember{User: partner, Role: StaffOwner}, PermissionStaffManage, true},
+		{CafeMember{User: partner, Role: StaffManager}, PermissionStaffManage, false},
+		{CafeMember{User: partner, Role: StaffManager}, PermissionCafeSettings, true},
+		{CafeMember{User: partner, Role: StaffHost}, PermissionCafeSettings, false},
+		{CafeMember{User: partner, Role: StaffHost}, PermissionReservationStatus, true},
+		{CafeMember{User: viewer, Role: StaffOwner}, PermissionReservationStatus, false},
+		{CafeMember{User: viewer, Role: StaffHost}, PermissionReservationView, true},
+		{CafeMember{User: partner, Role: StaffRole("cook")}, PermissionReservationView, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.member.Can(tt.permission); got != tt.want {
+			t.Errorf("%s with %v: %s want %v; got %v", tt.member.Role, tt.member.User.Role.Permissions,
+				tt.permission, tt.want, got)
+		}
+	}
+}
+
+func TestCafeMemberAuthorize(t *testing.T) {
+	host := CafeMember{Cafe: Cafe{ID: 1}, User: User{Role: Role{Permissions: PartnerPermissions}}, Role: StaffHost}
+
+	if err := host.Authorize(1, PermissionReservationBook); err != nil {
+		t.Errorf("want host to book tables of own cafe; got %v", err)
+	}
+	if err := host.Authorize(2, PermissionReservationBook); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("want tables of another cafe to be denied; got %v", err)
+	}
+	if err := host.Authorize(1, PermissionBlacklistManage); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("want host not to manage blacklist; got %v", err)
+	}
+}
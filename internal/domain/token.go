@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// RefreshToken is stored only as a hash, the token itself is known to the client alone
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	Hash      []byte
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	Created   time.Time
+}
+
+func (t *RefreshToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// TokenPair is issued to api clients that can not keep cookie session,
+// short-lived access token is exchanged for a new pair with refresh token
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// PasswordReset is a one-time link sent to user's email, stored only as a hash like refresh tokens
+type PasswordReset struct {
+	ID        int
+	UserID    int
+	Hash      []byte
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	Created   time.Time
+}
+
+func (r *PasswordReset) IsActive(now time.Time) bool {
+	return r.UsedAt == nil && now.Before(r.ExpiresAt)
+}
+
+// Session is server side state of browser session, the cookie holds only a random token
+// and the token is stored as a hash like refresh tokens
+type Session struct {
+	ID     int
+	Hash   []byte
+	UserID int // 0 until guest logs in
+	// Data is encoded values of session, only http handlers know what is inside
+	Data       []byte
+	IP         string
+	UserAgent  string
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Created    time.Time
+}
@@ -10,6 +10,15 @@ var (
 	ErrNoRecord           = errors.New("domain: no matching record found")
 	ErrInvalidCredentials = errors.New("domain: invalid credentials")
 	ErrDuplicateEmail     = errors.New("domain: duplicate email")
+	ErrBookingNotAllowed  = errors.New("domain: booking is not allowed by cafe policy")
+	ErrNotChangeable      = errors.New("domain: reservation can not be changed")
+	ErrInvalidTransition  = errors.New("domain: invalid reservation status transition")
+	ErrNoAvailableTables  = errors.New("domain: no available tables")
+	ErrTableTaken         = errors.New("domain: table is already taken for this time")
+	ErrAccessDenied       = errors.New("domain: access denied")
+	ErrOfferExpired       = errors.New("domain: waitlist offer has expired")
+	ErrInvalidToken       = errors.New("domain: invalid or expired token")
+	ErrInvalidCode        = errors.New("domain: invalid one-time code")
 )
 
 type UserHandler interface {
@@ -30,13 +39,56 @@ type User struct {
 	Password []byte    `json:"password"`
 	Created  time.Time `json:"created"`
 	Role     Role      `json:"role"`
+	// EmailVerifiedAt is zero until user follows the link sent to the email
+	EmailVerifiedAt time.Time `json:"-"`
+	// SessionsRevokedAt invalidates sessions and access tokens issued before it, e.g. after password reset
+	SessionsRevokedAt time.Time `json:"-"`
+	// TOTPSecret is set on enrolment and stays unconfirmed until TOTPEnabledAt is set
+	TOTPSecret    string    `json:"-"`
+	TOTPEnabledAt time.Time `json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, it can not be used twice
+	TOTPLastStep  int64         `json:"-"`
+	LoginFailures LoginFailures `json:"-"`
+	NotifyChannel NotifyChannel `json:"notifyChannel"`
+	Locale        Locale        `json:"locale"`
+
+	// NotifyPreferences are loaded for the profile page only
+	NotifyPreferences NotifyPreferences `json:"-"`
 }
 
 func NewUser() *User {
 	return &User{}
 }
 
+func (u *User) IsEmailVerified() bool {
+	return !u.EmailVerifiedAt.IsZero()
+}
+
+// Subscribed tells whether user gets messages of the topic by the channel
+func (u *User) Subscribed(topic NotifyTopic, channel NotifyChannel) bool {
+	return u.NotifyPreferences.Subscribed(topic, channel, u.NotifyChannel)
+}
+
+func (u *User) IsTwoFactorEnabled() bool {
+	return !u.TOTPEnabledAt.IsZero()
+}
+
+// MustEnrollTwoFactor is true when user's role requires second factor that user has not set up yet
+func (u *User) MustEnrollTwoFactor() bool {
+	return u.Role.RequireTwoFactor && !u.IsTwoFactorEnabled()
+}
+
 type Role struct {
-	ID   int
-	Name string
+	ID               int
+	Name             string
+	RequireTwoFactor bool
+	Permissions      []Permission
+}
+
+// TOTPEnrollment is what user needs to add the account to authenticator app
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+	// QRCode is png image of URI
+	QRCode []byte
 }
@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting   WaitlistStatus = "waiting"
+	WaitlistOffered   WaitlistStatus = "offered"
+	WaitlistClaimed   WaitlistStatus = "claimed"
+	WaitlistExpired   WaitlistStatus = "expired"
+	WaitlistCancelled WaitlistStatus = "cancelled"
+)
+
+// WaitlistEntry is a guest waiting for a table in a cafe,
+// any table of the location seating the party and starting between WindowStart and WindowEnd suits them
+type WaitlistEntry struct {
+	ID          int
+	PartySize   int
+	CustName    string
+	CustMobile  string
+	CustEmail   string
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Status      WaitlistStatus
+	Created     time.Time
+	Cafe        Cafe
+	Location    Location
+	User        User
+	// Reservation is offered to the guest as pending until OfferExpiresAt,
+	// so that nobody else takes its tables meanwhile
+	Reservation    Reservation
+	OfferExpiresAt time.Time
+}
+
+// IsOfferOpen tells whether guest can still claim the offered reservation
+func (e *WaitlistEntry) IsOfferOpen() bool {
+	return e.Status == WaitlistOffered && time.Now().Before(e.OfferExpiresAt)
+}
@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type audit struct {
+	db *pgxpool.Pool
+}
+
+func NewAudit(db *pgxpool.Pool) *audit {
+	return &audit{db: db}
+}
+
+// auditJSON returns empty string for empty data, so that it is stored as null
+func auditJSON(data domain.AuditData) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal audit data")
+	}
+	return string(b), nil
+}
+
+func (a *audit) Insert(entry *domain.AuditEntry) error {
+	before, err := auditJSON(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditJSON(entry.After)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO audit_log (actor_id, action, target_type, target_id, cafe_id, before, after, ip)
+			VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7::jsonb, $8) RETURNING id, created`
+
+	cafeID := sql.NullInt32{Int32: int32(entry.CafeID), Valid: entry.CafeID != 0}
+	err = a.db.QueryRow(context.Background(), query, entry.Actor.ID, entry.Action, entry.TargetType, entry.TargetID,
+		cafeID, newNullString(before), newNullString(after), entry.IP).Scan(&entry.ID, &entry.Created)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert audit entry")
+	}
+
+	return nil
+}
+
+// Find returns entries matching filter, the latest first
+func (a *audit) Find(filter domain.AuditFilter) ([]domain.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Action != "" {
+		where("a.action = $%d", filter.Action)
+	}
+	if filter.ActorEmail != "" {
+		where("lower(u.email) = lower($%d)", filter.ActorEmail)
+	}
+	if filter.CafeID != 0 {
+		where("a.cafe_id = $%d", filter.CafeID)
+	}
+	if !filter.From.IsZero() {
+		where("a.created >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("a.created < $%d", filter.To)
+	}
+
+	query := `SELECT a.id, a.actor_id, coalesce(u.name, ''), coalesce(u.email, ''), a.action, a.target_type,
+			a.target_id, a.cafe_id, a.before, a.after, a.ip, a.created
+			FROM audit_log a left join users u on a.actor_id = u.id`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " and ")
+	}
+	query += ` ORDER BY a.created DESC, a.id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	rows, err := a.db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []domain.AuditEntry
+	for rows.Next() {
+		var e domain.AuditEntry
+		var cafeID sql.NullInt32
+		var before, after []byte
+		err = rows.Scan(&e.ID, &e.Actor.ID, &e.Actor.Name, &e.Actor.Email, &e.Action, &e.TargetType,
+			&e.TargetID, &cafeID, &before, &after, &e.IP, &e.Created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		e.CafeID = int(cafeID.Int32)
+		if e.Before, err = parseAuditData(before); err != nil {
+			return nil, err
+		}
+		if e.After, err = parseAuditData(after); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseAuditData(b []byte) (domain.AuditData, error) {
+	if b == nil {
+		return nil, nil
+	}
+	var data domain.AuditData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal audit data")
+	}
+	return data, nil
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+func TestAuditLogAppendOnly(t *testing.T) {
+	pool := testPool(t)
+	repo := NewAudit(pool)
+
+	entry := &domain.AuditEntry{
+		Actor:      domain.User{ID: 1},
+		Action:     domain.AuditTableBusy,
+		TargetType: domain.AuditTargetTable,
+		TargetID:   1,
+		CafeID:     1,
+		After:      domain.AuditData{"date": "2021-06-04", "time": "19:00"},
+		IP:         "127.0.0.1",
+	}
+	if err := repo.Insert(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pool.Exec(context.Background(), `UPDATE audit_log SET ip = '' WHERE id = $1`, entry.ID); err == nil {
+		t.Error("want audit entry not to be updated")
+	}
+	if _, err := pool.Exec(context.Background(), `DELETE FROM audit_log WHERE id = $1`, entry.ID); err == nil {
+		t.Error("want audit entry not to be deleted")
+	}
+
+	entries, err := repo.Find(domain.AuditFilter{Action: domain.AuditTableBusy, CafeID: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != entry.ID || entries[0].After["time"] != "19:00" || entries[0].Before != nil {
+		t.Errorf("want the entry just written; got %+v", entries)
+	}
+}
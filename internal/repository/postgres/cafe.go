@@ -105,7 +105,7 @@ func (c *cafe) FindEvents() ([]domain.Event, error) {
 }
 
 func (c *cafe) FindCities() ([]domain.City, error) {
-	query := `SELECT * FROM cities`
+	query := `SELECT id, name, time_zone FROM cities`
 
 	rows, err := c.db.Query(context.Background(), query)
 	if err != nil {
@@ -117,7 +117,7 @@ func (c *cafe) FindCities() ([]domain.City, error) {
 
 	for rows.Next() {
 		c := citiesPool.Get().(*domain.City)
-		err = rows.Scan(&c.ID, &c.Name)
+		err = rows.Scan(&c.ID, &c.Name, &c.TimeZone)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to assign values to type struct from row")
 		}
@@ -317,9 +317,16 @@ func (c *cafe) FindCollabRequests() ([]domain.Cafe, error) {
 	return cc, nil
 }
 
+// ApproveByID also makes the partner who sent the request owner of the cafe
 func (c *cafe) ApproveByID(cafeID int) error {
+	tx, err := c.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
 	query := `update cafes set status = true where id = $1`
-	_, err := c.db.Exec(context.Background(), query, cafeID)
+	_, err = tx.Exec(context.Background(), query, cafeID)
 	if err != nil {
 		if err.Error() == "no rows in result set" {
 			return domain.ErrInvalidCredentials
@@ -327,13 +334,42 @@ func (c *cafe) ApproveByID(cafeID int) error {
 		return errors.Wrap(err, "failed to update cafe status")
 	}
 
+	query = `INSERT INTO cafe_members (cafe_id, user_id, role)
+			SELECT id, admin_id, 'owner' FROM cafes WHERE id = $1 and admin_id is not null
+			ON CONFLICT (cafe_id, user_id) DO UPDATE SET role = excluded.role`
+	if _, err = tx.Exec(context.Background(), query, cafeID); err != nil {
+		return errors.Wrap(err, "inserting owner of cafe")
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing cafe approval")
+	}
+
 	return nil
 }
 
 func (c *cafe) DeleteByID(cafeID int) error {
 
-	query := `DELETE from tables where cafe_id = $1`
+	query := `DELETE from cafe_opening_hours where cafe_id = $1`
 	_, err := c.db.Exec(context.Background(), query, cafeID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete cafe")
+	}
+
+	query = `DELETE from cafe_policies where cafe_id = $1`
+	_, err = c.db.Exec(context.Background(), query, cafeID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete cafe")
+	}
+
+	query = `DELETE from table_joins where cafe_id = $1`
+	_, err = c.db.Exec(context.Background(), query, cafeID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete cafe")
+	}
+
+	query = `DELETE from tables where cafe_id = $1`
+	_, err = c.db.Exec(context.Background(), query, cafeID)
 	if err != nil {
 		if err.Error() == "no rows in result set" {
 			return domain.ErrInvalidCredentials
@@ -371,20 +407,219 @@ func (c *cafe) DeleteByID(cafeID int) error {
 	return nil
 }
 
-func (c *cafe) QueryCafeIDByAdminID(adminID int) (int, error) {
-	query := `SELECT id FROM cafes WHERE admin_id = $1`
+func (c *cafe) FindBookingPolicy(cafeID int) (*domain.BookingPolicy, error) {
+	return queryBookingPolicy(c.db, cafeID)
+}
+
+func (c *cafe) UpdateBookingPolicy(policy *domain.BookingPolicy) error {
+	tx, err := c.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
 
-	var cafeID int
+	offsets := make([]int32, len(policy.ReminderOffsets))
+	for i, minutes := range policy.ReminderOffsets {
+		offsets[i] = int32(minutes)
+	}
 
-	err := c.db.QueryRow(context.Background(), query, adminID).
-		Scan(&cafeID)
+	query := `INSERT INTO cafe_policies (cafe_id, reservation_interval, max_days_in_advance, max_party_size,
+		reminder_offsets)
+	VALUES($1, $2, $3, $4, $5)
+	ON CONFLICT (cafe_id) DO UPDATE SET reservation_interval = $2, max_days_in_advance = $3, max_party_size = $4,
+		reminder_offsets = $5`
+	_, err = tx.Exec(context.Background(), query, policy.CafeID, policy.ReservationInterval,
+		policy.MaxDaysInAdvance, policy.MaxPartySize, offsets)
+	if err != nil {
+		return errors.Wrap(err, "upserting cafe policy")
+	}
+
+	query = `DELETE FROM cafe_opening_hours WHERE cafe_id = $1`
+	if _, err = tx.Exec(context.Background(), query, policy.CafeID); err != nil {
+		return errors.Wrap(err, "deleting opening hours")
+	}
+
+	query = `INSERT INTO cafe_opening_hours (cafe_id, weekday, opens_at, closes_at)
+	VALUES($1, $2, $3, $4)`
+	for _, h := range policy.OpeningHours {
+		if h.IsClosed {
+			continue
+		}
+		_, err = tx.Exec(context.Background(), query, policy.CafeID, int(h.Weekday), h.OpensAt, h.ClosesAt)
+		if err != nil {
+			return errors.Wrap(err, "inserting opening hours")
+		}
+	}
+
+	if err = scheduleCafeReminders(tx, policy.CafeID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing cafe policy")
+	}
+
+	return nil
+}
+
+// queryBookingPolicy is shared by cafe and reservation repositories,
+// cafes without stored policy get the default one in their city's time zone
+func queryBookingPolicy(db *pgxpool.Pool, cafeID int) (*domain.BookingPolicy, error) {
+	query := `SELECT ci.time_zone FROM cafes c JOIN cities ci ON c.city_id = ci.id WHERE c.id = $1`
+
+	var city domain.City
+	err := db.QueryRow(context.Background(), query, cafeID).Scan(&city.TimeZone)
 	if err != nil {
 		if err.Error() == "no rows in result set" {
-			return -1, domain.ErrNoRecord
-		} else {
-			return -1, errors.Wrap(err, "failed to make select statement")
+			return nil, domain.ErrNoRecord
 		}
+		return nil, errors.Wrap(err, "failed to select cafe time zone")
+	}
+	loc, err := city.Location()
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading time zone of cafe %d", cafeID)
+	}
+
+	query = `SELECT reservation_interval, max_days_in_advance, max_party_size, reminder_offsets
+			FROM cafe_policies WHERE cafe_id = $1`
+
+	policy := &domain.BookingPolicy{CafeID: cafeID, Location: loc}
+	var offsets []int32
+	err = db.QueryRow(context.Background(), query, cafeID).
+		Scan(&policy.ReservationInterval, &policy.MaxDaysInAdvance, &policy.MaxPartySize, &offsets)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			policy = domain.DefaultBookingPolicy(cafeID)
+			policy.Location = loc
+			return policy, nil
+		}
+		return nil, errors.Wrap(err, "failed to select cafe policy")
+	}
+	for _, minutes := range offsets {
+		policy.ReminderOffsets = append(policy.ReminderOffsets, int(minutes))
+	}
+
+	query = `SELECT weekday, opens_at, closes_at FROM cafe_opening_hours WHERE cafe_id = $1`
+
+	rows, err := db.Query(context.Background(), query, cafeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	open := make(map[time.Weekday]domain.OpeningHours)
+	for rows.Next() {
+		var h domain.OpeningHours
+		var weekday int
+		err = rows.Scan(&weekday, &h.OpensAt, &h.ClosesAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to assign values to opening hours struct from row")
+		}
+		h.Weekday = time.Weekday(weekday)
+		open[h.Weekday] = h
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		h, ok := open[day]
+		if !ok {
+			h = domain.OpeningHours{Weekday: day, IsClosed: true}
+		}
+		policy.OpeningHours = append(policy.OpeningHours, h)
+	}
+
+	return policy, nil
+}
+
+func (c *cafe) FindTables(cafeID int) ([]domain.Table, error) {
+	query := `SELECT t.id, t.capacity, t.location_id, l.name FROM tables t
+			JOIN locations l on t.location_id = l.id
+			WHERE t.cafe_id = $1 ORDER BY t.location_id, t.id`
+
+	rows, err := c.db.Query(context.Background(), query, cafeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tt []domain.Table
+
+	for rows.Next() {
+		t := tablesPool.Get().(*domain.Table)
+		err = rows.Scan(&t.ID, &t.Capacity, &t.Location.ID, &t.Location.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to assign values to table struct from row")
+		}
+		tt = append(tt, *t)
+
+		*t = domain.Table{}
+		tablesPool.Put(t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tt, nil
+}
+
+func (c *cafe) FindTableJoins(cafeID int) ([]domain.TableJoin, error) {
+	return queryTableJoins(c.db, cafeID)
+}
+
+// UpdateTableJoins replaces all joins of the cafe's tables
+func (c *cafe) UpdateTableJoins(cafeID int, joins []domain.TableJoin) error {
+	tx, err := c.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `DELETE FROM table_joins WHERE cafe_id = $1`
+	if _, err = tx.Exec(context.Background(), query, cafeID); err != nil {
+		return errors.Wrap(err, "deleting table joins")
+	}
+
+	query = `INSERT INTO table_joins (cafe_id, table_id, joined_table_id) VALUES($1, $2, $3)`
+	for _, j := range joins {
+		_, err = tx.Exec(context.Background(), query, cafeID, j.Table.ID, j.JoinedTable.ID)
+		if err != nil {
+			return errors.Wrap(err, "inserting table join")
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing table joins")
+	}
+
+	return nil
+}
+
+// queryTableJoins is shared by cafe and reservation repositories
+func queryTableJoins(db *pgxpool.Pool, cafeID int) ([]domain.TableJoin, error) {
+	query := `SELECT table_id, joined_table_id FROM table_joins WHERE cafe_id = $1
+			ORDER BY table_id, joined_table_id`
+
+	rows, err := db.Query(context.Background(), query, cafeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jj []domain.TableJoin
+
+	for rows.Next() {
+		j := domain.TableJoin{IsJoined: true}
+		err = rows.Scan(&j.Table.ID, &j.JoinedTable.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to assign values to table join struct from row")
+		}
+		jj = append(jj, j)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return cafeID, nil
+	return jj, nil
 }
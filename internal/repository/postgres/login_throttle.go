@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type loginThrottle struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginThrottle(db *pgxpool.Pool) *loginThrottle {
+	return &loginThrottle{db: db}
+}
+
+// GetIPFailures returns zero counters for addresses without recent failures
+func (l *loginThrottle) GetIPFailures(ip string) (*domain.LoginFailures, error) {
+	query := `SELECT failures, last_failure_at, locked_until FROM login_ip_failures WHERE ip = $1`
+
+	f := &domain.LoginFailures{}
+	var lockedUntil sql.NullTime
+
+	err := l.db.QueryRow(context.Background(), query, ip).Scan(&f.Failures, &f.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return f, nil
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	f.LockedUntil = lockedUntil.Time
+
+	return f, nil
+}
+
+// RecordAccountFailure increments the counter in one statement, so that concurrent attempts
+// on different app instances are all counted; failures before windowStart are forgotten
+func (l *loginThrottle) RecordAccountFailure(userID int, now, windowStart time.Time) (*domain.LoginFailures, error) {
+	query := `UPDATE users SET
+			failed_logins = case when last_failed_login_at is null or last_failed_login_at < $3
+				then 1 else failed_logins + 1 end,
+			last_failed_login_at = $2
+			WHERE id = $1 RETURNING failed_logins, last_failed_login_at, locked_until`
+
+	return l.record(query, userID, now, windowStart)
+}
+
+func (l *loginThrottle) RecordIPFailure(ip string, now, windowStart time.Time) (*domain.LoginFailures, error) {
+	query := `INSERT INTO login_ip_failures (ip, failures, last_failure_at) VALUES($1, 1, $2)
+			ON CONFLICT (ip) DO UPDATE SET
+			failures = case when login_ip_failures.last_failure_at < $3
+				then 1 else login_ip_failures.failures + 1 end,
+			last_failure_at = $2
+			RETURNING failures, last_failure_at, locked_until`
+
+	return l.record(query, ip, now, windowStart)
+}
+
+func (l *loginThrottle) record(query string, key interface{}, now, windowStart time.Time) (*domain.LoginFailures, error) {
+	f := &domain.LoginFailures{}
+	var lockedUntil sql.NullTime
+
+	err := l.db.QueryRow(context.Background(), query, key, now, windowStart).
+		Scan(&f.Failures, &f.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, errors.Wrap(err, "recording login failure")
+	}
+	f.LockedUntil = lockedUntil.Time
+
+	return f, nil
+}
+
+func (l *loginThrottle) LockAccount(userID int, until time.Time) error {
+	query := `UPDATE users SET locked_until = $2 WHERE id = $1`
+
+	if _, err := l.db.Exec(context.Background(), query, userID, until); err != nil {
+		return errors.Wrap(err, "locking account")
+	}
+
+	return nil
+}
+
+func (l *loginThrottle) LockIP(ip string, until time.Time) error {
+	query := `UPDATE login_ip_failures SET locked_until = $2 WHERE ip = $1`
+
+	if _, err := l.db.Exec(context.Background(), query, ip, until); err != nil {
+		return errors.Wrap(err, "locking address")
+	}
+
+	return nil
+}
+
+// ResetAccount forgets failures and lifts the lock
+func (l *loginThrottle) ResetAccount(userID int) error {
+	query := `UPDATE users SET failed_logins = 0, locked_until = null WHERE id = $1`
+
+	tag, err := l.db.Exec(context.Background(), query, userID)
+	if err != nil {
+		return errors.Wrap(err, "resetting login failures")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (l *loginThrottle) GetLockedUsers(now time.Time) ([]domain.User, error) {
+	query := `SELECT id, name, email, failed_logins, last_failed_login_at, locked_until
+			FROM users WHERE locked_until > $1 ORDER BY locked_until`
+
+	rows, err := l.db.Query(context.Background(), query, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	for rows.Next() {
+		var u domain.User
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.LoginFailures.Failures,
+			&u.LoginFailures.LastFailureAt, &u.LoginFailures.LockedUntil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan locked user: %v", err)
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteIPFailuresBefore removes counters of addresses that are quiet since before and are not locked
+func (l *loginThrottle) DeleteIPFailuresBefore(before time.Time) (int64, error) {
+	query := `DELETE FROM login_ip_failures
+			WHERE last_failure_at < $1 and (locked_until is null or locked_until < $1)`
+
+	tag, err := l.db.Exec(context.Background(), query, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting login failures")
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type outbox struct {
+	db *pgxpool.Pool
+}
+
+func NewOutbox(db *pgxpool.Pool) *outbox {
+	return &outbox{db: db}
+}
+
+// remindersQuery queues a job for every reminder offset of the cafe that is still ahead, cafes without policy
+// remind an hour before like the default one does. Reservations that are over or have no address
+// to remind at get none, reminders already queued are skipped
+const remindersQuery = `INSERT INTO notifications (kind, reservation_id, scheduled_for, next_attempt_at)
+			SELECT $1, r.id, reminder.at, reminder.at FROM reservations r
+			LEFT JOIN cafe_policies p ON r.cafe_id = p.cafe_id
+			CROSS JOIN LATERAL (
+				SELECT r.date - make_interval(mins => offsets.minutes) AS at
+				FROM unnest(coalesce(p.reminder_offsets, '{60}')) AS offsets(minutes)
+			) reminder
+			WHERE %s and reminder.at > now() and r.status in ('pending', 'confirmed')
+				and (r.cust_email <> '' or r.cust_mobile <> '')
+			ON CONFLICT (kind, reservation_id, scheduled_for) DO NOTHING`
+
+// scheduleReminders queues reminders of the reservation when it is booked or rescheduled
+func scheduleReminders(tx pgx.Tx, reservationID int) error {
+	_, err := tx.Exec(context.Background(), fmt.Sprintf(remindersQuery, "r.id = $2"),
+		domain.NotificationReminder, reservationID)
+	if err != nil {
+		return errors.Wrap(err, "scheduling reminders")
+	}
+	return nil
+}
+
+// scheduleCafeReminders queues reminders at offsets the cafe added for its upcoming reservations,
+// reminders at removed offsets are cancelled by the worker
+func scheduleCafeReminders(tx pgx.Tx, cafeID int) error {
+	_, err := tx.Exec(context.Background(), fmt.Sprintf(remindersQuery, "r.cafe_id = $2"),
+		domain.NotificationReminder, cafeID)
+	if err != nil {
+		return errors.Wrap(err, "scheduling reminders of cafe")
+	}
+	return nil
+}
+
+// unscheduleReminders drops reminders of the reservation that were not sent yet
+func unscheduleReminders(tx pgx.Tx, reservationID int) error {
+	query := `DELETE FROM notifications WHERE kind = $1 and reservation_id = $2 and status = 'pending'`
+	if _, err := tx.Exec(context.Background(), query, domain.NotificationReminder, reservationID); err != nil {
+		return errors.Wrap(err, "unscheduling reminders")
+	}
+	return nil
+}
+
+// Claim locks the earliest due job while handle runs, other workers skip it instead of waiting,
+// then saves the job the way handle left it. false is returned when there is no due job
+func (o *outbox) Claim(now time.Time, handle func(job *domain.Notification)) (bool, error) {
+	tx, err := o.db.Begin(context.Background())
+	if err != nil {
+		return false, errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `SELECT id, kind, reservation_id, scheduled_for, status, attempts, next_attempt_at, created
+			FROM notifications
+			WHERE status = 'pending' and next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`
+
+	job := &domain.Notification{}
+	err = tx.QueryRow(context.Background(), query, now).Scan(&job.ID, &job.Kind, &job.Reservation.ID,
+		&job.ScheduledFor, &job.Status, &job.Attempts, &job.NextAttemptAt, &job.Created)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to make select statement: %v", err)
+	}
+
+	handle(job)
+
+	query = `UPDATE notifications
+			SET status = $2, attempts = $3, next_attempt_at = $4, last_error = $5, sent_at = $6
+			WHERE id = $1`
+
+	_, err = tx.Exec(context.Background(), query, job.ID, job.Status, job.Attempts, job.NextAttemptAt,
+		newNullString(job.LastError), newNullTime(job.SentAt))
+	if err != nil {
+		return false, errors.Wrap(err, "saving notification")
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return false, errors.Wrap(err, "committing notification")
+	}
+
+	return true, nil
+}
+
+// FindFailed returns jobs that ran out of attempts, the latest first
+func (o *outbox) FindFailed() ([]domain.Notification, error) {
+	query := `SELECT n.id, n.kind, n.status, n.attempts, n.next_attempt_at, n.last_error, n.created,
+			r.id, r.cust_name, r.cust_email, r.cust_mobile, r.date, c.id, c.name
+			FROM notifications n
+			JOIN reservations r ON n.reservation_id = r.id
+			JOIN cafes c ON r.cafe_id = c.id
+			WHERE n.status = 'failed'
+			ORDER BY n.next_attempt_at DESC, n.id DESC`
+
+	rows, err := o.db.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []domain.Notification
+	for rows.Next() {
+		var job domain.Notification
+		var lastError sql.NullString
+		err = rows.Scan(&job.ID, &job.Kind, &job.Status, &job.Attempts, &job.NextAttemptAt, &lastError, &job.Created,
+			&job.Reservation.ID, &job.Reservation.CustName, &job.Reservation.CustEmail, &job.Reservation.CustMobile,
+			&job.Reservation.Date, &job.Reservation.Cafe.ID, &job.Reservation.Cafe.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %v", err)
+		}
+		job.LastError = lastError.String
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Retry gives failed job a fresh set of attempts starting at now
+func (o *outbox) Retry(jobID int, now time.Time) error {
+	query := `UPDATE notifications SET status = 'pending', attempts = 0, next_attempt_at = $2
+			WHERE id = $1 and status = 'failed'`
+
+	tag, err := o.db.Exec(context.Background(), query, jobID, now)
+	if err != nil {
+		return errors.Wrap(err, "retrying notification")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNoRecord
+	}
+
+	return nil
+}
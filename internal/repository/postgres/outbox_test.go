@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestOutboxClaimSkipsLockedJobs(t *testing.T) {
+	pool := testPool(t)
+	reservations := NewReservation(pool)
+	repo := NewOutbox(pool)
+
+	date := time.Date(2100, 9, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, int(time.Now().Unix()%10000))
+	t.Cleanup(func() { deleteReservations(t, pool, date, date.Add(time.Hour)) })
+
+	reservation := testReservation(date, 1)
+	if err := reservations.BookTable(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	// cafe reminds an hour before by default
+	now := date.Add(-time.Hour + time.Minute)
+	if queued := queuedReminders(t, pool, reservation.ID); len(queued) != 1 {
+		t.Fatalf("want reminder queued once; got %v", queued)
+	}
+
+	// the job stays locked while the first worker handles it, the second one must not get it
+	var first, second int
+	claimed, err := repo.Claim(now, func(job *domain.Notification) {
+		first = job.ID
+		if _, err := repo.Claim(now, func(job *domain.Notification) { second = job.ID }); err != nil {
+			t.Error(err)
+		}
+		job.Attempts++
+		job.Status = domain.NotificationSent
+		job.SentAt = now
+	})
+	if err != nil || !claimed {
+		t.Fatalf("want due job to be claimed; got %t, %v", claimed, err)
+	}
+	if first == 0 || first == second {
+		t.Errorf("want locked job to be skipped; got %d and %d", first, second)
+	}
+
+	var status domain.NotificationStatus
+	err = pool.QueryRow(context.Background(), `SELECT status FROM notifications WHERE id = $1`, first).Scan(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != domain.NotificationSent {
+		t.Errorf("want job saved as handled; got %s", status)
+	}
+}
+
+// queuedReminders returns times pending reminders of the reservation are scheduled for
+func queuedReminders(t *testing.T, pool *pgxpool.Pool, reservationID int) []time.Time {
+	t.Helper()
+
+	rows, err := pool.Query(context.Background(), `SELECT scheduled_for FROM notifications
+		WHERE reservation_id = $1 and kind = $2 and status = 'pending' ORDER BY scheduled_for`,
+		reservationID, domain.NotificationReminder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var queued []time.Time
+	for rows.Next() {
+		var at time.Time
+		if err = rows.Scan(&at); err != nil {
+			t.Fatal(err)
+		}
+		queued = append(queued, at)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return queued
+}
+
+func TestRemindersFollowReservation(t *testing.T) {
+	pool := testPool(t)
+	reservations := NewReservation(pool)
+
+	date := time.Date(2100, 10, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, int(time.Now().Unix()%10000))
+	t.Cleanup(func() { deleteReservations(t, pool, date, date.Add(24*time.Hour)) })
+
+	// staff set the table busy for a walk-in, there is nobody to remind
+	walkIn := testReservation(date, 1)
+	walkIn.CustName, walkIn.CustMobile, walkIn.CustEmail = "", "", ""
+	if err := reservations.BookTable(walkIn); err != nil {
+		t.Fatal(err)
+	}
+	if queued := queuedReminders(t, pool, walkIn.ID); len(queued) != 0 {
+		t.Errorf("want no reminders without address; got %v", queued)
+	}
+
+	reservation := testReservation(date, 2)
+	if err := reservations.BookTable(reservation); err != nil {
+		t.Fatal(err)
+	}
+	if queued := queuedReminders(t, pool, reservation.ID); len(queued) != 1 || !queued[0].Equal(date.Add(-time.Hour)) {
+		t.Fatalf("want reminder an hour before when booked; got %v", queued)
+	}
+
+	reservation.Date, reservation.EndDate = date.Add(3*time.Hour), date.Add(3*time.Hour+90*time.Minute)
+	if err := reservations.UpdateReservationDate(reservation); err != nil {
+		t.Fatal(err)
+	}
+	if queued := queuedReminders(t, pool, reservation.ID); len(queued) != 1 || !queued[0].Equal(date.Add(2*time.Hour)) {
+		t.Errorf("want reminder moved with the reservation; got %v", queued)
+	}
+
+	err := reservations.UpdateStatus(reservation.ID, domain.StatusConfirmed, domain.StatusCancelled, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued := queuedReminders(t, pool, reservation.ID); len(queued) != 0 {
+		t.Errorf("want no reminders of cancelled reservation; got %v", queued)
+	}
+}
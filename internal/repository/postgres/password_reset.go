@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type passwordReset struct {
+	db *pgxpool.Pool
+}
+
+func NewPasswordReset(db *pgxpool.Pool) *passwordReset {
+	return &passwordReset{db: db}
+}
+
+func (p *passwordReset) Insert(userID int, hash []byte, expiresAt time.Time) error {
+	query := `INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES($1, $2, $3)`
+
+	_, err := p.db.Exec(context.Background(), query, userID, hash, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "inserting password reset")
+	}
+
+	return nil
+}
+
+func (p *passwordReset) FindByHash(hash []byte) (*domain.PasswordReset, error) {
+	query := `SELECT id, user_id, token_hash, expires_at, used_at, created
+			FROM password_resets WHERE token_hash = $1`
+
+	r := &domain.PasswordReset{}
+	var usedAt sql.NullTime
+
+	err := p.db.QueryRow(context.Background(), query, hash).
+		Scan(&r.ID, &r.UserID, &r.Hash, &r.ExpiresAt, &usedAt, &r.Created)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	if usedAt.Valid {
+		r.UsedAt = &usedAt.Time
+	}
+
+	return r, nil
+}
+
+// Consume uses the link and sets new password at once, user's sessions and refresh tokens are revoked
+// and locked account is unlocked with it; fails with ErrInvalidToken when the link was used meanwhile
+func (p *passwordReset) Consume(resetID int, hashedPassword string, now time.Time) error {
+	tx, err := p.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	var userID int
+	query := `UPDATE password_resets SET used_at = $2
+			WHERE id = $1 and used_at is null and expires_at > $2 RETURNING user_id`
+	err = tx.QueryRow(context.Background(), query, resetID, now).Scan(&userID)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return domain.ErrInvalidToken
+		}
+		return errors.Wrap(err, "using password reset")
+	}
+
+	query = `UPDATE users SET password = $2, sessions_revoked_at = $3, failed_logins = 0, locked_until = null
+			WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), query, userID, hashedPassword, now); err != nil {
+		return errors.Wrap(err, "updating password")
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 and revoked_at is null`
+	if _, err = tx.Exec(context.Background(), query, userID, now); err != nil {
+		return errors.Wrap(err, "revoking refresh tokens of user")
+	}
+
+	query = `DELETE FROM sessions WHERE user_id = $1`
+	if _, err = tx.Exec(context.Background(), query, userID); err != nil {
+		return errors.Wrap(err, "deleting sessions of user")
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing password reset")
+	}
+
+	return nil
+}
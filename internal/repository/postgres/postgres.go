@@ -9,6 +9,7 @@ import (
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"sync"
+	"time"
 )
 
 var (
@@ -86,3 +87,13 @@ func newNullString(s string) sql.NullString {
 		Valid:  true,
 	}
 }
+
+func newNullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{
+		Time:  t,
+		Valid: true,
+	}
+}
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type preference struct {
+	db *pgxpool.Pool
+}
+
+func NewPreference(db *pgxpool.Pool) *preference {
+	return &preference{db: db}
+}
+
+// FindPreferences returns choices user made, topics and channels without a choice are left out
+func (p *preference) FindPreferences(userID int) (domain.NotifyPreferences, error) {
+	query := `SELECT topic, channel, subscribed FROM notification_preferences WHERE user_id = $1`
+
+	rows, err := p.db.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	preferences := domain.NotifyPreferences{}
+	for rows.Next() {
+		var topic domain.NotifyTopic
+		var channel domain.NotifyChannel
+		var subscribed bool
+		if err = rows.Scan(&topic, &channel, &subscribed); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %v", err)
+		}
+		preferences.Set(topic, channel, subscribed)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+// SavePreferences stores every choice in preferences, the other choices stay as they are
+func (p *preference) SavePreferences(userID int, preferences domain.NotifyPreferences) error {
+	tx, err := p.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `INSERT INTO notification_preferences (user_id, topic, channel, subscribed)
+			VALUES($1, $2, $3, $4)
+			ON CONFLICT (user_id, topic, channel) DO UPDATE SET subscribed = $4`
+
+	for topic, channels := range preferences {
+		for channel, subscribed := range channels {
+			_, err = tx.Exec(context.Background(), query, userID, string(topic), string(channel), subscribed)
+			if err != nil {
+				return errors.Wrap(err, "upserting notification preference")
+			}
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing notification preferences")
+	}
+
+	return nil
+}
+
+func (p *preference) IsEmailUnsubscribed(email string, topic domain.NotifyTopic) (bool, error) {
+	query := `SELECT exists(SELECT 1 FROM email_unsubscribes WHERE email = $1 and topic = $2)`
+
+	var unsubscribed bool
+	err := p.db.QueryRow(context.Background(), query, strings.ToLower(email), string(topic)).Scan(&unsubscribed)
+	if err != nil {
+		return false, fmt.Errorf("failed to make select statement: %v", err)
+	}
+
+	return unsubscribed, nil
+}
+
+// UnsubscribeEmail stops topics for guest's address, topics it is already unsubscribed from are skipped
+func (p *preference) UnsubscribeEmail(email string, topics []domain.NotifyTopic) error {
+	query := `INSERT INTO email_unsubscribes (email, topic) VALUES($1, $2) ON CONFLICT (email, topic) DO NOTHING`
+
+	for _, topic := range topics {
+		if _, err := p.db.Exec(context.Background(), query, strings.ToLower(email), string(topic)); err != nil {
+			return errors.Wrap(err, "inserting email unsubscribe")
+		}
+	}
+
+	return nil
+}
+
+// IsGuestEmail tells whether anybody booked a table or joined a waitlist with the address
+func (p *preference) IsGuestEmail(email string) (bool, error) {
+	query := `SELECT exists(SELECT 1 FROM reservations WHERE lower(cust_email) = $1)
+			or exists(SELECT 1 FROM waitlist WHERE lower(cust_email) = $1)`
+
+	var known bool
+	err := p.db.QueryRow(context.Background(), query, strings.ToLower(email)).Scan(&known)
+	if err != nil {
+		return false, fmt.Errorf("failed to make select statement: %v", err)
+	}
+
+	return known, nil
+}
@@ -2,8 +2,11 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"time"
@@ -75,7 +78,14 @@ func (r *reservation) GetAvailableEventsByCafeID(cafeID int) ([]domain.Event, er
 	return ee, nil
 }
 
-func (r *reservation) GetSuitableTables(cafeID, partySize, locationID int, date, minPossibleBookingTime, maxPossibleBookingTime string) ([]domain.Table, error) {
+func (r *reservation) GetBookingPolicy(cafeID int) (*domain.BookingPolicy, error) {
+	return queryBookingPolicy(r.db, cafeID)
+}
+
+// GetSuitableTables returns tables that are free during the whole period from start to end,
+// reservation with exceptReservationID is skipped, so that it does not block itself while rescheduling.
+// Held tables have no reservation_id, "is distinct from" keeps them busy where "!=" would give null
+func (r *reservation) GetSuitableTables(cafeID, partySize, locationID, exceptReservationID int, start, end time.Time) ([]domain.Table, error) {
 	query := `	select id, capacity, location_id
 				from tables
 				where cafe_id = $1
@@ -83,12 +93,14 @@ func (r *reservation) GetSuitableTables(cafeID, partySize, locationID int, date,
 				  and location_id = $3
 				  and id not in (
 					select table_id
-					from reservations
-					where to_char(date, 'YYYY-MM-DD') = $4
-					  and to_char(date, 'HH24:MI') between $5 and $6
+					from reservation_tables
+					where cafe_id = $1
+					  and active
+					  and reservation_id is distinct from $6
+					  and period && tstzrange($4, $5)
 					);`
 	rows, err := r.db.Query(context.Background(),
-		query, cafeID, partySize, locationID, date, minPossibleBookingTime, maxPossibleBookingTime)
+		query, cafeID, partySize, locationID, start, end, exceptReservationID)
 	if err != nil {
 		return nil, err
 	}
@@ -114,84 +126,193 @@ func (r *reservation) GetSuitableTables(cafeID, partySize, locationID int, date,
 	return tt, nil
 }
 
+// BookTable relies on reservation_tables_no_overlap exclusion constraint,
+// so that only one of simultaneous bookings of the same table succeeds
 func (r *reservation) BookTable(reservation *domain.Reservation) error {
+	return r.bookTable(reservation, 0)
+}
+
+// BookHeldTable turns guest's hold into reservation, tables are released and occupied again
+// in one transaction, so that nobody can take them in between
+func (r *reservation) BookHeldTable(reservation *domain.Reservation, holdID int) error {
+	return r.bookTable(reservation, holdID)
+}
+
+func (r *reservation) bookTable(reservation *domain.Reservation, holdID int) error {
+	tx, err := r.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	if holdID != 0 {
+		// held tables are deleted with the hold, expired hold may be already swept
+		_, err = tx.Exec(context.Background(), `DELETE FROM table_holds WHERE id = $1`, holdID)
+		if err != nil {
+			return errors.Wrap(err, "releasing table hold")
+		}
+	}
+
 	query := `INSERT INTO reservations(cafe_id, user_id, table_id, event_id, event_description,
-				cust_name, cust_mobile, cust_email, num_of_persons, date, notify_date)
+				cust_name, cust_mobile, cust_email, num_of_persons, date, status)
 				VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id;`
 
-	err := r.db.QueryRow(context.Background(), query, reservation.Cafe.ID, newNullInt(int32(reservation.User.ID)), reservation.Table.ID, reservation.Event.ID,
+	err = tx.QueryRow(context.Background(), query, reservation.Cafe.ID, newNullInt(int32(reservation.User.ID)), reservation.Table.ID, reservation.Event.ID,
 		newNullString(reservation.EventDescription), reservation.CustName, reservation.CustMobile,
-		reservation.CustEmail, reservation.PartySize, reservation.Date, reservation.NotifyDate).
+		reservation.CustEmail, reservation.PartySize, reservation.Date, string(reservation.Status)).
 		Scan(&reservation.ID)
 	if err != nil {
 		return fmt.Errorf("failed to book table: %v", err)
 	}
 
+	if err = occupyTables(tx, reservation); err != nil {
+		return err
+	}
+
+	if err = scheduleReminders(tx, reservation.ID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing reservation")
+	}
+
 	return nil
 }
 
-func (r *reservation) GetUserReservations(userID int) ([]domain.Reservation, error) {
-	query := `SELECT DISTINCT r.id, r.cafe_id, c.name, r.table_id,
-			t.location_id, l.name, r.event_id, e.name, r.num_of_persons, r.date
-			from reservations r
-			left join cafes c on r.cafe_id = c.id
-			left join tables t on r.table_id = t.id
-			left join locations l on t.location_id = l.id
-			left join events e on r.event_id = e.id
-			WHERE r.user_id = $1;`
+// occupyTables takes reservation's first table together with joined ones for the reservation period
+func occupyTables(tx pgx.Tx, reservation *domain.Reservation) error {
+	query := `INSERT INTO reservation_tables (reservation_id, cafe_id, table_id, period)
+			VALUES($1, $2, $3, tstzrange($4, $5))`
 
-	rows, err := r.db.Query(context.Background(), query, userID)
+	tables := append([]domain.Table{reservation.Table}, reservation.JoinedTables...)
+	for _, t := range tables {
+		_, err := tx.Exec(context.Background(), query, reservation.ID, reservation.Cafe.ID, t.ID,
+			reservation.Date, reservation.EndDate)
+		if err != nil {
+			if isOverlapViolation(err) {
+				return domain.ErrTableTaken
+			}
+			return errors.Wrap(err, "occupying reservation tables")
+		}
+	}
+
+	return nil
+}
+
+// HoldTables keeps tables for the hold period until ExpiresAt, overlapping holds and reservations are rejected
+// by reservation_tables_no_overlap the same way as in BookTable
+func (r *reservation) HoldTables(hold *domain.TableHold) error {
+	tx, err := r.db.Begin(context.Background())
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "starting transaction")
 	}
-	defer rows.Close()
+	defer tx.Rollback(context.Background())
 
-	var rr []domain.Reservation
+	query := `INSERT INTO table_holds (cafe_id, period, expires_at)
+			VALUES($1, tstzrange($2, $3), $4) RETURNING id`
 
-	for rows.Next() {
-		r := reservationsPool.Get().(*domain.Reservation)
-		err = rows.Scan(&r.ID, &r.Cafe.ID, &r.Cafe.Name, &r.Table.ID, &r.Table.Location.ID,
-			&r.Table.Location.Name, &r.Event.ID, &r.Event.Name, &r.PartySize, &r.Date)
+	err = tx.QueryRow(context.Background(), query, hold.CafeID, hold.Start, hold.End, hold.ExpiresAt).
+		Scan(&hold.ID)
+	if err != nil {
+		return errors.Wrap(err, "inserting table hold")
+	}
+
+	query = `INSERT INTO reservation_tables (hold_id, cafe_id, table_id, period)
+			VALUES($1, $2, $3, tstzrange($4, $5))`
+
+	for _, t := range hold.Tables {
+		_, err = tx.Exec(context.Background(), query, hold.ID, hold.CafeID, t.ID, hold.Start, hold.End)
 		if err != nil {
-			return nil, fmt.Errorf("failed to assign values to Reservation struct from row: %v", err)
+			if isOverlapViolation(err) {
+				return domain.ErrTableTaken
+			}
+			return errors.Wrap(err, "holding tables")
 		}
-		rr = append(rr, *r)
+	}
 
-		*r = domain.Reservation{}
-		reservationsPool.Put(r)
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing table hold")
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+
+	return nil
+}
+
+// ReleaseHold frees held tables, releasing already expired hold is not an error
+func (r *reservation) ReleaseHold(holdID int) error {
+	_, err := r.db.Exec(context.Background(), `DELETE FROM table_holds WHERE id = $1`, holdID)
+	if err != nil {
+		return errors.Wrap(err, "releasing table hold")
 	}
 
-	return rr, nil
+	return nil
+}
+
+// DeleteExpiredHolds frees tables of guests who did not submit the confirmation form in time
+func (r *reservation) DeleteExpiredHolds(now time.Time) (int64, error) {
+	tag, err := r.db.Exec(context.Background(), `DELETE FROM table_holds WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting expired table holds")
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// GetTableJoins returns pairs of tables that partner allowed to put together
+func (r *reservation) GetTableJoins(cafeID int) ([]domain.TableJoin, error) {
+	return queryTableJoins(r.db, cafeID)
+}
+
+// inCafeTime converts timestamp to the wall clock of cafe's city, the way guests and partners see it
+func inCafeTime(t time.Time, city domain.City) time.Time {
+	loc, err := city.Location()
+	if err != nil {
+		return t
+	}
+	return t.In(loc)
 }
 
-func (r *reservation) GetReservationsByNotifyDate(now time.Time) ([]domain.Reservation, error) {
-	query := `SELECT r.id, r.cafe_id, c.name, r.table_id,
-			t.location_id, l.name, r.event_id, e.name, r.num_of_persons, r.date, r.cust_name, r.cust_email, r.notify_date
+func isOverlapViolation(err error) bool {
+	var postgresError *pgconn.PgError
+	return errors.As(err, &postgresError) &&
+		postgresError.Code == ExclusionViolationCode &&
+		postgresError.ConstraintName == "reservation_tables_no_overlap"
+}
+
+func (r *reservation) GetUserReservations(userID int) ([]domain.Reservation, error) {
+	query := `SELECT DISTINCT r.id, r.cafe_id, c.name, r.table_id,
+			t.location_id, l.name, r.event_id, e.name, r.num_of_persons, r.date, r.status,
+			coalesce(ci.time_zone, 'UTC'),
+			array(SELECT rt.table_id FROM reservation_tables rt
+				WHERE rt.reservation_id = r.id and rt.table_id != r.table_id ORDER BY rt.table_id)
 			from reservations r
-			join cafes c on r.cafe_id = c.id
-			join tables t on r.table_id = t.id
-			join locations l on t.location_id = l.id
-			join events e on r.event_id = e.id
-			WHERE r.notify_date = $1;`
+			left join cafes c on r.cafe_id = c.id
+			left join cities ci on c.city_id = ci.id
+			left join tables t on r.table_id = t.id and r.cafe_id = t.cafe_id
+			left join locations l on t.location_id = l.id
+			left join events e on r.event_id = e.id
+			WHERE r.user_id = $1
+			ORDER BY r.date DESC;`
 
-	rows, err := r.db.Query(context.Background(), query, now)
+	rows, err := r.db.Query(context.Background(), query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var rr []domain.Reservation
+	var joinedTableIDs []int32
 
 	for rows.Next() {
 		r := reservationsPool.Get().(*domain.Reservation)
 		err = rows.Scan(&r.ID, &r.Cafe.ID, &r.Cafe.Name, &r.Table.ID, &r.Table.Location.ID,
-			&r.Table.Location.Name, &r.Event.ID, &r.Event.Name, &r.PartySize, &r.Date, &r.CustName, &r.CustEmail, &r.NotifyDate)
+			&r.Table.Location.Name, &r.Event.ID, &r.Event.Name, &r.PartySize, &r.Date, &r.Status, &r.Cafe.City.TimeZone,
+			&joinedTableIDs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to assign values to Reservation struct from row: %v", err)
 		}
+		r.Date = inCafeTime(r.Date, r.Cafe.City)
+		r.JoinedTables = tablesByIDs(joinedTableIDs)
 		rr = append(rr, *r)
 
 		*r = domain.Reservation{}
@@ -204,7 +325,7 @@ func (r *reservation) GetReservationsByNotifyDate(now time.Time) ([]domain.Reser
 	return rr, nil
 }
 
-func (r *reservation) GetBusyTables(cafeID, partySize, locationID int, date, minPossibleBookingTime, maxPossibleBookingTime string) ([]domain.Table, error) {
+func (r *reservation) GetBusyTables(cafeID, partySize, locationID int, start, end time.Time) ([]domain.Table, error) {
 	query := `	select id, capacity, location_id
 				from tables
 				where cafe_id = $1
@@ -212,12 +333,13 @@ func (r *reservation) GetBusyTables(cafeID, partySize, locationID int, date, min
 				  and location_id = $3
 				  and id in (
 					select table_id
-					from reservations
-					where to_char(date, 'YYYY-MM-DD') = $4
-					  and to_char(date, 'HH24:MI') between $5 and $6
+					from reservation_tables
+					where cafe_id = $1
+					  and active
+					  and period && tstzrange($4, $5)
 					);`
 	rows, err := r.db.Query(context.Background(),
-		query, cafeID, partySize, locationID, date, minPossibleBookingTime, maxPossibleBookingTime)
+		query, cafeID, partySize, locationID, start, end)
 	if err != nil {
 		return nil, err
 	}
@@ -243,13 +365,297 @@ func (r *reservation) GetBusyTables(cafeID, partySize, locationID int, date, min
 	return tt, nil
 }
 
-func (r *reservation) FreeTable(reservation *domain.Reservation, minBookDate, maxBookDate time.Time) error {
-	query := `DELETE FROM reservations where cafe_id = $1 and table_id = $2 and date between $3 and $4;`
+// FreeTable frees the table from reservations overlapping the period from start to end, together with
+// tables joined to it, and keeps them in cafe's history: seated guests are completed, others are cancelled.
+// Every change is written to status history on behalf of reservation.User, ids of cancelled reservations are returned
+func (r *reservation) FreeTable(reservation *domain.Reservation, start, end time.Time) ([]int, error) {
+	query := `WITH old AS (
+				SELECT id, status FROM reservations
+				WHERE id IN (
+					SELECT reservation_id FROM reservation_tables
+					WHERE cafe_id = $1 and table_id = $2 and active and period && tstzrange($3, $4)
+				)
+				FOR UPDATE
+			), released AS (
+				UPDATE reservation_tables rt SET active = false
+				FROM old WHERE rt.reservation_id = old.id
+			), unscheduled AS (
+				DELETE FROM notifications n
+				USING old WHERE n.reservation_id = old.id and n.kind = $6 and n.status = 'pending'
+			), changed AS (
+				UPDATE reservations r
+				SET status = CASE WHEN old.status = 'seated' THEN 'completed' ELSE 'cancelled' END,
+					cancelled_at = CASE WHEN old.status = 'seated' THEN NULL ELSE now() END
+				FROM old WHERE r.id = old.id
+				RETURNING r.id, old.status AS from_status, r.status AS to_status
+			)
+			INSERT INTO reservation_status_history (reservation_id, from_status, to_status, changed_by, changed_at)
+			SELECT id, from_status, to_status, $5, now() FROM changed
+			RETURNING reservation_id, to_status;`
+
+	rows, err := r.db.Query(context.Background(), query, reservation.Cafe.ID, reservation.Table.ID,
+		start, end, newNullInt(int32(reservation.User.ID)), domain.NotificationReminder)
+	if err != nil {
+		return nil, errors.Wrap(err, "freeing table")
+	}
+	defer rows.Close()
+
+	var cancelled []int
+	for rows.Next() {
+		var id int
+		var status domain.ReservationStatus
+		if err = rows.Scan(&id, &status); err != nil {
+			return nil, errors.Wrap(err, "scanning freed reservation")
+		}
+		if status == domain.StatusCancelled {
+			cancelled = append(cancelled, id)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "freeing table")
+	}
+
+	return cancelled, nil
+}
 
-	_, err := r.db.Exec(context.Background(), query, reservation.Cafe.ID, reservation.Table.ID, minBookDate, maxBookDate)
+func (r *reservation) GetReservationByID(reservationID int) (*domain.Reservation, error) {
+	query := `SELECT r.id, r.user_id, r.cafe_id, c.name, c.address, r.table_id, t.location_id, l.name,
+			r.event_id, e.name, r.num_of_persons, r.cust_name, r.cust_mobile, r.cust_email,
+			r.date, upper(rt.period), r.status, r.cancelled_at, r.guest_confirmed_at, ci.time_zone,
+			coalesce(u.notify_channel, 'email'), coalesce(u.locale, 'en')
+			from reservations r
+			join cafes c on r.cafe_id = c.id
+			join cities ci on c.city_id = ci.id
+			join tables t on r.table_id = t.id and r.cafe_id = t.cafe_id
+			join locations l on t.location_id = l.id
+			join events e on r.event_id = e.id
+			left join reservation_tables rt on rt.reservation_id = r.id and rt.table_id = r.table_id
+			left join users u on r.user_id = u.id
+			WHERE r.id = $1;`
+
+	res := domain.NewReservation()
+	var userID sql.NullInt32
+	var endDate, cancelledAt, guestConfirmedAt sql.NullTime
+
+	err := r.db.QueryRow(context.Background(), query, reservationID).
+		Scan(&res.ID, &userID, &res.Cafe.ID, &res.Cafe.Name, &res.Cafe.Address, &res.Table.ID,
+			&res.Table.Location.ID, &res.Table.Location.Name, &res.Event.ID, &res.Event.Name,
+			&res.PartySize, &res.CustName, &res.CustMobile, &res.CustEmail,
+			&res.Date, &endDate, &res.Status, &cancelledAt, &guestConfirmedAt, &res.Cafe.City.TimeZone,
+			&res.User.NotifyChannel, &res.User.Locale)
 	if err != nil {
-		return errors.Wrap(err, "removing table from reservation")
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+
+	res.User.ID = -1
+	if userID.Valid {
+		res.User.ID = int(userID.Int32)
+	}
+	res.CancelledAt = cancelledAt.Time
+	res.GuestConfirmedAt = guestConfirmedAt.Time
+	res.Date = inCafeTime(res.Date, res.Cafe.City)
+	if endDate.Valid {
+		res.EndDate = inCafeTime(endDate.Time, res.Cafe.City)
+	}
+
+	if res.JoinedTables, err = r.queryJoinedTables(res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// queryJoinedTables returns tables put together with reservation's first table
+func (r *reservation) queryJoinedTables(reservation *domain.Reservation) ([]domain.Table, error) {
+	query := `SELECT t.id, t.capacity, t.location_id
+			FROM reservation_tables rt
+			JOIN tables t ON rt.table_id = t.id and rt.cafe_id = t.cafe_id
+			WHERE rt.reservation_id = $1 and rt.table_id != $2
+			ORDER BY t.id`
+
+	rows, err := r.db.Query(context.Background(), query, reservation.ID, reservation.Table.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tt []domain.Table
+
+	for rows.Next() {
+		var t domain.Table
+		err = rows.Scan(&t.ID, &t.Capacity, &t.Location.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to assign values to table struct from row %v", err)
+		}
+		tt = append(tt, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tt, nil
+}
+
+func (r *reservation) GetCafeReservations(cafeID int) ([]domain.Reservation, error) {
+	query := `SELECT r.id, r.table_id, t.location_id, l.name, r.num_of_persons,
+			r.cust_name, r.cust_mobile, r.cust_email, r.date, r.status, r.guest_confirmed_at, ci.time_zone,
+			array(SELECT rt.table_id FROM reservation_tables rt
+				WHERE rt.reservation_id = r.id and rt.table_id != r.table_id ORDER BY rt.table_id)
+			from reservations r
+			join cafes c on r.cafe_id = c.id
+			join cities ci on c.city_id = ci.id
+			join tables t on r.table_id = t.id and r.cafe_id = t.cafe_id
+			join locations l on t.location_id = l.id
+			WHERE r.cafe_id = $1
+			ORDER BY r.date DESC;`
+
+	rows, err := r.db.Query(context.Background(), query, cafeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rr []domain.Reservation
+	var joinedTableIDs []int32
+	var guestConfirmedAt sql.NullTime
+
+	for rows.Next() {
+		r := reservationsPool.Get().(*domain.Reservation)
+		err = rows.Scan(&r.ID, &r.Table.ID, &r.Table.Location.ID, &r.Table.Location.Name, &r.PartySize,
+			&r.CustName, &r.CustMobile, &r.CustEmail, &r.Date, &r.Status, &guestConfirmedAt, &r.Cafe.City.TimeZone,
+			&joinedTableIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to assign values to Reservation struct from row: %v", err)
+		}
+		r.GuestConfirmedAt = guestConfirmedAt.Time
+		r.Date = inCafeTime(r.Date, r.Cafe.City)
+		r.JoinedTables = tablesByIDs(joinedTableIDs)
+		r.Cafe.ID = cafeID
+		rr = append(rr, *r)
+
+		*r = domain.Reservation{}
+		reservationsPool.Put(r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+// UpdateStatus moves reservation from one status to another only if nobody changed it meanwhile
+func (r *reservation) UpdateStatus(reservationID int, from, to domain.ReservationStatus, changedBy int) error {
+	tx, err := r.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `UPDATE reservations SET status = $3,
+				cancelled_at = CASE WHEN $3 = 'cancelled' THEN now() ELSE cancelled_at END
+			WHERE id = $1 and status = $2`
+
+	tag, err := tx.Exec(context.Background(), query, reservationID, string(from), string(to))
+	if err != nil {
+		return errors.Wrap(err, "updating reservation status")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidTransition
+	}
+
+	query = `UPDATE reservation_tables SET active = $2 WHERE reservation_id = $1`
+	if _, err = tx.Exec(context.Background(), query, reservationID, to.OccupiesTable()); err != nil {
+		return errors.Wrap(err, "releasing reservation tables")
+	}
+
+	query = `INSERT INTO reservation_status_history (reservation_id, from_status, to_status, changed_by, changed_at)
+			VALUES($1, $2, $3, $4, now())`
+
+	_, err = tx.Exec(context.Background(), query, reservationID, string(from), string(to), newNullInt(int32(changedBy)))
+	if err != nil {
+		return errors.Wrap(err, "inserting reservation status history")
+	}
+
+	// guests are reminded of upcoming reservations only
+	if to != domain.StatusPending && to != domain.StatusConfirmed {
+		if err = unscheduleReminders(tx, reservationID); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing reservation status")
 	}
 
 	return nil
 }
+
+// UpdateReservationDate moves reservation together with all its tables to the new period
+func (r *reservation) UpdateReservationDate(reservation *domain.Reservation) error {
+	tx, err := r.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `UPDATE reservations SET table_id = $2, date = $3
+			WHERE id = $1 and status in ('pending', 'confirmed')`
+
+	tag, err := tx.Exec(context.Background(), query, reservation.ID, reservation.Table.ID, reservation.Date)
+	if err != nil {
+		return errors.Wrap(err, "rescheduling reservation")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotChangeable
+	}
+
+	query = `DELETE FROM reservation_tables WHERE reservation_id = $1`
+	if _, err = tx.Exec(context.Background(), query, reservation.ID); err != nil {
+		return errors.Wrap(err, "releasing reservation tables")
+	}
+
+	if err = occupyTables(tx, reservation); err != nil {
+		return err
+	}
+
+	// reminders go at offsets before the new date
+	if err = unscheduleReminders(tx, reservation.ID); err != nil {
+		return err
+	}
+	if err = scheduleReminders(tx, reservation.ID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing rescheduled reservation")
+	}
+
+	return nil
+}
+
+// ConfirmVisit records that guest replied they are coming, reservation must still be upcoming
+func (r *reservation) ConfirmVisit(reservationID int, at time.Time) error {
+	query := `UPDATE reservations SET guest_confirmed_at = $2
+			WHERE id = $1 and status = 'confirmed' and date > $2`
+
+	tag, err := r.db.Exec(context.Background(), query, reservationID, at)
+	if err != nil {
+		return errors.Wrap(err, "confirming visit")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotChangeable
+	}
+
+	return nil
+}
+
+func tablesByIDs(ids []int32) []domain.Table {
+	var tt []domain.Table
+	for _, id := range ids {
+		tt = append(tt, domain.Table{ID: int(id)})
+	}
+	return tt
+}
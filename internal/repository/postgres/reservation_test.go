@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// testPool connects to TEST_DATABASE_URL database with scripts/table_reservation.sql applied,
+// tests that need real postgres are skipped without it
+func testPool(t *testing.T) *pgxpool.Pool {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// deleteReservations removes reservations of seeded cafe made by tests
+func deleteReservations(t *testing.T, pool *pgxpool.Pool, from, to time.Time) {
+	_, err := pool.Exec(context.Background(),
+		`DELETE FROM reservation_tables WHERE reservation_id IN (
+			SELECT id FROM reservations WHERE cafe_id = 1 and date between $1 and $2)`, from, to)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = pool.Exec(context.Background(),
+		`DELETE FROM reservations WHERE cafe_id = 1 and date between $1 and $2`, from, to)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func testReservation(date time.Time, tableIDs ...int) *domain.Reservation {
+	reservation := &domain.Reservation{
+		PartySize:  2,
+		CustName:   "guest",
+		CustMobile: "87770000000",
+		CustEmail:  "guest@example.com",
+		Date:       date,
+		EndDate:    date.Add(90 * time.Minute),
+		Status:     domain.StatusConfirmed,
+		Cafe:       domain.Cafe{ID: 1},
+		Table:      domain.Table{ID: tableIDs[0]},
+		Event:      domain.Event{ID: 1},
+		User:       domain.User{ID: -1},
+	}
+	for _, id := range tableIDs[1:] {
+		reservation.JoinedTables = append(reservation.JoinedTables, domain.Table{ID: id})
+	}
+	return reservation
+}
+
+func TestBookTableConcurrently(t *testing.T) {
+	pool := testPool(t)
+	repo := NewReservation(pool)
+
+	const n = 10
+	// far in the future, so that the test does not collide with real reservations of seeded cafe
+	date := time.Date(2100, 1, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, int(time.Now().Unix()%10000))
+	t.Cleanup(func() { deleteReservations(t, pool, date, date.Add(time.Hour)) })
+
+	start := make(chan struct{})
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every booking starts a bit later, but all of them overlap
+			reservation := testReservation(date.Add(time.Duration(i)*time.Minute), 1)
+			<-start
+			errs <- repo.BookTable(reservation)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	var booked, taken int
+	for err := range errs {
+		switch {
+		case err == nil:
+			booked++
+		case errors.Is(err, domain.ErrTableTaken):
+			taken++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if booked != 1 || taken != n-1 {
+		t.Errorf("want 1 booked and %d taken; got %d booked and %d taken", n-1, booked, taken)
+	}
+}
+
+func TestBookTableCombination(t *testing.T) {
+	pool := testPool(t)
+	repo := NewReservation(pool)
+
+	date := time.Date(2100, 6, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, int(time.Now().Unix()%10000))
+	t.Cleanup(func() { deleteReservations(t, pool, date, date.Add(time.Hour)) })
+
+	if err := repo.BookTable(testReservation(date, 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// joined table is busy as well as the first one
+	err := repo.BookTable(testReservation(date.Add(30*time.Minute), 2))
+	if !errors.Is(err, domain.ErrTableTaken) {
+		t.Errorf("want %v; got %v", domain.ErrTableTaken, err)
+	}
+
+	// failed combination must not leave its first table occupied
+	err = repo.BookTable(testReservation(date.Add(30*time.Minute), 3, 2))
+	if !errors.Is(err, domain.ErrTableTaken) {
+		t.Errorf("want %v; got %v", domain.ErrTableTaken, err)
+	}
+	if err = repo.BookTable(testReservation(date.Add(30*time.Minute), 3)); err != nil {
+		t.Errorf("want table 3 to be free; got %v", err)
+	}
+}
+
+func TestTableHold(t *testing.T) {
+	pool := testPool(t)
+	repo := NewReservation(pool)
+
+	date := time.Date(2100, 9, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, int(time.Now().Unix()%10000))
+	t.Cleanup(func() { deleteReservations(t, pool, date, date.Add(time.Hour)) })
+
+	now := time.Now()
+	hold := &domain.TableHold{CafeID: 1, Tables: []domain.Table{{ID: 1}}, Start: date, End: date.Add(90 * time.Minute),
+		ExpiresAt: now.Add(5 * time.Minute)}
+	if err := repo.HoldTables(hold); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.ReleaseHold(hold.ID) })
+
+	// the hold has not expired yet, so its table is busy for others
+	if _, err := repo.DeleteExpiredHolds(now); err != nil {
+		t.Fatal(err)
+	}
+	err := repo.BookTable(testReservation(date.Add(30*time.Minute), 1))
+	if !errors.Is(err, domain.ErrTableTaken) {
+		t.Errorf("want %v; got %v", domain.ErrTableTaken, err)
+	}
+
+	// but not for the guest holding it
+	if err = repo.BookHeldTable(testReservation(date, 1), hold.ID); err != nil {
+		t.Fatalf("want held table to be booked; got %v", err)
+	}
+
+	expired := &domain.TableHold{CafeID: 1, Tables: []domain.Table{{ID: 2}}, Start: date, End: date.Add(90 * time.Minute),
+		ExpiresAt: now.Add(-time.Minute)}
+	if err = repo.HoldTables(expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.DeleteExpiredHolds(now); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.BookTable(testReservation(date, 2)); err != nil {
+		t.Errorf("want table of expired hold to be free; got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+)
+
+type role struct {
+	db *pgxpool.Pool
+}
+
+func NewRole(db *pgxpool.Pool) *role {
+	return &role{db: db}
+}
+
+func toPermissions(names []string) []domain.Permission {
+	permissions := make([]domain.Permission, len(names))
+	for i, name := range names {
+		permissions[i] = domain.Permission(name)
+	}
+	return permissions
+}
+
+func (r *role) GetAll() ([]domain.Role, error) {
+	query := `SELECT r.id, r.name, r.require_two_factor,
+			array(SELECT permission FROM role_permissions WHERE role_id = r.id ORDER BY permission)
+			FROM roles r ORDER BY r.id`
+
+	rows, err := r.db.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	var roles []domain.Role
+	for rows.Next() {
+		var role domain.Role
+		var permissions []string
+		if err = rows.Scan(&role.ID, &role.Name, &role.RequireTwoFactor, &permissions); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %v", err)
+		}
+		role.Permissions = toPermissions(permissions)
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *role) GetByName(name string) (*domain.Role, error) {
+	query := `SELECT r.id, r.name, r.require_two_factor,
+			array(SELECT permission FROM role_permissions WHERE role_id = r.id ORDER BY permission)
+			FROM roles r WHERE r.name = $1`
+
+	role := &domain.Role{}
+	var permissions []string
+
+	err := r.db.QueryRow(context.Background(), query, name).
+		Scan(&role.ID, &role.Name, &role.RequireTwoFactor, &permissions)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	role.Permissions = toPermissions(permissions)
+
+	return role, nil
+}
+
+// SetPermissions replaces permissions of role
+func (r *role) SetPermissions(roleID int, permissions []domain.Permission) error {
+	tx, err := r.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `DELETE FROM role_permissions WHERE role_id = $1`
+	if _, err = tx.Exec(context.Background(), query, roleID); err != nil {
+		return errors.Wrap(err, "deleting permissions of role")
+	}
+
+	query = `INSERT INTO role_permissions (role_id, permission) VALUES($1, $2)`
+	for _, p := range permissions {
+		if _, err = tx.Exec(context.Background(), query, roleID, string(p)); err != nil {
+			return errors.Wrap(err, "inserting permission of role")
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing permissions of role")
+	}
+
+	return nil
+}
+
+// GetStaff returns users whose roles have any permission
+func (r *role) GetStaff() ([]domain.User, error) {
+	query := `SELECT u.id, u.name, u.email, r.id, r.name
+			FROM users u join roles r on u.role_id = r.id
+			WHERE r.id in (SELECT role_id FROM role_permissions) ORDER BY r.id, u.name`
+
+	rows, err := r.db.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	for rows.Next() {
+		var u domain.User
+		if err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.Role.ID, &u.Role.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
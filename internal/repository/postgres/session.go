@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type session struct {
+	db *pgxpool.Pool
+}
+
+func NewSession(db *pgxpool.Pool) *session {
+	return &session{db: db}
+}
+
+// nullUserID stores guest's session without user
+func nullUserID(userID int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(userID), Valid: userID != 0}
+}
+
+func (s *session) Insert(session *domain.Session) (int, error) {
+	query := `INSERT INTO sessions (token_hash, user_id, data, ip, user_agent, last_seen_at, expires_at)
+			VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	var id int
+	err := s.db.QueryRow(context.Background(), query, session.Hash, nullUserID(session.UserID), session.Data,
+		session.IP, session.UserAgent, session.LastSeenAt, session.ExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "inserting session")
+	}
+
+	return id, nil
+}
+
+// FindByHash returns ErrNoRecord for expired sessions too
+func (s *session) FindByHash(hash []byte, now time.Time) (*domain.Session, error) {
+	query := `SELECT id, token_hash, user_id, data, ip, user_agent, last_seen_at, expires_at, created
+			FROM sessions WHERE token_hash = $1 and expires_at > $2`
+
+	session := &domain.Session{}
+	var userID sql.NullInt32
+
+	err := s.db.QueryRow(context.Background(), query, hash, now).
+		Scan(&session.ID, &session.Hash, &userID, &session.Data, &session.IP, &session.UserAgent,
+			&session.LastSeenAt, &session.ExpiresAt, &session.Created)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	session.UserID = int(userID.Int32)
+
+	return session, nil
+}
+
+// Update fails with ErrNoRecord when the session was revoked meanwhile
+func (s *session) Update(session *domain.Session) error {
+	query := `UPDATE sessions SET data = $2, last_seen_at = $3, expires_at = $4 WHERE id = $1`
+
+	tag, err := s.db.Exec(context.Background(), query, session.ID, session.Data, session.LastSeenAt, session.ExpiresAt)
+	if err != nil {
+		return errors.Wrap(err, "updating session")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (s *session) Touch(sessionID int, now time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = $2 WHERE id = $1`
+
+	_, err := s.db.Exec(context.Background(), query, sessionID, now)
+	if err != nil {
+		return errors.Wrap(err, "touching session")
+	}
+
+	return nil
+}
+
+func (s *session) Delete(sessionID int) error {
+	query := `DELETE FROM sessions WHERE id = $1`
+
+	_, err := s.db.Exec(context.Background(), query, sessionID)
+	if err != nil {
+		return errors.Wrap(err, "deleting session")
+	}
+
+	return nil
+}
+
+// GetByUser returns active sessions of user, the most recently used first
+func (s *session) GetByUser(userID int, now time.Time) ([]domain.Session, error) {
+	query := `SELECT id, ip, user_agent, last_seen_at, expires_at, created
+			FROM sessions WHERE user_id = $1 and expires_at > $2 ORDER BY last_seen_at DESC`
+
+	rows, err := s.db.Query(context.Background(), query, userID, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting sessions of user")
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		session := domain.Session{UserID: userID}
+		err = rows.Scan(&session.ID, &session.IP, &session.UserAgent, &session.LastSeenAt, &session.ExpiresAt, &session.Created)
+		if err != nil {
+			return nil, errors.Wrap(err, "scanning session")
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteOfUser fails with ErrNoRecord when user has no such session
+func (s *session) DeleteOfUser(userID, sessionID int) error {
+	query := `DELETE FROM sessions WHERE id = $1 and user_id = $2`
+
+	tag, err := s.db.Exec(context.Background(), query, sessionID, userID)
+	if err != nil {
+		return errors.Wrap(err, "deleting session of user")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteByUser ends all sessions of user except the one with exceptID
+func (s *session) DeleteByUser(userID, exceptID int) error {
+	query := `DELETE FROM sessions WHERE user_id = $1 and id <> $2`
+
+	_, err := s.db.Exec(context.Background(), query, userID, exceptID)
+	if err != nil {
+		return errors.Wrap(err, "deleting sessions of user")
+	}
+
+	return nil
+}
+
+func (s *session) DeleteExpired(now time.Time) (int64, error) {
+	query := `DELETE FROM sessions WHERE expires_at <= $1`
+
+	tag, err := s.db.Exec(context.Background(), query, now)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting expired sessions")
+	}
+
+	return tag.RowsAffected(), nil
+}
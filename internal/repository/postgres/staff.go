@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type staff struct {
+	db *pgxpool.Pool
+}
+
+func NewStaff(db *pgxpool.Pool) *staff {
+	return &staff{db: db}
+}
+
+const selectMembers = `SELECT m.cafe_id, c.name, m.user_id, u.name, u.email, m.role, m.created
+			FROM cafe_members m join cafes c on m.cafe_id = c.id join users u on m.user_id = u.id`
+
+func (s *staff) queryMembers(query string, args ...interface{}) ([]domain.CafeMember, error) {
+	rows, err := s.db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	var members []domain.CafeMember
+	for rows.Next() {
+		var m domain.CafeMember
+		err = rows.Scan(&m.Cafe.ID, &m.Cafe.Name, &m.User.ID, &m.User.Name, &m.User.Email, &m.Role, &m.Created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan cafe member: %v", err)
+		}
+		members = append(members, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (s *staff) GetMember(cafeID, userID int) (*domain.CafeMember, error) {
+	members, err := s.queryMembers(selectMembers+` WHERE m.cafe_id = $1 and m.user_id = $2`, cafeID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, domain.ErrNoRecord
+	}
+
+	return &members[0], nil
+}
+
+// GetByUser returns cafes the user works at
+func (s *staff) GetByUser(userID int) ([]domain.CafeMember, error) {
+	return s.queryMembers(selectMembers+` WHERE m.user_id = $1 ORDER BY c.name`, userID)
+}
+
+func (s *staff) GetByCafe(cafeID int) ([]domain.CafeMember, error) {
+	return s.queryMembers(selectMembers+` WHERE m.cafe_id = $1 ORDER BY m.role, u.name`, cafeID)
+}
+
+func (s *staff) Delete(cafeID, userID int) error {
+	query := `DELETE FROM cafe_members WHERE cafe_id = $1 and user_id = $2`
+
+	tag, err := s.db.Exec(context.Background(), query, cafeID, userID)
+	if err != nil {
+		return errors.Wrap(err, "deleting cafe member")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (s *staff) InsertInvite(invite *domain.StaffInvite) error {
+	query := `INSERT INTO staff_invites (cafe_id, email, role, token_hash, invited_by, expires_at)
+			VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created`
+
+	err := s.db.QueryRow(context.Background(), query, invite.Cafe.ID, invite.Email, invite.Role,
+		invite.Hash, invite.InvitedBy, invite.ExpiresAt).Scan(&invite.ID, &invite.Created)
+	if err != nil {
+		return errors.Wrap(err, "inserting staff invite")
+	}
+
+	return nil
+}
+
+const selectInvites = `SELECT i.id, i.cafe_id, c.name, i.email, i.role, i.token_hash, i.invited_by,
+			i.expires_at, i.accepted_at, i.created
+			FROM staff_invites i join cafes c on i.cafe_id = c.id`
+
+// scanInvite scans a row of selectInvites, pgx.Rows is a pgx.Row as well
+func scanInvite(row pgx.Row) (*domain.StaffInvite, error) {
+	i := &domain.StaffInvite{}
+	var acceptedAt sql.NullTime
+
+	err := row.Scan(&i.ID, &i.Cafe.ID, &i.Cafe.Name, &i.Email, &i.Role, &i.Hash, &i.InvitedBy,
+		&i.ExpiresAt, &acceptedAt, &i.Created)
+	if err != nil {
+		return nil, err
+	}
+	if acceptedAt.Valid {
+		i.AcceptedAt = &acceptedAt.Time
+	}
+
+	return i, nil
+}
+
+func (s *staff) FindInviteByHash(hash []byte) (*domain.StaffInvite, error) {
+	invite, err := scanInvite(s.db.QueryRow(context.Background(), selectInvites+` WHERE i.token_hash = $1`, hash))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+
+	return invite, nil
+}
+
+// GetPendingInvites returns invites of the cafe that were not accepted and did not expire
+func (s *staff) GetPendingInvites(cafeID int, now time.Time) ([]domain.StaffInvite, error) {
+	query := selectInvites + ` WHERE i.cafe_id = $1 and i.accepted_at is null and i.expires_at > $2
+			ORDER BY i.created`
+
+	rows, err := s.db.Query(context.Background(), query, cafeID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	defer rows.Close()
+
+	var invites []domain.StaffInvite
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan staff invite: %v", err)
+		}
+		invites = append(invites, *invite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// AcceptInvite makes user staff of the invite's cafe, the position of former staff is replaced.
+// Users whose role grants no permission are given role with roleName, so that they can open partner's panel.
+// Fails with ErrInvalidToken when the invite was used or expired meanwhile
+func (s *staff) AcceptInvite(inviteID, userID int, roleName string, now time.Time) error {
+	tx, err := s.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	var cafeID int
+	var role domain.StaffRole
+	query := `UPDATE staff_invites SET accepted_at = $2
+			WHERE id = $1 and accepted_at is null and expires_at > $2 RETURNING cafe_id, role`
+	err = tx.QueryRow(context.Background(), query, inviteID, now).Scan(&cafeID, &role)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return domain.ErrInvalidToken
+		}
+		return errors.Wrap(err, "accepting staff invite")
+	}
+
+	query = `INSERT INTO cafe_members (cafe_id, user_id, role) VALUES($1, $2, $3)
+			ON CONFLICT (cafe_id, user_id) DO UPDATE SET role = excluded.role`
+	if _, err = tx.Exec(context.Background(), query, cafeID, userID, role); err != nil {
+		return errors.Wrap(err, "inserting cafe member")
+	}
+
+	query = `UPDATE users SET role_id = (SELECT id FROM roles WHERE name = $2)
+			WHERE id = $1 and role_id not in (SELECT role_id FROM role_permissions)`
+	if _, err = tx.Exec(context.Background(), query, userID, roleName); err != nil {
+		return errors.Wrap(err, "updating role of staff")
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing staff invite")
+	}
+
+	return nil
+}
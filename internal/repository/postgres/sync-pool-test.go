@@ -16,7 +16,6 @@ func WithPoolReseting() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -33,7 +32,6 @@ func WithPoolReseting() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -50,7 +48,6 @@ func WithPoolReseting() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -82,7 +79,6 @@ func WithPoolAssigning() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -99,7 +95,6 @@ func WithPoolAssigning() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -116,7 +111,6 @@ func WithPoolAssigning() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -149,7 +143,6 @@ func WithoutPool() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -166,7 +159,6 @@ func WithoutPool() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
@@ -183,7 +175,6 @@ func WithoutPool() {
 			CustEmail:               "zxc",
 			EventDescription:        "zxc",
 			Date:                    time.Time{},
-			NotifyDate:              time.Time{},
 			Cafe:                    domain.Cafe{},
 			Table:                   domain.Table{},
 			Event:                   domain.Event{},
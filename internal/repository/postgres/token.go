@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type refreshToken struct {
+	db *pgxpool.Pool
+}
+
+func NewRefreshToken(db *pgxpool.Pool) *refreshToken {
+	return &refreshToken{db: db}
+}
+
+func (r *refreshToken) Insert(userID int, hash []byte, expiresAt time.Time) error {
+	query := `INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES($1, $2, $3)`
+
+	_, err := r.db.Exec(context.Background(), query, userID, hash, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "inserting refresh token")
+	}
+
+	return nil
+}
+
+func (r *refreshToken) FindByHash(hash []byte) (*domain.RefreshToken, error) {
+	query := `SELECT id, user_id, token_hash, expires_at, revoked_at, created
+			FROM refresh_tokens WHERE token_hash = $1`
+
+	t := &domain.RefreshToken{}
+	var revokedAt sql.NullTime
+
+	err := r.db.QueryRow(context.Background(), query, hash).
+		Scan(&t.ID, &t.UserID, &t.Hash, &t.ExpiresAt, &revokedAt, &t.Created)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+
+	return t, nil
+}
+
+// Revoke fails with ErrInvalidToken when the token was revoked meanwhile,
+// so that two concurrent refreshes can not both succeed
+func (r *refreshToken) Revoke(tokenID int, now time.Time) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $2 WHERE id = $1 and revoked_at is null`
+
+	tag, err := r.db.Exec(context.Background(), query, tokenID, now)
+	if err != nil {
+		return errors.Wrap(err, "revoking refresh token")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidToken
+	}
+
+	return nil
+}
+
+func (r *refreshToken) RevokeByUser(userID int, now time.Time) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 and revoked_at is null`
+
+	_, err := r.db.Exec(context.Background(), query, userID, now)
+	if err != nil {
+		return errors.Wrap(err, "revoking refresh tokens of user")
+	}
+
+	return nil
+}
+
+func (r *refreshToken) DeleteExpired(now time.Time) (int64, error) {
+	query := `DELETE FROM refresh_tokens WHERE expires_at <= $1`
+
+	tag, err := r.db.Exec(context.Background(), query, now)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting expired refresh tokens")
+	}
+
+	return tag.RowsAffected(), nil
+}
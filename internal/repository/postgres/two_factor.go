@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type twoFactor struct {
+	db *pgxpool.Pool
+}
+
+func NewTwoFactor(db *pgxpool.Pool) *twoFactor {
+	return &twoFactor{db: db}
+}
+
+// SetSecret starts enrolment, secret of already enabled second factor is not replaced
+func (t *twoFactor) SetSecret(userID int, secret string) error {
+	query := `UPDATE users SET totp_secret = $2, totp_last_step = null
+			WHERE id = $1 and totp_enabled_at is null`
+
+	if _, err := t.db.Exec(context.Background(), query, userID, secret); err != nil {
+		return errors.Wrap(err, "setting totp secret")
+	}
+
+	return nil
+}
+
+// Enable confirms enrolment with the step of the code user entered and replaces recovery codes
+func (t *twoFactor) Enable(userID int, step int64, recoveryCodeHashes [][]byte, now time.Time) error {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `UPDATE users SET totp_enabled_at = $2, totp_last_step = $3
+			WHERE id = $1 and totp_secret is not null and totp_enabled_at is null`
+	tag, err := tx.Exec(context.Background(), query, userID, now, step)
+	if err != nil {
+		return errors.Wrap(err, "enabling totp")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidCode
+	}
+
+	query = `DELETE FROM recovery_codes WHERE user_id = $1`
+	if _, err = tx.Exec(context.Background(), query, userID); err != nil {
+		return errors.Wrap(err, "deleting recovery codes")
+	}
+
+	query = `INSERT INTO recovery_codes (user_id, code_hash) VALUES($1, $2)`
+	for _, hash := range recoveryCodeHashes {
+		if _, err = tx.Exec(context.Background(), query, userID, hash); err != nil {
+			return errors.Wrap(err, "inserting recovery code")
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing totp enrolment")
+	}
+
+	return nil
+}
+
+func (t *twoFactor) Disable(userID int) error {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `UPDATE users SET totp_secret = null, totp_enabled_at = null, totp_last_step = null WHERE id = $1`
+	if _, err = tx.Exec(context.Background(), query, userID); err != nil {
+		return errors.Wrap(err, "disabling totp")
+	}
+
+	query = `DELETE FROM recovery_codes WHERE user_id = $1`
+	if _, err = tx.Exec(context.Background(), query, userID); err != nil {
+		return errors.Wrap(err, "deleting recovery codes")
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing totp removal")
+	}
+
+	return nil
+}
+
+// UseStep remembers the step of accepted code, fails with ErrInvalidCode when
+// the same or a later step was already used
+func (t *twoFactor) UseStep(userID int, step int64) error {
+	query := `UPDATE users SET totp_last_step = $2
+			WHERE id = $1 and (totp_last_step is null or totp_last_step < $2)`
+
+	tag, err := t.db.Exec(context.Background(), query, userID, step)
+	if err != nil {
+		return errors.Wrap(err, "using totp step")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidCode
+	}
+
+	return nil
+}
+
+func (t *twoFactor) UseRecoveryCode(userID int, hash []byte, now time.Time) error {
+	query := `UPDATE recovery_codes SET used_at = $3
+			WHERE id = (SELECT id FROM recovery_codes
+			WHERE user_id = $1 and code_hash = $2 and used_at is null LIMIT 1)`
+
+	tag, err := t.db.Exec(context.Background(), query, userID, hash, now)
+	if err != nil {
+		return errors.Wrap(err, "using recovery code")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidCode
+	}
+
+	return nil
+}
+
+func (t *twoFactor) SetRequired(roleID int, required bool) error {
+	query := `UPDATE roles SET require_two_factor = $2 WHERE id = $1`
+
+	tag, err := t.db.Exec(context.Background(), query, roleID, required)
+	if err != nil {
+		return errors.Wrap(err, "updating role")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNoRecord
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/CyganFx/table-reservation/internal/domain"
 	"github.com/jackc/pgconn"
@@ -12,7 +13,10 @@ import (
 	"time"
 )
 
-const UniqueViolationCode = "23505"
+const (
+	UniqueViolationCode    = "23505"
+	ExclusionViolationCode = "23P01"
+)
 
 type user struct {
 	db *pgxpool.Pool
@@ -22,11 +26,11 @@ func NewUser(db *pgxpool.Pool) *user {
 	return &user{db: db}
 }
 
-func (u *user) Create(name, email, mobile, hashedPassword string, roleId int) error {
+func (u *user) Create(name, email, mobile, hashedPassword, roleName string) error {
 	query := `INSERT INTO users (name, role_id, email, mobile, password, created)
-	VALUES($1, $2, $3, $4, $5, $6)`
+	VALUES($1, (SELECT id FROM roles WHERE name = $2), $3, $4, $5, $6)`
 
-	_, err := u.db.Exec(context.Background(), query, name, roleId, email, mobile, hashedPassword, time.Now())
+	_, err := u.db.Exec(context.Background(), query, name, roleName, email, mobile, hashedPassword, time.Now())
 	if err != nil {
 		postgresError := err.(*pgconn.PgError)
 		if errors.As(err, &postgresError) {
@@ -42,13 +46,23 @@ func (u *user) Create(name, email, mobile, hashedPassword string, roleId int) er
 }
 
 func (u *user) GetById(id int) (*domain.User, error) {
-	query := `SELECT u.name, u.role_id, r.name, u.email, u.mobile, u.created, u.profile_image_url
+	query := `SELECT u.name, u.role_id, r.name, r.require_two_factor,
+			array(SELECT permission FROM role_permissions WHERE role_id = r.id ORDER BY permission),
+			u.email, u.mobile, u.created, u.profile_image_url,
+			u.email_verified_at, u.sessions_revoked_at, u.totp_secret, u.totp_enabled_at, u.totp_last_step,
+			u.failed_logins, u.last_failed_login_at, u.locked_until, u.notify_channel, u.locale
 			FROM users u join roles r on u.role_id = r.id WHERE u.id = $1`
 	user := domain.NewUser()
+	var emailVerifiedAt, sessionsRevokedAt, totpEnabledAt, lastFailedLoginAt, lockedUntil sql.NullTime
+	var totpSecret sql.NullString
+	var totpLastStep sql.NullInt64
+	var permissions []string
 
 	err := u.db.QueryRow(context.Background(), query, id).
-		Scan(&user.Name, &user.Role.ID, &user.Role.Name, &user.Email,
-			&user.Mobile, &user.Created, &user.ImageURL)
+		Scan(&user.Name, &user.Role.ID, &user.Role.Name, &user.Role.RequireTwoFactor, &permissions, &user.Email,
+			&user.Mobile, &user.Created, &user.ImageURL, &emailVerifiedAt, &sessionsRevokedAt,
+			&totpSecret, &totpEnabledAt, &totpLastStep,
+			&user.LoginFailures.Failures, &lastFailedLoginAt, &lockedUntil, &user.NotifyChannel, &user.Locale)
 	if err != nil {
 		if err.Error() == "no rows in result set" {
 			return nil, domain.ErrNoRecord
@@ -58,10 +72,33 @@ func (u *user) GetById(id int) (*domain.User, error) {
 	}
 
 	user.ID = id
+	user.Role.Permissions = toPermissions(permissions)
+	user.EmailVerifiedAt = emailVerifiedAt.Time
+	user.SessionsRevokedAt = sessionsRevokedAt.Time
+	user.TOTPSecret = totpSecret.String
+	user.TOTPEnabledAt = totpEnabledAt.Time
+	user.TOTPLastStep = totpLastStep.Int64
+	user.LoginFailures.LastFailureAt = lastFailedLoginAt.Time
+	user.LoginFailures.LockedUntil = lockedUntil.Time
 
 	return user, nil
 }
 
+func (u *user) GetByEmail(email string) (*domain.User, error) {
+	var id int
+
+	query := `SELECT id FROM users WHERE email = $1`
+	err := u.db.QueryRow(context.Background(), query, email).Scan(&id)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+
+	return u.GetById(id)
+}
+
 func (u *user) Update(user *domain.User) error {
 	query := `UPDATE users SET name = $2, mobile = $3 FROM users WHERE id = $1`
 
@@ -102,6 +139,17 @@ func (u *user) Authenticate(email, password string) (int, error) {
 	return id, nil
 }
 
+func (u *user) MarkEmailVerified(userID int, now time.Time) error {
+	query := `UPDATE users SET email_verified_at = $2 WHERE id = $1 and email_verified_at is null`
+
+	_, err := u.db.Exec(context.Background(), query, userID, now)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %v", err)
+	}
+
+	return nil
+}
+
 func (u *user) SetProfileImage(filePath string, userID int) error {
 	query := `UPDATE users SET profile_image_url = $1 WHERE id = $2`
 
@@ -113,10 +161,28 @@ func (u *user) SetProfileImage(filePath string, userID int) error {
 	return nil
 }
 
+func (u *user) SetNotificationSettings(userID int, channel domain.NotifyChannel, locale domain.Locale) error {
+	query := `UPDATE users SET notify_channel = $2, locale = $3 WHERE id = $1`
+
+	_, err := u.db.Exec(context.Background(), query, userID, channel, locale)
+	if err != nil {
+		return fmt.Errorf("failed to update notification settings: %v", err)
+	}
+
+	return nil
+}
+
+// UpdateUserRoleByID also ends sessions of user, they keep the role they were started with
 func (u *user) UpdateUserRoleByID(userID, roleID int) error {
+	tx, err := u.db.Begin(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback(context.Background())
+
 	query := `UPDATE users SET role_id = $2 WHERE id = $1`
 
-	_, err := u.db.Exec(context.Background(), query, userID, roleID)
+	_, err = tx.Exec(context.Background(), query, userID, roleID)
 	if err != nil {
 		if err.Error() == "no rows in result set" {
 			return domain.ErrInvalidCredentials
@@ -124,12 +190,21 @@ func (u *user) UpdateUserRoleByID(userID, roleID int) error {
 		return fmt.Errorf("failed to update: %v", err)
 	}
 
+	query = `DELETE FROM sessions WHERE user_id = $1`
+	if _, err = tx.Exec(context.Background(), query, userID); err != nil {
+		return errors.Wrap(err, "deleting sessions of user")
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return errors.Wrap(err, "committing role update")
+	}
+
 	return nil
 }
 
 func (u *user) Query(cafeID int) ([]domain.User, error) {
 	query := `SELECT id, name, email, mobile FROM users where 
-			role_id != 1 and role_id != 3
+			role_id not in (select role_id from role_permissions)
 			and 
 			id not in
 			(select user_id from blacklist where cafe_id = $1)`
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type waitlist struct {
+	db *pgxpool.Pool
+}
+
+func NewWaitlist(db *pgxpool.Pool) *waitlist {
+	return &waitlist{db: db}
+}
+
+const waitlistColumns = `w.id, w.cafe_id, c.name, ci.time_zone, w.location_id, l.name, w.user_id,
+			w.party_size, w.cust_name, w.cust_mobile, w.cust_email, w.window_start, w.window_end,
+			w.status, w.reservation_id, w.offer_expires_at, w.created, coalesce(u.notify_channel, 'email'),
+			coalesce(u.locale, 'en')
+			FROM waitlist w
+			JOIN cafes c ON w.cafe_id = c.id
+			JOIN cities ci ON c.city_id = ci.id
+			JOIN locations l ON w.location_id = l.id
+			LEFT JOIN users u ON w.user_id = u.id`
+
+func scanWaitlistEntry(row pgx.Row) (*domain.WaitlistEntry, error) {
+	e := &domain.WaitlistEntry{}
+	var userID, reservationID sql.NullInt32
+	var offerExpiresAt sql.NullTime
+
+	err := row.Scan(&e.ID, &e.Cafe.ID, &e.Cafe.Name, &e.Cafe.City.TimeZone, &e.Location.ID, &e.Location.Name,
+		&userID, &e.PartySize, &e.CustName, &e.CustMobile, &e.CustEmail, &e.WindowStart, &e.WindowEnd,
+		&e.Status, &reservationID, &offerExpiresAt, &e.Created, &e.User.NotifyChannel, &e.User.Locale)
+	if err != nil {
+		return nil, err
+	}
+
+	e.User.ID = -1
+	if userID.Valid {
+		e.User.ID = int(userID.Int32)
+	}
+	e.Reservation.ID = int(reservationID.Int32)
+	e.OfferExpiresAt = inCafeTime(offerExpiresAt.Time, e.Cafe.City)
+	e.WindowStart = inCafeTime(e.WindowStart, e.Cafe.City)
+	e.WindowEnd = inCafeTime(e.WindowEnd, e.Cafe.City)
+	e.Created = inCafeTime(e.Created, e.Cafe.City)
+
+	return e, nil
+}
+
+func (w *waitlist) queryEntries(query string, args ...interface{}) ([]domain.WaitlistEntry, error) {
+	rows, err := w.db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ee []domain.WaitlistEntry
+
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to assign values to waitlist entry struct from row: %v", err)
+		}
+		ee = append(ee, *e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ee, nil
+}
+
+func (w *waitlist) Insert(entry *domain.WaitlistEntry) error {
+	query := `INSERT INTO waitlist (cafe_id, location_id, user_id, party_size, cust_name, cust_mobile, cust_email,
+				window_start, window_end)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, status`
+
+	err := w.db.QueryRow(context.Background(), query, entry.Cafe.ID, entry.Location.ID,
+		newNullInt(int32(entry.User.ID)), entry.PartySize, entry.CustName, entry.CustMobile, entry.CustEmail,
+		entry.WindowStart, entry.WindowEnd).
+		Scan(&entry.ID, &entry.Status)
+	if err != nil {
+		return errors.Wrap(err, "inserting waitlist entry")
+	}
+
+	return nil
+}
+
+func (w *waitlist) FindByID(entryID int) (*domain.WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + ` WHERE w.id = $1`
+
+	e, err := scanWaitlistEntry(w.db.QueryRow(context.Background(), query, entryID))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, domain.ErrNoRecord
+		}
+		return nil, fmt.Errorf("failed to make select statement: %v", err)
+	}
+
+	return e, nil
+}
+
+// FindWaiting returns guests whose time window has not passed yet, first come first served
+func (w *waitlist) FindWaiting(cafeID int, now time.Time) ([]domain.WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + `
+			WHERE w.cafe_id = $1 and w.status = 'waiting' and w.window_end > $2
+			ORDER BY w.created, w.id`
+
+	return w.queryEntries(query, cafeID, now)
+}
+
+func (w *waitlist) FindByCafeID(cafeID int) ([]domain.WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + `
+			WHERE w.cafe_id = $1
+			ORDER BY w.window_start DESC, w.created`
+
+	return w.queryEntries(query, cafeID)
+}
+
+func (w *waitlist) FindExpiredOffers(now time.Time) ([]domain.WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + `
+			WHERE w.status = 'offered' and w.offer_expires_at <= $1`
+
+	return w.queryEntries(query, now)
+}
+
+// MarkOffered links pending reservation to the entry, only if nobody offered it something meanwhile
+func (w *waitlist) MarkOffered(entryID, reservationID int, expiresAt time.Time) error {
+	query := `UPDATE waitlist SET status = 'offered', reservation_id = $2, offer_expires_at = $3
+			WHERE id = $1 and status = 'waiting'`
+
+	tag, err := w.db.Exec(context.Background(), query, entryID, reservationID, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "offering reservation to waitlist entry")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidTransition
+	}
+
+	return nil
+}
+
+func (w *waitlist) UpdateStatus(entryID int, from, to domain.WaitlistStatus) error {
+	query := `UPDATE waitlist SET status = $3 WHERE id = $1 and status = $2`
+
+	tag, err := w.db.Exec(context.Background(), query, entryID, string(from), string(to))
+	if err != nil {
+		return errors.Wrap(err, "updating waitlist entry status")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidTransition
+	}
+
+	return nil
+}
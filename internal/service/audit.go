@@ -0,0 +1,86 @@
+package service
+
+import (
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"math"
+	"strconv"
+	"time"
+)
+
+// auditPageSize is how many of the latest entries audit viewer shows
+const auditPageSize = 200
+
+type AuditRepo interface {
+	Insert(entry *domain.AuditEntry) error
+	Find(filter domain.AuditFilter) ([]domain.AuditEntry, error)
+}
+
+// audit keeps append-only log of privileged actions
+type audit struct {
+	repo AuditRepo
+}
+
+func NewAudit(repo AuditRepo) *audit {
+	return &audit{repo: repo}
+}
+
+// Record writes entry of the action that is already done
+func (a *audit) Record(entry *domain.AuditEntry) error {
+	return a.repo.Insert(entry)
+}
+
+// Search fills filter from "action", "actor", "cafe", "from" and "to" fields of audit viewer and returns
+// the latest entries matching it. Dates are days in UTC, the "to" day is included. Cafe that is already
+// set in filter is kept whatever the form says, that is how partners see only their own cafe
+func (a *audit) Search(form *forms.FormValidator, filter *domain.AuditFilter) ([]domain.AuditEntry, bool, error) {
+	actions := make([]string, len(domain.AuditActions))
+	for i, action := range domain.AuditActions {
+		actions[i] = string(action)
+	}
+	form.PermittedValues("action", actions...)
+	form.MatchesPattern("actor", forms.EmailRX)
+	form.IntRange("cafe", 1, math.MaxInt32)
+
+	from := parseAuditDay(form, "from")
+	to := parseAuditDay(form, "to")
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		form.Errors.Add("to", "This date must not be before the start date")
+	}
+
+	if !form.Valid() {
+		return nil, false, nil
+	}
+
+	filter.Action = domain.AuditAction(form.Get("action"))
+	filter.ActorEmail = form.Get("actor")
+	if filter.CafeID == 0 {
+		filter.CafeID, _ = strconv.Atoi(form.Get("cafe"))
+	}
+	filter.From = from
+	if !to.IsZero() {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	filter.Limit = auditPageSize
+
+	entries, err := a.repo.Find(*filter)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return entries, true, nil
+}
+
+// parseAuditDay returns zero time when the field is empty or is not a date
+func parseAuditDay(form *forms.FormValidator, field string) time.Time {
+	value := form.Get(field)
+	if value == "" {
+		return time.Time{}
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		form.Errors.Add(field, "This field must be a date")
+		return time.Time{}
+	}
+	return day
+}
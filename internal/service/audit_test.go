@@ -0,0 +1,59 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+)
+
+type fakeAuditRepo struct {
+	AuditRepo
+	filters []domain.AuditFilter
+}
+
+func (f *fakeAuditRepo) Find(filter domain.AuditFilter) ([]domain.AuditEntry, error) {
+	f.filters = append(f.filters, filter)
+	return nil, nil
+}
+
+func TestAuditSearch(t *testing.T) {
+	repo := &fakeAuditRepo{}
+	s := NewAudit(repo)
+
+	invalid := []url.Values{
+		{"action": {"cafe.destroy"}},
+		{"actor": {"nobody"}},
+		{"cafe": {"-1"}},
+		{"from": {"04.06.2021"}},
+		{"from": {"2021-06-05"}, "to": {"2021-06-04"}},
+	}
+	for _, values := range invalid {
+		if _, valid, err := s.Search(forms.New(values), &domain.AuditFilter{}); valid || err != nil {
+			t.Errorf("want %v to be rejected; got %t, %v", values, valid, err)
+		}
+	}
+	if len(repo.filters) != 0 {
+		t.Fatalf("want log not to be searched by invalid filter; got %+v", repo.filters)
+	}
+
+	form := forms.New(url.Values{"action": {string(domain.AuditTableBusy)}, "actor": {"host@cafe.kz"},
+		"cafe": {"2"}, "from": {"2021-06-04"}, "to": {"2021-06-04"}})
+	if _, valid, err := s.Search(form, &domain.AuditFilter{CafeID: 1}); !valid || err != nil {
+		t.Fatalf("want filter to be valid; got %t, %v", valid, err)
+	}
+
+	filter := repo.filters[0]
+	if filter.Action != domain.AuditTableBusy || filter.ActorEmail != "host@cafe.kz" || filter.Limit != auditPageSize {
+		t.Errorf("want filter taken from form; got %+v", filter)
+	}
+	if filter.CafeID != 1 {
+		t.Errorf("want partner's cafe to be kept; got %d", filter.CafeID)
+	}
+	day := time.Date(2021, 6, 4, 0, 0, 0, 0, time.UTC)
+	if !filter.From.Equal(day) || !filter.To.Equal(day.AddDate(0, 0, 1)) {
+		t.Errorf("want the whole day of 2021-06-04; got %v - %v", filter.From, filter.To)
+	}
+}
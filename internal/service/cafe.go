@@ -1,8 +1,24 @@
 package service
 
 import (
+	"fmt"
 	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	minReservationInterval = 15
+	maxReservationInterval = 360
+	maxDaysInAdvanceLimit  = 90
+	maxPartySizeLimit      = 50
+
+	maxReminders = 5
+	// maxReminderOffset is a week, reminders are minutes before the visit
+	maxReminderOffset = 7 * 24 * 60
 )
 
 type cafe struct {
@@ -28,7 +44,11 @@ type CafeRepo interface {
 	FindCollabRequests() ([]domain.Cafe, error)
 	ApproveByID(cafeID int) error
 	DeleteByID(cafeID int) error
-	QueryCafeIDByAdminID(adminID int) (int, error)
+	FindBookingPolicy(cafeID int) (*domain.BookingPolicy, error)
+	UpdateBookingPolicy(policy *domain.BookingPolicy) error
+	FindTables(cafeID int) ([]domain.Table, error)
+	FindTableJoins(cafeID int) ([]domain.TableJoin, error)
+	UpdateTableJoins(cafeID int, joins []domain.TableJoin) error
 }
 
 func (c *cafe) GetLocations() ([]domain.Location, error) {
@@ -88,6 +108,160 @@ func (c *cafe) Disapprove(cafeID int) error {
 	return c.repo.DeleteByID(cafeID)
 }
 
-func (c *cafe) GetCafeIDByAdminID(adminID int) (int, error) {
-	return c.repo.QueryCafeIDByAdminID(adminID)
+func (c *cafe) GetBookingPolicy(cafeID int) (*domain.BookingPolicy, error) {
+	return c.repo.FindBookingPolicy(cafeID)
+}
+
+// SaveBookingPolicy fills policy from the partner's form,
+// opening hours of weekday i come in open{i}, opens{i} and closes{i} fields
+func (c *cafe) SaveBookingPolicy(form *forms.FormValidator, policy *domain.BookingPolicy) (bool, error) {
+	form.Required("reservation_interval", "max_days_in_advance", "max_party_size")
+	form.IntRange("reservation_interval", minReservationInterval, maxReservationInterval)
+	form.IntRange("max_days_in_advance", 1, maxDaysInAdvanceLimit)
+	form.IntRange("max_party_size", 1, maxPartySizeLimit)
+
+	policy.ReservationInterval, _ = strconv.Atoi(form.Get("reservation_interval"))
+	policy.MaxDaysInAdvance, _ = strconv.Atoi(form.Get("max_days_in_advance"))
+	policy.MaxPartySize, _ = strconv.Atoi(form.Get("max_party_size"))
+	if policy.ReservationInterval%bookTimeSelectInterval != 0 {
+		form.Errors.Add("reservation_interval",
+			fmt.Sprintf("This field must be a multiple of %d", bookTimeSelectInterval))
+	}
+
+	policy.ReminderOffsets = reminderOffsets(form, "reminder_offsets")
+
+	policy.OpeningHours = nil
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		h := domain.OpeningHours{Weekday: day, IsClosed: form.Get(fmt.Sprintf("open%d", day)) == ""}
+		opens, closes := fmt.Sprintf("opens%d", day), fmt.Sprintf("closes%d", day)
+
+		if !h.IsClosed {
+			form.Required(opens, closes)
+			form.MatchesPattern(opens, forms.ClockRX)
+			form.MatchesPattern(closes, forms.ClockRX)
+			h.OpensAt = clockToMinutes(form.Get(opens))
+			h.ClosesAt = clockToMinutes(form.Get(closes))
+			if h.OpensAt == h.ClosesAt {
+				form.Errors.Add(closes, "Closing time must differ from opening time")
+			} else if h.WorkingMinutes() < policy.ReservationInterval {
+				form.Errors.Add(closes, "Cafe must work at least one reservation interval")
+			}
+		}
+		policy.OpeningHours = append(policy.OpeningHours, h)
+	}
+
+	if !form.Valid() {
+		return false, nil
+	}
+
+	if err := c.repo.UpdateBookingPolicy(policy); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// reminderOffsets reads comma separated minutes before the visit, the earliest reminder goes first.
+// Empty field turns reminders off
+func reminderOffsets(form *forms.FormValidator, field string) []int {
+	var offsets []int
+	for _, value := range strings.Split(form.Get(field), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < minReservationInterval || minutes > maxReminderOffset {
+			form.Errors.Add(field, fmt.Sprintf("Every reminder must be between %d and %d minutes before the visit",
+				minReservationInterval, maxReminderOffset))
+			return offsets
+		}
+		for _, o := range offsets {
+			if o == minutes {
+				form.Errors.Add(field, "Reminders must be at different times")
+				return offsets
+			}
+		}
+		offsets = append(offsets, minutes)
+	}
+	if len(offsets) > maxReminders {
+		form.Errors.Add(field, fmt.Sprintf("There can be at most %d reminders", maxReminders))
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	return offsets
+}
+
+// clockToMinutes converts validated "15:04" string to minutes since midnight
+func clockToMinutes(clock string) int {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+// GetTableJoins lists every pair of tables in the same location, IsJoined marks pairs partner allowed to join
+func (c *cafe) GetTableJoins(cafeID int) ([]domain.TableJoin, error) {
+	tables, err := c.repo.FindTables(cafeID)
+	if err != nil {
+		return nil, err
+	}
+	joined, err := c.repo.FindTableJoins(cafeID)
+	if err != nil {
+		return nil, err
+	}
+
+	isJoined := make(map[string]bool)
+	for _, j := range joined {
+		isJoined[tableJoinValue(j.Table.ID, j.JoinedTable.ID)] = true
+	}
+
+	var joins []domain.TableJoin
+	for i, t := range tables {
+		for _, other := range tables[i+1:] {
+			if t.Location.ID != other.Location.ID {
+				continue
+			}
+			first, second := t, other
+			if first.ID > second.ID {
+				first, second = second, first
+			}
+			joins = append(joins, domain.TableJoin{
+				Table:       first,
+				JoinedTable: second,
+				IsJoined:    isJoined[tableJoinValue(first.ID, second.ID)],
+			})
+		}
+	}
+
+	return joins, nil
+}
+
+// SaveTableJoins keeps only the pairs that come checked in the partner's form as "join" values,
+// pairs of tables from different locations are ignored
+func (c *cafe) SaveTableJoins(cafeID int, values []string) error {
+	joins, err := c.GetTableJoins(cafeID)
+	if err != nil {
+		return err
+	}
+
+	checked := make(map[string]bool)
+	for _, v := range values {
+		checked[v] = true
+	}
+
+	var joined []domain.TableJoin
+	for _, j := range joins {
+		if checked[tableJoinValue(j.Table.ID, j.JoinedTable.ID)] {
+			joined = append(joined, j)
+		}
+	}
+
+	return c.repo.UpdateTableJoins(cafeID, joined)
+}
+
+// tableJoinValue identifies pair of tables in html forms, e.g. "3-4"
+func tableJoinValue(tableID, joinedTableID int) string {
+	return fmt.Sprintf("%d-%d", tableID, joinedTableID)
 }
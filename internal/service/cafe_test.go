@@ -0,0 +1,56 @@
+package service
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+)
+
+type fakeCafeRepo struct {
+	CafeRepo
+	saved *domain.BookingPolicy
+}
+
+func (f *fakeCafeRepo) UpdateBookingPolicy(policy *domain.BookingPolicy) error {
+	f.saved = policy
+	return nil
+}
+
+func TestSaveBookingPolicyReminders(t *testing.T) {
+	tests := []struct {
+		offsets string
+		valid   bool
+		want    []int
+	}{
+		{"60, 1440", true, []int{1440, 60}},
+		{"", true, nil},
+		{"120,", true, []int{120}},
+		{"60, 60", false, nil},
+		{"5", false, nil},
+		{"a day", false, nil},
+		{"20160", false, nil},
+		{"30, 60, 90, 120, 180, 240", false, nil},
+	}
+
+	for _, tt := range tests {
+		repo := &fakeCafeRepo{}
+		s := NewCafe(repo)
+		form := forms.New(url.Values{"reservation_interval": {"90"}, "max_days_in_advance": {"7"},
+			"max_party_size": {"8"}, "reminder_offsets": {tt.offsets}})
+
+		valid, err := s.SaveBookingPolicy(form, &domain.BookingPolicy{CafeID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if valid != tt.valid {
+			t.Errorf("%q: want valid %v; got %v, %v", tt.offsets, tt.valid, valid, form.Errors)
+			continue
+		}
+		if valid && !reflect.DeepEqual(repo.saved.ReminderOffsets, tt.want) {
+			t.Errorf("%q: want %v, the earliest first; got %v", tt.offsets, tt.want, repo.saved.ReminderOffsets)
+		}
+	}
+}
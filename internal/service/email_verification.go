@@ -0,0 +1,66 @@
+package service
+
+import (
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+// emailVerificationValue binds the link to the email it was sent to
+func emailVerificationValue(userID int, email string) string {
+	return "verify-email:" + strconv.Itoa(userID) + ":" + email
+}
+
+// SendEmailVerification emails a link that proves the address belongs to user,
+// verified addresses get no email
+func (u *user) SendEmailVerification(email string, notificator http_v1.NotificatorService) error {
+	user, err := u.repo.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	token := u.signer.Sign(emailVerificationValue(user.ID, user.Email), time.Now().Add(emailVerificationTTL))
+
+	return notificator.EmailVerification(*user, token)
+}
+
+func (u *user) VerifyEmail(token string) error {
+	return u.verifyEmail(token, time.Now())
+}
+
+func (u *user) verifyEmail(token string, now time.Time) error {
+	value, err := u.signer.Verify(token, now)
+	if err != nil {
+		return domain.ErrInvalidToken
+	}
+
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] != "verify-email" {
+		return domain.ErrInvalidToken
+	}
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return domain.ErrInvalidToken
+	}
+
+	user, err := u.repo.GetById(userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return domain.ErrInvalidToken
+		}
+		return err
+	}
+	if user.Email != parts[2] {
+		return domain.ErrInvalidToken
+	}
+
+	return u.repo.MarkEmailVerified(user.ID, now)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/signer"
+)
+
+func (f *fakeUserRepo) MarkEmailVerified(userID int, now time.Time) error {
+	f.users[userID].EmailVerifiedAt = now
+	return nil
+}
+
+type fakeVerificationNotificator struct {
+	http_v1.NotificatorService
+	tokens []string
+}
+
+func (f *fakeVerificationNotificator) EmailVerification(user domain.User, token string) error {
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func TestEmailVerification(t *testing.T) {
+	verifiedAt := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+	repo := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "guest@example.com"},
+		8: {ID: 8, Email: "old@example.com", EmailVerifiedAt: verifiedAt},
+	}}
+	s := signer.New("secret")
+	users := NewUser(repo, nil, nil, s)
+	notificator := &fakeVerificationNotificator{}
+
+	if err := users.SendEmailVerification("old@example.com", notificator); err != nil || len(notificator.tokens) != 0 {
+		t.Fatalf("want verified user to get no email; got %v, %d emails", err, len(notificator.tokens))
+	}
+	if err := users.SendEmailVerification("guest@example.com", notificator); err != nil || len(notificator.tokens) != 1 {
+		t.Fatalf("want verification link to be emailed; got %v, %d emails", err, len(notificator.tokens))
+	}
+	token := notificator.tokens[0]
+
+	now := time.Now()
+	if err := users.verifyEmail(token, now.Add(emailVerificationTTL+time.Second)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want expired link to be invalid; got %v", err)
+	}
+	forged := signer.New("guess").Sign(emailVerificationValue(7, "guest@example.com"), now.Add(time.Hour))
+	if err := users.VerifyEmail(forged); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want forged link to be invalid; got %v", err)
+	}
+	otherUser := s.Sign(emailVerificationValue(9, "ghost@example.com"), now.Add(time.Hour))
+	if err := users.VerifyEmail(otherUser); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want link of deleted user to be invalid; got %v", err)
+	}
+
+	repo.users[7].Email = "changed@example.com"
+	if err := users.VerifyEmail(token); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want link sent to previous email to be invalid; got %v", err)
+	}
+	repo.users[7].Email = "guest@example.com"
+
+	if err := users.verifyEmail(token, now); err != nil {
+		t.Fatalf("want email to be verified; got %v", err)
+	}
+	if !repo.users[7].IsEmailVerified() {
+		t.Error("want user to be marked verified")
+	}
+}
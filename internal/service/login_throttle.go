@@ -0,0 +1,143 @@
+package service
+
+import (
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"net"
+	"time"
+)
+
+const (
+	// loginFailureWindow is how long a failure is remembered after the last one
+	loginFailureWindow = time.Hour
+	// loginFreeAttempts failures go without delay, then the delay doubles from a second up to loginMaxDelay
+	loginFreeAttempts = 3
+	loginMaxDelay     = time.Minute
+	accountLockAfter  = 10
+	// one address may be shared by many people, e.g. office network, therefore it is locked later
+	ipLockAfter       = 50
+	loginLockDuration = 30 * time.Minute
+	// maxIPLength is the length of login_ip_failures.ip
+	maxIPLength = 64
+)
+
+type LoginThrottleRepo interface {
+	GetIPFailures(ip string) (*domain.LoginFailures, error)
+	RecordAccountFailure(userID int, now, windowStart time.Time) (*domain.LoginFailures, error)
+	RecordIPFailure(ip string, now, windowStart time.Time) (*domain.LoginFailures, error)
+	LockAccount(userID int, until time.Time) error
+	LockIP(ip string, until time.Time) error
+	ResetAccount(userID int) error
+	GetLockedUsers(now time.Time) ([]domain.User, error)
+	DeleteIPFailuresBefore(before time.Time) (int64, error)
+}
+
+// loginThrottle slows down guessing of passwords and one-time codes, counters are kept
+// in database, so that all app instances see the same numbers
+type loginThrottle struct {
+	repo LoginThrottleRepo
+}
+
+// ipKey is the address failures are counted by, it is the same however the address is written
+// and never longer than the column
+func ipKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	if len(ip) > maxIPLength {
+		return ip[:maxIPLength]
+	}
+	return ip
+}
+
+// throttled returns LoginThrottledError while f forbids new attempts
+func throttled(f domain.LoginFailures, now time.Time) error {
+	if f.IsLocked(now) {
+		return &domain.LoginThrottledError{RetryAt: f.LockedUntil, Locked: true}
+	}
+	if f.Failures <= loginFreeAttempts || now.Sub(f.LastFailureAt) > loginFailureWindow {
+		return nil
+	}
+
+	delay := loginMaxDelay
+	if n := f.Failures - loginFreeAttempts - 1; n < 8 {
+		if d := time.Second << uint(n); d < delay {
+			delay = d
+		}
+	}
+	if retryAt := f.LastFailureAt.Add(delay); retryAt.After(now) {
+		return &domain.LoginThrottledError{RetryAt: retryAt}
+	}
+
+	return nil
+}
+
+// check is called before credentials are checked, user is nil for unknown emails
+func (t loginThrottle) check(user *domain.User, ip string, now time.Time) error {
+	f, err := t.repo.GetIPFailures(ipKey(ip))
+	if err != nil {
+		return err
+	}
+	if err = throttled(*f, now); err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	return throttled(user.LoginFailures, now)
+}
+
+// fail counts the failure and locks the address or the account once there are too many,
+// owner of the account is told about the lock. The account is counted even when counting the address fails,
+// so that guessing of its password can not go on
+func (t loginThrottle) fail(user *domain.User, ip string, now time.Time, notificator http_v1.NotificatorService) error {
+	windowStart := now.Add(-loginFailureWindow)
+
+	var accountErr error
+	if user != nil {
+		accountErr = t.failAccount(user, now, windowStart, notificator)
+	}
+	if err := t.failIP(ipKey(ip), now, windowStart); err != nil {
+		return err
+	}
+
+	return accountErr
+}
+
+func (t loginThrottle) failAccount(user *domain.User, now, windowStart time.Time, notificator http_v1.NotificatorService) error {
+	f, err := t.repo.RecordAccountFailure(user.ID, now, windowStart)
+	if err != nil {
+		return err
+	}
+	if f.Failures >= accountLockAfter && !f.IsLocked(now) {
+		until := now.Add(loginLockDuration)
+		if err = t.repo.LockAccount(user.ID, until); err != nil {
+			return err
+		}
+		return notificator.AccountLocked(*user, until)
+	}
+
+	return nil
+}
+
+func (t loginThrottle) failIP(ip string, now, windowStart time.Time) error {
+	f, err := t.repo.RecordIPFailure(ip, now, windowStart)
+	if err != nil {
+		return err
+	}
+	if f.Failures >= ipLockAfter && !f.IsLocked(now) {
+		return t.repo.LockIP(ip, now.Add(loginLockDuration))
+	}
+
+	return nil
+}
+
+// succeed forgets failures of the account, failures of the address are forgotten only with time,
+// otherwise one valid account would be enough to guess passwords of others
+func (t loginThrottle) succeed(user *domain.User) error {
+	if user.LoginFailures.Failures == 0 {
+		return nil
+	}
+	return t.repo.ResetAccount(user.ID)
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+// Authenticate of fake repo keeps passwords in plain text
+func (f *fakeUserRepo) Authenticate(email, password string) (int, error) {
+	for _, u := range f.users {
+		if u.Email == email && string(u.Password) == password {
+			return u.ID, nil
+		}
+	}
+	return 0, domain.ErrInvalidCredentials
+}
+
+// fakeLoginThrottleRepo keeps counters of accounts in users of fakeUserRepo
+type fakeLoginThrottleRepo struct {
+	LoginThrottleRepo
+	users *fakeUserRepo
+	ips   map[string]*domain.LoginFailures
+	ipErr error
+}
+
+func (f *fakeLoginThrottleRepo) GetIPFailures(ip string) (*domain.LoginFailures, error) {
+	if failures, ok := f.ips[ip]; ok {
+		copied := *failures
+		return &copied, nil
+	}
+	return &domain.LoginFailures{}, nil
+}
+
+func record(failures *domain.LoginFailures, now, windowStart time.Time) *domain.LoginFailures {
+	if failures.LastFailureAt.Before(windowStart) {
+		failures.Failures = 0
+	}
+	failures.Failures++
+	failures.LastFailureAt = now
+	copied := *failures
+	return &copied
+}
+
+func (f *fakeLoginThrottleRepo) RecordAccountFailure(userID int, now, windowStart time.Time) (*domain.LoginFailures, error) {
+	return record(&f.users.users[userID].LoginFailures, now, windowStart), nil
+}
+
+func (f *fakeLoginThrottleRepo) RecordIPFailure(ip string, now, windowStart time.Time) (*domain.LoginFailures, error) {
+	if f.ipErr != nil {
+		return nil, f.ipErr
+	}
+	if _, ok := f.ips[ip]; !ok {
+		f.ips[ip] = &domain.LoginFailures{}
+	}
+	return record(f.ips[ip], now, windowStart), nil
+}
+
+func (f *fakeLoginThrottleRepo) LockAccount(userID int, until time.Time) error {
+	f.users.users[userID].LoginFailures.LockedUntil = until
+	return nil
+}
+
+func (f *fakeLoginThrottleRepo) LockIP(ip string, until time.Time) error {
+	f.ips[ip].LockedUntil = until
+	return nil
+}
+
+func (f *fakeLoginThrottleRepo) ResetAccount(userID int) error {
+	f.users.users[userID].LoginFailures = domain.LoginFailures{}
+	return nil
+}
+
+type fakeLockNotificator struct {
+	http_v1.NotificatorService
+	locked []time.Time
+}
+
+func (f *fakeLockNotificator) AccountLocked(user domain.User, until time.Time) error {
+	f.locked = append(f.locked, until)
+	return nil
+}
+
+func TestSignInThrottle(t *testing.T) {
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "guest@example.com", Password: []byte("secret")},
+	}}
+	repo := &fakeLoginThrottleRepo{users: users, ips: map[string]*domain.LoginFailures{}}
+	s := NewUser(users, nil, repo, nil)
+	notificator := &fakeLockNotificator{}
+	now := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < loginFreeAttempts; i++ {
+		if _, err := s.signIn("guest@example.com", "wrong", "10.0.0.1", now, notificator); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: want invalid credentials; got %v", i+1, err)
+		}
+	}
+	if _, err := s.signIn("guest@example.com", "wrong", "10.0.0.1", now, notificator); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("want the failure after free attempts to be counted; got %v", err)
+	}
+
+	var throttledErr *domain.LoginThrottledError
+	if _, err := s.signIn("guest@example.com", "secret", "10.0.0.2", now, notificator); !errors.As(err, &throttledErr) || throttledErr.Locked {
+		t.Fatalf("want even valid password to wait for the delay; got %v", err)
+	}
+	if want := now.Add(time.Second); !throttledErr.RetryAt.Equal(want) {
+		t.Errorf("want retry at %v; got %v", want, throttledErr.RetryAt)
+	}
+
+	for i := loginFreeAttempts + 1; i < accountLockAfter; i++ {
+		now = now.Add(loginMaxDelay)
+		if _, err := s.signIn("guest@example.com", "wrong", "10.0.0.1", now, notificator); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: want invalid credentials; got %v", i+1, err)
+		}
+	}
+	if len(notificator.locked) != 1 {
+		t.Fatalf("want owner to be told about the lock once; got %d emails", len(notificator.locked))
+	}
+	if !users.users[7].LoginFailures.IsLocked(now) {
+		t.Fatal("want account to be locked")
+	}
+
+	now = now.Add(loginMaxDelay)
+	if _, err := s.signIn("guest@example.com", "secret", "10.0.0.2", now, notificator); !errors.As(err, &throttledErr) || !throttledErr.Locked {
+		t.Fatalf("want locked account to refuse valid password; got %v", err)
+	}
+
+	now = now.Add(loginLockDuration)
+	if id, err := s.signIn("guest@example.com", "secret", "10.0.0.2", now, notificator); err != nil || id != 7 {
+		t.Fatalf("want login after the lock expires; got %d, %v", id, err)
+	}
+	if f := users.users[7].LoginFailures; f.Failures != 0 || !f.LockedUntil.IsZero() {
+		t.Errorf("want failures of account to be forgotten after login; got %+v", f)
+	}
+	if f := repo.ips["10.0.0.1"]; f.Failures != accountLockAfter {
+		t.Errorf("want failures of address to be kept; got %+v", f)
+	}
+}
+
+func TestSignInThrottleUnknownEmail(t *testing.T) {
+	users := &fakeUserRepo{users: map[int]*domain.User{}}
+	repo := &fakeLoginThrottleRepo{users: users, ips: map[string]*domain.LoginFailures{}}
+	s := NewUser(users, nil, repo, nil)
+	now := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < ipLockAfter; i++ {
+		now = now.Add(loginMaxDelay)
+		if _, err := s.signIn("nobody@example.com", "wrong", "10.0.0.1", now, nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: want invalid credentials; got %v", i+1, err)
+		}
+	}
+
+	var throttledErr *domain.LoginThrottledError
+	if _, err := s.signIn("nobody@example.com", "wrong", "10.0.0.1", now, nil); !errors.As(err, &throttledErr) || !throttledErr.Locked {
+		t.Fatalf("want address to be locked; got %v", err)
+	}
+	if _, err := s.signIn("nobody@example.com", "wrong", "10.0.0.2", now, nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Errorf("want other addresses to be let in; got %v", err)
+	}
+}
+
+func TestSignInThrottleIPFailure(t *testing.T) {
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "guest@example.com", Password: []byte("secret")},
+	}}
+	// address that does not fit the column fails to be recorded
+	repo := &fakeLoginThrottleRepo{users: users, ips: map[string]*domain.LoginFailures{},
+		ipErr: errors.New("value too long for type character varying(64)")}
+	s := NewUser(users, nil, repo, nil)
+	notificator := &fakeLockNotificator{}
+	now := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < accountLockAfter; i++ {
+		now = now.Add(loginMaxDelay)
+		if _, err := s.signIn("guest@example.com", "wrong", "10.0.0.1", now, notificator); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: want the same answer as for any wrong password; got %v", i+1, err)
+		}
+	}
+	if !users.users[7].LoginFailures.IsLocked(now) || len(notificator.locked) != 1 {
+		t.Errorf("want account locked although its address was not counted; got %+v", users.users[7].LoginFailures)
+	}
+}
+
+func TestIPKey(t *testing.T) {
+	tests := []struct {
+		ip, want string
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"::ffff:10.0.0.1", "10.0.0.1"},
+		{"2001:DB8:0:0::1", "2001:db8::1"},
+		{strings.Repeat("1.1.1.1, ", 20), strings.Repeat("1.1.1.1, ", 20)[:maxIPLength]},
+	}
+
+	for _, tt := range tests {
+		if got := ipKey(tt.ip); got != tt.want {
+			t.Errorf("ipKey(%q) = %q; want %q", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	// maxNotificationAttempts with doubling backoff gives a job about an hour before it fails
+	maxNotificationAttempts = 6
+	notificationBackoff     = 2 * time.Minute
+	// notificationBatch caps jobs one run delivers, the rest wait for the next run
+	notificationBatch = 100
+)
+
+// errNotificationCancelled tells that reservation changed so that the job is not needed anymore
+var errNotificationCancelled = errors.New("notification is no longer needed")
+
+// OutboxRepo queues reminders itself when reservation is booked, rescheduled or stops being upcoming
+type OutboxRepo interface {
+	Claim(now time.Time, handle func(job *domain.Notification)) (bool, error)
+	FindFailed() ([]domain.Notification, error)
+	Retry(jobID int, now time.Time) error
+}
+
+// outbox delivers queued notifications, a job that fails is retried with backoff
+// until it runs out of attempts
+type outbox struct {
+	repo        OutboxRepo
+	reservation *reservation
+}
+
+func NewOutbox(repo OutboxRepo, reservation *reservation) *outbox {
+	return &outbox{repo: repo, reservation: reservation}
+}
+
+// DeliverDue delivers due jobs one by one, failure of one job does not hold up the others
+func (o *outbox) DeliverDue(now time.Time, notificator http_v1.NotificatorService) error {
+	for i := 0; i < notificationBatch; i++ {
+		claimed, err := o.repo.Claim(now, func(job *domain.Notification) {
+			o.deliver(job, now, notificator)
+		})
+		if err != nil {
+			return errors.Wrap(err, "delivering notifications")
+		}
+		if !claimed {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (o *outbox) deliver(job *domain.Notification, now time.Time, notificator http_v1.NotificatorService) {
+	job.Attempts++
+
+	err := o.send(job, now, notificator)
+	if err == errNotificationCancelled {
+		job.Status = domain.NotificationCancelled
+		return
+	}
+	if err != nil {
+		job.LastError = err.Error()
+		if job.Attempts >= maxNotificationAttempts {
+			job.Status = domain.NotificationFailed
+			return
+		}
+		job.NextAttemptAt = now.Add(notificationBackoff << uint(job.Attempts-1))
+		return
+	}
+
+	job.Status = domain.NotificationSent
+	job.SentAt = now
+	job.LastError = ""
+}
+
+func (o *outbox) send(job *domain.Notification, now time.Time, notificator http_v1.NotificatorService) error {
+	reservation, err := o.reservation.repo.GetReservationByID(job.Reservation.ID)
+	if errors.Is(err, domain.ErrNoRecord) {
+		return errNotificationCancelled
+	}
+	if err != nil {
+		return err
+	}
+
+	switch job.Kind {
+	case domain.NotificationReminder:
+		if (reservation.Status != domain.StatusPending && reservation.Status != domain.StatusConfirmed) ||
+			!reservation.Date.After(now) {
+			return errNotificationCancelled
+		}
+		policy, err := o.reservation.repo.GetBookingPolicy(reservation.Cafe.ID)
+		if err != nil {
+			return err
+		}
+		if !policy.WantsReminder(reservation.Date, job.ScheduledFor, now) {
+			return errNotificationCancelled
+		}
+		reservation.MinutesUntilReservation = int(reservation.Date.Sub(now).Round(time.Minute) / time.Minute)
+		return notificator.Reminder(*reservation, o.reservation.ManageToken(reservation.ID))
+	default:
+		return errors.Errorf("unknown notification kind %q", job.Kind)
+	}
+}
+
+func (o *outbox) GetFailed() ([]domain.Notification, error) {
+	return o.repo.FindFailed()
+}
+
+// Retry sends failed job again right away with a fresh set of attempts
+func (o *outbox) Retry(jobID int) error {
+	return o.repo.Retry(jobID, time.Now())
+}
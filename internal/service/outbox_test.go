@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/signer"
+)
+
+// fakeOutboxRepo claims jobs in order they were queued
+type fakeOutboxRepo struct {
+	OutboxRepo
+	jobs []*domain.Notification
+}
+
+func (f *fakeOutboxRepo) Claim(now time.Time, handle func(job *domain.Notification)) (bool, error) {
+	for _, job := range f.jobs {
+		if job.Status == domain.NotificationPending && !job.NextAttemptAt.After(now) {
+			handle(job)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeReservationLookup struct {
+	ReservationRepo
+	reservations map[int]*domain.Reservation
+}
+
+func (f *fakeReservationLookup) GetReservationByID(reservationID int) (*domain.Reservation, error) {
+	if r, ok := f.reservations[reservationID]; ok {
+		return r, nil
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeReservationLookup) GetBookingPolicy(cafeID int) (*domain.BookingPolicy, error) {
+	return &domain.BookingPolicy{CafeID: cafeID, ReminderOffsets: []int{24 * 60, 60}}, nil
+}
+
+type fakeReminderNotificator struct {
+	http_v1.NotificatorService
+	down     map[int]bool // reservations whose guests can not be reached
+	reminded []int
+}
+
+func (f *fakeReminderNotificator) Reminder(data domain.Reservation, manageToken string) error {
+	if f.down[data.ID] {
+		return errors.New("connection refused")
+	}
+	if manageToken == "" {
+		return errors.New("no link to confirm or cancel")
+	}
+	f.reminded = append(f.reminded, data.ID)
+	return nil
+}
+
+func TestOutboxDeliverDue(t *testing.T) {
+	now := time.Date(2021, 6, 4, 18, 0, 0, 0, time.UTC)
+	reservations := &fakeReservationLookup{reservations: map[int]*domain.Reservation{
+		1: {ID: 1, Status: domain.StatusConfirmed, Date: now.Add(time.Hour)},
+		2: {ID: 2, Status: domain.StatusConfirmed, Date: now.Add(24 * time.Hour)},
+		3: {ID: 3, Status: domain.StatusCancelled, Date: now.Add(time.Hour)},
+		// moved half an hour later since its reminder was scheduled an hour before
+		4: {ID: 4, Status: domain.StatusConfirmed, Date: now.Add(90 * time.Minute)},
+	}}
+	repo := &fakeOutboxRepo{}
+	for _, id := range []int{2, 1, 3, 4} {
+		repo.jobs = append(repo.jobs, &domain.Notification{ID: id, Kind: domain.NotificationReminder,
+			Reservation: domain.Reservation{ID: id}, ScheduledFor: now, Status: domain.NotificationPending,
+			NextAttemptAt: now})
+	}
+	repo.jobs[3].ScheduledFor = now.Add(-30 * time.Minute)
+	notificator := &fakeReminderNotificator{down: map[int]bool{2: true}}
+	s := NewOutbox(repo, NewReservation(reservations, signer.New("secret")))
+
+	if err := s.DeliverDue(now, notificator); err != nil {
+		t.Fatal(err)
+	}
+
+	failing, sent, cancelled, moved := repo.jobs[0], repo.jobs[1], repo.jobs[2], repo.jobs[3]
+	if sent.Status != domain.NotificationSent || !sent.SentAt.Equal(now) || len(notificator.reminded) != 1 {
+		t.Errorf("want reminder sent despite failure of the job before it; got %+v", sent)
+	}
+	if cancelled.Status != domain.NotificationCancelled {
+		t.Errorf("want reminder of cancelled reservation to be cancelled; got %s", cancelled.Status)
+	}
+	if moved.Status != domain.NotificationCancelled {
+		t.Errorf("want reminder of moved reservation to be cancelled; got %s", moved.Status)
+	}
+	if failing.Status != domain.NotificationPending || failing.Attempts != 1 || failing.LastError != "connection refused" ||
+		!failing.NextAttemptAt.Equal(now.Add(notificationBackoff)) {
+		t.Errorf("want failed job to be retried after backoff; got %+v", failing)
+	}
+
+	// every attempt waits twice as long as the one before, the last one gives up
+	for attempt := 2; attempt <= maxNotificationAttempts; attempt++ {
+		now = failing.NextAttemptAt
+		if err := s.DeliverDue(now, notificator); err != nil {
+			t.Fatal(err)
+		}
+		if attempt < maxNotificationAttempts && !failing.NextAttemptAt.Equal(now.Add(notificationBackoff<<uint(attempt-1))) {
+			t.Errorf("attempt %d: want next one in %v; got %v", attempt, notificationBackoff<<uint(attempt-1),
+				failing.NextAttemptAt.Sub(now))
+		}
+	}
+	if failing.Status != domain.NotificationFailed || failing.Attempts != maxNotificationAttempts {
+		t.Errorf("want job failed after %d attempts; got %+v", maxNotificationAttempts, failing)
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+const passwordResetTTL = time.Hour
+
+type PasswordResetRepo interface {
+	Insert(userID int, hash []byte, expiresAt time.Time) error
+	FindByHash(hash []byte) (*domain.PasswordReset, error)
+	Consume(resetID int, hashedPassword string, now time.Time) error
+}
+
+// RequestPasswordReset emails a one-time link, unknown emails are silently ignored,
+// so that the form does not tell which emails are registered
+func (u *user) RequestPasswordReset(email string, notificator http_v1.NotificatorService) error {
+	user, err := u.repo.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return errors.Wrap(err, "generating password reset token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err = u.resetRepo.Insert(user.ID, hashToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		return err
+	}
+
+	return notificator.PasswordReset(*user, token)
+}
+
+func (u *user) activePasswordReset(token string, now time.Time) (*domain.PasswordReset, error) {
+	reset, err := u.resetRepo.FindByHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return nil, domain.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if !reset.IsActive(now) {
+		return nil, domain.ErrInvalidToken
+	}
+
+	return reset, nil
+}
+
+// CheckPasswordReset lets reset page tell about used or expired link before user types new password
+func (u *user) CheckPasswordReset(token string) error {
+	_, err := u.activePasswordReset(token, time.Now())
+	return err
+}
+
+// ResetPassword takes link's token from "token" field, the password follows the rules of Save.
+// All user's sessions and tokens stop working, including the one of the current browser
+func (u *user) ResetPassword(form *forms.FormValidator) (bool, error) {
+	validatePassword(form)
+
+	if !form.Valid() {
+		return false, nil
+	}
+
+	now := time.Now()
+	reset, err := u.activePasswordReset(form.Get("token"), now)
+	if err != nil {
+		return true, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), bcryptCost)
+	if err != nil {
+		return true, errors.Wrap(err, "failed to generate hashed password")
+	}
+
+	return true, u.resetRepo.Consume(reset.ID, string(hashedPassword), now)
+}
+
+// IsSessionValid tells whether session or access token issued at authenticatedAt
+// survived revocation of user's sessions
+func (u *user) IsSessionValid(userID int, authenticatedAt time.Time) (bool, error) {
+	user, err := u.repo.GetById(userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return !authenticatedAt.Before(user.SessionsRevokedAt), nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (f *fakeUserRepo) GetByEmail(email string) (*domain.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, domain.ErrNoRecord
+}
+
+type fakePasswordResetRepo struct {
+	PasswordResetRepo
+	resets   []*domain.PasswordReset
+	password string
+}
+
+func (f *fakePasswordResetRepo) Insert(userID int, hash []byte, expiresAt time.Time) error {
+	f.resets = append(f.resets, &domain.PasswordReset{ID: len(f.resets) + 1, UserID: userID, Hash: hash, ExpiresAt: expiresAt})
+	return nil
+}
+
+func (f *fakePasswordResetRepo) FindByHash(hash []byte) (*domain.PasswordReset, error) {
+	for _, r := range f.resets {
+		if bytes.Equal(r.Hash, hash) {
+			copied := *r
+			return &copied, nil
+		}
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakePasswordResetRepo) Consume(resetID int, hashedPassword string, now time.Time) error {
+	r := f.resets[resetID-1]
+	if r.UsedAt != nil {
+		return domain.ErrInvalidToken
+	}
+	r.UsedAt = &now
+	f.password = hashedPassword
+	return nil
+}
+
+type fakeResetNotificator struct {
+	http_v1.NotificatorService
+	tokens []string
+}
+
+func (f *fakeResetNotificator) PasswordReset(user domain.User, token string) error {
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	resets := &fakePasswordResetRepo{}
+	users := NewUser(&fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "guest@example.com"},
+	}}, resets, nil, nil)
+	notificator := &fakeResetNotificator{}
+
+	if err := users.RequestPasswordReset("nobody@example.com", notificator); err != nil || len(notificator.tokens) != 0 {
+		t.Fatalf("want unknown email to be ignored; got %v, %d emails", err, len(notificator.tokens))
+	}
+	if err := users.RequestPasswordReset("guest@example.com", notificator); err != nil || len(notificator.tokens) != 1 {
+		t.Fatalf("want reset link to be emailed; got %v, %d emails", err, len(notificator.tokens))
+	}
+	token := notificator.tokens[0]
+	if bytes.Contains(resets.resets[0].Hash, []byte(token)) {
+		t.Error("want token to be stored hashed")
+	}
+
+	if err := users.CheckPasswordReset(token); err != nil {
+		t.Errorf("want fresh link to be valid; got %v", err)
+	}
+	if err := users.CheckPasswordReset("forged"); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want unknown link to be invalid; got %v", err)
+	}
+
+	form := forms.New(url.Values{"token": {token}, "password": {"abc"}})
+	if ok, err := users.ResetPassword(form); ok || err != nil || form.Errors.Get("password") == "" {
+		t.Errorf("want short password to be rejected the same way as on sign up; got %v, %v", ok, err)
+	}
+
+	if ok, err := users.ResetPassword(forms.New(url.Values{"token": {token}, "password": {"new secret"}})); !ok || err != nil {
+		t.Fatalf("want password to be reset; got %v, %v", ok, err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(resets.password), []byte("new secret")); err != nil {
+		t.Errorf("want new password to be stored as bcrypt hash; got %v", err)
+	}
+
+	if _, err := users.ResetPassword(forms.New(url.Values{"token": {token}, "password": {"other secret"}})); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want used link to be invalid; got %v", err)
+	}
+
+	resets.resets[0].UsedAt = nil
+	resets.resets[0].ExpiresAt = time.Now().Add(-time.Minute)
+	if err := users.CheckPasswordReset(token); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want expired link to be invalid; got %v", err)
+	}
+}
+
+func TestIsSessionValid(t *testing.T) {
+	revokedAt := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+	users := NewUser(&fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7},
+		8: {ID: 8, SessionsRevokedAt: revokedAt},
+	}}, nil, nil, nil)
+
+	tests := []struct {
+		name            string
+		userID          int
+		authenticatedAt time.Time
+		want            bool
+	}{
+		{"never revoked", 7, time.Unix(0, 0), true},
+		{"started before revocation", 8, revokedAt.Add(-time.Second), false},
+		{"started after revocation", 8, revokedAt.Add(time.Nanosecond), true},
+		{"deleted user", 9, revokedAt, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := users.IsSessionValid(tt.userID, tt.authenticatedAt)
+			if err != nil || got != tt.want {
+				t.Errorf("want %v; got %v, %v", tt.want, got, err)
+			}
+		})
+	}
+}
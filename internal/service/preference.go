@@ -0,0 +1,187 @@
+package service
+
+import (
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// unsubscribeLinkTTL is long, messages are read and acted upon long after they are sent
+	unsubscribeLinkTTL = 365 * 24 * time.Hour
+	// unsubscribeRequestTTL is for links emailed on request from the unsubscribe page
+	unsubscribeRequestTTL = 48 * time.Hour
+)
+
+type preference struct {
+	repo     PreferenceRepo
+	userRepo UserRepo
+	signer   Signer
+}
+
+func NewPreference(repo PreferenceRepo, userRepo UserRepo, signer Signer) *preference {
+	return &preference{repo: repo, userRepo: userRepo, signer: signer}
+}
+
+type PreferenceRepo interface {
+	FindPreferences(userID int) (domain.NotifyPreferences, error)
+	SavePreferences(userID int, preferences domain.NotifyPreferences) error
+	IsEmailUnsubscribed(email string, topic domain.NotifyTopic) (bool, error)
+	UnsubscribeEmail(email string, topics []domain.NotifyTopic) error
+	IsGuestEmail(email string) (bool, error)
+}
+
+// unsubscribeValue binds the link to the subscriber and channel, guests are unsubscribed by email address
+func unsubscribeValue(sub domain.Subscriber, topics []domain.NotifyTopic, channel domain.NotifyChannel) string {
+	names := make([]string, len(topics))
+	for i, topic := range topics {
+		names[i] = string(topic)
+	}
+
+	return "unsubscribe:" + strings.Join(names, ",") + ":" + string(channel) + ":" +
+		strconv.Itoa(sub.UserID) + ":" + sub.Email
+}
+
+// IsSubscribed tells whether subscriber gets messages of the topic by the channel.
+// Guests have no preferences, they get defaults by email until they unsubscribe the address
+func (p *preference) IsSubscribed(sub domain.Subscriber, topic domain.NotifyTopic, channel domain.NotifyChannel) (bool, error) {
+	if !topic.IsValid() {
+		return false, domain.ErrUnknownTopic
+	}
+
+	if sub.UserID > 0 {
+		preferences, err := p.repo.FindPreferences(sub.UserID)
+		if err != nil {
+			return false, err
+		}
+		return preferences.Subscribed(topic, channel, sub.Preferred), nil
+	}
+
+	if !domain.NotifyPreferences(nil).Subscribed(topic, channel, domain.NotifyEmail) {
+		return false, nil
+	}
+	unsubscribed, err := p.repo.IsEmailUnsubscribed(sub.Email, topic)
+	if err != nil {
+		return false, err
+	}
+
+	return !unsubscribed, nil
+}
+
+// UnsubscribeToken is put in every message of the topic, it unsubscribes from the topic by that channel only
+func (p *preference) UnsubscribeToken(sub domain.Subscriber, topic domain.NotifyTopic, channel domain.NotifyChannel) string {
+	return p.signer.Sign(unsubscribeValue(sub, []domain.NotifyTopic{topic}, channel), time.Now().Add(unsubscribeLinkTTL))
+}
+
+// Unsubscribe turns off topics the token was issued for and returns them
+func (p *preference) Unsubscribe(token string) ([]domain.NotifyTopic, error) {
+	return p.unsubscribe(token, time.Now())
+}
+
+func (p *preference) unsubscribe(token string, now time.Time) ([]domain.NotifyTopic, error) {
+	value, err := p.signer.Verify(token, now)
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	parts := strings.SplitN(value, ":", 5)
+	if len(parts) != 5 || parts[0] != "unsubscribe" {
+		return nil, domain.ErrInvalidToken
+	}
+	var topics []domain.NotifyTopic
+	for _, name := range strings.Split(parts[1], ",") {
+		topic := domain.NotifyTopic(name)
+		if !topic.IsValid() {
+			return nil, domain.ErrInvalidToken
+		}
+		topics = append(topics, topic)
+	}
+	channel := domain.NotifyChannel(parts[2])
+	if !channel.IsValid() {
+		return nil, domain.ErrInvalidToken
+	}
+	userID, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	if userID < 1 {
+		return topics, p.repo.UnsubscribeEmail(parts[4], topics)
+	}
+
+	user, err := p.userRepo.GetById(userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return nil, domain.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if user.Email != parts[4] {
+		return nil, domain.ErrInvalidToken
+	}
+
+	preferences := domain.NotifyPreferences{}
+	for _, topic := range topics {
+		preferences.Set(topic, channel, false)
+	}
+
+	return topics, p.repo.SavePreferences(userID, preferences)
+}
+
+// RequestEmailUnsubscribe emails a link that unsubscribes the address from every topic,
+// addresses nobody booked with get no email, the same as the page tells
+func (p *preference) RequestEmailUnsubscribe(email string, notificator http_v1.NotificatorService) error {
+	sub := domain.Subscriber{UserID: -1, Email: email}
+
+	user, err := p.userRepo.GetByEmail(email)
+	switch {
+	case err == nil:
+		sub.UserID, sub.Email = user.ID, user.Email
+	case errors.Is(err, domain.ErrNoRecord):
+		known, err := p.repo.IsGuestEmail(email)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return nil
+		}
+	default:
+		return err
+	}
+
+	token := p.signer.Sign(unsubscribeValue(sub, domain.NotifyTopics, domain.NotifyEmail),
+		time.Now().Add(unsubscribeRequestTTL))
+
+	return notificator.UnsubscribeConfirmation(sub.Email, token)
+}
+
+// UpdatePreferences replaces user's choices, channels other than email need mobile number
+func (p *preference) UpdatePreferences(userID int, preferences domain.NotifyPreferences) error {
+	user, err := p.userRepo.GetById(userID)
+	if err != nil {
+		return err
+	}
+
+	for topic, channels := range preferences {
+		if !topic.IsValid() {
+			return domain.ErrUnknownTopic
+		}
+		for channel, subscribed := range channels {
+			if !channel.IsValid() {
+				return domain.ErrUnknownChannel
+			}
+			if subscribed && channel.NeedsMobile() && user.Mobile == "" {
+				return domain.ErrNoMobile
+			}
+		}
+	}
+
+	return p.repo.SavePreferences(userID, preferences)
+}
+
+func (p *preference) GetPreferences(userID int) (domain.NotifyPreferences, error) {
+	return p.repo.FindPreferences(userID)
+}
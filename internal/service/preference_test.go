@@ -0,0 +1,216 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/signer"
+)
+
+type fakePreferenceRepo struct {
+	preferences  map[int]domain.NotifyPreferences
+	unsubscribed map[string]bool
+	guests       []string
+}
+
+func (f *fakePreferenceRepo) FindPreferences(userID int) (domain.NotifyPreferences, error) {
+	preferences := domain.NotifyPreferences{}
+	for topic, channels := range f.preferences[userID] {
+		for channel, subscribed := range channels {
+			preferences.Set(topic, channel, subscribed)
+		}
+	}
+	return preferences, nil
+}
+
+func (f *fakePreferenceRepo) SavePreferences(userID int, preferences domain.NotifyPreferences) error {
+	if f.preferences[userID] == nil {
+		f.preferences[userID] = domain.NotifyPreferences{}
+	}
+	for topic, channels := range preferences {
+		for channel, subscribed := range channels {
+			f.preferences[userID].Set(topic, channel, subscribed)
+		}
+	}
+	return nil
+}
+
+func (f *fakePreferenceRepo) IsEmailUnsubscribed(email string, topic domain.NotifyTopic) (bool, error) {
+	return f.unsubscribed[strings.ToLower(email)+":"+string(topic)], nil
+}
+
+func (f *fakePreferenceRepo) UnsubscribeEmail(email string, topics []domain.NotifyTopic) error {
+	for _, topic := range topics {
+		f.unsubscribed[strings.ToLower(email)+":"+string(topic)] = true
+	}
+	return nil
+}
+
+func (f *fakePreferenceRepo) IsGuestEmail(email string) (bool, error) {
+	for _, guest := range f.guests {
+		if strings.EqualFold(guest, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeUnsubscribeNotificator struct {
+	http_v1.NotificatorService
+	emails []string
+	tokens []string
+}
+
+func (f *fakeUnsubscribeNotificator) UnsubscribeConfirmation(email, token string) error {
+	f.emails = append(f.emails, email)
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func newTestPreference() (*preference, *fakePreferenceRepo, *fakeUserRepo) {
+	repo := &fakePreferenceRepo{preferences: map[int]domain.NotifyPreferences{}, unsubscribed: map[string]bool{},
+		guests: []string{"guest@mail.kz"}}
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "user@mail.kz", NotifyChannel: domain.NotifySMS},
+	}}
+	return NewPreference(repo, users, signer.New("secret")), repo, users
+}
+
+func TestPreferenceIsSubscribed(t *testing.T) {
+	p, repo, _ := newTestPreference()
+	user := domain.Subscriber{UserID: 7, Email: "user@mail.kz", Preferred: domain.NotifySMS}
+	guest := domain.Subscriber{UserID: -1, Email: "Guest@mail.kz", Preferred: domain.NotifySMS}
+
+	tests := []struct {
+		name    string
+		sub     domain.Subscriber
+		topic   domain.NotifyTopic
+		channel domain.NotifyChannel
+		want    bool
+	}{
+		{"user by preferred channel", user, domain.TopicReminders, domain.NotifySMS, true},
+		{"user by other channel", user, domain.TopicReminders, domain.NotifyEmail, false},
+		{"user marketing", user, domain.TopicMarketing, domain.NotifySMS, false},
+		{"user turned on", user, domain.TopicMarketing, domain.NotifyEmail, true},
+		{"guest by email", guest, domain.TopicReminders, domain.NotifyEmail, true},
+		{"guest by sms", guest, domain.TopicReminders, domain.NotifySMS, false},
+		{"guest marketing", guest, domain.TopicMarketing, domain.NotifyEmail, false},
+		{"guest unsubscribed", guest, domain.TopicAnnouncements, domain.NotifyEmail, false},
+	}
+
+	repo.preferences[7] = domain.NotifyPreferences{}
+	repo.preferences[7].Set(domain.TopicMarketing, domain.NotifyEmail, true)
+	repo.unsubscribed["guest@mail.kz:"+string(domain.TopicAnnouncements)] = true
+
+	for _, tt := range tests {
+		got, err := p.IsSubscribed(tt.sub, tt.topic, tt.channel)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: want subscribed %v; got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := p.IsSubscribed(user, "weather", domain.NotifyEmail); !errors.Is(err, domain.ErrUnknownTopic) {
+		t.Errorf("want unknown topic to be rejected; got %v", err)
+	}
+}
+
+func TestPreferenceUnsubscribe(t *testing.T) {
+	p, repo, users := newTestPreference()
+	user := domain.Subscriber{UserID: 7, Email: "user@mail.kz", Preferred: domain.NotifySMS}
+	guest := domain.Subscriber{UserID: -1, Email: "guest@mail.kz", Preferred: domain.NotifyEmail}
+	now := time.Now()
+
+	token := p.UnsubscribeToken(user, domain.TopicReminders, domain.NotifySMS)
+	if _, err := p.unsubscribe(token, now.Add(unsubscribeLinkTTL+time.Second)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want expired link to be invalid; got %v", err)
+	}
+	forged := signer.New("guess").Sign(unsubscribeValue(user, domain.NotifyTopics, domain.NotifySMS), now.Add(time.Hour))
+	if _, err := p.Unsubscribe(forged); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want forged link to be invalid; got %v", err)
+	}
+	users.users[7].Email = "changed@mail.kz"
+	if _, err := p.Unsubscribe(token); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want link sent to previous email to be invalid; got %v", err)
+	}
+	users.users[7].Email = "user@mail.kz"
+
+	topics, err := p.Unsubscribe(token)
+	if err != nil || len(topics) != 1 || topics[0] != domain.TopicReminders {
+		t.Fatalf("want user unsubscribed from reminders; got %v, %v", topics, err)
+	}
+	if subscribed, _ := p.IsSubscribed(user, domain.TopicReminders, domain.NotifySMS); subscribed {
+		t.Error("want reminders by sms to be off")
+	}
+	if len(repo.preferences[7]) != 1 || len(repo.preferences[7][domain.TopicReminders]) != 1 {
+		t.Errorf("want the other choices left as they were; got %v", repo.preferences[7])
+	}
+
+	token = p.UnsubscribeToken(guest, domain.TopicReminders, domain.NotifyEmail)
+	if _, err = p.Unsubscribe(token); err != nil {
+		t.Fatal(err)
+	}
+	if subscribed, _ := p.IsSubscribed(guest, domain.TopicReminders, domain.NotifyEmail); subscribed {
+		t.Error("want guest's address unsubscribed from reminders")
+	}
+}
+
+func TestPreferenceRequestEmailUnsubscribe(t *testing.T) {
+	p, repo, _ := newTestPreference()
+	notificator := &fakeUnsubscribeNotificator{}
+
+	if err := p.RequestEmailUnsubscribe("stranger@mail.kz", notificator); err != nil || len(notificator.tokens) != 0 {
+		t.Fatalf("want address nobody booked with to get no email; got %v, %d emails", err, len(notificator.tokens))
+	}
+	if err := p.RequestEmailUnsubscribe("GUEST@mail.kz", notificator); err != nil || len(notificator.tokens) != 1 {
+		t.Fatalf("want guest to get the link; got %v, %d emails", err, len(notificator.tokens))
+	}
+	if err := p.RequestEmailUnsubscribe("user@mail.kz", notificator); err != nil || len(notificator.tokens) != 2 {
+		t.Fatalf("want user to get the link; got %v, %d emails", err, len(notificator.tokens))
+	}
+
+	for _, token := range notificator.tokens {
+		topics, err := p.Unsubscribe(token)
+		if err != nil || len(topics) != len(domain.NotifyTopics) {
+			t.Fatalf("want link to unsubscribe from every topic; got %v, %v", topics, err)
+		}
+	}
+	for _, topic := range domain.NotifyTopics {
+		if !repo.unsubscribed["guest@mail.kz:"+string(topic)] {
+			t.Errorf("want guest unsubscribed from %s", topic)
+		}
+		if subscribed, _ := p.IsSubscribed(domain.Subscriber{UserID: 7, Preferred: domain.NotifyEmail}, topic,
+			domain.NotifyEmail); subscribed {
+			t.Errorf("want user unsubscribed from %s by email", topic)
+		}
+	}
+}
+
+func TestPreferenceUpdate(t *testing.T) {
+	p, repo, users := newTestPreference()
+
+	preferences := domain.NotifyPreferences{}
+	preferences.Set(domain.TopicMarketing, domain.NotifySMS, true)
+	if err := p.UpdatePreferences(7, preferences); !errors.Is(err, domain.ErrNoMobile) {
+		t.Errorf("want sms without mobile number to be rejected; got %v", err)
+	}
+
+	users.users[7].Mobile = "87011234567"
+	if err := p.UpdatePreferences(7, preferences); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.preferences[7].Subscribed(domain.TopicMarketing, domain.NotifySMS, domain.NotifyEmail) {
+		t.Error("want marketing by sms to be saved")
+	}
+
+	preferences.Set("weather", domain.NotifyEmail, true)
+	if err := p.UpdatePreferences(7, preferences); !errors.Is(err, domain.ErrUnknownTopic) {
+		t.Errorf("want unknown topic to be rejected; got %v", err)
+	}
+}
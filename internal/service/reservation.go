@@ -6,41 +6,58 @@ import (
 	"github.com/CyganFx/table-reservation/internal/domain"
 	"github.com/CyganFx/table-reservation/pkg/validator/forms"
 	"github.com/pkg/errors"
+	"sort"
 	"strconv"
 	"time"
 )
 
 const (
-	reservationInterval          = 90
-	maxDaysToBookInAdvance       = 7
-	amountOfHoursRestaurantWorks = 15 // for now let every restaurant work from 11:00 to 2:00
-	possibleBookingsPerHour      = 4
-	restaurantOpeningTimeHours   = 11
-	maxTableCapacity             = 8 //assume that max table size is 8 for all restaurants
-	bookTimeSelectInterval       = 15
-
-	dateLayout          = "2006-01-02"
-	timeLayout          = "15:04:05"
-	minutesBeforeNotify = 60
+	bookTimeSelectInterval = 15
+
+	dateLayout  = "2006-01-02"
+	clockLayout = "15:04"
+
+	manageLinkTTL = 120 * 24 * time.Hour
+	// tableHoldTTL is how long chosen tables are kept for guest filling in the confirmation form
+	tableHoldTTL = 5 * time.Minute
+
+	maxJoinedTables = 4
 )
 
 type reservation struct {
-	repo ReservationRepo
+	repo   ReservationRepo
+	signer Signer
+}
+
+func NewReservation(repo ReservationRepo, signer Signer) *reservation {
+	return &reservation{repo: repo, signer: signer}
 }
 
-func NewReservation(repo ReservationRepo) *reservation {
-	return &reservation{repo: repo}
+// Signer signs values put in links that are sent to guests
+type Signer interface {
+	Sign(value string, expires time.Time) string
+	Verify(token string, now time.Time) (string, error)
 }
 
 type ReservationRepo interface {
-	GetSuitableTables(cafeID, partySize, locationID int, date, minPossibleBookingTime, maxPossibleBookingTime string) ([]domain.Table, error)
-	GetBusyTables(cafeID, partySize, locationID int, date, minPossibleBookingTime, maxPossibleBookingTime string) ([]domain.Table, error)
+	GetSuitableTables(cafeID, partySize, locationID, exceptReservationID int, start, end time.Time) ([]domain.Table, error)
+	GetBusyTables(cafeID, partySize, locationID int, start, end time.Time) ([]domain.Table, error)
 	GetAvailableLocationsByCafeID(cafeID int) ([]domain.Location, error)
 	GetAvailableEventsByCafeID(cafeID int) ([]domain.Event, error)
 	BookTable(reservation *domain.Reservation) error
+	BookHeldTable(reservation *domain.Reservation, holdID int) error
+	HoldTables(hold *domain.TableHold) error
+	ReleaseHold(holdID int) error
+	DeleteExpiredHolds(now time.Time) (int64, error)
 	GetUserReservations(userID int) ([]domain.Reservation, error)
-	GetReservationsByNotifyDate(now time.Time) ([]domain.Reservation, error)
-	FreeTable(reservation *domain.Reservation, minBookDate, maxBookDate time.Time) error
+	FreeTable(reservation *domain.Reservation, start, end time.Time) ([]int, error)
+	GetBookingPolicy(cafeID int) (*domain.BookingPolicy, error)
+	GetReservationByID(reservationID int) (*domain.Reservation, error)
+	GetCafeReservations(cafeID int) ([]domain.Reservation, error)
+	UpdateStatus(reservationID int, from, to domain.ReservationStatus, changedBy int) error
+	UpdateReservationDate(reservation *domain.Reservation) error
+	ConfirmVisit(reservationID int, at time.Time) error
+	GetTableJoins(cafeID int) ([]domain.TableJoin, error)
 }
 
 func (r *reservation) GetLocationsByCafeID(cafeID int) ([]domain.Location, error) {
@@ -52,51 +69,237 @@ func (r *reservation) GetEventsByCafeID(cafeID int) ([]domain.Event, error) {
 }
 
 func (r *reservation) GetAvailableTables(cafeID, partySize, locationID int, date, bookTime string) ([]domain.Table, error) {
-	tempTime, _ := time.Parse("15:04", bookTime)
-	// postgres between operation is inclusive for greater value, therefore we need to extract to fit in range
-	tempMaxPossibleBookingTime := tempTime.Add((reservationInterval - 1) * time.Minute)
-	tempMinPossibleBookingTime := tempTime.Add(-(reservationInterval - 1) * time.Minute)
+	policy, err := r.repo.GetBookingPolicy(cafeID)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := bookingPeriod(policy, date, bookTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBookingPolicy(policy, partySize, date, start, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return r.repo.GetSuitableTables(cafeID, partySize, locationID, 0, start, end)
+}
+
+// GetTableCombinations proposes joined tables when none of free tables seats the party alone
+func (r *reservation) GetTableCombinations(cafeID, partySize, locationID int, date, bookTime string) ([]domain.TableCombination, error) {
+	policy, err := r.repo.GetBookingPolicy(cafeID)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := bookingPeriod(policy, date, bookTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBookingPolicy(policy, partySize, date, start, time.Now()); err != nil {
+		return nil, err
+	}
+
+	_, combinations, err := r.seatingOptions(cafeID, partySize, locationID, 0, start, end)
+	return combinations, err
+}
 
-	maxPossibleBookingTime :=
-		strconv.Itoa(tempMaxPossibleBookingTime.Hour()) + ":" + strconv.Itoa(tempMaxPossibleBookingTime.Minute())
+// seatingOptions returns free tables seating the party alone,
+// or combinations of joinable free tables if there are none
+func (r *reservation) seatingOptions(cafeID, partySize, locationID, exceptReservationID int, start, end time.Time) ([]domain.Table, []domain.TableCombination, error) {
+	free, err := r.repo.GetSuitableTables(cafeID, 1, locationID, exceptReservationID, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tables []domain.Table
+	for _, t := range free {
+		if t.Capacity >= partySize {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) > 0 {
+		return tables, nil, nil
+	}
 
-	minPossibleBookingTime :=
-		strconv.Itoa(tempMinPossibleBookingTime.Hour()) + ":" + strconv.Itoa(tempMinPossibleBookingTime.Minute())
+	joins, err := r.repo.GetTableJoins(cafeID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return r.repo.GetSuitableTables(cafeID, partySize, locationID, date, minPossibleBookingTime, maxPossibleBookingTime)
+	return nil, tableCombinations(free, joins, partySize), nil
 }
 
-func (r *reservation) GetBusyTables(cafeID, partySize, locationID int, date, bookTime string) ([]domain.Table, error) {
-	tempTime, _ := time.Parse("15:04", bookTime)
-	// postgres between operation is inclusive for greater value, therefore we need to extract to fit in range
-	tempMaxPossibleBookingTime := tempTime.Add((reservationInterval - 1) * time.Minute)
-	tempMinPossibleBookingTime := tempTime.Add(-(reservationInterval - 1) * time.Minute)
+// tableCombinations finds sets of joined free tables seating the party.
+// Every set is minimal, without any of its tables the party would not fit,
+// and sets with less spare seats go first, so that large tables are not wasted
+func tableCombinations(free []domain.Table, joins []domain.TableJoin, partySize int) []domain.TableCombination {
+	byID := make(map[int]domain.Table)
+	for _, t := range free {
+		byID[t.ID] = t
+	}
+	neighbours := make(map[int][]int)
+	for _, j := range joins {
+		_, ok := byID[j.Table.ID]
+		_, joinedOk := byID[j.JoinedTable.ID]
+		if ok && joinedOk {
+			neighbours[j.Table.ID] = append(neighbours[j.Table.ID], j.JoinedTable.ID)
+			neighbours[j.JoinedTable.ID] = append(neighbours[j.JoinedTable.ID], j.Table.ID)
+		}
+	}
+
+	var combinations []domain.TableCombination
+	seen := make(map[string]bool)
+
+	var grow func(tables []domain.Table)
+	grow = func(tables []domain.Table) {
+		combination := domain.TableCombination{Tables: tables}
+		if seen[combination.Value()] {
+			return
+		}
+		seen[combination.Value()] = true
+
+		if combination.Capacity() >= partySize {
+			if len(tables) > 1 && isMinimalCombination(combination, partySize) {
+				combinations = append(combinations, combination)
+			}
+			return
+		}
+		if len(tables) == maxJoinedTables {
+			return
+		}
+
+		for _, t := range tables {
+			for _, id := range neighbours[t.ID] {
+				if containsTable(tables, id) {
+					continue
+				}
+				next := append(append([]domain.Table{}, tables...), byID[id])
+				sort.Slice(next, func(i, j int) bool { return next[i].ID < next[j].ID })
+				grow(next)
+			}
+		}
+	}
+	for _, t := range free {
+		grow([]domain.Table{t})
+	}
 
-	maxPossibleBookingTime :=
-		strconv.Itoa(tempMaxPossibleBookingTime.Hour()) + ":" + strconv.Itoa(tempMaxPossibleBookingTime.Minute())
+	sort.SliceStable(combinations, func(i, j int) bool {
+		if combinations[i].Capacity() != combinations[j].Capacity() {
+			return combinations[i].Capacity() < combinations[j].Capacity()
+		}
+		return len(combinations[i].Tables) < len(combinations[j].Tables)
+	})
+
+	return combinations
+}
+
+func isMinimalCombination(combination domain.TableCombination, partySize int) bool {
+	for _, t := range combination.Tables {
+		if combination.Capacity()-t.Capacity >= partySize {
+			return false
+		}
+	}
+	return true
+}
+
+func containsTable(tables []domain.Table, id int) bool {
+	for _, t := range tables {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
 
-	minPossibleBookingTime :=
-		strconv.Itoa(tempMinPossibleBookingTime.Hour()) + ":" + strconv.Itoa(tempMinPossibleBookingTime.Minute())
+// areJoined checks that partner allowed to put all the tables together
+func areJoined(ids []int, joins []domain.TableJoin) bool {
+	reached := map[int]bool{ids[0]: true}
+	for changed := true; changed; {
+		changed = false
+		for _, j := range joins {
+			if reached[j.Table.ID] != reached[j.JoinedTable.ID] &&
+				containsID(ids, j.Table.ID) && containsID(ids, j.JoinedTable.ID) {
+				reached[j.Table.ID], reached[j.JoinedTable.ID] = true, true
+				changed = true
+			}
+		}
+	}
+	return len(reached) == len(ids)
+}
 
-	return r.repo.GetBusyTables(cafeID, partySize, locationID, date, minPossibleBookingTime, maxPossibleBookingTime)
+func containsID(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
 }
 
-func setBookAndNotifyDate(strBookDate, strBookTime string, bookDate, notifyDate *time.Time) error {
-	partialDate, err := time.Parse(dateLayout, strBookDate)
+func (r *reservation) GetBusyTables(cafeID, partySize, locationID int, date, bookTime string) ([]domain.Table, error) {
+	policy, err := r.repo.GetBookingPolicy(cafeID)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := bookingPeriod(policy, date, bookTime)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse string date")
+		return nil, err
 	}
 
-	bookTime, err := time.Parse(timeLayout, strBookTime)
+	return r.repo.GetBusyTables(cafeID, partySize, locationID, start, end)
+}
+
+// bookingPeriod converts the date and wall clock time chosen in the cafe's time zone
+// to the period a reservation occupies the table.
+// The date is the cafe's working day, so times earlier than its opening belong to the night after it,
+// e.g. 01:00 of Friday is booked for Saturday 01:00 when cafe works on Friday from 11:00 to 2:00
+func bookingPeriod(policy *domain.BookingPolicy, strDate, strTime string) (time.Time, time.Time, error) {
+	date, err := time.ParseInLocation(dateLayout, strDate, policy.Location)
+	if err != nil {
+		return time.Time{}, time.Time{}, domain.ErrBookingNotAllowed
+	}
+	clock, err := time.Parse(clockLayout, strTime)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse string bookTime")
+		return time.Time{}, time.Time{}, domain.ErrBookingNotAllowed
 	}
 
-	*bookDate = partialDate.Add(time.Hour*time.Duration(bookTime.Hour()) +
-		time.Minute*time.Duration(bookTime.Minute()) +
-		time.Second*time.Duration(bookTime.Second()))
+	hours := policy.HoursOn(date.Weekday())
+	minutes := clock.Hour()*60 + clock.Minute()
+	if minutes < hours.OpensAt {
+		minutes += 24 * 60
+	}
+	if hours.IsClosed || minutes-hours.OpensAt+policy.ReservationInterval > hours.WorkingMinutes() {
+		return time.Time{}, time.Time{}, domain.ErrBookingNotAllowed
+	}
 
-	*notifyDate = bookDate.Add(time.Minute * time.Duration(-minutesBeforeNotify))
+	// time.Date normalizes minutes overflowing the day into the next date
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, minutes, 0, 0, policy.Location)
+	if start.Hour() != clock.Hour() || start.Minute() != clock.Minute() {
+		// the wall clock time is skipped by switching to daylight saving time
+		return time.Time{}, time.Time{}, domain.ErrBookingNotAllowed
+	}
+
+	return start, start.Add(time.Duration(policy.ReservationInterval) * time.Minute), nil
+}
+
+// checkBookingPolicy verifies that guest books in the future within allowed days and party size,
+// strDate is the cafe's working day the booking starting at start belongs to
+func checkBookingPolicy(policy *domain.BookingPolicy, partySize int, strDate string, start, now time.Time) error {
+	if partySize < 1 || partySize > policy.MaxPartySize {
+		return domain.ErrBookingNotAllowed
+	}
+	if !start.After(now) {
+		return domain.ErrBookingNotAllowed
+	}
+
+	date, err := time.ParseInLocation(dateLayout, strDate, policy.Location)
+	if err != nil {
+		return domain.ErrBookingNotAllowed
+	}
+	now = now.In(policy.Location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, policy.Location)
+	if date.After(today.AddDate(0, 0, policy.MaxDaysInAdvance)) {
+		return domain.ErrBookingNotAllowed
+	}
 
 	return nil
 }
@@ -112,22 +315,28 @@ func (r *reservation) BookTable(form *forms.FormValidator, userChoice http_v1.Us
 		return -1, form, nil
 	}
 
-	var bookDate, notifyDate time.Time
-	strBookTime := userChoice.BookTime + ":00"
-
-	err := setBookAndNotifyDate(userChoice.Date, strBookTime, &bookDate, &notifyDate)
+	policy, err := r.repo.GetBookingPolicy(userChoice.CafeID)
+	if err != nil {
+		return -1, form, err
+	}
+	start, end, err := bookingPeriod(policy, userChoice.Date, userChoice.BookTime)
+	if err != nil {
+		return -1, form, err
+	}
+	err = checkBookingPolicy(policy, userChoice.PartySize, userChoice.Date, start, time.Now())
 	if err != nil {
 		return -1, form, err
 	}
 
 	reservation := domain.NewReservation()
+	reservation.Status = domain.StatusConfirmed
 	if userID != nil {
 		reservation.User.ID = userID.(int)
 	} else {
 		reservation.User.ID = -1
 	}
-	reservation.Date = bookDate
-	reservation.NotifyDate = notifyDate
+	reservation.Date = start
+	reservation.EndDate = end
 	reservation.CustName = form.Get("name")
 	reservation.CustMobile = form.Get("mobile")
 	reservation.CustEmail = form.Get("email")
@@ -137,69 +346,218 @@ func (r *reservation) BookTable(form *forms.FormValidator, userChoice http_v1.Us
 	reservation.PartySize = userChoice.PartySize
 	reservation.EventDescription = userChoice.EventDescription
 
-	if err := r.repo.BookTable(reservation); err != nil {
+	if err = r.checkJoinedTables(userChoice); err != nil {
+		return -1, form, err
+	}
+	// held tables were checked when the hold was taken and are busy for everyone now
+	if userChoice.HoldID == 0 {
+		if err = r.checkSeating(userChoice, start, end); err != nil {
+			return -1, form, err
+		}
+	}
+	for _, id := range userChoice.JoinedTableIDs {
+		reservation.JoinedTables = append(reservation.JoinedTables, domain.Table{ID: id})
+	}
+
+	if userChoice.HoldID != 0 {
+		err = r.repo.BookHeldTable(reservation, userChoice.HoldID)
+	} else {
+		err = r.repo.BookTable(reservation)
+	}
+	if err != nil {
 		return -1, nil, err
 	}
 
 	return reservation.ID, nil, nil
 }
 
-func (r *reservation) BookTableManually(userChoice http_v1.UserChoice, userID interface{}) (int, error) {
-	var bookDate, notifyDate time.Time
-	strBookTime := userChoice.BookTime + ":00"
+// checkJoinedTables makes sure that partner allowed to put the chosen tables together
+func (r *reservation) checkJoinedTables(userChoice http_v1.UserChoice) error {
+	if len(userChoice.JoinedTableIDs) == 0 {
+		return nil
+	}
 
-	err := setBookAndNotifyDate(userChoice.Date, strBookTime, &bookDate, &notifyDate)
+	joins, err := r.repo.GetTableJoins(userChoice.CafeID)
 	if err != nil {
-		return -1, err
+		return err
+	}
+	if !areJoined(append([]int{userChoice.TableID}, userChoice.JoinedTableIDs...), joins) {
+		return domain.ErrBookingNotAllowed
 	}
 
-	reservation := domain.NewReservation()
-	if userID != nil {
-		reservation.User.ID = userID.(int)
+	return nil
+}
+
+// checkSeating makes sure that the chosen tables are among seatingOptions, that is they are at the chosen location
+// and seat the party, the same way as guest is offered them. It fails with ErrTableTaken when any of them is not free
+func (r *reservation) checkSeating(userChoice http_v1.UserChoice, start, end time.Time) error {
+	tables, combinations, err := r.seatingOptions(userChoice.CafeID, userChoice.PartySize, userChoice.LocationID,
+		0, start, end)
+	if err != nil {
+		return err
+	}
+
+	chosen := append([]int{userChoice.TableID}, userChoice.JoinedTableIDs...)
+	sort.Ints(chosen)
+	if len(chosen) == 1 {
+		if containsTable(tables, chosen[0]) {
+			return nil
+		}
 	} else {
-		reservation.User.ID = -1
+		var want domain.TableCombination
+		for _, id := range chosen {
+			want.Tables = append(want.Tables, domain.Table{ID: id})
+		}
+		for _, combination := range combinations {
+			if combination.Value() == want.Value() {
+				return nil
+			}
+		}
 	}
 
-	reservation.Date = bookDate
-	reservation.Cafe.ID = userChoice.CafeID
-	reservation.Table.ID = userChoice.TableID
-	reservation.Event.ID = 1 // default value
+	free, err := r.repo.GetSuitableTables(userChoice.CafeID, 1, userChoice.LocationID, 0, start, end)
+	if err != nil {
+		return err
+	}
+	for _, id := range chosen {
+		if !containsTable(free, id) {
+			return domain.ErrTableTaken
+		}
+	}
+	return domain.ErrBookingNotAllowed
+}
 
-	if err := r.repo.BookTable(reservation); err != nil {
-		return -1, err
+// HoldTables keeps the chosen tables for the guest while they fill in the confirmation form,
+// BookTable turns the hold into reservation
+func (r *reservation) HoldTables(userChoice http_v1.UserChoice) (*domain.TableHold, error) {
+	policy, err := r.repo.GetBookingPolicy(userChoice.CafeID)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := bookingPeriod(policy, userChoice.Date, userChoice.BookTime)
+	if err != nil {
+		return nil, err
+	}
+	err = checkBookingPolicy(policy, userChoice.PartySize, userChoice.Date, start, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err = r.checkJoinedTables(userChoice); err != nil {
+		return nil, err
+	}
+	if err = r.checkSeating(userChoice, start, end); err != nil {
+		return nil, err
 	}
 
-	return reservation.ID, nil
+	hold := &domain.TableHold{
+		CafeID:    userChoice.CafeID,
+		Start:     start,
+		End:       end,
+		ExpiresAt: time.Now().Add(tableHoldTTL).In(policy.Location),
+	}
+	for _, id := range append([]int{userChoice.TableID}, userChoice.JoinedTableIDs...) {
+		hold.Tables = append(hold.Tables, domain.Table{ID: id})
+	}
+
+	if err = r.repo.HoldTables(hold); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
 }
 
-func (r *reservation) FreeTableManually(userChoice http_v1.UserChoice, userID interface{}) error {
-	var bookDate, notifyDate time.Time
-	strBookTime := userChoice.BookTime + ":00"
+func (r *reservation) ReleaseHold(holdID int) error {
+	return r.repo.ReleaseHold(holdID)
+}
 
-	err := setBookAndNotifyDate(userChoice.Date, strBookTime, &bookDate, &notifyDate)
+// ExpireHolds frees tables of guests who did not submit the confirmation form in time
+func (r *reservation) ExpireHolds(now time.Time) error {
+	_, err := r.repo.DeleteExpiredHolds(now)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "expiring table holds")
 	}
 
-	reservation := domain.NewReservation()
-	if userID != nil {
-		reservation.User.ID = userID.(int)
-	} else {
-		reservation.User.ID = -1
+	return nil
+}
+
+// BookTableManually is partner's action, it fails with ErrAccessDenied when the choice is not of actor's cafe.
+// Guest's contacts are optional: walk-ins leave them empty, guests booking over the phone give them to be notified.
+// Reservation belongs to no account, staff who made it is in the audit log
+func (r *reservation) BookTableManually(actor *domain.CafeMember, form *forms.FormValidator, userChoice http_v1.UserChoice) (int, *forms.FormValidator, error) {
+	if err := actor.Authorize(userChoice.CafeID, domain.PermissionReservationBook); err != nil {
+		return -1, nil, err
+	}
+
+	if form.Get("mobile") != "" || form.Get("email") != "" {
+		form.Required("name")
+	}
+	form.MatchesPattern("email", forms.EmailRX)
+	form.MinLength("mobile", 11)
+	form.MaxLength("mobile", 12)
+	form.MaxLength("name", 50)
+	form.MaxLength("email", 100)
+	if !form.Valid() {
+		return -1, form, nil
+	}
+
+	policy, err := r.repo.GetBookingPolicy(userChoice.CafeID)
+	if err != nil {
+		return -1, nil, err
+	}
+	start, end, err := bookingPeriod(policy, userChoice.Date, userChoice.BookTime)
+	if err != nil {
+		return -1, nil, err
 	}
 
-	minBookDate := bookDate.Add(-(reservationInterval - 1) * time.Minute)
-	maxBookDate := bookDate.Add((reservationInterval - 1) * time.Minute)
+	// staff seat guests by the same rules guests book by
+	if err = r.checkSeating(userChoice, start, end); err != nil {
+		return -1, nil, err
+	}
 
+	reservation := domain.NewReservation()
+	reservation.Status = domain.StatusConfirmed
+	reservation.User.ID = -1
+	reservation.Date = start
+	reservation.EndDate = end
 	reservation.Cafe.ID = userChoice.CafeID
 	reservation.Table.ID = userChoice.TableID
 	reservation.Event.ID = 1 // default value
+	reservation.PartySize = userChoice.PartySize
+	reservation.CustName = form.Get("name")
+	reservation.CustMobile = form.Get("mobile")
+	reservation.CustEmail = form.Get("email")
 
-	if err := r.repo.FreeTable(reservation, minBookDate, maxBookDate); err != nil {
-		return err
+	if err := r.repo.BookTable(reservation); err != nil {
+		return -1, nil, err
 	}
 
-	return nil
+	return reservation.ID, nil, nil
+}
+
+// FreeTableManually is partner's action, it fails with ErrAccessDenied when the choice is not of actor's cafe.
+// It returns ids of reservations it cancelled, so that their guests can be told
+func (r *reservation) FreeTableManually(actor *domain.CafeMember, userChoice http_v1.UserChoice) ([]int, error) {
+	if err := actor.Authorize(userChoice.CafeID, domain.PermissionReservationFree); err != nil {
+		return nil, err
+	}
+
+	reservation := domain.NewReservation()
+	reservation.User.ID = actor.User.ID
+
+	policy, err := r.repo.GetBookingPolicy(userChoice.CafeID)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := bookingPeriod(policy, userChoice.Date, userChoice.BookTime)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation.Cafe.ID = userChoice.CafeID
+	reservation.Table.ID = userChoice.TableID
+	reservation.Event.ID = 1 // default value
+
+	return r.repo.FreeTable(reservation, start, end)
 }
 
 func (r *reservation) GetUserBookings(userID int) ([]domain.Reservation, error) {
@@ -210,114 +568,231 @@ func (r *reservation) GetUserBookings(userID int) ([]domain.Reservation, error)
 
 	now := time.Now()
 	for idx, r := range rr {
-		if r.Date.Year() == now.Year() &&
-			int(r.Date.Month()) == int(now.Month()) &&
-			r.Date.Day() == now.Day() {
-			if r.Date.Hour() > now.Hour() {
-				// using rr[idx] because we have slice of values, not pointers
-				rr[idx].IsActive = true
-				rr[idx].HoursUntilReservation = r.Date.Hour() - now.Hour()
-				rr[idx].MinutesUntilReservation = r.Date.Minute() - now.Minute()
-			}
+		until := r.Date.Sub(now)
+		if r.Status.OccupiesTable() && until > 0 && until < 24*time.Hour {
+			// using rr[idx] because we have slice of values, not pointers
+			rr[idx].IsActive = true
+			rr[idx].HoursUntilReservation = int(until.Hours())
+			rr[idx].MinutesUntilReservation = int(until.Minutes()) % 60
 		}
 	}
 
 	return rr, nil
 }
 
-func (r *reservation) SetDefaultReservationData(data *http_v1.ReservationData, cafeID int) error {
-	data.CafeID = cafeID
-	data.CurrentDate = time.Now().Format("2006-01-02")
-	data.MaxBookingDate =
-		time.Now().AddDate(0, 0, maxDaysToBookInAdvance).Format("2006-01-02")
+func (r *reservation) GetCafeBookings(cafeID int) ([]domain.Reservation, error) {
+	return r.repo.GetCafeReservations(cafeID)
+}
 
-	if err := r.setTimeSelector(data); err != nil {
-		return err
+func (r *reservation) GetReservation(reservationID int) (*domain.Reservation, error) {
+	return r.repo.GetReservationByID(reservationID)
+}
+
+// GetCafeReservation returns reservation to staff of its cafe, the rest get ErrAccessDenied
+func (r *reservation) GetCafeReservation(actor *domain.CafeMember, reservationID int) (*domain.Reservation, error) {
+	res, err := r.repo.GetReservationByID(reservationID)
+	if err != nil {
+		return nil, err
 	}
-	r.setPartySizeSelector(data)
-	err := r.setLocationSelector(data, cafeID)
+
+	if err = actor.Authorize(res.Cafe.ID, domain.PermissionReservationView, domain.PermissionReservationStatus); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ManageToken is put in the link that lets guest manage reservation without logging in
+func (r *reservation) ManageToken(reservationID int) string {
+	return r.signer.Sign(manageTokenValue(reservationID), time.Now().Add(manageLinkTTL))
+}
+
+func manageTokenValue(reservationID int) string {
+	return "reservation:" + strconv.Itoa(reservationID)
+}
+
+// GetManageableReservation returns reservation if it belongs to logged in user
+// or if token from the emailed link was issued for it
+func (r *reservation) GetManageableReservation(reservationID int, userID interface{}, token string) (*domain.Reservation, error) {
+	res, err := r.repo.GetReservationByID(reservationID)
 	if err != nil {
+		return nil, err
+	}
+
+	if userID != nil && res.User.ID == userID.(int) {
+		return res, nil
+	}
+
+	if token != "" {
+		value, err := r.signer.Verify(token, time.Now())
+		if err == nil && value == manageTokenValue(reservationID) {
+			return res, nil
+		}
+	}
+
+	return nil, domain.ErrAccessDenied
+}
+
+// Cancel is guest's action, userID is nil for guests that came by emailed link
+func (r *reservation) Cancel(reservation *domain.Reservation, userID interface{}) error {
+	if !reservation.IsChangeable() {
+		return domain.ErrNotChangeable
+	}
+
+	changedBy := -1
+	if userID != nil {
+		changedBy = userID.(int)
+	}
+
+	return r.ChangeStatus(reservation, domain.StatusCancelled, changedBy)
+}
+
+// ConfirmVisit is guest's reply to reminder that they are coming, partner sees it next to the reservation.
+// Pending reservation is a waitlist offer, it is confirmed by claiming the offer instead
+func (r *reservation) ConfirmVisit(reservation *domain.Reservation) error {
+	if reservation.Status != domain.StatusConfirmed || !reservation.IsChangeable() {
+		return domain.ErrNotChangeable
+	}
+
+	now := time.Now()
+	if err := r.repo.ConfirmVisit(reservation.ID, now); err != nil {
 		return err
 	}
-	err = r.setEventSelector(data, cafeID)
-	if err != nil {
+	reservation.GuestConfirmedAt = now
+
+	return nil
+}
+
+// ChangeStatus validates transition of reservation's lifecycle and records who made it,
+// see domain.Reservation.CanBecome for when guest can be seated or marked as no-show
+func (r *reservation) ChangeStatus(reservation *domain.Reservation, next domain.ReservationStatus, changedBy int) error {
+	if !reservation.CanBecome(next, time.Now()) {
+		return domain.ErrInvalidTransition
+	}
+
+	if err := r.repo.UpdateStatus(reservation.ID, reservation.Status, next, changedBy); err != nil {
 		return err
 	}
+	reservation.Status = next
+
 	return nil
 }
 
-func (r *reservation) setTimeSelector(data *http_v1.ReservationData) error {
-	hours := restaurantOpeningTimeHours
-	minutes := 0
-	addZeroToMinutes := "0"
-	addZeroToHours := ""
-
-	//now := time.Now()
-	//
-	//if now.Hour()-restaurantOpeningTimeHours >= 0 &&
-	//	(data.UserChoice == http_v1.UserChoice{} ||
-	//		data.UserChoice.Date == now.Format("2006-01-02")) {
-	//	hours = now.Hour()
-	//	if hours == 0 {
-	//		addZeroToHours = "0"
-	//	}
-	//
-	//	minutes = time.Now().Minute()
-	//	if minutes != 0 {
-	//		addZeroToMinutes = ""
-	//		for minutes % 15 != 0 {
-	//			if minutes == 60 {
-	//				hours++
-	//				if hours == 24 {
-	//					hours = 0
-	//					addZeroToHours = "0"
-	//				}
-	//				minutes = 0
-	//				break
-	//			}
-	//			minutes++
-	//		}
-	//	}
-	//}
-	//
-	//var possibleBookingIntervalsLength int
-	//considerMinutes := 0
-	//
-	//if minutes != 0 {
-	//	considerMinutes = minutes / bookTimeSelectInterval
-	//}
-	//
-	//if hours == restaurantOpeningTimeHours {
-	//	possibleBookingIntervalsLength = amountOfHoursRestaurantWorks*possibleBookingsPerHour - considerMinutes - (reservationInterval / bookTimeSelectInterval)
-	//} else {
-	//	possibleBookingIntervalsLength = (amountOfHoursRestaurantWorks-(hours-restaurantOpeningTimeHours))*possibleBookingsPerHour - considerMinutes - (reservationInterval / bookTimeSelectInterval)
-	//}
-
-	possibleBookingIntervalsLength := amountOfHoursRestaurantWorks*possibleBookingsPerHour - (reservationInterval / bookTimeSelectInterval)
-
-	for i := 0; i <= possibleBookingIntervalsLength; i++ {
-		if minutes == 60 {
-			minutes = 0
-			hours++
-			addZeroToMinutes = "0"
+// Reschedule moves reservation to another date and time keeping its tables if they are free,
+// otherwise any other suitable table or combination of tables in the same location is taken
+func (r *reservation) Reschedule(reservation *domain.Reservation, date, bookTime string) error {
+	if !reservation.IsChangeable() {
+		return domain.ErrNotChangeable
+	}
+
+	policy, err := r.repo.GetBookingPolicy(reservation.Cafe.ID)
+	if err != nil {
+		return err
+	}
+	start, end, err := bookingPeriod(policy, date, bookTime)
+	if err != nil {
+		return err
+	}
+	if err := checkBookingPolicy(policy, reservation.PartySize, date, start, time.Now()); err != nil {
+		return err
+	}
+
+	tables, combinations, err := r.seatingOptions(reservation.Cafe.ID, reservation.PartySize,
+		reservation.Table.Location.ID, reservation.ID, start, end)
+	if err != nil {
+		return err
+	}
+
+	chosen := keepTables(reservation, tables, combinations)
+	if chosen == nil {
+		switch {
+		case len(tables) > 0:
+			chosen = tables[:1]
+		case len(combinations) > 0:
+			chosen = combinations[0].Tables
+		default:
+			return domain.ErrNoAvailableTables
 		}
-		if hours == 24 {
-			hours = 0
-			addZeroToHours = "0"
+	}
+
+	reservation.Table = chosen[0]
+	reservation.JoinedTables = chosen[1:]
+	reservation.Date = start
+	reservation.EndDate = end
+
+	return r.repo.UpdateReservationDate(reservation)
+}
+
+// keepTables returns reservation's current tables if they are among the free options
+func keepTables(reservation *domain.Reservation, tables []domain.Table, combinations []domain.TableCombination) []domain.Table {
+	current := append([]domain.Table{reservation.Table}, reservation.JoinedTables...)
+	if len(current) == 1 {
+		for _, t := range tables {
+			if t.ID == reservation.Table.ID {
+				return []domain.Table{t}
+			}
 		}
+		return nil
+	}
 
-		data.TimeSelector = append(data.TimeSelector,
-			fmt.Sprintf("%s%d:%d%s", addZeroToHours, hours, minutes, addZeroToMinutes))
+	value := domain.TableCombination{Tables: current}.Value()
+	for _, c := range combinations {
+		if c.Value() == value {
+			return c.Tables
+		}
+	}
+	return nil
+}
 
-		addZeroToMinutes = ""
-		minutes += bookTimeSelectInterval
+func (r *reservation) SetDefaultReservationData(data *http_v1.ReservationData, cafeID int) error {
+	policy, err := r.repo.GetBookingPolicy(cafeID)
+	if err != nil {
+		return err
 	}
 
+	now := time.Now().In(policy.Location)
+	data.CafeID = cafeID
+	data.CurrentDate = now.Format(dateLayout)
+	data.MaxBookingDate = now.AddDate(0, 0, policy.MaxDaysInAdvance).Format(dateLayout)
+
+	setTimeSelector(data, policy, time.Now())
+	r.setPartySizeSelector(data, policy)
+	err = r.setLocationSelector(data, cafeID)
+	if err != nil {
+		return err
+	}
+	err = r.setEventSelector(data, cafeID)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
-func (r *reservation) setPartySizeSelector(data *http_v1.ReservationData) {
-	for partySize := 1; partySize <= maxTableCapacity; partySize++ {
+// setTimeSelector offers booking times for the chosen working day (today in cafe's time zone by default),
+// the last one leaves a whole reservation interval before closing, times already passed are skipped
+func setTimeSelector(data *http_v1.ReservationData, policy *domain.BookingPolicy, now time.Time) {
+	date, err := time.ParseInLocation(dateLayout, data.UserChoice.Date, policy.Location)
+	if err != nil {
+		date = now.In(policy.Location)
+	}
+
+	hours := policy.HoursOn(date.Weekday())
+	lastBookingMinute := hours.WorkingMinutes() - policy.ReservationInterval
+
+	for minutes := 0; minutes <= lastBookingMinute; minutes += bookTimeSelectInterval {
+		clock := (hours.OpensAt + minutes) % (24 * 60)
+		strTime := fmt.Sprintf("%02d:%02d", clock/60, clock%60)
+
+		start, _, err := bookingPeriod(policy, date.Format(dateLayout), strTime)
+		if err != nil || !start.After(now) {
+			continue
+		}
+		data.TimeSelector = append(data.TimeSelector, strTime)
+	}
+}
+
+func (r *reservation) setPartySizeSelector(data *http_v1.ReservationData, policy *domain.BookingPolicy) {
+	for partySize := 1; partySize <= policy.MaxPartySize; partySize++ {
 		data.PartySizeSelector = append(data.PartySizeSelector, partySize)
 	}
 }
@@ -339,20 +814,3 @@ func (r *reservation) setEventSelector(data *http_v1.ReservationData, cafeID int
 	}
 	return nil
 }
-
-func (r *reservation) CheckNotifyDate(now time.Time, notificator http_v1.NotificatorService) error {
-	nowNoSeconds := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, time.UTC)
-	reservations, err := r.repo.GetReservationsByNotifyDate(nowNoSeconds)
-	if err != nil {
-		return errors.Wrap(err, "getting emails")
-	}
-	if len(reservations) == 0 {
-		return nil
-	}
-
-	if err = notificator.UsersBooking(reservations); err != nil {
-		return err
-	}
-
-	return nil
-}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// nightPolicy is open every day from 20:00 to 4:00 with hour long reservations,
+// so that its nights cover DST switches
+func nightPolicy(loc *time.Location) *domain.BookingPolicy {
+	p := domain.DefaultBookingPolicy(1)
+	p.Location = loc
+	p.ReservationInterval = 60
+	for i := range p.OpeningHours {
+		p.OpeningHours[i].OpensAt = 20 * 60
+		p.OpeningHours[i].ClosesAt = 4 * 60
+	}
+	return p
+}
+
+func TestBookingPeriod(t *testing.T) {
+	almaty := domain.DefaultBookingPolicy(1)
+	almaty.Location = mustLoadLocation(t, "Asia/Almaty")
+
+	fridayOff := domain.DefaultBookingPolicy(1)
+	fridayOff.Location = almaty.Location
+	fridayOff.OpeningHours[time.Friday].IsClosed = true
+
+	berlin := nightPolicy(mustLoadLocation(t, "Europe/Berlin"))
+
+	tests := []struct {
+		name      string
+		policy    *domain.BookingPolicy
+		date      string
+		bookTime  string
+		wantStart time.Time
+		wantErr   error
+	}{
+		{"evening", almaty, "2021-06-04", "19:00", time.Date(2021, 6, 4, 13, 0, 0, 0, time.UTC), nil},
+		{"single digit minutes", almaty, "2021-06-04", "11:05", time.Date(2021, 6, 4, 5, 5, 0, 0, time.UTC), nil},
+		{"after midnight belongs to the next night", almaty, "2021-06-04", "00:05", time.Date(2021, 6, 4, 18, 5, 0, 0, time.UTC), nil},
+		{"last slot before closing", almaty, "2021-06-04", "00:30", time.Date(2021, 6, 4, 18, 30, 0, 0, time.UTC), nil},
+		{"crossing new year", almaty, "2021-12-31", "00:30", time.Date(2021, 12, 31, 18, 30, 0, 0, time.UTC), nil},
+		{"ends after closing", almaty, "2021-06-04", "00:45", time.Time{}, domain.ErrBookingNotAllowed},
+		{"before opening", almaty, "2021-06-04", "10:00", time.Time{}, domain.ErrBookingNotAllowed},
+		{"day off", fridayOff, "2021-06-04", "19:00", time.Time{}, domain.ErrBookingNotAllowed},
+		{"night before day off is still open", fridayOff, "2021-06-03", "00:30", time.Date(2021, 6, 3, 18, 30, 0, 0, time.UTC), nil},
+		{"malformed time", almaty, "2021-06-04", "9:5", time.Time{}, domain.ErrBookingNotAllowed},
+		{"malformed date", almaty, "04.06.2021", "19:00", time.Time{}, domain.ErrBookingNotAllowed},
+		{"before switching to summer time", berlin, "2021-03-27", "01:30", time.Date(2021, 3, 28, 0, 30, 0, 0, time.UTC), nil},
+		{"skipped by switching to summer time", berlin, "2021-03-27", "02:30", time.Time{}, domain.ErrBookingNotAllowed},
+		{"after switching to summer time", berlin, "2021-03-27", "03:00", time.Date(2021, 3, 28, 1, 0, 0, 0, time.UTC), nil},
+		{"before switching to winter time", berlin, "2021-10-30", "01:00", time.Date(2021, 10, 30, 23, 0, 0, 0, time.UTC), nil},
+		{"after switching to winter time", berlin, "2021-10-30", "03:00", time.Date(2021, 10, 31, 2, 0, 0, 0, time.UTC), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := bookingPeriod(tt.policy, tt.date, tt.bookTime)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want error %v; got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !start.Equal(tt.wantStart) {
+				t.Errorf("want start %v; got %v", tt.wantStart, start.UTC())
+			}
+			if got, want := end.Sub(start), time.Duration(tt.policy.ReservationInterval)*time.Minute; got != want {
+				t.Errorf("want reservation to last %v; got %v", want, got)
+			}
+			if got := start.In(tt.policy.Location).Format(clockLayout); got != tt.bookTime {
+				t.Errorf("want wall clock %s; got %s", tt.bookTime, got)
+			}
+		})
+	}
+}
+
+func TestCheckBookingPolicy(t *testing.T) {
+	policy := domain.DefaultBookingPolicy(1)
+	policy.Location = mustLoadLocation(t, "Asia/Almaty")
+
+	// Friday 23:10 in Almaty
+	now := time.Date(2021, 6, 4, 17, 10, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		partySize int
+		date      string
+		bookTime  string
+		wantErr   error
+	}{
+		{"later tonight", 2, "2021-06-04", "23:15", nil},
+		{"tonight after midnight", 2, "2021-06-04", "00:30", nil},
+		{"already started", 2, "2021-06-04", "23:00", domain.ErrBookingNotAllowed},
+		{"last allowed day", 2, "2021-06-11", "19:00", nil},
+		{"after midnight of last allowed day", 2, "2021-06-11", "00:30", nil},
+		{"too far in advance", 2, "2021-06-12", "19:00", domain.ErrBookingNotAllowed},
+		{"party too large", 9, "2021-06-05", "19:00", domain.ErrBookingNotAllowed},
+		{"empty party", 0, "2021-06-05", "19:00", domain.ErrBookingNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, _, err := bookingPeriod(policy, tt.date, tt.bookTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = checkBookingPolicy(policy, tt.partySize, tt.date, start, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want error %v; got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSetTimeSelector(t *testing.T) {
+	almaty := domain.DefaultBookingPolicy(1)
+	almaty.Location = mustLoadLocation(t, "Asia/Almaty")
+
+	berlin := nightPolicy(mustLoadLocation(t, "Europe/Berlin"))
+
+	tests := []struct {
+		name      string
+		policy    *domain.BookingPolicy
+		date      string
+		now       time.Time
+		wantFirst string
+		wantLast  string
+		wantLen   int
+	}{
+		{"whole day", almaty, "2021-06-05", time.Date(2021, 6, 4, 17, 10, 0, 0, time.UTC), "11:00", "00:30", 55},
+		{"rest of tonight", almaty, "2021-06-04", time.Date(2021, 6, 4, 17, 10, 0, 0, time.UTC), "23:15", "00:30", 6},
+		{"today by default", almaty, "", time.Date(2021, 6, 4, 17, 10, 0, 0, time.UTC), "23:15", "00:30", 6},
+		{"night switching to summer time", berlin, "2021-03-27", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), "20:00", "03:00", 25},
+		{"night switching to winter time", berlin, "2021-10-30", time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC), "20:00", "03:00", 29},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &http_v1.ReservationData{}
+			data.UserChoice.Date = tt.date
+
+			setTimeSelector(data, tt.policy, tt.now)
+
+			if len(data.TimeSelector) != tt.wantLen {
+				t.Fatalf("want %d slots; got %d: %v", tt.wantLen, len(data.TimeSelector), data.TimeSelector)
+			}
+			if data.TimeSelector[0] != tt.wantFirst {
+				t.Errorf("want first slot %s; got %s", tt.wantFirst, data.TimeSelector[0])
+			}
+			if last := data.TimeSelector[len(data.TimeSelector)-1]; last != tt.wantLast {
+				t.Errorf("want last slot %s; got %s", tt.wantLast, last)
+			}
+		})
+	}
+}
+
+func TestTableCombinations(t *testing.T) {
+	free := []domain.Table{
+		{ID: 1, Capacity: 4}, {ID: 2, Capacity: 4}, {ID: 3, Capacity: 8},
+		{ID: 4, Capacity: 2}, {ID: 5, Capacity: 2},
+	}
+	join := func(a, b int) domain.TableJoin {
+		return domain.TableJoin{Table: domain.Table{ID: a}, JoinedTable: domain.Table{ID: b}, IsJoined: true}
+	}
+	// 1 - 2 - 3 in a row, 4 - 5 next to each other, 6 is joined but not free
+	joins := []domain.TableJoin{join(1, 2), join(2, 3), join(4, 5), join(5, 6)}
+
+	tests := []struct {
+		name      string
+		partySize int
+		want      []string
+	}{
+		{"pair fits exactly", 8, []string{"1,2"}},
+		{"twelve people", 12, []string{"2,3"}},
+		{"whole row", 14, []string{"1,2,3"}},
+		{"too large", 17, nil},
+		{"small pair", 3, []string{"4,5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range tableCombinations(free, joins, tt.partySize) {
+				got = append(got, c.Value())
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("want %v; got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("want %v; got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAreJoined(t *testing.T) {
+	join := func(a, b int) domain.TableJoin {
+		return domain.TableJoin{Table: domain.Table{ID: a}, JoinedTable: domain.Table{ID: b}, IsJoined: true}
+	}
+	joins := []domain.TableJoin{join(1, 2), join(2, 3), join(4, 5)}
+
+	tests := []struct {
+		ids  []int
+		want bool
+	}{
+		{[]int{1, 2}, true},
+		{[]int{1, 2, 3}, true},
+		{[]int{3, 1, 2}, true},
+		{[]int{1, 3}, false},
+		{[]int{2, 4}, false},
+		{[]int{1, 1}, false},
+	}
+
+	for _, tt := range tests {
+		if got := areJoined(tt.ids, joins); got != tt.want {
+			t.Errorf("areJoined(%v) = %v; want %v", tt.ids, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSeating(t *testing.T) {
+	start := time.Date(2021, 6, 4, 19, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Minute)
+	join := func(a, b int) domain.TableJoin {
+		return domain.TableJoin{Table: domain.Table{ID: a}, JoinedTable: domain.Table{ID: b}, IsJoined: true}
+	}
+	// 1 and 2 are joined, 3 is busy, 4 is free but not joined to anything, 5 is the largest table
+	repo := &fakeReservationRepo{
+		free: map[time.Time][]domain.Table{start: {
+			{ID: 1, Capacity: 4}, {ID: 2, Capacity: 4}, {ID: 4, Capacity: 4}, {ID: 5, Capacity: 6},
+		}},
+		joins: []domain.TableJoin{join(1, 2), join(2, 3)},
+	}
+	r := NewReservation(repo, nil)
+
+	tests := []struct {
+		name      string
+		partySize int
+		tableID   int
+		joined    []int
+		want      error
+	}{
+		{"table fits", 4, 1, nil, nil},
+		{"table too small", 6, 1, nil, domain.ErrBookingNotAllowed},
+		{"busy table", 2, 3, nil, domain.ErrTableTaken},
+		{"party does not fit", 7, 5, nil, domain.ErrBookingNotAllowed},
+		{"joined tables", 8, 2, []int{1}, nil},
+		{"tables not joined", 8, 1, []int{4}, domain.ErrBookingNotAllowed},
+		{"busy joined table", 8, 2, []int{3}, domain.ErrTableTaken},
+		{"joined tables while one table fits", 4, 1, []int{2}, domain.ErrBookingNotAllowed},
+	}
+
+	for _, tt := range tests {
+		choice := http_v1.UserChoice{CafeID: 1, TableID: tt.tableID, JoinedTableIDs: tt.joined, PartySize: tt.partySize}
+		if err := r.checkSeating(choice, start, end); !errors.Is(err, tt.want) {
+			t.Errorf("%s: want %v; got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func (f *fakeReservationRepo) GetBookingPolicy(cafeID int) (*domain.BookingPolicy, error) {
+	return domain.DefaultBookingPolicy(cafeID), nil
+}
+
+func TestBookTableManually(t *testing.T) {
+	policy := domain.DefaultBookingPolicy(1)
+	visit, _, err := bookingPeriod(policy, "2021-06-04", "19:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeReservationRepo{free: map[time.Time][]domain.Table{visit: {{ID: 3, Capacity: 2}}}}
+	r := NewReservation(repo, nil)
+	host := &domain.CafeMember{Cafe: domain.Cafe{ID: 1},
+		User: domain.User{ID: 7, Role: domain.Role{Permissions: domain.PartnerPermissions}}, Role: domain.StaffHost}
+	choice := http_v1.UserChoice{CafeID: 2, TableID: 3, PartySize: 2, Date: "2021-06-04", BookTime: "19:00"}
+
+	if _, _, err := r.BookTableManually(host, forms.New(url.Values{}), choice); !errors.Is(err, domain.ErrAccessDenied) {
+		t.Errorf("want table of another cafe to be denied; got %v", err)
+	}
+	if len(repo.booked) != 0 {
+		t.Fatalf("want nothing booked; got %+v", repo.booked)
+	}
+
+	choice.CafeID = 1
+	choice.PartySize = 12
+	if _, _, err := r.BookTableManually(host, forms.New(url.Values{}), choice); !errors.Is(err, domain.ErrBookingNotAllowed) {
+		t.Errorf("want party too large for the table to be rejected; got %v", err)
+	}
+
+	choice.PartySize = 2
+	if _, _, err := r.BookTableManually(host, forms.New(url.Values{}), choice); err != nil {
+		t.Fatalf("want table to be set busy; got %v", err)
+	}
+	// staff member is in the audit log, the reservation is not theirs
+	if b := repo.booked[0]; b.Cafe.ID != 1 || b.Table.ID != 3 || b.User.ID != -1 || b.PartySize != 2 {
+		t.Errorf("want table 3 of cafe 1 set busy without account; got %+v", b)
+	}
+
+	// guest booking over the phone is notified, so their contacts have to be valid
+	_, form, err := r.BookTableManually(host, forms.New(url.Values{"email": {"guest"}}), choice)
+	if err != nil || form == nil || form.Errors.Get("name") == "" || form.Errors.Get("email") == "" {
+		t.Errorf("want invalid contacts rejected; got %v, %v", form, err)
+	}
+	contacts := url.Values{"name": {"Aigerim"}, "mobile": {"87011234567"}, "email": {"guest@mail.kz"}}
+	if _, form, err = r.BookTableManually(host, forms.New(contacts), choice); err != nil || form != nil {
+		t.Fatalf("want table booked for guest; got %v, %v", form, err)
+	}
+	if len(repo.booked) != 2 || repo.booked[1].CustName != "Aigerim" || repo.booked[1].CustEmail != "guest@mail.kz" ||
+		repo.booked[1].CustMobile != "87011234567" {
+		t.Errorf("want guest's contacts kept; got %+v", repo.booked)
+	}
+}
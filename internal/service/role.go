@@ -0,0 +1,107 @@
+package service
+
+import (
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+type RoleRepo interface {
+	GetAll() ([]domain.Role, error)
+	GetByName(name string) (*domain.Role, error)
+	SetPermissions(roleID int, permissions []domain.Permission) error
+	GetStaff() ([]domain.User, error)
+}
+
+// role manages which roles have which permissions and who has which role,
+// admins can not take role.manage away from themselves, so that someone is always left to fix roles
+type role struct {
+	repo     RoleRepo
+	userRepo UserRepo
+}
+
+func NewRole(repo RoleRepo, userRepo UserRepo) *role {
+	return &role{repo: repo, userRepo: userRepo}
+}
+
+func (r *role) GetRoles() ([]domain.Role, error) {
+	return r.repo.GetAll()
+}
+
+func (r *role) GetRoleByName(name string) (*domain.Role, error) {
+	return r.repo.GetByName(name)
+}
+
+// GetStaff returns users whose roles have any permission
+func (r *role) GetStaff() ([]domain.User, error) {
+	return r.repo.GetStaff()
+}
+
+// SetPermissions fails with ErrUnknownPermission for names that are not in domain.Permissions
+// and with ErrAccessDenied when actor would lose role.manage. The role is returned as it was before
+func (r *role) SetPermissions(actorID, roleID int, names []string) (*domain.Role, error) {
+	role, err := r.findRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make([]domain.Permission, 0, len(names))
+	for _, name := range names {
+		p := domain.Permission(name)
+		if !domain.IsKnownPermission(p) {
+			return nil, domain.ErrUnknownPermission
+		}
+		permissions = append(permissions, p)
+	}
+
+	actor, err := r.userRepo.GetById(actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role.ID == roleID && !(domain.Role{Permissions: permissions}).Can(domain.PermissionRoleManage) {
+		return nil, domain.ErrAccessDenied
+	}
+
+	if err = r.repo.SetPermissions(roleID, permissions); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// AssignRole gives role to user with the email, sessions of user are ended, see UserRepo.UpdateUserRoleByID.
+// Admins can not change their own role. ErrNoRecord is returned for unknown users and roles,
+// otherwise the user is returned as they were before together with the assigned role
+func (r *role) AssignRole(actorID int, email string, roleID int) (*domain.User, *domain.Role, error) {
+	user, err := r.userRepo.GetByEmail(email)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.ID == actorID {
+		return nil, nil, domain.ErrAccessDenied
+	}
+
+	role, err := r.findRole(roleID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = r.userRepo.UpdateUserRoleByID(user.ID, roleID); err != nil {
+		return nil, nil, err
+	}
+
+	return user, role, nil
+}
+
+// findRole returns ErrNoRecord for unknown role
+func (r *role) findRole(roleID int) (*domain.Role, error) {
+	roles, err := r.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if role.ID == roleID {
+			return &role, nil
+		}
+	}
+
+	return nil, domain.ErrNoRecord
+}
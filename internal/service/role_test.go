@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+// UpdateUserRoleByID replaces the user, so that users returned earlier keep their role like loaded from db do
+func (f *fakeUserRepo) UpdateUserRoleByID(userID, roleID int) error {
+	user := *f.users[userID]
+	user.Role = domain.Role{ID: roleID}
+	f.users[userID] = &user
+	return nil
+}
+
+type fakeRoleRepo struct {
+	RoleRepo
+	roles []domain.Role
+}
+
+func (f *fakeRoleRepo) GetAll() ([]domain.Role, error) {
+	return f.roles, nil
+}
+
+func (f *fakeRoleRepo) SetPermissions(roleID int, permissions []domain.Permission) error {
+	for i := range f.roles {
+		if f.roles[i].ID == roleID {
+			f.roles[i].Permissions = permissions
+		}
+	}
+	return nil
+}
+
+func TestSetPermissions(t *testing.T) {
+	admin := domain.Role{ID: 1, Name: "admin", Permissions: domain.AdminPermissions}
+	roles := &fakeRoleRepo{roles: []domain.Role{admin, {ID: 2, Name: domain.RoleUser}}}
+	users := &fakeUserRepo{users: map[int]*domain.User{7: {ID: 7, Role: admin}}}
+	s := NewRole(roles, users)
+
+	if _, err := s.SetPermissions(7, 2, []string{"cafe.destroy"}); !errors.Is(err, domain.ErrUnknownPermission) {
+		t.Errorf("want unknown permission to be rejected; got %v", err)
+	}
+	if _, err := s.SetPermissions(7, 9, nil); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want unknown role to be not found; got %v", err)
+	}
+	if _, err := s.SetPermissions(7, 1, []string{string(domain.PermissionCafeApprove)}); !errors.Is(err, domain.ErrAccessDenied) {
+		t.Errorf("want admin to keep role management of own role; got %v", err)
+	}
+	if !roles.roles[0].Can(domain.PermissionRoleManage) {
+		t.Errorf("want permissions of admin role unchanged; got %v", roles.roles[0].Permissions)
+	}
+
+	before, err := s.SetPermissions(7, 2, []string{string(domain.PermissionReservationView)})
+	if err != nil {
+		t.Fatalf("want permissions to be set; got %v", err)
+	}
+	if before.Name != domain.RoleUser || len(before.Permissions) != 0 {
+		t.Errorf("want role as it was before; got %+v", before)
+	}
+	if !roles.roles[1].Can(domain.PermissionReservationView) {
+		t.Errorf("want user role to see reservations; got %v", roles.roles[1].Permissions)
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	roles := &fakeRoleRepo{roles: []domain.Role{{ID: 1, Name: "admin"}, {ID: 2, Name: domain.RoleUser}}}
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "admin@example.com", Role: domain.Role{ID: 1}},
+		8: {ID: 8, Email: "guest@example.com", Role: domain.Role{ID: 2}},
+	}}
+	s := NewRole(roles, users)
+
+	if _, _, err := s.AssignRole(7, "admin@example.com", 2); !errors.Is(err, domain.ErrAccessDenied) {
+		t.Errorf("want admin not to change own role; got %v", err)
+	}
+	if _, _, err := s.AssignRole(7, "ghost@example.com", 1); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want unknown email to be not found; got %v", err)
+	}
+	if _, _, err := s.AssignRole(7, "guest@example.com", 9); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want unknown role to be not found; got %v", err)
+	}
+
+	user, role, err := s.AssignRole(7, "guest@example.com", 1)
+	if err != nil {
+		t.Fatalf("want role to be assigned; got %v", err)
+	}
+	if user.Role.ID != 2 || role.Name != "admin" {
+		t.Errorf("want user's previous role and the assigned one; got %d, %s", user.Role.ID, role.Name)
+	}
+	if users.users[8].Role.ID != 1 {
+		t.Errorf("want role %d; got %d", 1, users.users[8].Role.ID)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// sessionTouchInterval limits writes of last seen time, it is shown to user in the list of sessions
+const sessionTouchInterval = time.Minute
+
+type SessionRepo interface {
+	Insert(session *domain.Session) (int, error)
+	FindByHash(hash []byte, now time.Time) (*domain.Session, error)
+	Update(session *domain.Session) error
+	Touch(sessionID int, now time.Time) error
+	Delete(sessionID int) error
+	GetByUser(userID int, now time.Time) ([]domain.Session, error)
+	DeleteOfUser(userID, sessionID int) error
+	DeleteByUser(userID, exceptID int) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// session keeps browser sessions in database, so that users can see where they are logged in
+// and end any of the sessions
+type session struct {
+	repo SessionRepo
+}
+
+func NewSession(repo SessionRepo) *session {
+	return &session{repo: repo}
+}
+
+// Start stores new session and returns its token for the cookie, session gets its ID and hash
+func (s *session) Start(session *domain.Session) (string, error) {
+	return s.start(session, time.Now())
+}
+
+func (s *session) start(session *domain.Session, now time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating session token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	session.Hash = hashToken(token)
+	session.LastSeenAt = now
+
+	id, err := s.repo.Insert(session)
+	if err != nil {
+		return "", err
+	}
+	session.ID = id
+
+	return token, nil
+}
+
+// Find returns ErrNoRecord for unknown, expired and revoked sessions
+func (s *session) Find(token string) (*domain.Session, error) {
+	return s.find(token, time.Now())
+}
+
+func (s *session) find(token string, now time.Time) (*domain.Session, error) {
+	session, err := s.repo.FindByHash(hashToken(token), now)
+	if err != nil {
+		return nil, err
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		if err = s.repo.Touch(session.ID, now); err != nil {
+			return nil, err
+		}
+		session.LastSeenAt = now
+	}
+
+	return session, nil
+}
+
+// Save stores changed data of session, it fails with ErrNoRecord when the session was revoked meanwhile
+func (s *session) Save(session *domain.Session) error {
+	session.LastSeenAt = time.Now()
+	return s.repo.Update(session)
+}
+
+func (s *session) End(sessionID int) error {
+	return s.repo.Delete(sessionID)
+}
+
+func (s *session) GetUserSessions(userID int) ([]domain.Session, error) {
+	return s.repo.GetByUser(userID, time.Now())
+}
+
+// Revoke ends one of user's sessions, ErrNoRecord is returned for sessions of other users
+func (s *session) Revoke(userID, sessionID int) error {
+	return s.repo.DeleteOfUser(userID, sessionID)
+}
+
+// RevokeOthers ends all sessions of user but the current one
+func (s *session) RevokeOthers(userID, currentSessionID int) error {
+	return s.repo.DeleteByUser(userID, currentSessionID)
+}
+
+func (s *session) ExpireSessions(now time.Time) error {
+	_, err := s.repo.DeleteExpired(now)
+	if err != nil {
+		return errors.Wrap(err, "expiring sessions")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+type fakeSessionRepo struct {
+	SessionRepo
+	sessions []*domain.Session
+	touched  int
+}
+
+func (f *fakeSessionRepo) Insert(session *domain.Session) (int, error) {
+	copied := *session
+	copied.ID = len(f.sessions) + 1
+	f.sessions = append(f.sessions, &copied)
+	return copied.ID, nil
+}
+
+func (f *fakeSessionRepo) FindByHash(hash []byte, now time.Time) (*domain.Session, error) {
+	for _, s := range f.sessions {
+		if s != nil && bytes.Equal(s.Hash, hash) && now.Before(s.ExpiresAt) {
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeSessionRepo) Touch(sessionID int, now time.Time) error {
+	f.sessions[sessionID-1].LastSeenAt = now
+	f.touched++
+	return nil
+}
+
+func (f *fakeSessionRepo) DeleteOfUser(userID, sessionID int) error {
+	if s := f.sessions[sessionID-1]; s == nil || s.UserID != userID {
+		return domain.ErrNoRecord
+	}
+	f.sessions[sessionID-1] = nil
+	return nil
+}
+
+func (f *fakeSessionRepo) DeleteByUser(userID, exceptID int) error {
+	for i, s := range f.sessions {
+		if s != nil && s.UserID == userID && s.ID != exceptID {
+			f.sessions[i] = nil
+		}
+	}
+	return nil
+}
+
+func TestSession(t *testing.T) {
+	repo := &fakeSessionRepo{}
+	s := NewSession(repo)
+	now := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+
+	stored := &domain.Session{UserID: 7, Data: []byte("values"), ExpiresAt: now.Add(time.Hour)}
+	token, err := s.start(stored, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ID != 1 || bytes.Contains(repo.sessions[0].Hash, []byte(token)) {
+		t.Fatalf("want session to be stored with hash of token; got %+v", repo.sessions[0])
+	}
+
+	found, err := s.find(token, now.Add(time.Second))
+	if err != nil || found.ID != stored.ID || repo.touched != 0 {
+		t.Fatalf("want session to be found without touching it; got %v, %v, %d touches", found, err, repo.touched)
+	}
+	if found, err = s.find(token, now.Add(sessionTouchInterval)); err != nil || !found.LastSeenAt.Equal(now.Add(sessionTouchInterval)) {
+		t.Errorf("want last seen time to be updated; got %v, %v", found, err)
+	}
+	if _, err = s.find(token, now.Add(time.Hour)); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want expired session not to be found; got %v", err)
+	}
+	if _, err = s.find("unknown", now); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want unknown token not to be found; got %v", err)
+	}
+
+	other, _ := s.start(&domain.Session{UserID: 7, ExpiresAt: now.Add(time.Hour)}, now)
+	third, _ := s.start(&domain.Session{UserID: 7, ExpiresAt: now.Add(time.Hour)}, now)
+	stranger, _ := s.start(&domain.Session{UserID: 8, ExpiresAt: now.Add(time.Hour)}, now)
+
+	if err = s.Revoke(8, 2); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want session of another user not to be revoked; got %v", err)
+	}
+	if err = s.Revoke(7, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.find(other, now); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want revoked session not to be found; got %v", err)
+	}
+
+	if err = s.RevokeOthers(7, stored.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.find(third, now); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want other sessions of user to be revoked; got %v", err)
+	}
+	if _, err = s.find(token, now); err != nil {
+		t.Errorf("want current session to stay; got %v", err)
+	}
+	if _, err = s.find(stranger, now); err != nil {
+		t.Errorf("want sessions of other users to stay; got %v", err)
+	}
+}
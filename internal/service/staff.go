@@ -0,0 +1,155 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const staffInviteTTL = 7 * 24 * time.Hour
+
+type StaffRepo interface {
+	GetMember(cafeID, userID int) (*domain.CafeMember, error)
+	GetByUser(userID int) ([]domain.CafeMember, error)
+	GetByCafe(cafeID int) ([]domain.CafeMember, error)
+	Delete(cafeID, userID int) error
+	InsertInvite(invite *domain.StaffInvite) error
+	FindInviteByHash(hash []byte) (*domain.StaffInvite, error)
+	GetPendingInvites(cafeID int, now time.Time) ([]domain.StaffInvite, error)
+	AcceptInvite(inviteID, userID int, roleName string, now time.Time) error
+}
+
+// staff manages who works at which cafe, owners invite staff by email
+type staff struct {
+	repo     StaffRepo
+	userRepo UserRepo
+}
+
+func NewStaff(repo StaffRepo, userRepo UserRepo) *staff {
+	return &staff{repo: repo, userRepo: userRepo}
+}
+
+// GetMember returns ErrNoRecord when user does not work at the cafe
+func (s *staff) GetMember(cafeID, userID int) (*domain.CafeMember, error) {
+	return s.repo.GetMember(cafeID, userID)
+}
+
+func (s *staff) GetUserCafes(userID int) ([]domain.CafeMember, error) {
+	return s.repo.GetByUser(userID)
+}
+
+func (s *staff) GetStaff(cafeID int) ([]domain.CafeMember, error) {
+	return s.repo.GetByCafe(cafeID)
+}
+
+func (s *staff) GetPendingInvites(cafeID int) ([]domain.StaffInvite, error) {
+	return s.repo.GetPendingInvites(cafeID, time.Now())
+}
+
+// Invite emails a link to join actor's cafe, the form has "email" and "role" fields
+func (s *staff) Invite(actor *domain.CafeMember, form *forms.FormValidator, notificator http_v1.NotificatorService) (bool, error) {
+	form.Required("email", "role")
+	form.MatchesPattern("email", forms.EmailRX)
+	roles := make([]string, len(domain.StaffRoles))
+	for i, r := range domain.StaffRoles {
+		roles[i] = string(r)
+	}
+	form.PermittedValues("role", roles...)
+
+	if !form.Valid() {
+		return false, nil
+	}
+
+	email := strings.TrimSpace(form.Get("email"))
+	members, err := s.repo.GetByCafe(actor.Cafe.ID)
+	if err != nil {
+		return true, err
+	}
+	for _, m := range members {
+		if strings.EqualFold(m.User.Email, email) {
+			form.Errors.Add("email", "This user already works at the cafe")
+			return false, nil
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return true, errors.Wrap(err, "generating staff invite token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	invite := &domain.StaffInvite{
+		Cafe:      actor.Cafe,
+		Email:     email,
+		Role:      domain.StaffRole(form.Get("role")),
+		Hash:      hashToken(token),
+		InvitedBy: actor.User.ID,
+		ExpiresAt: time.Now().Add(staffInviteTTL),
+	}
+	if err = s.repo.InsertInvite(invite); err != nil {
+		return true, err
+	}
+
+	return true, notificator.StaffInvite(*invite, token)
+}
+
+func (s *staff) activeInvite(token string, now time.Time) (*domain.StaffInvite, error) {
+	invite, err := s.repo.FindInviteByHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return nil, domain.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if !invite.IsActive(now) {
+		return nil, domain.ErrInvalidToken
+	}
+
+	return invite, nil
+}
+
+// CheckInvite lets invite page show the cafe and position before user accepts
+func (s *staff) CheckInvite(token string) (*domain.StaffInvite, error) {
+	return s.activeInvite(token, time.Now())
+}
+
+// AcceptInvite fails with ErrAccessDenied when the invite was sent to another email
+func (s *staff) AcceptInvite(token string, userID int) (*domain.StaffInvite, error) {
+	return s.acceptInvite(token, userID, time.Now())
+}
+
+func (s *staff) acceptInvite(token string, userID int, now time.Time) (*domain.StaffInvite, error) {
+	invite, err := s.activeInvite(token, now)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, invite.Email) {
+		return nil, domain.ErrAccessDenied
+	}
+
+	if err = s.repo.AcceptInvite(invite.ID, userID, domain.RolePartner, now); err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// RemoveMember fails with ErrAccessDenied when actor removes themselves,
+// so that the cafe always keeps an owner
+func (s *staff) RemoveMember(actor *domain.CafeMember, userID int) error {
+	if actor.User.ID == userID {
+		return domain.ErrAccessDenied
+	}
+
+	return s.repo.Delete(actor.Cafe.ID, userID)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+)
+
+type fakeStaffRepo struct {
+	StaffRepo
+	members []domain.CafeMember
+	invites []*domain.StaffInvite
+}
+
+func (f *fakeStaffRepo) GetByCafe(cafeID int) ([]domain.CafeMember, error) {
+	var members []domain.CafeMember
+	for _, m := range f.members {
+		if m.Cafe.ID == cafeID {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+func (f *fakeStaffRepo) Delete(cafeID, userID int) error {
+	for i, m := range f.members {
+		if m.Cafe.ID == cafeID && m.User.ID == userID {
+			f.members = append(f.members[:i], f.members[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNoRecord
+}
+
+func (f *fakeStaffRepo) InsertInvite(invite *domain.StaffInvite) error {
+	invite.ID = len(f.invites) + 1
+	f.invites = append(f.invites, invite)
+	return nil
+}
+
+func (f *fakeStaffRepo) FindInviteByHash(hash []byte) (*domain.StaffInvite, error) {
+	for _, i := range f.invites {
+		if bytes.Equal(i.Hash, hash) {
+			return i, nil
+		}
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeStaffRepo) AcceptInvite(inviteID, userID int, roleName string, now time.Time) error {
+	invite := f.invites[inviteID-1]
+	invite.AcceptedAt = &now
+	f.members = append(f.members, domain.CafeMember{Cafe: invite.Cafe, User: domain.User{ID: userID}, Role: invite.Role})
+	return nil
+}
+
+type fakeInviteNotificator struct {
+	http_v1.NotificatorService
+	tokens []string
+}
+
+func (f *fakeInviteNotificator) StaffInvite(invite domain.StaffInvite, token string) error {
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func TestStaffInvite(t *testing.T) {
+	owner := domain.CafeMember{Cafe: domain.Cafe{ID: 1, Name: "Del Papa"},
+		User: domain.User{ID: 7, Email: "owner@example.com"}, Role: domain.StaffOwner}
+	repo := &fakeStaffRepo{members: []domain.CafeMember{owner}}
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "owner@example.com"},
+		8: {ID: 8, Email: "host@example.com"},
+		9: {ID: 9, Email: "other@example.com"},
+	}}
+	s := NewStaff(repo, users)
+	notificator := &fakeInviteNotificator{}
+
+	form := forms.New(url.Values{"email": {"host@example.com"}, "role": {"chef"}})
+	if valid, err := s.Invite(&owner, form, notificator); valid || err != nil {
+		t.Errorf("want unknown position to be invalid; got %v, %v", valid, err)
+	}
+	form = forms.New(url.Values{"email": {"OWNER@example.com"}, "role": {"host"}})
+	if valid, err := s.Invite(&owner, form, notificator); valid || err != nil {
+		t.Errorf("want staff not to be invited again; got %v, %v", valid, err)
+	}
+
+	form = forms.New(url.Values{"email": {"host@example.com"}, "role": {"host"}})
+	if valid, err := s.Invite(&owner, form, notificator); !valid || err != nil || len(notificator.tokens) != 1 {
+		t.Fatalf("want invite to be emailed; got %v, %v, %d emails", valid, err, len(notificator.tokens))
+	}
+	token := notificator.tokens[0]
+
+	now := time.Now()
+	if _, err := s.acceptInvite(token, 8, now.Add(staffInviteTTL+time.Second)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want expired invite to be invalid; got %v", err)
+	}
+	if _, err := s.acceptInvite(token, 9, now); !errors.Is(err, domain.ErrAccessDenied) {
+		t.Errorf("want invite to be accepted only by its email; got %v", err)
+	}
+
+	invite, err := s.acceptInvite(token, 8, now)
+	if err != nil {
+		t.Fatalf("want invite to be accepted; got %v", err)
+	}
+	if invite.Cafe.ID != 1 || len(repo.members) != 2 || repo.members[1].Role != domain.StaffHost {
+		t.Errorf("want user to become host of the cafe; got %+v", repo.members)
+	}
+	if _, err = s.acceptInvite(token, 8, now); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want invite to be used once; got %v", err)
+	}
+}
+
+func TestRemoveStaff(t *testing.T) {
+	owner := domain.CafeMember{Cafe: domain.Cafe{ID: 1}, User: domain.User{ID: 7}, Role: domain.StaffOwner}
+	repo := &fakeStaffRepo{members: []domain.CafeMember{
+		owner,
+		{Cafe: domain.Cafe{ID: 1}, User: domain.User{ID: 8}, Role: domain.StaffHost},
+		{Cafe: domain.Cafe{ID: 2}, User: domain.User{ID: 9}, Role: domain.StaffHost},
+	}}
+	s := NewStaff(repo, nil)
+
+	if err := s.RemoveMember(&owner, 7); !errors.Is(err, domain.ErrAccessDenied) {
+		t.Errorf("want owner not to remove themselves; got %v", err)
+	}
+	if err := s.RemoveMember(&owner, 9); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want staff of another cafe to be not found; got %v", err)
+	}
+	if err := s.RemoveMember(&owner, 8); err != nil || len(repo.members) != 2 {
+		t.Errorf("want host to be removed; got %v, %+v", err, repo.members)
+	}
+}
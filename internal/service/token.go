@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// accessTokenTTL also bounds how long a changed role stays in issued tokens
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type TokenRepo interface {
+	Insert(userID int, hash []byte, expiresAt time.Time) error
+	FindByHash(hash []byte) (*domain.RefreshToken, error)
+	Revoke(tokenID int, now time.Time) error
+	RevokeByUser(userID int, now time.Time) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// token issues bearer tokens for api clients: access tokens are signed, refresh tokens
+// are random and stored, so that they can be revoked
+type token struct {
+	repo     TokenRepo
+	userRepo UserRepo
+	signer   Signer
+}
+
+func NewToken(repo TokenRepo, userRepo UserRepo, signer Signer) *token {
+	return &token{repo: repo, userRepo: userRepo, signer: signer}
+}
+
+// accessTokenValue carries issue time, so that tokens issued before user's sessions were revoked stop working
+func accessTokenValue(userID, roleID int, issuedAt time.Time) string {
+	return fmt.Sprintf("access:%d:%d:%d", userID, roleID, issuedAt.UnixNano())
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+func (t *token) Issue(userID int) (*domain.TokenPair, error) {
+	return t.issue(userID, time.Now())
+}
+
+func (t *token) issue(userID int, now time.Time) (*domain.TokenPair, error) {
+	user, err := t.userRepo.GetById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "generating refresh token")
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+	refreshExpiresAt := now.Add(refreshTokenTTL)
+
+	if err = t.repo.Insert(user.ID, hashToken(refreshToken), refreshExpiresAt); err != nil {
+		return nil, err
+	}
+
+	accessExpiresAt := now.Add(accessTokenTTL)
+
+	return &domain.TokenPair{
+		AccessToken:      t.signer.Sign(accessTokenValue(user.ID, user.Role.ID, now), accessExpiresAt),
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// Authenticate returns user and role the access token was issued for,
+// the role is the one user had at that time
+func (t *token) Authenticate(accessToken string) (int, int, error) {
+	return t.authenticate(accessToken, time.Now())
+}
+
+func (t *token) authenticate(accessToken string, now time.Time) (int, int, error) {
+	value, err := t.signer.Verify(accessToken, now)
+	if err != nil {
+		return 0, 0, domain.ErrInvalidToken
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 || parts[0] != "access" {
+		// other signed tokens, e.g. manage links, are not access tokens
+		return 0, 0, domain.ErrInvalidToken
+	}
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, domain.ErrInvalidToken
+	}
+	roleID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, domain.ErrInvalidToken
+	}
+	issuedAt, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return 0, 0, domain.ErrInvalidToken
+	}
+
+	user, err := t.userRepo.GetById(userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return 0, 0, domain.ErrInvalidToken
+		}
+		return 0, 0, err
+	}
+	if time.Unix(0, issuedAt).Before(user.SessionsRevokedAt) {
+		return 0, 0, domain.ErrInvalidToken
+	}
+
+	return userID, roleID, nil
+}
+
+// Refresh rotates refresh token: the used one is revoked and a new pair is issued.
+// A revoked token presented again means it was stolen, all user's tokens are revoked then
+func (t *token) Refresh(refreshToken string) (*domain.TokenPair, error) {
+	return t.refresh(refreshToken, time.Now())
+}
+
+func (t *token) refresh(refreshToken string, now time.Time) (*domain.TokenPair, error) {
+	stored, err := t.repo.FindByHash(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return nil, domain.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil {
+		if err = t.repo.RevokeByUser(stored.UserID, now); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrInvalidToken
+	}
+	if !stored.IsActive(now) {
+		return nil, domain.ErrInvalidToken
+	}
+
+	if err = t.repo.Revoke(stored.ID, now); err != nil {
+		return nil, err
+	}
+
+	return t.issue(stored.UserID, now)
+}
+
+// Revoke succeeds for unknown and already revoked tokens, client's intent is fulfilled anyway
+func (t *token) Revoke(refreshToken string) error {
+	stored, err := t.repo.FindByHash(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, domain.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	err = t.repo.Revoke(stored.ID, time.Now())
+	if err != nil && !errors.Is(err, domain.ErrInvalidToken) {
+		return err
+	}
+
+	return nil
+}
+
+func (t *token) ExpireRefreshTokens(now time.Time) error {
+	_, err := t.repo.DeleteExpired(now)
+	if err != nil {
+		return errors.Wrap(err, "expiring refresh tokens")
+	}
+
+	return nil
+}
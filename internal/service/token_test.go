@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/signer"
+)
+
+type fakeUserRepo struct {
+	UserRepo
+	users map[int]*domain.User
+}
+
+func (f *fakeUserRepo) GetById(id int) (*domain.User, error) {
+	if u, ok := f.users[id]; ok {
+		return u, nil
+	}
+	return nil, domain.ErrNoRecord
+}
+
+type fakeTokenRepo struct {
+	TokenRepo
+	tokens []*domain.RefreshToken
+}
+
+func (f *fakeTokenRepo) Insert(userID int, hash []byte, expiresAt time.Time) error {
+	f.tokens = append(f.tokens, &domain.RefreshToken{ID: len(f.tokens) + 1, UserID: userID, Hash: hash, ExpiresAt: expiresAt})
+	return nil
+}
+
+func (f *fakeTokenRepo) FindByHash(hash []byte) (*domain.RefreshToken, error) {
+	for _, t := range f.tokens {
+		if bytes.Equal(t.Hash, hash) {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, domain.ErrNoRecord
+}
+
+func (f *fakeTokenRepo) Revoke(tokenID int, now time.Time) error {
+	t := f.tokens[tokenID-1]
+	if t.RevokedAt != nil {
+		return domain.ErrInvalidToken
+	}
+	t.RevokedAt = &now
+	return nil
+}
+
+func (f *fakeTokenRepo) RevokeByUser(userID int, now time.Time) error {
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func TestTokens(t *testing.T) {
+	now := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+	repo := &fakeTokenRepo{}
+	s := signer.New("secret")
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Role: domain.Role{ID: 3}},
+	}}
+	tokens := NewToken(repo, users, s)
+
+	pair, err := tokens.issue(7, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, roleID, err := tokens.authenticate(pair.AccessToken, now.Add(time.Minute))
+	if err != nil || userID != 7 || roleID != 3 {
+		t.Errorf("want user 7 with role 3; got %d, %d, %v", userID, roleID, err)
+	}
+	if _, _, err = tokens.authenticate(pair.AccessToken, now.Add(accessTokenTTL+time.Second)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want expired access token to be invalid; got %v", err)
+	}
+	manageLink := s.Sign("reservation:7", now.Add(time.Hour))
+	if _, _, err = tokens.authenticate(manageLink, now); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want other signed tokens to be invalid access tokens; got %v", err)
+	}
+	if _, _, err = tokens.authenticate(pair.RefreshToken, now); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want refresh token to be invalid access token; got %v", err)
+	}
+	users.users[7].SessionsRevokedAt = now.Add(time.Second)
+	if _, _, err = tokens.authenticate(pair.AccessToken, now.Add(time.Minute)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want access token issued before sessions were revoked to be invalid; got %v", err)
+	}
+	users.users[7].SessionsRevokedAt = time.Time{}
+
+	rotated, err := tokens.refresh(pair.RefreshToken, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Error("want refresh token to be rotated")
+	}
+	if !bytes.Equal(repo.tokens[0].Hash, hashToken(pair.RefreshToken)) || repo.tokens[0].RevokedAt == nil {
+		t.Error("want used refresh token to be revoked and stored as hash")
+	}
+
+	// reusing revoked token revokes the rotated one too
+	if _, err = tokens.refresh(pair.RefreshToken, now.Add(2*time.Hour)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want reused refresh token to be invalid; got %v", err)
+	}
+	if _, err = tokens.refresh(rotated.RefreshToken, now.Add(2*time.Hour)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want all tokens to be revoked after reuse; got %v", err)
+	}
+
+	pair, err = tokens.issue(7, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tokens.refresh(pair.RefreshToken, now.Add(refreshTokenTTL)); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want expired refresh token to be invalid; got %v", err)
+	}
+
+	pair, err = tokens.issue(7, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tokens.Revoke(pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if err = tokens.Revoke(pair.RefreshToken); err != nil {
+		t.Errorf("want revoking twice to succeed; got %v", err)
+	}
+	if _, err = tokens.refresh(pair.RefreshToken, now); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("want revoked refresh token to be invalid; got %v", err)
+	}
+}
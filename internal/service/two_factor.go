@@ -0,0 +1,207 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/qrcode"
+	"github.com/CyganFx/table-reservation/pkg/totp"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer        = "Check, Please"
+	recoveryCodeCount = 10
+	qrCodeScale       = 5
+)
+
+type TwoFactorRepo interface {
+	SetSecret(userID int, secret string) error
+	Enable(userID int, step int64, recoveryCodeHashes [][]byte, now time.Time) error
+	Disable(userID int) error
+	UseStep(userID int, step int64) error
+	UseRecoveryCode(userID int, hash []byte, now time.Time) error
+	SetRequired(roleID int, required bool) error
+}
+
+// twoFactor manages TOTP second factor, recovery codes are the way in when the phone is lost
+type twoFactor struct {
+	repo     TwoFactorRepo
+	userRepo UserRepo
+	throttle loginThrottle
+}
+
+func NewTwoFactor(repo TwoFactorRepo, userRepo UserRepo, throttleRepo LoginThrottleRepo) *twoFactor {
+	return &twoFactor{repo: repo, userRepo: userRepo, throttle: loginThrottle{repo: throttleRepo}}
+}
+
+// BeginEnrollment generates a new secret, previous unconfirmed one stops working
+func (t *twoFactor) BeginEnrollment(userID int) (*domain.TOTPEnrollment, error) {
+	user, err := t.userRepo.GetById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsTwoFactorEnabled() {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.Wrap(err, "generating totp secret")
+	}
+	if err = t.repo.SetSecret(userID, secret); err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+
+	return enrollment(user)
+}
+
+// PendingEnrollment returns ErrNoRecord when enrolment was not started or is already confirmed
+func (t *twoFactor) PendingEnrollment(userID int) (*domain.TOTPEnrollment, error) {
+	user, err := t.userRepo.GetById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPSecret == "" || user.IsTwoFactorEnabled() {
+		return nil, domain.ErrNoRecord
+	}
+
+	return enrollment(user)
+}
+
+func enrollment(user *domain.User) (*domain.TOTPEnrollment, error) {
+	uri := totp.URI(totpIssuer, user.Email, user.TOTPSecret)
+
+	code, err := qrcode.Encode([]byte(uri))
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding qr code")
+	}
+	image, err := code.PNG(qrCodeScale)
+	if err != nil {
+		return nil, errors.Wrap(err, "drawing qr code")
+	}
+
+	return &domain.TOTPEnrollment{Secret: user.TOTPSecret, URI: uri, QRCode: image}, nil
+}
+
+// ConfirmEnrollment enables second factor once user proves the app generates right codes,
+// recovery codes are returned only here and are not stored in plain text
+func (t *twoFactor) ConfirmEnrollment(userID int, code string) ([]string, error) {
+	return t.confirmEnrollment(userID, code, time.Now())
+}
+
+func (t *twoFactor) confirmEnrollment(userID int, code string, now time.Time) ([]string, error) {
+	user, err := t.userRepo.GetById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPSecret == "" || user.IsTwoFactorEnabled() {
+		return nil, domain.ErrInvalidCode
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, now)
+	if !ok {
+		return nil, domain.ErrInvalidCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = generateRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err = t.repo.Enable(userID, step, hashes, now); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns code like "ABCDE-FGHIJ", 50 random bits
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating recovery code")
+	}
+	code := base32.StdEncoding.EncodeToString(b)[:10]
+
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// Verify is the second step of login, failed codes are counted the same way as wrong passwords
+func (t *twoFactor) Verify(userID int, code, ip string, notificator http_v1.NotificatorService) error {
+	return t.verify(userID, code, ip, time.Now(), notificator)
+}
+
+func (t *twoFactor) verify(userID int, code, ip string, now time.Time, notificator http_v1.NotificatorService) error {
+	user, err := t.userRepo.GetById(userID)
+	if err != nil {
+		return err
+	}
+
+	if err = t.throttle.check(user, ip, now); err != nil {
+		return err
+	}
+
+	err = t.checkCode(user, code, now)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			// failed counting must look like any wrong code, otherwise it tells the right one
+			if err = t.throttle.fail(user, ip, now, notificator); err != nil {
+				return errors.Wrapf(domain.ErrInvalidCode, "counting failed code: %v", err)
+			}
+			return domain.ErrInvalidCode
+		}
+		return err
+	}
+
+	return t.throttle.succeed(user)
+}
+
+// checkCode accepts either a code from authenticator app or one of recovery codes,
+// both can be used only once
+func (t *twoFactor) checkCode(user *domain.User, code string, now time.Time) error {
+	if !user.IsTwoFactorEnabled() {
+		return domain.ErrInvalidCode
+	}
+
+	if step, ok := totp.Validate(user.TOTPSecret, code, now); ok {
+		return t.repo.UseStep(user.ID, step)
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != 10 {
+		return domain.ErrInvalidCode
+	}
+
+	return t.repo.UseRecoveryCode(user.ID, hashToken(normalized), now)
+}
+
+// Disable asks for a code, so that an open session alone is not enough to turn the second factor off
+func (t *twoFactor) Disable(userID int, code string) error {
+	user, err := t.userRepo.GetById(userID)
+	if err != nil {
+		return err
+	}
+	if err = t.checkCode(user, code, time.Now()); err != nil {
+		return err
+	}
+
+	return t.repo.Disable(userID)
+}
+
+func (t *twoFactor) SetRequired(roleID int, required bool) error {
+	return t.repo.SetRequired(roleID, required)
+}
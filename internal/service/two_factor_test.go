@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/totp"
+)
+
+type fakeTwoFactorRepo struct {
+	TwoFactorRepo
+	users  *fakeUserRepo
+	hashes [][]byte
+}
+
+func (f *fakeTwoFactorRepo) SetSecret(userID int, secret string) error {
+	f.users.users[userID].TOTPSecret = secret
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) Enable(userID int, step int64, hashes [][]byte, now time.Time) error {
+	u := f.users.users[userID]
+	u.TOTPEnabledAt, u.TOTPLastStep = now, step
+	f.hashes = hashes
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) Disable(userID int) error {
+	u := f.users.users[userID]
+	u.TOTPSecret, u.TOTPEnabledAt, u.TOTPLastStep = "", time.Time{}, 0
+	f.hashes = nil
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) UseStep(userID int, step int64) error {
+	u := f.users.users[userID]
+	if u.TOTPLastStep >= step {
+		return domain.ErrInvalidCode
+	}
+	u.TOTPLastStep = step
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) UseRecoveryCode(userID int, hash []byte, now time.Time) error {
+	for i, h := range f.hashes {
+		if bytes.Equal(h, hash) {
+			f.hashes = append(f.hashes[:i], f.hashes[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrInvalidCode
+}
+
+func TestTwoFactor(t *testing.T) {
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		7: {ID: 7, Email: "partner@example.com"},
+	}}
+	repo := &fakeTwoFactorRepo{users: users}
+	s := NewTwoFactor(repo, users, &fakeLoginThrottleRepo{users: users, ips: map[string]*domain.LoginFailures{}})
+	now := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+
+	if err := s.verify(7, "123456", "10.0.0.1", now, nil); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("want code to be refused before enrolment; got %v", err)
+	}
+
+	enrollment, err := s.BeginEnrollment(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enrollment.Secret == "" || len(enrollment.QRCode) == 0 {
+		t.Fatalf("want secret and qr code; got %+v", enrollment)
+	}
+	if pending, err := s.PendingEnrollment(7); err != nil || pending.Secret != enrollment.Secret {
+		t.Errorf("want pending enrolment with the same secret; got %v, %v", pending, err)
+	}
+
+	if _, err = s.confirmEnrollment(7, "000000", now); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("want wrong code to be refused; got %v", err)
+	}
+	code, _ := totp.Code(enrollment.Secret, totp.Step(now))
+	recoveryCodes, err := s.confirmEnrollment(7, code, now)
+	if err != nil {
+		t.Fatalf("want enrolment to be confirmed; got %v", err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount || len(repo.hashes) != recoveryCodeCount {
+		t.Fatalf("want %d recovery codes; got %d, %d stored", recoveryCodeCount, len(recoveryCodes), len(repo.hashes))
+	}
+	if _, err = s.PendingEnrollment(7); !errors.Is(err, domain.ErrNoRecord) {
+		t.Errorf("want no pending enrolment after confirmation; got %v", err)
+	}
+	if _, err = s.BeginEnrollment(7); err == nil {
+		t.Error("want enabled secret not to be replaced")
+	}
+
+	if err = s.verify(7, code, "10.0.0.1", now, nil); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("want code used for enrolment not to be accepted again; got %v", err)
+	}
+	next, _ := totp.Code(enrollment.Secret, totp.Step(now)+1)
+	if err = s.verify(7, next, "10.0.0.1", now.Add(totp.Period), nil); err != nil {
+		t.Errorf("want next code to be accepted; got %v", err)
+	}
+
+	lowercase := "  " + string(bytes.ToLower([]byte(recoveryCodes[0])))
+	if err = s.verify(7, lowercase, "10.0.0.1", now, nil); err != nil {
+		t.Errorf("want recovery code to be accepted; got %v", err)
+	}
+	if err = s.verify(7, recoveryCodes[0], "10.0.0.1", now, nil); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("want recovery code to be used once; got %v", err)
+	}
+
+	if err = s.Disable(7, "ZZZZZ-ZZZZZ"); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("want disabling without valid code to fail; got %v", err)
+	}
+	if err = s.Disable(7, recoveryCodes[1]); err != nil || users.users[7].IsTwoFactorEnabled() {
+		t.Errorf("want second factor to be disabled; got %v", err)
+	}
+}
@@ -18,26 +18,31 @@ import (
 	"mime/multipart"
 	"net/url"
 	"strings"
+	"time"
 )
 
-const (
-	UserRoleId = 2
-)
+const bcryptCost = 12
 
 type user struct {
-	repo UserRepo
+	repo      UserRepo
+	resetRepo PasswordResetRepo
+	throttle  loginThrottle
+	signer    Signer
 }
 
-func NewUser(repo UserRepo) *user {
-	return &user{repo: repo}
+func NewUser(repo UserRepo, resetRepo PasswordResetRepo, throttleRepo LoginThrottleRepo, signer Signer) *user {
+	return &user{repo: repo, resetRepo: resetRepo, throttle: loginThrottle{repo: throttleRepo}, signer: signer}
 }
 
 type UserRepo interface {
-	Create(name, email, mobile, hashedPassword string, roleId int) error
+	Create(name, email, mobile, hashedPassword, roleName string) error
 	GetById(id int) (*domain.User, error)
+	GetByEmail(email string) (*domain.User, error)
+	MarkEmailVerified(userID int, now time.Time) error
 	Update(user *domain.User) error
 	Authenticate(email, password string) (int, error)
 	SetProfileImage(filePath string, userID int) error
+	SetNotificationSettings(userID int, channel domain.NotifyChannel, locale domain.Locale) error
 	UpdateUserRoleByID(userID, roleID int) error
 	Query(cafeID int) ([]domain.User, error)
 	Report(userID, cafeID int) error
@@ -45,9 +50,9 @@ type UserRepo interface {
 }
 
 func (u *user) Save(form *forms.FormValidator) (bool, error) {
-	form.Required("name", "email", "mobile", "password")
+	form.Required("name", "email", "mobile")
 	form.MatchesPattern("email", forms.EmailRX)
-	form.MinLength("password", 5)
+	validatePassword(form)
 	form.MinLength("mobile", 11)
 	form.MaxLength("mobile", 12)
 	form.MaxLength("name", 50)
@@ -57,7 +62,7 @@ func (u *user) Save(form *forms.FormValidator) (bool, error) {
 		return false, nil
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), 12)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), bcryptCost)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to generate hashed password")
 	}
@@ -66,7 +71,7 @@ func (u *user) Save(form *forms.FormValidator) (bool, error) {
 		form.Get("email"),
 		form.Get("mobile"),
 		string(hashedPassword),
-		UserRoleId,
+		domain.RoleUser,
 	)
 	if err != nil {
 		return true, err
@@ -75,8 +80,63 @@ func (u *user) Save(form *forms.FormValidator) (bool, error) {
 	return true, nil
 }
 
-func (u *user) SignIn(email, password string) (int, error) {
-	return u.repo.Authenticate(email, password)
+// validatePassword keeps the same rules for sign up and password reset
+func validatePassword(form *forms.FormValidator) {
+	form.Required("password")
+	form.MinLength("password", 5)
+}
+
+// SignIn checks the password unless the account or client address made too many failed attempts,
+// see loginThrottle
+func (u *user) SignIn(email, password, ip string, notificator http_v1.NotificatorService) (int, error) {
+	return u.signIn(email, password, ip, time.Now(), notificator)
+}
+
+func (u *user) signIn(email, password, ip string, now time.Time, notificator http_v1.NotificatorService) (int, error) {
+	user, err := u.repo.GetByEmail(email)
+	if err != nil && !errors.Is(err, domain.ErrNoRecord) {
+		return -1, err
+	}
+
+	if err = u.throttle.check(user, ip, now); err != nil {
+		return -1, err
+	}
+
+	id, err := u.repo.Authenticate(email, password)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCredentials) {
+			// failed counting must look like any wrong password, otherwise it tells the right one
+			if err = u.throttle.fail(user, ip, now, notificator); err != nil {
+				return -1, errors.Wrapf(domain.ErrInvalidCredentials, "counting failed login: %v", err)
+			}
+			return -1, domain.ErrInvalidCredentials
+		}
+		return -1, err
+	}
+
+	// with second factor the login is not over yet, failed codes keep counting
+	if user != nil && !user.IsTwoFactorEnabled() {
+		if err = u.throttle.succeed(user); err != nil {
+			return -1, err
+		}
+	}
+
+	return id, nil
+}
+
+// GetLockedAccounts returns accounts locked after too many failed logins
+func (u *user) GetLockedAccounts() ([]domain.User, error) {
+	return u.throttle.repo.GetLockedUsers(time.Now())
+}
+
+func (u *user) UnlockAccount(userID int) error {
+	return u.throttle.repo.ResetAccount(userID)
+}
+
+// ExpireLoginFailures forgets client addresses that stopped failing
+func (u *user) ExpireLoginFailures(now time.Time) error {
+	_, err := u.throttle.repo.DeleteIPFailuresBefore(now.Add(-loginFailureWindow))
+	return err
 }
 
 func (u *user) FindById(id int) (*domain.User, error) {
@@ -91,10 +151,37 @@ func (u *user) Update(user *domain.User) error {
 	return u.repo.Update(user)
 }
 
-func (u *user) SetConfirmData(ctx *gin.Context, reservationData *http_v1.ReservationData, tableID, eventID int, eventDescription string) (*forms.FormValidator, error) {
+// UpdateNotificationSettings changes the way user gets notifications and their language,
+// channels other than email need mobile number
+func (u *user) UpdateNotificationSettings(userID int, channel domain.NotifyChannel, locale domain.Locale) error {
+	if !channel.IsValid() {
+		return domain.ErrUnknownChannel
+	}
+	if !locale.IsValid() {
+		return domain.ErrUnknownLocale
+	}
+
+	user, err := u.repo.GetById(userID)
+	if err != nil {
+		return err
+	}
+	if channel.NeedsMobile() && user.Mobile == "" {
+		return domain.ErrNoMobile
+	}
+
+	return u.repo.SetNotificationSettings(userID, channel, locale)
+}
+
+// SetConfirmData remembers chosen tables, the first one is reservation's table and the rest are joined to it
+func (u *user) SetConfirmData(ctx *gin.Context, reservationData *http_v1.ReservationData, tableIDs []int, eventID int, eventDescription string) (*forms.FormValidator, error) {
 	session := sessions.Default(ctx)
 	userChoice := session.Get("userChoice").(http_v1.UserChoice)
-	userChoice.TableID = tableID
+	userChoice.TableID = 0
+	userChoice.JoinedTableIDs = nil
+	if len(tableIDs) > 0 {
+		userChoice.TableID = tableIDs[0]
+		userChoice.JoinedTableIDs = tableIDs[1:]
+	}
 	userChoice.EventID = eventID
 	userChoice.EventDescription = eventDescription
 	reservationData.UserChoice = userChoice
@@ -103,7 +190,7 @@ func (u *user) SetConfirmData(ctx *gin.Context, reservationData *http_v1.Reserva
 
 	form := forms.New(url.Values{})
 
-	userID := session.Get("authenticatedUserID")
+	userID := http_v1.AuthenticatedUserID(ctx)
 	if userID != nil {
 		u, err := u.FindById(userID.(int))
 		if err != nil {
@@ -166,8 +253,13 @@ func (u *user) UpdateUserRole(userID, roleID int) error {
 	return u.repo.UpdateUserRoleByID(userID, roleID)
 }
 
-func (u *user) AddToBlacklist(userID, cafeID int) error {
-	return u.repo.Report(userID, cafeID)
+// AddToBlacklist bans user from booking at actor's cafe
+func (u *user) AddToBlacklist(actor *domain.CafeMember, userID int) error {
+	if err := actor.Authorize(actor.Cafe.ID, domain.PermissionBlacklistManage); err != nil {
+		return err
+	}
+
+	return u.repo.Report(userID, actor.Cafe.ID)
 }
 
 func (u *user) InBlacklist(userID, cafeID int) (bool, error) {
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+func (f *fakeUserRepo) SetNotificationSettings(userID int, channel domain.NotifyChannel, locale domain.Locale) error {
+	f.users[userID].NotifyChannel = channel
+	f.users[userID].Locale = locale
+	return nil
+}
+
+func TestUpdateNotificationSettings(t *testing.T) {
+	users := &fakeUserRepo{users: map[int]*domain.User{
+		1: {ID: 1, Mobile: "87011234567", NotifyChannel: domain.NotifyEmail},
+		2: {ID: 2, NotifyChannel: domain.NotifyEmail},
+	}}
+	s := NewUser(users, nil, nil, nil)
+
+	if err := s.UpdateNotificationSettings(1, "pigeon", domain.LocaleEN); !errors.Is(err, domain.ErrUnknownChannel) {
+		t.Errorf("want unknown channel to be rejected; got %v", err)
+	}
+	if err := s.UpdateNotificationSettings(1, domain.NotifyEmail, "de"); !errors.Is(err, domain.ErrUnknownLocale) {
+		t.Errorf("want unknown locale to be rejected; got %v", err)
+	}
+	if err := s.UpdateNotificationSettings(2, domain.NotifySMS, domain.LocaleEN); !errors.Is(err, domain.ErrNoMobile) {
+		t.Errorf("want sms to need mobile number; got %v", err)
+	}
+	err := s.UpdateNotificationSettings(1, domain.NotifySMS, domain.LocaleKK)
+	if err != nil || users.users[1].NotifyChannel != domain.NotifySMS || users.users[1].Locale != domain.LocaleKK {
+		t.Errorf("want sms in kazakh to be set; got %v, %+v", err, users.users[1])
+	}
+}
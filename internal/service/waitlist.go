@@ -0,0 +1,366 @@
+package service
+
+import (
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+const (
+	// waitlistOfferTTL is how long a freed table is kept for the guest to claim it
+	waitlistOfferTTL = 15 * time.Minute
+	// waitlistLinkTTL is counted from the end of guest's time window,
+	// so that an outdated link still shows that the offer has expired
+	waitlistLinkTTL = 24 * time.Hour
+)
+
+type waitlist struct {
+	repo        WaitlistRepo
+	reservation *reservation
+	signer      Signer
+}
+
+func NewWaitlist(repo WaitlistRepo, reservation *reservation, signer Signer) *waitlist {
+	return &waitlist{repo: repo, reservation: reservation, signer: signer}
+}
+
+type WaitlistRepo interface {
+	Insert(entry *domain.WaitlistEntry) error
+	FindByID(entryID int) (*domain.WaitlistEntry, error)
+	FindWaiting(cafeID int, now time.Time) ([]domain.WaitlistEntry, error)
+	FindByCafeID(cafeID int) ([]domain.WaitlistEntry, error)
+	FindExpiredOffers(now time.Time) ([]domain.WaitlistEntry, error)
+	MarkOffered(entryID, reservationID int, expiresAt time.Time) error
+	UpdateStatus(entryID int, from, to domain.WaitlistStatus) error
+}
+
+// Join puts guest on the cafe's waitlist, any table starting between "from" and "until" of the date suits them
+func (w *waitlist) Join(form *forms.FormValidator, cafeID int, userID interface{}) (bool, error) {
+	form.Required("date", "from", "until", "party_size", "location_id", "name", "mobile", "email")
+	form.MatchesPattern("email", forms.EmailRX)
+	form.MinLength("mobile", 11)
+	form.MaxLength("mobile", 12)
+	form.MaxLength("name", 50)
+	form.MaxLength("email", 100)
+	if !form.Valid() {
+		return false, nil
+	}
+
+	policy, err := w.reservation.repo.GetBookingPolicy(cafeID)
+	if err != nil {
+		return true, err
+	}
+
+	date := form.Get("date")
+	partySize, _ := strconv.Atoi(form.Get("party_size"))
+	locationID, _ := strconv.Atoi(form.Get("location_id"))
+
+	windowStart, _, err := bookingPeriod(policy, date, form.Get("from"))
+	if err != nil {
+		form.Errors.Add("from", "The cafe does not accept bookings at this time")
+	}
+	windowEnd, _, err := bookingPeriod(policy, date, form.Get("until"))
+	if err != nil {
+		form.Errors.Add("until", "The cafe does not accept bookings at this time")
+	}
+	if !form.Valid() {
+		return false, nil
+	}
+
+	isCafeLocation, err := w.isCafeLocation(cafeID, locationID)
+	if err != nil {
+		return true, err
+	}
+	if !isCafeLocation {
+		form.Errors.Add("location_id", "Please choose one of the cafe's locations")
+	}
+	if windowEnd.Before(windowStart) {
+		form.Errors.Add("until", "This time must not be earlier than the first one")
+	} else if checkBookingPolicy(policy, partySize, date, windowEnd, time.Now()) != nil {
+		form.Errors.Add("party_size", "The cafe does not accept bookings for this date or party size")
+	}
+	if !form.Valid() {
+		return false, nil
+	}
+
+	entry := &domain.WaitlistEntry{
+		PartySize:   partySize,
+		CustName:    form.Get("name"),
+		CustMobile:  form.Get("mobile"),
+		CustEmail:   form.Get("email"),
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+	}
+	entry.Cafe.ID = cafeID
+	entry.Location.ID = locationID
+	entry.User.ID = -1
+	if userID != nil {
+		entry.User.ID = userID.(int)
+	}
+
+	return true, w.repo.Insert(entry)
+}
+
+func (w *waitlist) isCafeLocation(cafeID, locationID int) (bool, error) {
+	locations, err := w.reservation.repo.GetAvailableLocationsByCafeID(cafeID)
+	if err != nil {
+		return false, err
+	}
+	for _, location := range locations {
+		if location.ID == locationID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// OfferFreedTables goes through the cafe's waitlist in order of joining
+// and offers every guest the first free table within their time window
+func (w *waitlist) OfferFreedTables(cafeID int, notificator http_v1.NotificatorService) error {
+	now := time.Now()
+	entries, err := w.repo.FindWaiting(cafeID, now)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	policy, err := w.reservation.repo.GetBookingPolicy(cafeID)
+	if err != nil {
+		return err
+	}
+
+	// offer is already made when sending fails, so the rest of guests still get theirs
+	var failed []int
+	var sendErr error
+	for i := range entries {
+		entry := &entries[i]
+		offered, err := w.offerTable(entry, policy, now)
+		if err != nil {
+			return err
+		}
+		if !offered {
+			continue
+		}
+
+		if err = notificator.WaitlistOffer(*entry, w.OfferToken(entry)); err != nil {
+			failed = append(failed, entry.ID)
+			sendErr = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Wrapf(sendErr, "sending offers to waitlist entries %v", failed)
+	}
+	return nil
+}
+
+// offerTable books pending reservation for the guest, so that nobody takes the table until the offer expires
+func (w *waitlist) offerTable(entry *domain.WaitlistEntry, policy *domain.BookingPolicy, now time.Time) (bool, error) {
+	interval := time.Duration(policy.ReservationInterval) * time.Minute
+
+	for start := entry.WindowStart; !start.After(entry.WindowEnd); start = start.Add(bookTimeSelectInterval * time.Minute) {
+		if !start.After(now) {
+			continue
+		}
+
+		tables, combinations, err := w.reservation.seatingOptions(entry.Cafe.ID, entry.PartySize, entry.Location.ID,
+			0, start, start.Add(interval))
+		if err != nil {
+			return false, err
+		}
+
+		var chosen []domain.Table
+		switch {
+		case len(tables) > 0:
+			chosen = tables[:1]
+		case len(combinations) > 0:
+			chosen = combinations[0].Tables
+		default:
+			continue
+		}
+
+		reservation := domain.NewReservation()
+		reservation.Status = domain.StatusPending
+		reservation.User.ID = entry.User.ID
+		reservation.CustName = entry.CustName
+		reservation.CustMobile = entry.CustMobile
+		reservation.CustEmail = entry.CustEmail
+		reservation.PartySize = entry.PartySize
+		reservation.Cafe = entry.Cafe
+		reservation.Table = chosen[0]
+		reservation.JoinedTables = chosen[1:]
+		reservation.Event.ID = 1 // default value
+		reservation.Date = start
+		reservation.EndDate = start.Add(interval)
+
+		err = w.reservation.repo.BookTable(reservation)
+		if errors.Is(err, domain.ErrTableTaken) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		expiresAt := now.Add(waitlistOfferTTL)
+		if expiresAt.After(start) {
+			expiresAt = start
+		}
+
+		err = w.repo.MarkOffered(entry.ID, reservation.ID, expiresAt)
+		if err != nil {
+			// the guest got another offer meanwhile, release the table for others
+			cancelErr := w.reservation.repo.UpdateStatus(reservation.ID, domain.StatusPending, domain.StatusCancelled, -1)
+			if cancelErr != nil {
+				return false, cancelErr
+			}
+			if errors.Is(err, domain.ErrInvalidTransition) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		entry.Status = domain.WaitlistOffered
+		entry.Reservation = *reservation
+		entry.OfferExpiresAt = expiresAt
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// ExpireOffers releases tables of offers nobody claimed in time and offers them to the next guests
+func (w *waitlist) ExpireOffers(now time.Time, notificator http_v1.NotificatorService) error {
+	entries, err := w.repo.FindExpiredOffers(now)
+	if err != nil {
+		return errors.Wrap(err, "getting expired waitlist offers")
+	}
+
+	cafes := make(map[int]bool)
+	for _, entry := range entries {
+		err = w.repo.UpdateStatus(entry.ID, domain.WaitlistOffered, domain.WaitlistExpired)
+		if errors.Is(err, domain.ErrInvalidTransition) {
+			continue // claimed at the last moment
+		}
+		if err != nil {
+			return err
+		}
+
+		err = w.reservation.repo.UpdateStatus(entry.Reservation.ID, domain.StatusPending, domain.StatusCancelled, -1)
+		if err != nil && !errors.Is(err, domain.ErrInvalidTransition) {
+			return err
+		}
+		cafes[entry.Cafe.ID] = true
+	}
+
+	for cafeID := range cafes {
+		if err = w.OfferFreedTables(cafeID, notificator); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OfferToken is put in the link that lets guest claim the offer without logging in
+func (w *waitlist) OfferToken(entry *domain.WaitlistEntry) string {
+	return w.signer.Sign(offerTokenValue(entry.ID), entry.WindowEnd.Add(waitlistLinkTTL))
+}
+
+func offerTokenValue(entryID int) string {
+	return "waitlist:" + strconv.Itoa(entryID)
+}
+
+// GetOffer returns waitlist entry if the token from the emailed link was issued for it
+func (w *waitlist) GetOffer(entryID int, token string) (*domain.WaitlistEntry, error) {
+	value, err := w.signer.Verify(token, time.Now())
+	if err != nil || value != offerTokenValue(entryID) {
+		return nil, domain.ErrAccessDenied
+	}
+
+	return w.GetEntry(entryID)
+}
+
+// GetCafeEntry returns waitlist entry to staff of its cafe, the rest get ErrAccessDenied
+func (w *waitlist) GetCafeEntry(actor *domain.CafeMember, entryID int) (*domain.WaitlistEntry, error) {
+	entry, err := w.GetEntry(entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = actor.Authorize(entry.Cafe.ID, domain.PermissionWaitlistManage); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetEntry returns waitlist entry with details of the offered reservation
+func (w *waitlist) GetEntry(entryID int) (*domain.WaitlistEntry, error) {
+	entry, err := w.repo.FindByID(entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Reservation.ID != 0 {
+		reservation, err := w.reservation.repo.GetReservationByID(entry.Reservation.ID)
+		if err != nil {
+			return nil, err
+		}
+		entry.Reservation = *reservation
+	}
+
+	return entry, nil
+}
+
+func (w *waitlist) GetCafeWaitlist(cafeID int) ([]domain.WaitlistEntry, error) {
+	return w.repo.FindByCafeID(cafeID)
+}
+
+// Claim turns the offered pending reservation into a confirmed one
+func (w *waitlist) Claim(entry *domain.WaitlistEntry, userID interface{}) error {
+	if !entry.IsOfferOpen() {
+		return domain.ErrOfferExpired
+	}
+
+	// whoever changes the entry first, guest or expiring job, decides the reservation's fate
+	err := w.repo.UpdateStatus(entry.ID, domain.WaitlistOffered, domain.WaitlistClaimed)
+	if errors.Is(err, domain.ErrInvalidTransition) {
+		return domain.ErrOfferExpired
+	}
+	if err != nil {
+		return err
+	}
+
+	changedBy := -1
+	if userID != nil {
+		changedBy = userID.(int)
+	}
+
+	return w.reservation.repo.UpdateStatus(entry.Reservation.ID, domain.StatusPending, domain.StatusConfirmed, changedBy)
+}
+
+// Cancel takes guest off the waitlist, the offered table is released
+func (w *waitlist) Cancel(entry *domain.WaitlistEntry, changedBy int) error {
+	if entry.Status != domain.WaitlistWaiting && entry.Status != domain.WaitlistOffered {
+		return domain.ErrInvalidTransition
+	}
+
+	if err := w.repo.UpdateStatus(entry.ID, entry.Status, domain.WaitlistCancelled); err != nil {
+		return err
+	}
+
+	if entry.Status == domain.WaitlistOffered {
+		err := w.reservation.repo.UpdateStatus(entry.Reservation.ID, domain.StatusPending, domain.StatusCancelled, changedBy)
+		if err != nil && !errors.Is(err, domain.ErrInvalidTransition) {
+			return err
+		}
+	}
+	entry.Status = domain.WaitlistCancelled
+
+	return nil
+}
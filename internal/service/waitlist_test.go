@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	http_v1 "github.com/CyganFx/table-reservation/internal/delivery/http-v1"
+	"github.com/CyganFx/table-reservation/internal/domain"
+	"github.com/CyganFx/table-reservation/pkg/signer"
+	"github.com/CyganFx/table-reservation/pkg/validator/forms"
+)
+
+// fakeReservationRepo has free tables only at the given starts, booking at taken starts fails
+type fakeReservationRepo struct {
+	ReservationRepo
+	free      map[time.Time][]domain.Table
+	taken     map[time.Time]bool
+	booked    []*domain.Reservation
+	cancelled []int
+	locations []domain.Location
+	joins     []domain.TableJoin
+}
+
+func (f *fakeReservationRepo) GetAvailableLocationsByCafeID(int) ([]domain.Location, error) {
+	return f.locations, nil
+}
+
+func (f *fakeReservationRepo) GetSuitableTables(_, _, _, _ int, start, _ time.Time) ([]domain.Table, error) {
+	return f.free[start], nil
+}
+
+func (f *fakeReservationRepo) GetTableJoins(int) ([]domain.TableJoin, error) {
+	return f.joins, nil
+}
+
+func (f *fakeReservationRepo) BookTable(reservation *domain.Reservation) error {
+	if f.taken[reservation.Date] {
+		return domain.ErrTableTaken
+	}
+	reservation.ID = len(f.booked) + 1
+	f.booked = append(f.booked, reservation)
+	return nil
+}
+
+func (f *fakeReservationRepo) UpdateStatus(reservationID int, _, to domain.ReservationStatus, _ int) error {
+	if to == domain.StatusCancelled {
+		f.cancelled = append(f.cancelled, reservationID)
+	}
+	return nil
+}
+
+type fakeWaitlistRepo struct {
+	WaitlistRepo
+	markErr   error
+	expiresAt time.Time
+	waiting   []domain.WaitlistEntry
+	inserted  []*domain.WaitlistEntry
+}
+
+func (f *fakeWaitlistRepo) FindWaiting(int, time.Time) ([]domain.WaitlistEntry, error) {
+	return f.waiting, nil
+}
+
+func (f *fakeWaitlistRepo) Insert(entry *domain.WaitlistEntry) error {
+	f.inserted = append(f.inserted, entry)
+	return nil
+}
+
+func (f *fakeWaitlistRepo) MarkOffered(_, _ int, expiresAt time.Time) error {
+	f.expiresAt = expiresAt
+	return f.markErr
+}
+
+func TestOfferTable(t *testing.T) {
+	policy := domain.DefaultBookingPolicy(1)
+	at := func(hour, min int) time.Time {
+		return time.Date(2021, 6, 4, hour, min, 0, 0, time.UTC)
+	}
+	table := []domain.Table{{ID: 1, Capacity: 4}}
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		free          map[time.Time][]domain.Table
+		taken         map[time.Time]bool
+		markErr       error
+		wantOffered   bool
+		wantStart     time.Time
+		wantExpiresAt time.Time
+		wantCancelled int
+	}{
+		{"first free slot", at(17, 0), map[time.Time][]domain.Table{at(19, 30): table, at(19, 45): table},
+			nil, nil, true, at(19, 30), at(17, 15), 0},
+		{"slot taken meanwhile", at(17, 0), map[time.Time][]domain.Table{at(19, 30): table, at(19, 45): table},
+			map[time.Time]bool{at(19, 30): true}, nil, true, at(19, 45), at(17, 15), 0},
+		{"offer expires when reservation starts", at(19, 20), map[time.Time][]domain.Table{at(19, 30): table},
+			nil, nil, true, at(19, 30), at(19, 30), 0},
+		{"passed slots are skipped", at(19, 30), map[time.Time][]domain.Table{at(19, 30): table},
+			nil, nil, false, time.Time{}, time.Time{}, 0},
+		{"too small tables", at(17, 0), map[time.Time][]domain.Table{at(19, 0): {{ID: 2, Capacity: 2}}},
+			nil, nil, false, time.Time{}, time.Time{}, 0},
+		{"offered meanwhile", at(17, 0), map[time.Time][]domain.Table{at(19, 0): table},
+			nil, domain.ErrInvalidTransition, false, time.Time{}, time.Time{}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reservationRepo := &fakeReservationRepo{free: tt.free, taken: tt.taken}
+			waitlistRepo := &fakeWaitlistRepo{markErr: tt.markErr}
+			w := NewWaitlist(waitlistRepo, NewReservation(reservationRepo, nil), nil)
+
+			entry := &domain.WaitlistEntry{ID: 1, PartySize: 3, WindowStart: at(19, 0), WindowEnd: at(19, 45),
+				Status: domain.WaitlistWaiting}
+
+			offered, err := w.offerTable(entry, policy, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offered != tt.wantOffered {
+				t.Fatalf("want offered %v; got %v", tt.wantOffered, offered)
+			}
+			if len(reservationRepo.cancelled) != tt.wantCancelled {
+				t.Errorf("want %d cancelled reservations; got %d", tt.wantCancelled, len(reservationRepo.cancelled))
+			}
+			if !offered {
+				return
+			}
+
+			if got := entry.Reservation; !got.Date.Equal(tt.wantStart) || got.Status != domain.StatusPending {
+				t.Errorf("want pending reservation at %v; got %s at %v", tt.wantStart, got.Status, got.Date)
+			}
+			if !waitlistRepo.expiresAt.Equal(tt.wantExpiresAt) {
+				t.Errorf("want offer to expire at %v; got %v", tt.wantExpiresAt, waitlistRepo.expiresAt)
+			}
+		})
+	}
+}
+
+// fakeOfferNotificator fails to send offers to the given entries
+type fakeOfferNotificator struct {
+	http_v1.NotificatorService
+	failFor map[int]bool
+	sent    []int
+}
+
+func (f *fakeOfferNotificator) WaitlistOffer(entry domain.WaitlistEntry, _ string) error {
+	if f.failFor[entry.ID] {
+		return errors.New("smtp is down")
+	}
+	f.sent = append(f.sent, entry.ID)
+	return nil
+}
+
+func TestOfferFreedTablesSendFailure(t *testing.T) {
+	tomorrow := time.Now().UTC().Add(24 * time.Hour)
+	start := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 19, 0, 0, 0, time.UTC)
+	table := []domain.Table{{ID: 1, Capacity: 4}}
+
+	reservationRepo := &fakeReservationRepo{free: map[time.Time][]domain.Table{start: table}}
+	waitlistRepo := &fakeWaitlistRepo{}
+	for id := 1; id <= 3; id++ {
+		waitlistRepo.waiting = append(waitlistRepo.waiting, domain.WaitlistEntry{ID: id, PartySize: 2,
+			WindowStart: start, WindowEnd: start, Status: domain.WaitlistWaiting})
+	}
+	w := NewWaitlist(waitlistRepo, NewReservation(reservationRepo, nil), signer.New("secret"))
+	notificator := &fakeOfferNotificator{failFor: map[int]bool{1: true}}
+
+	err := w.OfferFreedTables(1, notificator)
+	if err == nil || !strings.Contains(err.Error(), "[1]") {
+		t.Errorf("want error naming entry 1; got %v", err)
+	}
+	if len(notificator.sent) != 2 {
+		t.Errorf("want offers sent to the rest of guests; got %v", notificator.sent)
+	}
+}
+
+func TestJoinLocation(t *testing.T) {
+	tomorrow := time.Now().UTC().Add(24 * time.Hour)
+	form := func(locationID string) *forms.FormValidator {
+		return forms.New(url.Values{"date": {tomorrow.Format("2006-01-02")}, "from": {"19:00"}, "until": {"20:00"},
+			"party_size": {"2"}, "location_id": {locationID}, "name": {"Aida"}, "mobile": {"87011234567"},
+			"email": {"aida@mail.kz"}})
+	}
+	waitlistRepo := &fakeWaitlistRepo{}
+	reservationRepo := &fakeReservationRepo{locations: []domain.Location{{ID: 3}}}
+	w := NewWaitlist(waitlistRepo, NewReservation(reservationRepo, nil), nil)
+
+	// location of another cafe
+	f := form("4")
+	if valid, err := w.Join(f, 1, nil); valid || err != nil || f.Errors.Get("location_id") == "" {
+		t.Errorf("want location of another cafe rejected; got valid %v, %v", valid, err)
+	}
+	f = form("3")
+	if valid, err := w.Join(f, 1, nil); !valid || err != nil {
+		t.Fatalf("want guest put on waitlist; got valid %v, %v, %v", valid, err, f.Errors)
+	}
+	if len(waitlistRepo.inserted) != 1 || waitlistRepo.inserted[0].Location.ID != 3 {
+		t.Errorf("want entry at location 3; got %v", waitlistRepo.inserted)
+	}
+}
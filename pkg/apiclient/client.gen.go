@@ -0,0 +1,447 @@
+// Code generated by gen.go from http_v2.OpenAPISpec; DO NOT EDIT.
+
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type Availability struct {
+	Combinations []Combination `json:"combinations"`
+	Tables       []Table       `json:"tables"`
+}
+
+type BookingOptions struct {
+	Events     []IDName `json:"events"`
+	Locations  []IDName `json:"locations"`
+	MaxDate    string   `json:"max_date"` // formatted as 2006-01-02
+	MinDate    string   `json:"min_date"` // formatted as 2006-01-02
+	PartySizes []int    `json:"party_sizes"`
+	Times      []string `json:"times"`
+}
+
+type Cafe struct {
+	Address     string `json:"address"`
+	City        City   `json:"city"`
+	Description string `json:"description"`
+	Email       string `json:"email"`
+	ID          int    `json:"id"`
+	ImageURL    string `json:"image_url"`
+	Mobile      string `json:"mobile"`
+	Name        string `json:"name"`
+	Type        IDName `json:"type"`
+}
+
+type CancelRequest struct {
+	Token string `json:"token,omitempty"`
+}
+
+type City struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	TimeZone string `json:"time_zone"` // IANA name, e.g. Asia/Almaty
+}
+
+type Combination struct {
+	Capacity int   `json:"capacity"`
+	TableIDs []int `json:"table_ids"`
+}
+
+type Error struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"` // message per invalid field
+}
+
+type IDName struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	OTP      string `json:"otp,omitempty"` // code from authenticator app or a recovery code, required when two-factor authentication is enabled
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type Reservation struct {
+	Cafe             IDName    `json:"cafe"`
+	CustEmail        string    `json:"cust_email,omitempty"`
+	CustMobile       string    `json:"cust_mobile,omitempty"`
+	CustName         string    `json:"cust_name,omitempty"`
+	Date             time.Time `json:"date"` // in cafe's time zone
+	Event            IDName    `json:"event"`
+	EventDescription string    `json:"event_description,omitempty"`
+	ID               int       `json:"id"`
+	IsChangeable     bool      `json:"is_changeable"`
+	Location         IDName    `json:"location"`
+	ManageToken      string    `json:"manage_token,omitempty"` // returned once after booking
+	PartySize        int       `json:"party_size"`
+	Status           string    `json:"status"` // one of pending, confirmed, seated, completed, cancelled, no_show
+	TableIDs         []int     `json:"table_ids"`
+}
+
+type ReservationRequest struct {
+	CafeID           int    `json:"cafe_id"`
+	Date             string `json:"date"` // formatted as 2006-01-02
+	Email            string `json:"email"`
+	EventDescription string `json:"event_description,omitempty"`
+	EventID          int    `json:"event_id,omitempty"`
+	LocationID       int    `json:"location_id"`
+	Mobile           string `json:"mobile"`
+	Name             string `json:"name"`
+	PartySize        int    `json:"party_size"`
+	TableIDs         []int  `json:"table_ids"` // the first table and tables joined to it
+	Time             string `json:"time"`
+}
+
+type StatusRequest struct {
+	Status string `json:"status"` // one of pending, confirmed, seated, completed, cancelled, no_show
+}
+
+type Table struct {
+	Capacity int    `json:"capacity"`
+	ID       int    `json:"id"`
+	Location IDName `json:"location"`
+}
+
+type Token struct {
+	AccessToken      string    `json:"access_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"` // one of Bearer
+}
+
+type User struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	ID            int    `json:"id"`
+	ImageURL      string `json:"image_url"`
+	Mobile        string `json:"mobile"`
+	Name          string `json:"name"`
+	Role          IDName `json:"role"`
+}
+
+// RefreshToken calls POST /auth/refresh
+//
+// Exchange refresh token for a new pair, the used refresh token stops working
+func (c *Client) RefreshToken(ctx context.Context, body *RefreshRequest) (*Token, error) {
+	path := "/auth/refresh"
+	var out Token
+	if err := c.do(ctx, http.MethodPost, path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeToken calls POST /auth/revoke
+//
+// Revoke refresh token, issued access token expires on its own
+func (c *Client) RevokeToken(ctx context.Context, body *RefreshRequest) error {
+	path := "/auth/revoke"
+	return c.do(ctx, http.MethodPost, path, nil, body, nil)
+}
+
+// IssueToken calls POST /auth/token
+//
+// Login for clients without cookies, access token is sent in Authorization: Bearer header
+func (c *Client) IssueToken(ctx context.Context, body *LoginRequest) (*Token, error) {
+	path := "/auth/token"
+	var out Token
+	if err := c.do(ctx, http.MethodPost, path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListCafesParams are query parameters of ListCafes
+type ListCafesParams struct {
+	Search string
+	Type   int
+	City   int
+}
+
+func (p *ListCafesParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Search != "" {
+		v.Set("search", p.Search)
+	}
+	if p.Type != 0 {
+		v.Set("type", strconv.Itoa(p.Type))
+	}
+	if p.City != 0 {
+		v.Set("city", strconv.Itoa(p.City))
+	}
+	return v
+}
+
+// ListCafes calls GET /cafes
+//
+// Search cafes by name, filter them by type and city or list all of them
+func (c *Client) ListCafes(ctx context.Context, params *ListCafesParams) ([]Cafe, error) {
+	path := "/cafes"
+	var out []Cafe
+	if err := c.do(ctx, http.MethodGet, path, params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetAvailabilityParams are query parameters of GetAvailability
+type GetAvailabilityParams struct {
+	Date       string // formatted as 2006-01-02
+	Time       string // wall clock in cafe's time zone, e.g. 19:30
+	PartySize  int
+	LocationID int
+}
+
+func (p *GetAvailabilityParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	v.Set("date", p.Date)
+	v.Set("time", p.Time)
+	v.Set("party_size", strconv.Itoa(p.PartySize))
+	v.Set("location_id", strconv.Itoa(p.LocationID))
+	return v
+}
+
+// GetAvailability calls GET /cafes/{id}/availability
+//
+// Free tables, combinations of joinable tables are looked up when no single table seats the party
+func (c *Client) GetAvailability(ctx context.Context, id int, params *GetAvailabilityParams) (*Availability, error) {
+	path := "/cafes/" + strconv.Itoa(id) + "/availability"
+	var out Availability
+	if err := c.do(ctx, http.MethodGet, path, params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBookingOptionsParams are query parameters of GetBookingOptions
+type GetBookingOptionsParams struct {
+	Date string // times are listed for this date, today in cafe's time zone by default
+}
+
+func (p *GetBookingOptionsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Date != "" {
+		v.Set("date", p.Date)
+	}
+	return v
+}
+
+// GetBookingOptions calls GET /cafes/{id}/booking-options
+//
+// Dates, times, party sizes, locations and events guest can choose from
+func (c *Client) GetBookingOptions(ctx context.Context, id int, params *GetBookingOptionsParams) (*BookingOptions, error) {
+	path := "/cafes/" + strconv.Itoa(id) + "/booking-options"
+	var out BookingOptions
+	if err := c.do(ctx, http.MethodGet, path, params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOpenAPI calls GET /openapi.json
+//
+// OpenAPI document of this api
+func (c *Client) GetOpenAPI(ctx context.Context) (map[string]interface{}, error) {
+	path := "/openapi.json"
+	var out map[string]interface{}
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListPartnerReservationsParams are query parameters of ListPartnerReservations
+type ListPartnerReservationsParams struct {
+	CafeID int // cafe among those the user works at, may be left out by staff of a single cafe
+}
+
+func (p *ListPartnerReservationsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.CafeID != 0 {
+		v.Set("cafe_id", strconv.Itoa(p.CafeID))
+	}
+	return v
+}
+
+// ListPartnerReservations calls GET /partner/reservations
+//
+// Reservations history of partner's cafe including cancelled ones
+func (c *Client) ListPartnerReservations(ctx context.Context, params *ListPartnerReservationsParams) ([]Reservation, error) {
+	path := "/partner/reservations"
+	var out []Reservation
+	if err := c.do(ctx, http.MethodGet, path, params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetPartnerReservationParams are query parameters of GetPartnerReservation
+type GetPartnerReservationParams struct {
+	CafeID int // cafe among those the user works at, may be left out by staff of a single cafe
+}
+
+func (p *GetPartnerReservationParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.CafeID != 0 {
+		v.Set("cafe_id", strconv.Itoa(p.CafeID))
+	}
+	return v
+}
+
+// GetPartnerReservation calls GET /partner/reservations/{id}
+func (c *Client) GetPartnerReservation(ctx context.Context, id int, params *GetPartnerReservationParams) (*Reservation, error) {
+	path := "/partner/reservations/" + strconv.Itoa(id)
+	var out Reservation
+	if err := c.do(ctx, http.MethodGet, path, params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ChangeReservationStatusParams are query parameters of ChangeReservationStatus
+type ChangeReservationStatusParams struct {
+	CafeID int // cafe among those the user works at, may be left out by staff of a single cafe
+}
+
+func (p *ChangeReservationStatusParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.CafeID != 0 {
+		v.Set("cafe_id", strconv.Itoa(p.CafeID))
+	}
+	return v
+}
+
+// ChangeReservationStatus calls POST /partner/reservations/{id}/status
+//
+// Mark guests as seated, completed or no-show
+func (c *Client) ChangeReservationStatus(ctx context.Context, id int, params *ChangeReservationStatusParams, body *StatusRequest) (*Reservation, error) {
+	path := "/partner/reservations/" + strconv.Itoa(id) + "/status"
+	var out Reservation
+	if err := c.do(ctx, http.MethodPost, path, params.values(), body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateReservation calls POST /reservations
+//
+// Book tables, manage token of the new reservation is returned once
+func (c *Client) CreateReservation(ctx context.Context, body *ReservationRequest) (*Reservation, error) {
+	path := "/reservations"
+	var out Reservation
+	if err := c.do(ctx, http.MethodPost, path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReservationParams are query parameters of GetReservation
+type GetReservationParams struct {
+	Token string
+}
+
+func (p *GetReservationParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Token != "" {
+		v.Set("token", p.Token)
+	}
+	return v
+}
+
+// GetReservation calls GET /reservations/{id}
+//
+// Reservation of the logged in guest or the one the manage token was issued for
+func (c *Client) GetReservation(ctx context.Context, id int, params *GetReservationParams) (*Reservation, error) {
+	path := "/reservations/" + strconv.Itoa(id)
+	var out Reservation
+	if err := c.do(ctx, http.MethodGet, path, params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelReservation calls POST /reservations/{id}/cancel
+//
+// Cancel reservation, logged in guests do not need manage token
+func (c *Client) CancelReservation(ctx context.Context, id int, body *CancelRequest) (*Reservation, error) {
+	path := "/reservations/" + strconv.Itoa(id) + "/cancel"
+	var in interface{}
+	if body != nil {
+		in = body
+	}
+	var out Reservation
+	if err := c.do(ctx, http.MethodPost, path, nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Login calls POST /users/login
+//
+// Start a session, the session cookie authenticates next requests
+func (c *Client) Login(ctx context.Context, body *LoginRequest) (*User, error) {
+	path := "/users/login"
+	var out User
+	if err := c.do(ctx, http.MethodPost, path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Logout calls POST /users/logout
+func (c *Client) Logout(ctx context.Context) error {
+	path := "/users/logout"
+	return c.do(ctx, http.MethodPost, path, nil, nil, nil)
+}
+
+// GetProfile calls GET /users/me
+func (c *Client) GetProfile(ctx context.Context) (*User, error) {
+	path := "/users/me"
+	var out User
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListUserReservations calls GET /users/me/reservations
+func (c *Client) ListUserReservations(ctx context.Context) ([]Reservation, error) {
+	path := "/users/me/reservations"
+	var out []Reservation
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+// Package apiclient is a client of json api v2 for internal tools. Requests and types
+// in client.gen.go are generated from the OpenAPI document the api serves,
+// run go generate after changing http_v2.OpenAPISpec
+package apiclient
+
+//go:generate go run gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu          sync.RWMutex
+	accessToken string
+}
+
+// New returns client of api mounted at baseURL, e.g. https://example.com/api/v2.
+// Login starts a session that is kept in cookie jar of httpClient,
+// default client with its own jar is used when httpClient is nil
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		jar, _ := cookiejar.New(nil) // never fails without options
+		httpClient = &http.Client{Jar: jar}
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// SetAccessToken makes next requests authenticate with bearer token from IssueToken or RefreshToken
+// instead of session cookie, empty token turns it off
+func (c *Client) SetAccessToken(token string) {
+	c.mu.Lock()
+	c.accessToken = token
+	c.mu.Unlock()
+}
+
+// APIError is returned when api responds with an error status,
+// Fields has a message per invalid field of unprocessable requests
+type APIError struct {
+	StatusCode int
+	Message    string
+	Fields     map[string]string
+}
+
+func (e *APIError) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("apiclient: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("apiclient: %d %s %v", e.StatusCode, e.Message, e.Fields)
+}
+
+// do sends in as json body unless it is nil and decodes successful response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "apiclient: encoding request")
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return errors.Wrap(err, "apiclient")
+	}
+	req.Header.Set("Accept", "application/json")
+	c.mu.RLock()
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	}
+	c.mu.RUnlock()
+	if method != http.MethodGet {
+		// api rejects changing requests that are not json, even without body
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "apiclient")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var e Error
+		if err = json.NewDecoder(res.Body).Decode(&e); err != nil || e.Error == "" {
+			e.Error = http.StatusText(res.StatusCode)
+		}
+		return &APIError{StatusCode: res.StatusCode, Message: e.Error, Fields: e.Fields}
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "apiclient: decoding response of %s %s", method, path)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	http_v2 "github.com/CyganFx/table-reservation/internal/delivery/http-v2"
+	"github.com/CyganFx/table-reservation/pkg/apiclient/internal/gen"
+)
+
+func TestGeneratedClientIsUpToDate(t *testing.T) {
+	want, err := gen.Generate(http_v2.OpenAPISpec, "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile("client.gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("client.gen.go is out of date with http_v2.OpenAPISpec, run go generate ./pkg/apiclient")
+	}
+}
+
+func TestClient(t *testing.T) {
+	type request struct {
+		Method, URI, ContentType, Authorization string
+		Body                                    map[string]interface{}
+	}
+	var got []request
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/", func(w http.ResponseWriter, r *http.Request) {
+		req := request{Method: r.Method, URI: r.URL.RequestURI(), ContentType: r.Header.Get("Content-Type"),
+			Authorization: r.Header.Get("Authorization")}
+		json.NewDecoder(r.Body).Decode(&req.Body)
+		got = append(got, req)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/api/v2/cafes":
+			w.Write([]byte(`[{"id":1,"name":"Del Papa","city":{"id":1,"name":"Almaty","time_zone":"Asia/Almaty"}}]`))
+		case "/api/v2/reservations":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error":"invalid fields","fields":{"email":"This field is invalid"}}`))
+		case "/api/v2/reservations/7/cancel":
+			w.Write([]byte(`{"id":7,"status":"cancelled","table_ids":[3,4]}`))
+		case "/api/v2/users/logout":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := New(srv.URL+"/api/v2/", nil)
+	ctx := context.Background()
+
+	cafes, err := c.ListCafes(ctx, &ListCafesParams{City: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cafes) != 1 || cafes[0].City.TimeZone != "Asia/Almaty" {
+		t.Errorf("unexpected cafes %+v", cafes)
+	}
+
+	_, err = c.CreateReservation(ctx, &ReservationRequest{CafeID: 1, TableIDs: []int{3}, Email: "nope"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity ||
+		apiErr.Fields["email"] != "This field is invalid" {
+		t.Errorf("want validation error; got %v", err)
+	}
+
+	reservation, err := c.CancelReservation(ctx, 7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != "cancelled" || !reflect.DeepEqual(reservation.TableIDs, []int{3, 4}) {
+		t.Errorf("unexpected reservation %+v", reservation)
+	}
+
+	if err = c.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetAccessToken("access")
+	if _, err = c.GetProfile(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound ||
+		apiErr.Message != "Not Found" {
+		t.Errorf("want not found error; got %v", err)
+	}
+
+	want := []request{
+		{Method: "GET", URI: "/api/v2/cafes?city=1"},
+		{Method: "POST", URI: "/api/v2/reservations", ContentType: "application/json", Body: map[string]interface{}{
+			"cafe_id": 1.0, "date": "", "time": "", "party_size": 0.0, "location_id": 0.0,
+			"table_ids": []interface{}{3.0}, "name": "", "mobile": "", "email": "nope"}},
+		{Method: "POST", URI: "/api/v2/reservations/7/cancel", ContentType: "application/json"},
+		{Method: "POST", URI: "/api/v2/users/logout", ContentType: "application/json"},
+		{Method: "GET", URI: "/api/v2/users/me", Authorization: "Bearer access"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want requests\n%+v\ngot\n%+v", want, got)
+	}
+}
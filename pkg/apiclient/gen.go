@@ -0,0 +1,24 @@
+//go:build ignore
+// +build ignore
+
+// gen.go writes client.gen.go from http_v2.OpenAPISpec, run it with go generate
+package main
+
+import (
+	"io/ioutil"
+	"log"
+
+	http_v2 "github.com/CyganFx/table-reservation/internal/delivery/http-v2"
+	"github.com/CyganFx/table-reservation/pkg/apiclient/internal/gen"
+)
+
+func main() {
+	src, err := gen.Generate(http_v2.OpenAPISpec, "apiclient")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile("client.gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
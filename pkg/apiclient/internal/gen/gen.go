@@ -0,0 +1,528 @@
+// Package gen turns OpenAPI document into go source of apiclient package.
+// It supports only the subset of OpenAPI the api uses: json bodies, path and query
+// parameters of primitive types and schemas built of objects, arrays and references
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type document struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*schema   `json:"schemas"`
+		Responses map[string]*response `json:"responses"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool               `json:"required"`
+		Content  map[string]content `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type response struct {
+	Ref         string             `json:"$ref"`
+	Description string             `json:"description"`
+	Content     map[string]content `json:"content"`
+}
+
+type content struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Enum                 []string           `json:"enum"`
+	Items                *schema            `json:"items"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+}
+
+const jsonType = "application/json"
+
+// Generate returns formatted source of package pkg
+func Generate(spec []byte, pkg string) ([]byte, error) {
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing spec")
+	}
+
+	g := &generator{doc: &doc, imports: map[string]bool{}}
+
+	var body bytes.Buffer
+	g.buf = &body
+	if err := g.types(); err != nil {
+		return nil, err
+	}
+	if err := g.operations(); err != nil {
+		return nil, err
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by gen.go from http_v2.OpenAPISpec; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	src.WriteString("import (\n")
+	for _, imp := range sortedKeys(g.imports) {
+		fmt.Fprintf(&src, "\t%q\n", imp)
+	}
+	src.WriteString(")\n")
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "formatting generated source")
+	}
+	return formatted, nil
+}
+
+type generator struct {
+	doc     *document
+	buf     *bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format, args...)
+}
+
+func (g *generator) types() error {
+	for _, name := range sortedKeys(g.doc.Components.Schemas) {
+		s := g.doc.Components.Schemas[name]
+		if s.Type != "object" || len(s.Properties) == 0 {
+			return errors.Errorf("schema %s: only objects with properties are supported", name)
+		}
+
+		g.printf("\n")
+		if s.Description != "" {
+			g.printf("// %s %s\n", name, s.Description)
+		}
+		g.printf("type %s struct {\n", name)
+		if err := g.fields(name, s.Properties, s.Required); err != nil {
+			return err
+		}
+		g.printf("}\n")
+	}
+	return nil
+}
+
+func (g *generator) fields(owner string, properties map[string]*schema, required []string) error {
+	isRequired := map[string]bool{}
+	for _, r := range required {
+		isRequired[r] = true
+	}
+
+	for _, prop := range sortedKeys(properties) {
+		s := properties[prop]
+		typ, err := g.goType(s)
+		if err != nil {
+			return errors.Wrapf(err, "%s.%s", owner, prop)
+		}
+
+		tag := prop
+		if !isRequired[prop] {
+			tag += ",omitempty"
+		}
+		g.printf("\t%s %s `json:\"%s\"`%s\n", exported(prop), typ, tag, fieldComment(s))
+	}
+	return nil
+}
+
+func fieldComment(s *schema) string {
+	var notes []string
+	if s.Description != "" {
+		notes = append(notes, s.Description)
+	}
+	if len(s.Enum) > 0 {
+		notes = append(notes, "one of "+strings.Join(s.Enum, ", "))
+	}
+	if s.Format == "date" {
+		notes = append(notes, "formatted as 2006-01-02")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " // " + strings.Join(notes, "; ")
+}
+
+func (g *generator) goType(s *schema) (string, error) {
+	if s.Ref != "" {
+		const prefix = "#/components/schemas/"
+		if !strings.HasPrefix(s.Ref, prefix) {
+			return "", errors.Errorf("unsupported reference %s", s.Ref)
+		}
+		name := strings.TrimPrefix(s.Ref, prefix)
+		if _, ok := g.doc.Components.Schemas[name]; !ok {
+			return "", errors.Errorf("undefined schema %s", name)
+		}
+		return name, nil
+	}
+
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.imports["time"] = true
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		return "int", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "", errors.New("array without items")
+		}
+		item, err := g.goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if len(s.Properties) > 0 {
+			return "", errors.New("inline objects are not supported, move them to components")
+		}
+		if s.AdditionalProperties != nil {
+			value, err := g.goType(s.AdditionalProperties)
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + value, nil
+		}
+		return "map[string]interface{}", nil
+	}
+	return "", errors.Errorf("unsupported type %q", s.Type)
+}
+
+var httpMethods = map[string]string{
+	"get":    "http.MethodGet",
+	"post":   "http.MethodPost",
+	"put":    "http.MethodPut",
+	"patch":  "http.MethodPatch",
+	"delete": "http.MethodDelete",
+}
+
+func (g *generator) operations() error {
+	g.imports["context"] = true
+	g.imports["net/http"] = true
+
+	for _, path := range sortedKeys(g.doc.Paths) {
+		for _, method := range sortedKeys(g.doc.Paths[path]) {
+			op := g.doc.Paths[path][method]
+			if op.OperationID == "" {
+				return errors.Errorf("%s %s: operationId is required", method, path)
+			}
+			if _, ok := httpMethods[method]; !ok {
+				return errors.Errorf("%s %s: unsupported method", method, path)
+			}
+			if err := g.operation(path, method, op); err != nil {
+				return errors.Wrap(err, op.OperationID)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) operation(path, method string, op *operation) error {
+	name := exported(op.OperationID)
+
+	var pathParams, queryParams []*parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query":
+			queryParams = append(queryParams, p)
+		default:
+			return errors.Errorf("parameter %s in %s is not supported", p.Name, p.In)
+		}
+	}
+
+	if len(queryParams) > 0 {
+		if err := g.paramsType(name, queryParams); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		typ, err := g.primitive(p)
+		if err != nil {
+			return err
+		}
+		args = append(args, lowerFirst(exported(p.Name))+" "+typ)
+	}
+	if len(queryParams) > 0 {
+		args = append(args, "params *"+name+"Params")
+	}
+
+	var bodyType string
+	if op.RequestBody != nil {
+		c, ok := op.RequestBody.Content[jsonType]
+		if !ok || c.Schema == nil {
+			return errors.New("request body must be json")
+		}
+		typ, err := g.goType(c.Schema)
+		if err != nil {
+			return err
+		}
+		if c.Schema.Ref != "" {
+			typ = "*" + typ
+		}
+		bodyType = typ
+		args = append(args, "body "+typ)
+	}
+
+	resultType, err := g.resultType(op)
+	if err != nil {
+		return err
+	}
+
+	g.printf("\n// %s calls %s %s\n", name, strings.ToUpper(method), path)
+	if op.Summary != "" {
+		g.printf("//\n// %s\n", op.Summary)
+	}
+	if resultType == "" {
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	} else {
+		g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), resultType)
+	}
+
+	g.printf("\tpath := %s\n", g.pathExpr(path, pathParams))
+
+	query := "nil"
+	if len(queryParams) > 0 {
+		query = "params.values()"
+	}
+
+	in := "nil"
+	if bodyType != "" {
+		in = "body"
+		if !op.RequestBody.Required && strings.HasPrefix(bodyType, "*") {
+			// typed nil pointer must not be sent as json null
+			g.printf("\tvar in interface{}\n\tif body != nil {\n\t\tin = body\n\t}\n")
+			in = "in"
+		}
+	}
+
+	call := fmt.Sprintf("c.do(ctx, %s, path, %s, %s", httpMethods[method], query, in)
+	switch {
+	case resultType == "":
+		g.printf("\treturn %s, nil)\n", call)
+	case strings.HasPrefix(resultType, "*"):
+		g.printf("\tvar out %s\n", resultType[1:])
+		g.printf("\tif err := %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &out, nil\n", call)
+	default:
+		g.printf("\tvar out %s\n", resultType)
+		g.printf("\tif err := %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn out, nil\n", call)
+	}
+	g.printf("}\n")
+
+	return nil
+}
+
+// resultType is empty when successful response has no body
+func (g *generator) resultType(op *operation) (string, error) {
+	for _, code := range sortedKeys(op.Responses) {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		res := op.Responses[code]
+		if res.Ref != "" {
+			res = g.doc.Components.Responses[strings.TrimPrefix(res.Ref, "#/components/responses/")]
+			if res == nil {
+				return "", errors.Errorf("undefined response %s", op.Responses[code].Ref)
+			}
+		}
+
+		c, ok := res.Content[jsonType]
+		if !ok || c.Schema == nil {
+			return "", nil
+		}
+		typ, err := g.goType(c.Schema)
+		if err != nil {
+			return "", err
+		}
+		if c.Schema.Ref != "" {
+			typ = "*" + typ
+		}
+		return typ, nil
+	}
+	return "", errors.New("no successful response")
+}
+
+func (g *generator) primitive(p *parameter) (string, error) {
+	if p.Schema == nil {
+		return "", errors.Errorf("parameter %s has no schema", p.Name)
+	}
+	typ, err := g.goType(p.Schema)
+	if err != nil {
+		return "", errors.Wrapf(err, "parameter %s", p.Name)
+	}
+	if typ != "string" && typ != "int" && typ != "bool" {
+		return "", errors.Errorf("parameter %s of type %s is not supported", p.Name, typ)
+	}
+	return typ, nil
+}
+
+// paramsType declares struct of query parameters and its encoder,
+// zero values of optional parameters are not sent
+func (g *generator) paramsType(name string, params []*parameter) error {
+	g.imports["net/url"] = true
+
+	g.printf("\n// %sParams are query parameters of %s\n", name, name)
+	g.printf("type %sParams struct {\n", name)
+	for _, p := range params {
+		typ, err := g.primitive(p)
+		if err != nil {
+			return err
+		}
+		comment := fieldComment(p.Schema)
+		if p.Description != "" {
+			comment = " // " + p.Description
+		}
+		g.printf("\t%s %s%s\n", exported(p.Name), typ, comment)
+	}
+	g.printf("}\n")
+
+	g.printf("\nfunc (p *%sParams) values() url.Values {\n", name)
+	g.printf("\tv := url.Values{}\n\tif p == nil {\n\t\treturn v\n\t}\n")
+	for _, p := range params {
+		typ, _ := g.primitive(p)
+		field := "p." + exported(p.Name)
+
+		var value, zero string
+		switch typ {
+		case "int":
+			g.imports["strconv"] = true
+			value, zero = "strconv.Itoa("+field+")", "0"
+		case "bool":
+			g.imports["strconv"] = true
+			value, zero = "strconv.FormatBool("+field+")", "false"
+		default:
+			value, zero = field, `""`
+		}
+
+		if p.Required {
+			g.printf("\tv.Set(%q, %s)\n", p.Name, value)
+		} else {
+			g.printf("\tif %s != %s {\n\t\tv.Set(%q, %s)\n\t}\n", field, zero, p.Name, value)
+		}
+	}
+	g.printf("\treturn v\n}\n")
+
+	return nil
+}
+
+func (g *generator) pathExpr(path string, params []*parameter) string {
+	types := map[string]string{}
+	for _, p := range params {
+		types[p.Name], _ = g.primitive(p)
+	}
+
+	var parts []string
+	for path != "" {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			parts = append(parts, fmt.Sprintf("%q", path))
+			break
+		}
+		end := strings.Index(path, "}")
+		if start > 0 {
+			parts = append(parts, fmt.Sprintf("%q", path[:start]))
+		}
+
+		name := path[start+1 : end]
+		arg := lowerFirst(exported(name))
+		switch types[name] {
+		case "int":
+			g.imports["strconv"] = true
+			arg = "strconv.Itoa(" + arg + ")"
+		case "bool":
+			g.imports["strconv"] = true
+			arg = "strconv.FormatBool(" + arg + ")"
+		default:
+			g.imports["net/url"] = true
+			arg = "url.PathEscape(" + arg + ")"
+		}
+		parts = append(parts, arg)
+		path = path[end+1:]
+	}
+	return strings.Join(parts, " + ")
+}
+
+var initialisms = map[string]string{"id": "ID", "ids": "IDs", "url": "URL", "api": "API", "otp": "OTP"}
+
+// exported turns snake_case and camelCase names into go identifiers, e.g. table_ids into TableIDs
+func exported(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if s, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(s)
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "ID" {
+		return "id"
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// sortedKeys keeps generated source stable, json objects have no order in go maps
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*schema:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]*operation:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*operation:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*response:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]bool:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
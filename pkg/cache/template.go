@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"fmt"
 	"html/template"
 	"path/filepath"
 	"time"
@@ -10,8 +11,14 @@ func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// clock formats minutes since midnight as "15:04"
+func clock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"clock":     clock,
 }
 
 func NewTemplate(dir string) (map[string]*template.Template, error) {
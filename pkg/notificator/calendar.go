@@ -0,0 +1,95 @@
+package notificator
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+const (
+	calendarFileName    = "reservation.ics"
+	calendarContentType = "text/calendar; charset=utf-8"
+	// calendarLineLength is the limit of a content line in octets, longer lines are folded, see RFC 5545 3.1
+	calendarLineLength = 75
+	calendarTimeLayout = "20060102T150405Z"
+)
+
+var calendarEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// calendarEvent is an iCalendar object (RFC 5545) guests add to their calendars, description is the text of
+// the message it is attached to. Its UID is the same for every message about the reservation,
+// so that the cancellation removes the event added from the confirmation
+func calendarEvent(data domain.Reservation, baseURL, manageURL, description string, now time.Time) Attachment {
+	method, status, sequence := "PUBLISH", "CONFIRMED", 0
+	if data.Status == domain.StatusCancelled {
+		method, status, sequence = "CANCEL", "CANCELLED", 1
+	}
+
+	host := "localhost"
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	location := data.Cafe.Name
+	if data.Cafe.Address != "" {
+		location += ", " + data.Cafe.Address
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Check, Please//Table reservation//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:" + method,
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:reservation-%d@%s", data.ID, host),
+		"DTSTAMP:" + now.UTC().Format(calendarTimeLayout),
+		"DTSTART:" + data.Date.UTC().Format(calendarTimeLayout),
+	}
+	if data.EndDate.After(data.Date) {
+		lines = append(lines, "DTEND:"+data.EndDate.UTC().Format(calendarTimeLayout))
+	}
+	lines = append(lines,
+		fmt.Sprintf("SEQUENCE:%d", sequence),
+		"STATUS:"+status,
+		"SUMMARY:"+calendarEscaper.Replace(data.Cafe.Name),
+		"LOCATION:"+calendarEscaper.Replace(location),
+		"DESCRIPTION:"+calendarEscaper.Replace(description),
+	)
+	if manageURL != "" {
+		lines = append(lines, "URL:"+manageURL)
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var b bytes.Buffer
+	for _, line := range lines {
+		foldLine(&b, line)
+	}
+
+	return Attachment{Name: calendarFileName, ContentType: calendarContentType + "; method=" + method,
+		Content: b.Bytes()}
+}
+
+// foldLine writes content line ending with CRLF, lines longer than calendarLineLength octets go on
+// in lines starting with a space. Multi-byte characters are never split
+func foldLine(b *bytes.Buffer, line string) {
+	limit := calendarLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space counts too
+		limit = calendarLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,79 @@
+package notificator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+func TestCalendarEvent(t *testing.T) {
+	visit := time.Date(2021, 6, 4, 19, 30, 0, 0, time.FixedZone("ALMT", 6*60*60))
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	reservation := domain.Reservation{ID: 7, Date: visit, EndDate: visit.Add(2 * time.Hour),
+		Cafe: domain.Cafe{Name: "Del Papa", Address: "Dostyk 5; 2nd floor"}}
+
+	event := calendarEvent(reservation, "https://checkplease.kz", "https://checkplease.kz/manage?token=t",
+		"See you,\nCheck, Please", now)
+	content := string(event.Content)
+	if event.Name != calendarFileName || event.ContentType != "text/calendar; charset=utf-8; method=PUBLISH" {
+		t.Errorf("want calendar attachment published; got %q of %q", event.Name, event.ContentType)
+	}
+	for _, want := range []string{
+		"METHOD:PUBLISH\r\n",
+		"UID:reservation-7@checkplease.kz\r\n",
+		"DTSTAMP:20210601T120000Z\r\n",
+		"DTSTART:20210604T133000Z\r\n",
+		"DTEND:20210604T153000Z\r\n",
+		"STATUS:CONFIRMED\r\n",
+		"LOCATION:Del Papa\\, Dostyk 5\\; 2nd floor\r\n",
+		"DESCRIPTION:See you\\,\\nCheck\\, Please\r\n",
+		"URL:https://checkplease.kz/manage?token=t\r\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("want event to contain %q; got\n%s", want, content)
+		}
+	}
+
+	reservation.Status = domain.StatusCancelled
+	cancel := string(calendarEvent(reservation, "https://checkplease.kz", "", "", now).Content)
+	for _, want := range []string{"METHOD:CANCEL\r\n", "UID:reservation-7@checkplease.kz\r\n", "SEQUENCE:1\r\n",
+		"STATUS:CANCELLED\r\n"} {
+		if !strings.Contains(cancel, want) {
+			t.Errorf("want cancellation to contain %q; got\n%s", want, cancel)
+		}
+	}
+	if strings.Contains(cancel, "URL:") {
+		t.Errorf("want no url without manage link; got\n%s", cancel)
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("Брондау ", 30)
+
+	var b bytes.Buffer
+	foldLine(&b, line)
+
+	folded := strings.TrimSuffix(b.String(), "\r\n")
+	parts := strings.Split(folded, "\r\n")
+	if len(parts) < 2 {
+		t.Fatalf("want long line folded; got %q", folded)
+	}
+	for i, part := range parts {
+		if len(part) > calendarLineLength {
+			t.Errorf("want lines of at most %d octets; line %d has %d", calendarLineLength, i, len(part))
+		}
+		if !utf8.ValidString(part) {
+			t.Errorf("want characters kept whole; line %d is %q", i, part)
+		}
+		if i > 0 && !strings.HasPrefix(part, " ") {
+			t.Errorf("want continuation line %d to start with a space; got %q", i, part)
+		}
+	}
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != line {
+		t.Errorf("want unfolding to give the line back; got %q", unfolded)
+	}
+}
@@ -0,0 +1,78 @@
+package notificator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+var ErrNoAddress = errors.New("notificator: recipient has no address for the channel")
+
+// httpTimeout keeps slow gateway from holding up the request that triggered notification
+const httpTimeout = 10 * time.Second
+
+// Recipient carries every address we know, channel picks the one it delivers to
+type Recipient struct {
+	// UserID is -1 for guests without account
+	UserID  int
+	Name    string
+	Email   string
+	Mobile  string
+	Channel domain.NotifyChannel
+	Locale  domain.Locale
+}
+
+// Message is written in recipient's locale, HTML is an alternative to the plain text body for channels that can show it.
+// Unsubscribe is the link that stops messages of the same topic, messages out of any topic have none.
+// Attachments are sent by email only, other channels carry text
+type Message struct {
+	To          Recipient
+	Subject     string
+	Body        string
+	HTML        string
+	Unsubscribe string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with the message, e.g. reservation's calendar event
+type Attachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// Channel delivers message to a single recipient, e.g. by email or SMS
+type Channel interface {
+	Send(msg Message) error
+}
+
+// postJSON sends marshalled payload to url and fails on any status but 2xx
+func postJSON(client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("making request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		text, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, bytes.TrimSpace(text))
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package notificator
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	gomail "gopkg.in/mail.v2"
+)
+
+// email sends messages through SMTP server, the server's certificate is verified
+type email struct {
+	dialer gomail.Dialer
+	from   string
+}
+
+func NewEmail(host string, port int, from, pass string) *email {
+	return &email{dialer: *gomail.NewDialer(host, port, from, pass), from: from}
+}
+
+func (e *email) Send(msg Message) error {
+	if msg.To.Email == "" {
+		return ErrNoAddress
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", e.from)
+	m.SetHeader("To", msg.To.Email)
+	m.SetHeader("Subject", msg.Subject)
+	if msg.Unsubscribe != "" {
+		// mail clients show their own unsubscribe button and post to the link without opening it, see RFC 8058
+		m.SetHeader("List-Unsubscribe", "<"+msg.Unsubscribe+">")
+		m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	m.SetBody("text/plain", msg.Body)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
+	for _, a := range msg.Attachments {
+		content := a.Content
+		// copy func runs on every attempt to send, a reader would be drained by the first one
+		m.Attach(a.Name, gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		}), gomail.SetHeader(map[string][]string{"Content-Type": {a.ContentType}}))
+	}
+
+	// dialer picks auth mechanism the server offers by setting it on itself, every send gets a copy
+	dialer := e.dialer
+	if err := dialer.DialAndSend(m); err != nil {
+		return errors.Wrap(err, "sending email")
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package notificator
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts a single session with neither STARTTLS nor AUTH and returns the data it was sent
+func fakeSMTP(t *testing.T) (host string, port int, data <-chan string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+			case "EHLO":
+				tp.PrintfLine("250 localhost")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				lines, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				received <- strings.Join(lines, "\n")
+				tp.PrintfLine("250 ok")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestEmailSend(t *testing.T) {
+	host, port, data := fakeSMTP(t)
+	e := NewEmail(host, port, "booking@checkplease.kz", "secret")
+
+	if err := e.Send(Message{To: Recipient{Mobile: "87011234567"}}); err != ErrNoAddress {
+		t.Errorf("want recipient without email to be rejected; got %v", err)
+	}
+
+	err := e.Send(Message{To: Recipient{Email: "guest@mail.kz"}, Subject: "Reservation", Body: "See you at 19:00",
+		Unsubscribe: "https://checkplease.kz/api/unsubscribe?token=t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(<-data + "\n")))
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("To") != "guest@mail.kz" || header.Get("From") != "booking@checkplease.kz" ||
+		header.Get("Subject") != "Reservation" {
+		t.Errorf("want headers of the message; got %v", header)
+	}
+	if header.Get("List-Unsubscribe") != "<https://checkplease.kz/api/unsubscribe?token=t>" ||
+		header.Get("List-Unsubscribe-Post") != "List-Unsubscribe=One-Click" {
+		t.Errorf("want one-click unsubscribe headers; got %v", header)
+	}
+	if body, _ := r.ReadLine(); body != "See you at 19:00" {
+		t.Errorf("want body of the message; got %q", body)
+	}
+}
+
+func TestEmailSendAttachment(t *testing.T) {
+	host, port, data := fakeSMTP(t)
+	e := NewEmail(host, port, "booking@checkplease.kz", "secret")
+
+	err := e.Send(Message{To: Recipient{Email: "guest@mail.kz"}, Subject: "Reservation", Body: "See you at 19:00",
+		Attachments: []Attachment{{Name: "reservation.ics", ContentType: "text/calendar; method=PUBLISH",
+			Content: []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := <-data
+	for _, want := range []string{"Content-Type: text/calendar; method=PUBLISH",
+		`Content-Disposition: attachment; filename="reservation.ics"`} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("want message to contain %q; got\n%s", want, sent)
+		}
+	}
+}
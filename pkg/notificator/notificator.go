@@ -1,144 +1,244 @@
 package notificator
 
 import (
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/CyganFx/table-reservation/internal/app/config"
 	"github.com/CyganFx/table-reservation/internal/domain"
-	"github.com/pkg/errors"
-	gomail "gopkg.in/mail.v2"
-	"log"
+	"net/url"
+	"strings"
 	"time"
 )
 
-const (
-	timeLayoutWithoutSeconds = "15:04"
-	dateLayout               = "2006-01-02"
-)
-
+// notificator renders messages from templates in recipient's locale and dispatches them to the channel
+// recipient prefers, email is always there, SMS and webhook are on when their urls are configured
 type notificator struct {
-	Host string
-	Port int
-	From string
-	Pass string
+	channels      map[domain.NotifyChannel]Channel
+	templates     *Templates
+	subscriptions Subscriptions
+	// Admin gets collaboration requests
+	Admin   string
+	BaseURL string
+}
+
+// Subscriptions tells who wants messages of a topic by a channel and signs links that stop them
+type Subscriptions interface {
+	IsSubscribed(sub domain.Subscriber, topic domain.NotifyTopic, channel domain.NotifyChannel) (bool, error)
+	UnsubscribeToken(sub domain.Subscriber, topic domain.NotifyTopic, channel domain.NotifyChannel) string
 }
 
-func New(cfg config.Config) *notificator {
+func New(cfg config.Config, templates *Templates, subscriptions Subscriptions) *notificator {
+	channels := map[domain.NotifyChannel]Channel{
+		domain.NotifyEmail: NewEmail(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.From, cfg.SMTP.Pass),
+	}
+	if cfg.SMS.URL != "" {
+		channels[domain.NotifySMS] = NewSMS(cfg.SMS.URL, cfg.SMS.Token, cfg.SMS.Sender)
+	}
+	if cfg.Webhook.URL != "" {
+		channels[domain.NotifyWebhook] = NewWebhook(cfg.Webhook.URL, cfg.Webhook.Secret)
+	}
+
 	return &notificator{
-		Host: cfg.SMTP.Host,
-		Port: cfg.SMTP.Port,
-		From: cfg.SMTP.From,
-		Pass: cfg.SMTP.Pass,
+		channels:      channels,
+		templates:     templates,
+		subscriptions: subscriptions,
+		Admin:         cfg.SMTP.From,
+		BaseURL:       cfg.Web.BaseURL,
+	}
+}
+
+// messageData is what templates can refer to, every notification fills only the part it needs
+type messageData struct {
+	BaseURL     string
+	Name        string
+	Token       string
+	Reservation domain.Reservation
+	Entry       domain.WaitlistEntry
+	Cafe        domain.Cafe
+	Invite      domain.StaffInvite
+	// Hours and Minutes are left until the visit
+	Hours   int
+	Minutes int
+	// AskToConfirm is set in reminders until guest confirms that they are coming
+	AskToConfirm bool
+	Approved     bool
+	Until        time.Time
+	Now          time.Time
+	// Unsubscribe is set in messages of a topic only
+	Unsubscribe string
+	// Calendar attaches Reservation as calendar event
+	Calendar bool
+}
+
+// reaches tells whether channel is configured and recipient has the address it delivers to
+func (n *notificator) reaches(to Recipient, channel domain.NotifyChannel) bool {
+	_, ok := n.channels[channel]
+	return ok && !(channel.NeedsMobile() && to.Mobile == "")
+}
+
+// preferred falls back to email when the channel recipient prefers is not configured or they have no mobile number for it
+func (n *notificator) preferred(to Recipient) domain.NotifyChannel {
+	if !n.reaches(to, to.Channel) {
+		return domain.NotifyEmail
 	}
+	return to.Channel
 }
 
-func (n *notificator) UsersBooking(reservations []domain.Reservation) error {
-	m := gomail.NewMessage()
-	// Settings for SMTP server
-	d := gomail.NewDialer(n.Host, n.Port, n.From, n.Pass)
-	// This is only needed when SSL/TLS certificate is not valid on server.
-	// In production this should be set to false.
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-	// Set E-Mail sender
-	m.SetHeader("From", n.From)
-
-	for _, data := range reservations {
-
-		// Set E-Mail receivers
-		m.SetHeader("To", data.CustEmail)
-		// Set E-Mail subject
-		m.SetHeader("Subject", "Reservation")
-		// Set E-Mail body.
-		m.SetBody("text/plain", fmt.Sprintf(
-			`%s, we remind you about reservation:
-
-					Date: %v
-					Time: %v
-					Place: %s
-
-					Your visit is %v minutes away
-
-					Thank you and look forward to seeing you again!
-					
-					With gratitude,
-					Check, Please`,
-			data.CustName, data.Date.Format(dateLayout), data.Date.Format(timeLayoutWithoutSeconds),
-			data.Cafe.Name, data.Date.Sub(data.NotifyDate).Minutes()))
-
-		log.Printf("Message: %v \n", m)
-		if err := d.DialAndSend(m); err != nil {
-			return errors.Wrap(err, "sending email")
+func (n *notificator) send(to Recipient, name string, data messageData) error {
+	return n.deliver(to, n.preferred(to), name, data)
+}
+
+func (n *notificator) deliver(to Recipient, channel domain.NotifyChannel, name string, data messageData) error {
+	data.BaseURL = n.BaseURL
+	// templates get a pointer, so that they can call methods of reservation with pointer receiver
+	msg, err := n.templates.render(to.Locale, name, &data)
+	if err != nil {
+		return fmt.Errorf("rendering %s: %v", name, err)
+	}
+	to.Channel = channel
+	msg.To = to
+	msg.Unsubscribe = data.Unsubscribe
+	if data.Calendar {
+		var manageURL string
+		if data.Token != "" {
+			manageURL = fmt.Sprintf("%s/api/reservation/manage/%d?token=%s", n.BaseURL, data.Reservation.ID,
+				url.QueryEscape(data.Token))
 		}
+		msg.Attachments = append(msg.Attachments,
+			calendarEvent(data.Reservation, n.BaseURL, manageURL, msg.Body, time.Now()))
 	}
 
-	return nil
+	return n.channels[channel].Send(*msg)
 }
 
-func (n *notificator) CollaborationNotify(cafe domain.Cafe) error {
-	m := gomail.NewMessage()
-	// Settings for SMTP server
-	d := gomail.NewDialer(n.Host, n.Port, n.From, n.Pass)
-	// This is only needed when SSL/TLS certificate is not valid on server.
-	// In production this should be set to false.
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-	// Set E-Mail sender
-	m.SetHeader("From", n.From)
-
-	// Set E-Mail receivers
-	m.SetHeader("To", n.From) // need to check if i can send email to myself
-	// Set E-Mail subject
-	m.SetHeader("Subject", "Partnership")
-	// Set E-Mail body.
-	m.SetBody("text/plain", fmt.Sprintf(
-		`You have new request for collaboration,
-					Name: %s
-					Email: %s
-					Date: %v
-					Time: %v`,
-		cafe.Name, cafe.Email, time.Now().Format(dateLayout), time.Now().Format(timeLayoutWithoutSeconds)))
-
-	log.Printf("Message: %v \n", m)
-	if err := d.DialAndSend(m); err != nil {
-		return errors.Wrap(err, "sending email")
+// sendTopic delivers a copy by every channel recipient is subscribed to the topic by, each copy links
+// to unsubscribing from the topic by its channel. It fails only when no copy got through,
+// as the outbox retries failed notification as a whole and would repeat the copies that did
+func (n *notificator) sendTopic(to Recipient, topic domain.NotifyTopic, name string, data messageData) error {
+	sub := domain.Subscriber{UserID: to.UserID, Email: to.Email, Preferred: n.preferred(to)}
+
+	var sent int
+	var failures []string
+	for _, channel := range domain.NotifyChannels {
+		if !n.reaches(to, channel) {
+			continue
+		}
+		subscribed, err := n.subscriptions.IsSubscribed(sub, topic, channel)
+		if err != nil {
+			return err
+		}
+		if !subscribed {
+			continue
+		}
+
+		token := n.subscriptions.UnsubscribeToken(sub, topic, channel)
+		data.Unsubscribe = n.BaseURL + "/api/unsubscribe?token=" + url.QueryEscape(token)
+		if err = n.deliver(to, channel, name, data); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", channel, err))
+			continue
+		}
+		sent++
 	}
 
+	if sent == 0 && len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
 	return nil
 }
 
-func (n *notificator) AdminResponseToPartnership(email string, decision bool) error {
-	m := gomail.NewMessage()
-	// Settings for SMTP server
-	d := gomail.NewDialer(n.Host, n.Port, n.From, n.Pass)
-	// This is only needed when SSL/TLS certificate is not valid on server.
-	// In production this should be set to false.
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-	// Set E-Mail sender
-	m.SetHeader("From", n.From)
-
-	// Set E-Mail receivers
-	m.SetHeader("To", email)
-	// Set E-Mail subject
-	m.SetHeader("Subject", "Collaboration")
-	// Set E-Mail body.
-
-	text := "congratulations, you are our partner now!"
-	if !decision {
-		text = "sorry, we are not ready to collaborate with you yet :("
+// sendEmail is for messages that are about the email address itself or go where we know nothing but email
+func (n *notificator) sendEmail(to Recipient, name string, data messageData) error {
+	to.Channel = domain.NotifyEmail
+	return n.send(to, name, data)
+}
+
+func reservationRecipient(data domain.Reservation) Recipient {
+	return guestRecipient(data.User, data.CustName, data.CustEmail, data.CustMobile)
+}
+
+// guestRecipient is who left contacts with reservation or waitlist entry. Without account (user is -1 or not set)
+// they get email in default locale, preferences and unsubscribe links go by email address only
+func guestRecipient(user domain.User, name, email, mobile string) Recipient {
+	to := Recipient{UserID: -1, Name: name, Email: email, Mobile: mobile, Channel: domain.NotifyEmail,
+		Locale: domain.DefaultLocale}
+	if user.ID > 0 {
+		to.UserID, to.Channel, to.Locale = user.ID, user.NotifyChannel, user.Locale
 	}
+	return to
+}
 
-	m.SetBody("text/plain", fmt.Sprintf(
-		`Hello, %s
+func userRecipient(user domain.User) Recipient {
+	return Recipient{UserID: user.ID, Name: user.Name, Email: user.Email, Mobile: user.Mobile,
+		Channel: user.NotifyChannel, Locale: user.Locale}
+}
 
-				Thank you and look forward to seeing you again!
-					
-				With gratitude,
-				Check, Please`,
-		text))
+// Reminder is sent by outbox worker at every offset the cafe set before the visit to those subscribed to reminders,
+// manageToken lets guest confirm that they are coming or cancel without logging in
+func (n *notificator) Reminder(data domain.Reservation, manageToken string) error {
+	return n.sendTopic(reservationRecipient(data), domain.TopicReminders, templateReminder, messageData{Name: data.CustName, Reservation: data,
+		Token: manageToken, Hours: data.MinutesUntilReservation / 60, Minutes: data.MinutesUntilReservation % 60,
+		AskToConfirm: data.Status == domain.StatusConfirmed && data.GuestConfirmedAt.IsZero()})
+}
 
-	log.Printf("Message: %v \n", m)
-	if err := d.DialAndSend(m); err != nil {
-		return errors.Wrap(err, "sending email")
-	}
+// BookingConfirmation is sent right after booking with calendar event attached to email,
+// manageToken lets guest cancel or reschedule reservation without logging in
+func (n *notificator) BookingConfirmation(data domain.Reservation, manageToken string) error {
+	return n.send(reservationRecipient(data), templateBookingConfirmation, messageData{Name: data.CustName,
+		Reservation: data, Token: manageToken, Calendar: true})
+}
 
-	return nil
+// CafeBookingConfirmation is BookingConfirmation of a table the cafe's staff booked for guest, e.g. over the phone
+func (n *notificator) CafeBookingConfirmation(data domain.Reservation, manageToken string) error {
+	return n.send(reservationRecipient(data), templateCafeBooking, messageData{Name: data.CustName,
+		Reservation: data, Token: manageToken, Calendar: true})
+}
+
+// BookingCancellation is sent when guest or the cafe cancels reservation,
+// its calendar event removes the one attached to the confirmation
+func (n *notificator) BookingCancellation(data domain.Reservation) error {
+	return n.send(reservationRecipient(data), templateBookingCancellation, messageData{Name: data.CustName,
+		Reservation: data, Calendar: true})
+}
+
+// WaitlistOffer is sent when a table within guest's time window gets free,
+// claimToken lets guest claim it without logging in until the offer expires
+func (n *notificator) WaitlistOffer(entry domain.WaitlistEntry, claimToken string) error {
+	to := guestRecipient(entry.User, entry.CustName, entry.CustEmail, entry.CustMobile)
+	return n.send(to, templateWaitlistOffer, messageData{Name: entry.CustName, Entry: entry, Token: claimToken})
+}
+
+// EmailVerification is sent after sign up and on user's request, the link is valid for two days
+func (n *notificator) EmailVerification(user domain.User, token string) error {
+	return n.sendEmail(userRecipient(user), templateEmailVerification, messageData{Name: user.Name, Token: token})
+}
+
+// PasswordReset sends one-time link to set a new password, the link is valid for an hour
+func (n *notificator) PasswordReset(user domain.User, token string) error {
+	return n.sendEmail(userRecipient(user), templatePasswordReset, messageData{Name: user.Name, Token: token})
+}
+
+// AccountLocked warns the owner that someone is guessing the password
+func (n *notificator) AccountLocked(user domain.User, until time.Time) error {
+	return n.send(userRecipient(user), templateAccountLocked, messageData{Name: user.Name, Until: until.UTC()})
+}
+
+func (n *notificator) CollaborationNotify(cafe domain.Cafe) error {
+	return n.sendEmail(Recipient{Email: n.Admin}, templateCollaboration, messageData{Cafe: cafe, Now: time.Now()})
+}
+
+// AdminResponseToPartnership is written in the default locale, partner's one is not known until they sign in
+func (n *notificator) AdminResponseToPartnership(email string, decision bool) error {
+	return n.sendEmail(Recipient{Email: email}, templatePartnership, messageData{Approved: decision})
+}
+
+// StaffInvite sends link to join the cafe's staff, the link is valid for a week.
+// Invited person may have no account yet, so the invite is written in the default locale
+func (n *notificator) StaffInvite(invite domain.StaffInvite, token string) error {
+	return n.sendEmail(Recipient{Email: invite.Email}, templateStaffInvite, messageData{Invite: invite, Token: token})
+}
+
+// UnsubscribeConfirmation is sent to the address somebody asked to unsubscribe from every topic on the site,
+// the link is valid for two days
+func (n *notificator) UnsubscribeConfirmation(email, token string) error {
+	return n.sendEmail(Recipient{Email: email}, templateUnsubscribe, messageData{Token: token})
 }
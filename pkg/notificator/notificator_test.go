@@ -0,0 +1,175 @@
+package notificator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+type fakeChannel struct {
+	sent []Message
+}
+
+func (f *fakeChannel) Send(msg Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestNotificatorRouting(t *testing.T) {
+	email, sms := &fakeChannel{}, &fakeChannel{}
+	n := &notificator{templates: loadTemplates(t), channels: map[domain.NotifyChannel]Channel{
+		domain.NotifyEmail: email,
+		domain.NotifySMS:   sms,
+	}}
+
+	reservation := domain.Reservation{CustEmail: "guest@mail.kz", CustMobile: "87011234567",
+		User: domain.User{ID: 5, NotifyChannel: domain.NotifySMS, Locale: "ru"}}
+	if err := n.BookingConfirmation(reservation, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sms.sent) != 1 || len(email.sent) != 0 {
+		t.Errorf("want confirmation sent by sms user prefers; got %d sms, %d emails", len(sms.sent), len(email.sent))
+	}
+
+	if sms.sent[0].To.UserID != 5 || sms.sent[0].To.Locale != "ru" {
+		t.Errorf("want user's account and locale; got %+v", sms.sent[0].To)
+	}
+
+	// guests book without account, they have no preference
+	reservation.User = domain.User{ID: -1, NotifyChannel: domain.NotifySMS, Locale: "ru"}
+	if err := n.BookingConfirmation(reservation, "token"); err != nil {
+		t.Fatal(err)
+	}
+	user := domain.User{Email: "user@mail.kz", NotifyChannel: domain.NotifyWebhook, Mobile: "87011234567"}
+	if err := n.AccountLocked(user, reservation.Date); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PasswordReset(domain.User{Email: "user@mail.kz", NotifyChannel: domain.NotifySMS}, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if to := email.sent[0].To; to.UserID != -1 || to.Locale != domain.DefaultLocale {
+		t.Errorf("want guest without account in default locale; got %+v", to)
+	}
+	if len(email.sent) != 3 || len(sms.sent) != 1 {
+		t.Errorf("want guest, unconfigured webhook and password reset to fall back to email; got %d emails, %d sms",
+			len(email.sent), len(sms.sent))
+	}
+}
+
+func TestNotificatorWaitlistOfferRecipient(t *testing.T) {
+	email := &fakeChannel{}
+	n := &notificator{templates: loadTemplates(t), channels: map[domain.NotifyChannel]Channel{domain.NotifyEmail: email}}
+
+	entries := []domain.WaitlistEntry{
+		{CustEmail: "user@mail.kz", User: domain.User{ID: 5, Locale: "kk"}},
+		{CustEmail: "guest@mail.kz", User: domain.User{ID: -1, Locale: "kk"}},
+	}
+	for _, entry := range entries {
+		if err := n.WaitlistOffer(entry, "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(email.sent) != 2 {
+		t.Fatalf("want 2 offers; got %d", len(email.sent))
+	}
+	if to := email.sent[0].To; to.UserID != 5 || to.Locale != "kk" {
+		t.Errorf("want offer to user's account in their locale; got %+v", to)
+	}
+	if to := email.sent[1].To; to.UserID != -1 || to.Locale != domain.DefaultLocale {
+		t.Errorf("want offer to guest without account; got %+v", to)
+	}
+}
+
+func TestNotificatorCalendar(t *testing.T) {
+	email := &fakeChannel{}
+	n := &notificator{templates: loadTemplates(t), channels: map[domain.NotifyChannel]Channel{domain.NotifyEmail: email},
+		BaseURL: "https://checkplease.kz"}
+
+	reservation := domain.Reservation{ID: 7, CustEmail: "guest@mail.kz"}
+	if err := n.CafeBookingConfirmation(reservation, "to+ken"); err != nil {
+		t.Fatal(err)
+	}
+	reservation.Status = domain.StatusCancelled
+	if err := n.BookingCancellation(reservation); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PasswordReset(domain.User{Email: "guest@mail.kz"}, "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(email.sent) != 3 {
+		t.Fatalf("want 3 emails; got %d", len(email.sent))
+	}
+	booked, cancelled, reset := email.sent[0], email.sent[1], email.sent[2]
+	manageURL := "URL:https://checkplease.kz/api/reservation/manage/7?token=to%2Bken"
+	if len(booked.Attachments) != 1 || !strings.Contains(string(booked.Attachments[0].Content), manageURL) {
+		t.Errorf("want booking to carry event with manage link; got %v", booked.Attachments)
+	}
+	if len(cancelled.Attachments) != 1 || !strings.Contains(string(cancelled.Attachments[0].Content), "METHOD:CANCEL") {
+		t.Errorf("want cancellation to carry cancelled event; got %v", cancelled.Attachments)
+	}
+	if len(reset.Attachments) != 0 {
+		t.Errorf("want no event in messages not about reservation; got %v", reset.Attachments)
+	}
+}
+
+// fakeSubscriptions keeps topics and channels subscribers turned off, keyed by email
+type fakeSubscriptions struct {
+	off map[string]map[domain.NotifyChannel]bool
+}
+
+func (f *fakeSubscriptions) IsSubscribed(sub domain.Subscriber, topic domain.NotifyTopic, channel domain.NotifyChannel) (bool, error) {
+	if off, ok := f.off[sub.Email]; ok {
+		return !off[channel], nil
+	}
+	return channel == sub.Preferred, nil
+}
+
+func (f *fakeSubscriptions) UnsubscribeToken(sub domain.Subscriber, topic domain.NotifyTopic, channel domain.NotifyChannel) string {
+	return string(topic) + "+" + string(channel)
+}
+
+func TestNotificatorTopics(t *testing.T) {
+	email, sms := &fakeChannel{}, &fakeChannel{}
+	n := &notificator{templates: loadTemplates(t), BaseURL: "https://checkplease.kz",
+		channels: map[domain.NotifyChannel]Channel{domain.NotifyEmail: email, domain.NotifySMS: sms},
+		subscriptions: &fakeSubscriptions{off: map[string]map[domain.NotifyChannel]bool{
+			"both@mail.kz": {domain.NotifyWebhook: true},
+			"none@mail.kz": {domain.NotifyEmail: true, domain.NotifySMS: true, domain.NotifyWebhook: true},
+		}}}
+
+	reservation := domain.Reservation{CustEmail: "guest@mail.kz", CustMobile: "87011234567",
+		User: domain.User{ID: -1}, Status: domain.StatusConfirmed}
+	if err := n.Reminder(reservation, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if len(email.sent) != 1 || len(sms.sent) != 0 {
+		t.Fatalf("want reminder by the preferred channel only; got %d emails, %d sms", len(email.sent), len(sms.sent))
+	}
+	if got := email.sent[0].Unsubscribe; got != "https://checkplease.kz/api/unsubscribe?token=reminders%2Bemail" {
+		t.Errorf("want link to unsubscribe from reminders by email; got %q", got)
+	}
+
+	reservation.CustEmail = "both@mail.kz"
+	if err := n.Reminder(reservation, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if len(email.sent) != 2 || len(sms.sent) != 1 || sms.sent[0].Unsubscribe == email.sent[1].Unsubscribe {
+		t.Errorf("want a copy with its own unsubscribe link by every subscribed channel; got %d emails, %d sms",
+			len(email.sent), len(sms.sent))
+	}
+
+	reservation.CustEmail = "none@mail.kz"
+	if err := n.Reminder(reservation, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.BookingConfirmation(reservation, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if len(email.sent) != 3 || len(sms.sent) != 1 || email.sent[2].Unsubscribe != "" {
+		t.Errorf("want unsubscribed to get booking confirmation without unsubscribe link but no reminder; got %d emails, %d sms",
+			len(email.sent), len(sms.sent))
+	}
+}
@@ -0,0 +1,45 @@
+package notificator
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// sms posts messages to HTTP gateway as {"from", "to", "text"} json authorized by bearer token,
+// most gateways accept it as is or behind a thin adapter
+type sms struct {
+	url    string
+	token  string
+	sender string
+	client *http.Client
+}
+
+func NewSMS(url, token, sender string) *sms {
+	return &sms{url: url, token: token, sender: sender, client: &http.Client{Timeout: httpTimeout}}
+}
+
+type smsPayload struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+// Send leaves subject out, the body is meant to be read on its own
+func (s *sms) Send(msg Message) error {
+	if msg.To.Mobile == "" {
+		return ErrNoAddress
+	}
+
+	body, err := json.Marshal(smsPayload{From: s.sender, To: msg.To.Mobile, Text: msg.Body})
+	if err != nil {
+		return errors.Wrap(err, "marshalling sms")
+	}
+
+	if err = postJSON(s.client, s.url, body, map[string]string{"Authorization": "Bearer " + s.token}); err != nil {
+		return errors.Wrap(err, "sending sms")
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package notificator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSMSSend(t *testing.T) {
+	var got smsPayload
+	var auth string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got.To == "87000000000" {
+			http.Error(w, "unknown number", http.StatusUnprocessableEntity)
+		}
+	}))
+	defer gateway.Close()
+
+	s := NewSMS(gateway.URL, "token", "CheckPlease")
+
+	if err := s.Send(Message{To: Recipient{Email: "guest@mail.kz"}}); err != ErrNoAddress {
+		t.Errorf("want recipient without mobile to be rejected; got %v", err)
+	}
+
+	if err := s.Send(Message{To: Recipient{Mobile: "87011234567"}, Subject: "Reservation", Body: "See you at 19:00"}); err != nil {
+		t.Fatal(err)
+	}
+	want := smsPayload{From: "CheckPlease", To: "87011234567", Text: "See you at 19:00"}
+	if got != want || auth != "Bearer token" {
+		t.Errorf("want %+v authorized by token; got %+v, %q", want, got, auth)
+	}
+
+	if err := s.Send(Message{To: Recipient{Mobile: "87000000000"}, Body: "See you"}); err == nil {
+		t.Error("want gateway's refusal to be an error")
+	}
+}
@@ -0,0 +1,129 @@
+package notificator
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+// names of notifications, every locale has "<name>.page.txt" with subject and text part
+// and "<name>.page.html" with html part
+const (
+	templateReminder            = "reminder"
+	templateBookingConfirmation = "booking_confirmation"
+	templateCafeBooking         = "cafe_booking_confirmation"
+	templateBookingCancellation = "booking_cancellation"
+	templateWaitlistOffer       = "waitlist_offer"
+	templateEmailVerification   = "email_verification"
+	templatePasswordReset       = "password_reset"
+	templateAccountLocked       = "account_locked"
+	templateCollaboration       = "collaboration_request"
+	templatePartnership         = "partnership_response"
+	templateStaffInvite         = "staff_invite"
+	templateUnsubscribe         = "unsubscribe_confirmation"
+)
+
+var templateNames = []string{templateReminder, templateBookingConfirmation, templateCafeBooking,
+	templateBookingCancellation, templateWaitlistOffer,
+	templateEmailVerification, templatePasswordReset, templateAccountLocked, templateCollaboration,
+	templatePartnership, templateStaffInvite, templateUnsubscribe}
+
+func date(t time.Time) string {
+	return t.Format("02.01.2006")
+}
+
+func clock(t time.Time) string {
+	return t.Format("15:04")
+}
+
+var (
+	textFunctions = texttemplate.FuncMap{"date": date, "clock": clock}
+	htmlFunctions = htmltemplate.FuncMap{"date": date, "clock": clock}
+)
+
+// Templates keeps every notification in every locale
+type Templates struct {
+	text map[domain.Locale]map[string]*texttemplate.Template
+	html map[domain.Locale]map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parses templates of every locale from its own directory, "*.partial.txt" and
+// "*.layout.html" of the locale are shared by its pages. It fails when a locale misses a notification
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{
+		text: map[domain.Locale]map[string]*texttemplate.Template{},
+		html: map[domain.Locale]map[string]*htmltemplate.Template{},
+	}
+
+	for _, locale := range domain.Locales {
+		localeDir := filepath.Join(dir, string(locale))
+		t.text[locale] = map[string]*texttemplate.Template{}
+		t.html[locale] = map[string]*htmltemplate.Template{}
+
+		for _, name := range templateNames {
+			page := filepath.Join(localeDir, name+".page.txt")
+			text, err := texttemplate.New(filepath.Base(page)).Funcs(textFunctions).ParseFiles(page)
+			if err != nil {
+				return nil, err
+			}
+			if text, err = text.ParseGlob(filepath.Join(localeDir, "*.partial.txt")); err != nil {
+				return nil, err
+			}
+			if text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("notificator: %s has no subject", page)
+			}
+			t.text[locale][name] = text
+
+			page = filepath.Join(localeDir, name+".page.html")
+			html, err := htmltemplate.New(filepath.Base(page)).Funcs(htmlFunctions).ParseFiles(page)
+			if err != nil {
+				return nil, err
+			}
+			if html, err = html.ParseGlob(filepath.Join(localeDir, "*.layout.html")); err != nil {
+				return nil, err
+			}
+			t.html[locale][name] = html
+		}
+	}
+
+	return t, nil
+}
+
+// render writes notification in recipient's locale, unknown locale gets the default one
+func (t *Templates) render(locale domain.Locale, name string, data interface{}) (*Message, error) {
+	if !locale.IsValid() {
+		locale = domain.DefaultLocale
+	}
+
+	text, ok := t.text[locale][name]
+	if !ok {
+		return nil, fmt.Errorf("notificator: unknown notification %q", name)
+	}
+
+	msg := &Message{}
+	subject := new(bytes.Buffer)
+	if err := text.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+	msg.Subject = strings.TrimSpace(subject.String())
+
+	body := new(bytes.Buffer)
+	if err := text.Execute(body, data); err != nil {
+		return nil, err
+	}
+	msg.Body = strings.TrimSpace(body.String())
+
+	body.Reset()
+	if err := t.html[locale][name].Execute(body, data); err != nil {
+		return nil, err
+	}
+	msg.HTML = strings.TrimSpace(body.String())
+
+	return msg, nil
+}
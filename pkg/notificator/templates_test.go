@@ -0,0 +1,100 @@
+package notificator
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CyganFx/table-reservation/internal/domain"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with rendered notifications")
+
+func loadTemplates(t *testing.T) *Templates {
+	t.Helper()
+	templates, err := LoadTemplates("../../ui/notifications")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+// sampleData fills everything templates refer to, so that golden files show every part of a notification.
+// It is a pointer the way notificator renders it
+func sampleData() *messageData {
+	visit := time.Date(2021, 6, 4, 19, 30, 0, 0, time.UTC)
+	cafe := domain.Cafe{ID: 2, Name: "Del Papa", Email: "delpapa@mail.kz"}
+
+	return &messageData{
+		BaseURL: "https://checkplease.kz",
+		Name:    "Aigerim",
+		Token:   "token",
+		Reservation: domain.Reservation{ID: 7, Date: visit, PartySize: 4, Cafe: cafe,
+			Table: domain.Table{ID: 3, Location: domain.Location{Name: "Terrace"}}, JoinedTables: []domain.Table{{ID: 4}}},
+		Entry: domain.WaitlistEntry{ID: 3, PartySize: 2, Cafe: cafe, Reservation: domain.Reservation{Date: visit},
+			OfferExpiresAt: visit.Add(-time.Hour)},
+		Cafe:         cafe,
+		Invite:       domain.StaffInvite{Cafe: cafe, Role: domain.StaffManager},
+		Hours:        1,
+		Minutes:      30,
+		AskToConfirm: true,
+		Approved:     true,
+		Until:        visit.Add(-3 * time.Hour),
+		Now:          visit.Add(-24 * time.Hour),
+		Unsubscribe:  "https://checkplease.kz/api/unsubscribe?token=unsubscribe-token",
+	}
+}
+
+func TestTemplatesGolden(t *testing.T) {
+	templates := loadTemplates(t)
+
+	for _, locale := range domain.Locales {
+		for _, name := range templateNames {
+			msg, err := templates.render(locale, name, sampleData())
+			if err != nil {
+				t.Fatalf("%s/%s: %v", locale, name, err)
+			}
+			got := []byte("Subject: " + msg.Subject + "\n\n" + msg.Body + "\n\n" + msg.HTML + "\n")
+
+			golden := filepath.Join("testdata", string(locale), name+".golden")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("%s/%s differs from golden file, run go test with -update if the change is intended:\n%s",
+					locale, name, got)
+			}
+		}
+	}
+}
+
+func TestTemplatesFallBackToDefaultLocale(t *testing.T) {
+	templates := loadTemplates(t)
+
+	got, err := templates.render("de", templateReminder, sampleData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := templates.render(domain.DefaultLocale, templateReminder, sampleData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want unknown locale to get %s notification; got %q", domain.DefaultLocale, got.Subject)
+	}
+}
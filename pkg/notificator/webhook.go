@@ -0,0 +1,64 @@
+package notificator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader carries hex encoded HMAC-SHA256 of request body keyed by webhook secret,
+// receivers check it to make sure the message comes from us
+const SignatureHeader = "X-Signature"
+
+// webhook posts messages to an outgoing webhook, e.g. messenger bot that finds recipient by mobile number
+type webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhook(url, secret string) *webhook {
+	return &webhook{url: url, secret: []byte(secret), client: &http.Client{Timeout: httpTimeout}}
+}
+
+type webhookPayload struct {
+	To struct {
+		Name   string `json:"name"`
+		Email  string `json:"email"`
+		Mobile string `json:"mobile"`
+	} `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+func (w *webhook) Send(msg Message) error {
+	if msg.To.Mobile == "" {
+		return ErrNoAddress
+	}
+
+	payload := webhookPayload{Subject: msg.Subject, Text: msg.Body}
+	payload.To.Name = msg.To.Name
+	payload.To.Email = msg.To.Email
+	payload.To.Mobile = msg.To.Mobile
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshalling webhook payload")
+	}
+
+	if err = postJSON(w.client, w.url, body, map[string]string{SignatureHeader: w.Sign(body)}); err != nil {
+		return errors.Wrap(err, "calling webhook")
+	}
+
+	return nil
+}
+
+func (w *webhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
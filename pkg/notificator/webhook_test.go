@@ -0,0 +1,42 @@
+package notificator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSend(t *testing.T) {
+	w := NewWebhook("", "secret")
+
+	var got webhookPayload
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != w.Sign(body) {
+			http.Error(rw, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &got)
+	}))
+	defer receiver.Close()
+	w.url = receiver.URL
+
+	if err := w.Send(Message{To: Recipient{Email: "guest@mail.kz"}}); err != ErrNoAddress {
+		t.Errorf("want recipient without mobile to be rejected; got %v", err)
+	}
+
+	to := Recipient{Name: "Aigerim", Email: "guest@mail.kz", Mobile: "87011234567"}
+	if err := w.Send(Message{To: to, Subject: "Reservation", Body: "See you at 19:00"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.To.Mobile != to.Mobile || got.To.Name != to.Name || got.Subject != "Reservation" || got.Text != "See you at 19:00" {
+		t.Errorf("want the message delivered; got %+v", got)
+	}
+
+	forged := NewWebhook(receiver.URL, "guess")
+	if err := forged.Send(Message{To: to, Body: "See you"}); err == nil {
+		t.Error("want message signed by another secret to be refused")
+	}
+}
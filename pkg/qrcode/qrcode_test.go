@@ -0,0 +1,284 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as 1-M symbol, the example from thonky.com QR code tutorial
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("want %v; got %v", want, got)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	// level M rows of format information table in ISO/IEC 18004 annex C
+	formats := []int{
+		0x5412, // 101010000010010
+		0x5125, // 101000100100101
+		0x5E7C, // 101111001111100
+		0x5B4B, // 101101101001011
+		0x45F9, // 100010111111001
+		0x40CE, // 100000011001110
+		0x4F97, // 100111110010111
+		0x4AA0, // 100101010100000
+	}
+	for mask, want := range formats {
+		if got := formatBits(mask); got != want {
+			t.Errorf("mask %d: want %015b; got %015b", mask, want, got)
+		}
+	}
+
+	versionsInfo := map[int]int{
+		7:  0x07C94, // 000111110010010100
+		10: 0x0A4D3, // 001010010011010011
+	}
+	for version, want := range versionsInfo {
+		if got := versionBits(version); got != want {
+			t.Errorf("version %d: want %018b; got %018b", version, want, got)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		version int
+	}{
+		{"version 1", "hello", 1},
+		{"full version 1", strings.Repeat("a", 14), 1},
+		{"version 2", strings.Repeat("a", 15), 2},
+		{"two groups", strings.Repeat("b", 150), 8},
+		{"otpauth link", "otpauth://totp/Check%2C%20Please:guest@example.com?issuer=Check%2C+Please&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 7},
+		{"largest", strings.Repeat("c", 213), 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Encode([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 17 + 4*tt.version; c.Size() != want {
+				t.Fatalf("want size %d; got %d", want, c.Size())
+			}
+			assertFinders(t, c)
+
+			if got := decode(t, c, tt.version); got != tt.data {
+				t.Errorf("want %q decoded back; got %q", tt.data, got)
+			}
+		})
+	}
+
+	if _, err := Encode(make([]byte, 214)); err != ErrTooLong {
+		t.Errorf("want %v; got %v", ErrTooLong, err)
+	}
+}
+
+// TestKnownSymbols compares symbols with ones drawn by another encoder (rsc.io/qr) for the same version and mask,
+// testdata has one row of modules per line, "#" is dark
+func TestKnownSymbols(t *testing.T) {
+	tests := []struct {
+		fixture string
+		data    string
+		version int
+		mask    int
+	}{
+		{"hello-mask0", "hello", 1, 0},
+		{"hello-mask1", "hello", 1, 1},
+		{"hello-mask2", "hello", 1, 2},
+		{"hello-mask3", "hello", 1, 3},
+		{"hello-mask4", "hello", 1, 4},
+		{"hello-mask5", "hello", 1, 5},
+		{"hello-mask6", "hello", 1, 6},
+		{"hello-mask7", "hello", 1, 7},
+		{"full-version-1-mask3", strings.Repeat("a", 14), 1, 3},
+		{"version-2-mask5", strings.Repeat("a", 15), 2, 5},
+		{"two-groups-mask6", strings.Repeat("b", 150), 8, 6},
+		{"otpauth-link-mask2", "otpauth://totp/Check%2C%20Please:guest@example.com?issuer=Check%2C+Please&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 7, 2},
+		{"largest-mask7", strings.Repeat("c", 213), 10, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			want, err := ioutil.ReadFile(filepath.Join("testdata", tt.fixture+".txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			size := 17 + 4*tt.version
+			c := &Code{size: size, modules: grid(size), function: grid(size)}
+			c.drawFunctionPatterns(tt.version)
+			c.drawCodewords(interleave(tt.version, encodeData(tt.version, []byte(tt.data))))
+			c.applyMask(tt.mask)
+			c.drawFormat(tt.mask)
+
+			var got strings.Builder
+			for y := 0; y < c.Size(); y++ {
+				for x := 0; x < c.Size(); x++ {
+					got.WriteByte(".#"[bit(c.Dark(x, y))])
+				}
+				got.WriteByte('\n')
+			}
+			if got.String() != string(want) {
+				t.Errorf("symbol differs from %s:\n%s", tt.fixture, got.String())
+			}
+		})
+	}
+}
+
+func TestPNG(t *testing.T) {
+	c, _ := Encode([]byte("hello"))
+	b, err := c.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if side := (21 + 2*quietZone) * 4; img.Bounds().Dx() != side || img.Bounds().Dy() != side {
+		t.Errorf("want %dx%d image; got %v", side, side, img.Bounds())
+	}
+}
+
+func assertFinders(t *testing.T, c *Code) {
+	t.Helper()
+
+	for _, corner := range [][2]int{{0, 0}, {c.size - 7, 0}, {0, c.size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if want := ring != 2; c.Dark(corner[0]+dx, corner[1]+dy) != want {
+					t.Fatalf("finder pattern at %v is broken at %d,%d", corner, dx, dy)
+				}
+			}
+		}
+	}
+}
+
+// decode reads the symbol back: finds the mask in format information,
+// collects codewords, checks error correction of every block and returns data
+func decode(t *testing.T, c *Code, version int) string {
+	t.Helper()
+
+	var format int
+	for i := 14; i >= 9; i-- {
+		format = format<<1 | bit(c.Dark(14-i, 8))
+	}
+	format = format<<1 | bit(c.Dark(7, 8))
+	format = format<<1 | bit(c.Dark(8, 8))
+	format = format<<1 | bit(c.Dark(8, 7))
+	for i := 5; i >= 0; i-- {
+		format = format<<1 | bit(c.Dark(8, i))
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatBits(m) == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("unknown format information %015b", format)
+	}
+
+	c.applyMask(mask)
+	defer c.applyMask(mask)
+
+	var raw []byte
+	var current, n int
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = c.size - 1 - vert
+			}
+			for x := right; x > right-2; x-- {
+				if c.function[y][x] {
+					continue
+				}
+				current = current<<1 | bit(c.Dark(x, y))
+				if n++; n%8 == 0 {
+					raw = append(raw, byte(current))
+					current = 0
+				}
+			}
+		}
+	}
+
+	v := versions[version-1]
+	var blocks [][]byte
+	for _, g := range v.groups {
+		for i := 0; i < g[0]; i++ {
+			blocks = append(blocks, make([]byte, 0, g[1]+v.ecPerBlock))
+		}
+	}
+	for i := 0; ; i++ {
+		added := false
+		for b := range blocks {
+			if i < cap(blocks[b])-v.ecPerBlock {
+				blocks[b] = append(blocks[b], raw[0])
+				raw = raw[1:]
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	var data []byte
+	for b := range blocks {
+		data = append(data, blocks[b]...)
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], raw[0])
+			raw = raw[1:]
+		}
+	}
+	for b, block := range blocks {
+		dataLen := len(block) - v.ecPerBlock
+		if ec := rsRemainder(block[:dataLen], rsDivisor(v.ecPerBlock)); !bytes.Equal(ec, block[dataLen:]) {
+			t.Fatalf("error correction of block %d does not match", b)
+		}
+	}
+
+	if mode := data[0] >> 4; mode != 0x4 {
+		t.Fatalf("want byte mode; got %x", mode)
+	}
+	if version < 10 {
+		length := int(data[0]&0x0f)<<4 | int(data[1]>>4)
+		return shifted(data[1:], length)
+	}
+	length := int(data[0]&0x0f)<<12 | int(data[1])<<4 | int(data[2]>>4)
+	return shifted(data[2:], length)
+}
+
+// shifted returns length bytes starting at the lower half of data[0]
+func shifted(data []byte, length int) string {
+	out := make([]byte, length)
+	for i := range out {
+		out[i] = data[i]<<4 | data[i+1]>>4
+	}
+	return string(out)
+}
+
+func bit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("signer: invalid token")
+	ErrExpiredToken = errors.New("signer: expired token")
+)
+
+// signer issues tamper-proof tokens for links that are sent to users,
+// e.g. links to manage reservation without logging in
+type signer struct {
+	secret []byte
+}
+
+func New(secret string) *signer {
+	return &signer{secret: []byte(secret)}
+}
+
+// Sign returns url safe token that carries value until expires
+func (s *signer) Sign(value string, expires time.Time) string {
+	payload := value + "|" + strconv.FormatInt(expires.Unix(), 10)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify checks token signature and expiration and returns signed value
+func (s *signer) Verify(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if !hmac.Equal(signature, s.mac(string(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	sep := strings.LastIndex(string(payload), "|")
+	if sep == -1 {
+		return "", ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(string(payload[sep+1:]), 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if now.Unix() > expires {
+		return "", ErrExpiredToken
+	}
+
+	return string(payload[:sep]), nil
+}
+
+func (s *signer) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
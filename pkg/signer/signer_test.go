@@ -0,0 +1,39 @@
+package signer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	s := New("secret")
+	now := time.Date(2021, 5, 20, 12, 0, 0, 0, time.UTC)
+	token := s.Sign("reservation:42", now.Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		signer  *signer
+		token   string
+		now     time.Time
+		want    string
+		wantErr error
+	}{
+		{"valid", s, token, now, "reservation:42", nil},
+		{"expired", s, token, now.Add(2 * time.Hour), "", ErrExpiredToken},
+		{"other secret", New("other"), token, now, "", ErrInvalidToken},
+		{"tampered", s, "x" + token, now, "", ErrInvalidToken},
+		{"malformed", s, "token", now, "", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.signer.Verify(tt.token, tt.now)
+			if err != tt.wantErr {
+				t.Fatalf("want error %v; got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
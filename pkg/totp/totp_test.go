@@ -0,0 +1,94 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is base32 of "12345678901234567890", the SHA1 key from RFC 6238 appendix B
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC vectors are 8 digits long, 6 digit codes are their last digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d want %s; got %s", tt.unix, tt.want, got)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err != ErrInvalidSecret {
+		t.Errorf("want %v; got %v", ErrInvalidSecret, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := Code(rfcSecret, Step(now))
+	previous, _ := Code(rfcSecret, Step(now)-1)
+	stale, _ := Code(rfcSecret, Step(now)-2)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current", code, Step(now), true},
+		{"with spaces", " " + code[:3] + " " + code[3:], Step(now), true},
+		{"previous step", previous, Step(now) - 1, true},
+		{"too old", stale, 0, false},
+		{"wrong length", code[:5], 0, false},
+		{"empty", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("want %d, %v; got %d, %v", tt.wantStep, tt.wantOK, step, ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Error("want secrets to be random")
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("want generated secret to be usable; got %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Check, Please", "guest@example.com", rfcSecret)
+
+	if !strings.HasPrefix(got, "otpauth://totp/Check%2C%20Please:guest@example.com?") {
+		t.Errorf("unexpected label in %s", got)
+	}
+	if !strings.Contains(got, "secret="+rfcSecret) || !strings.Contains(got, "issuer=Check%2C+Please") {
+		t.Errorf("unexpected query in %s", got)
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
 
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+var ClockRX = regexp.MustCompile("^([01][0-9]|2[0-3]):[0-5][0-9]$")
+
 type FormValidator struct {
 	url.Values
 	Errors errors
@@ -74,6 +77,21 @@ func (f *FormValidator) PermittedValues(field string, opts ...string) {
 	f.Errors.Add(field, "This field is invalid")
 }
 
+func (f *FormValidator) IntRange(field string, min, max int) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		f.Errors.Add(field, "This field must be a number")
+		return
+	}
+	if n < min || n > max {
+		f.Errors.Add(field, fmt.Sprintf("This field must be between %d and %d", min, max))
+	}
+}
+
 func (f *FormValidator) Valid() bool {
 	return len(f.Errors) == 0
 }
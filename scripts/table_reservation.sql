@@ -146,8 +146,9 @@ create table reservations
     event_id          int          not null default 1,
     event_description text,
     num_of_persons    int          not null,
-    date              timestamp    not null,
-    notify_date       timestamp    not null,
+    -- dates are instants, cafes book and show them in their city's time zone
+    date              timestamptz  not null,
+    notify_date       timestamptz  not null,
     CONSTRAINT reservations_fk_cafe_id_table_id
         FOREIGN KEY (cafe_id, table_id)
             REFERENCES tables (cafe_id, id),
@@ -191,8 +192,9 @@ values ('cafe'),
 
 create table cities
 (
-    id   serial       not null primary key,
-    name varchar(255) not null
+    id        serial       not null primary key,
+    name      varchar(255) not null,
+    time_zone varchar(64)  not null default 'Asia/Almaty'
 );
 
 insert into cities(name)
@@ -226,3 +228,423 @@ create table blacklist
     CONSTRAINT blacklist_fk_cafe_id foreign key (cafe_id) references cafes (id),
     CONSTRAINT blacklist_ck unique (user_id, cafe_id)
 );
+
+
+create table cafe_policies
+(
+    cafe_id              int not null primary key,
+    reservation_interval int not null default 90,
+    max_days_in_advance  int not null default 7,
+    max_party_size       int not null default 8,
+    constraint cafe_policies_fk_cafe_id foreign key (cafe_id) references cafes (id)
+);
+
+-- opening hours are minutes since midnight, closes_at <= opens_at means closing after midnight
+-- weekdays without a row are days off
+create table cafe_opening_hours
+(
+    cafe_id   int not null,
+    weekday   int not null check (weekday between 0 and 6),
+    opens_at  int not null check (opens_at between 0 and 1439),
+    closes_at int not null check (closes_at between 0 and 1439),
+    constraint cafe_opening_hours_fk_cafe_id foreign key (cafe_id) references cafes (id),
+    constraint ck_cafe_id_weekday primary key (cafe_id, weekday)
+);
+
+-- cancelled reservations are kept for history
+alter table reservations
+    add column status varchar(20) not null default 'confirmed'
+        constraint reservations_ck_status check (status in ('confirmed', 'cancelled'));
+
+alter table reservations
+    add column cancelled_at timestamp;
+
+-- reservation lifecycle, transitions are validated by the service layer
+alter table reservations
+    drop constraint reservations_ck_status;
+alter table reservations
+    add constraint reservations_ck_status
+        check (status in ('pending', 'confirmed', 'seated', 'completed', 'cancelled', 'no_show'));
+
+create table reservation_status_history
+(
+    id             serial      not null primary key,
+    reservation_id int         not null,
+    from_status    varchar(20) not null,
+    to_status      varchar(20) not null,
+    changed_by     int,
+    changed_at     timestamp   not null default now(),
+    constraint reservation_status_history_fk_reservation_id
+        foreign key (reservation_id) references reservations (id),
+    constraint reservation_status_history_fk_changed_by
+        foreign key (changed_by) references users (id)
+);
+
+create index reservation_status_history_reservation_id_idx
+    on reservation_status_history (reservation_id);
+
+-- tables that can be put together for large parties, every pair is stored once
+create table table_joins
+(
+    cafe_id         int not null,
+    table_id        int not null,
+    joined_table_id int not null,
+    constraint table_joins_fk_table
+        foreign key (cafe_id, table_id) references tables (cafe_id, id),
+    constraint table_joins_fk_joined_table
+        foreign key (cafe_id, joined_table_id) references tables (cafe_id, id),
+    constraint table_joins_ck_order check (table_id < joined_table_id),
+    constraint ck_cafe_id_table_id_joined_table_id primary key (cafe_id, table_id, joined_table_id)
+);
+
+-- tables held while guest fills in the confirmation form, held tables are stored in reservation_tables,
+-- so that the same exclusion constraint keeps holds and reservations apart
+create table table_holds
+(
+    id         serial      not null primary key,
+    cafe_id    int         not null,
+    period     tstzrange   not null,
+    expires_at timestamptz not null,
+    constraint table_holds_fk_cafe_id foreign key (cafe_id) references cafes (id)
+);
+
+create index table_holds_expires_at_idx
+    on table_holds (expires_at);
+
+-- every table occupied by a reservation for a period, reservations.table_id is the first of them.
+-- Periods of active reservations of the same table must not overlap, checking it here keeps
+-- combined and single tables from taking the same table twice
+create extension if not exists btree_gist;
+
+create table reservation_tables
+(
+    reservation_id int,
+    hold_id        int,
+    cafe_id        int       not null,
+    table_id       int       not null,
+    period         tstzrange not null,
+    active         bool      not null default true,
+    constraint reservation_tables_fk_reservation_id
+        foreign key (reservation_id) references reservations (id),
+    constraint reservation_tables_fk_hold_id
+        foreign key (hold_id) references table_holds (id) on delete cascade,
+    constraint reservation_tables_fk_table
+        foreign key (cafe_id, table_id) references tables (cafe_id, id),
+    -- tables are taken either by reservation or by hold
+    constraint reservation_tables_ck_owner check ((reservation_id is null) <> (hold_id is null)),
+    constraint reservation_tables_uq_reservation_id_table_id unique (reservation_id, table_id),
+    constraint reservation_tables_uq_hold_id_table_id unique (hold_id, table_id),
+    constraint reservation_tables_no_overlap
+        exclude using gist (cafe_id with =, table_id with =, period with &&) where (active)
+);
+
+-- guests waiting for a table, an offer is a pending reservation the guest has to claim before offer_expires_at
+create table waitlist
+(
+    id               serial       not null primary key,
+    cafe_id          int          not null,
+    location_id      int          not null,
+    user_id          int,
+    party_size       int          not null,
+    cust_name        varchar(255) not null,
+    cust_mobile      varchar(255) not null,
+    cust_email       varchar(255) not null,
+    window_start     timestamptz  not null,
+    window_end       timestamptz  not null,
+    status           varchar(20)  not null default 'waiting'
+        constraint waitlist_ck_status check (status in ('waiting', 'offered', 'claimed', 'expired', 'cancelled')),
+    reservation_id   int,
+    offer_expires_at timestamptz,
+    created          timestamptz  not null default now(),
+    constraint waitlist_fk_cafe_id foreign key (cafe_id) references cafes (id),
+    constraint waitlist_fk_location_id foreign key (location_id) references locations (id),
+    constraint waitlist_fk_user_id foreign key (user_id) references users (id),
+    constraint waitlist_fk_reservation_id foreign key (reservation_id) references reservations (id),
+    constraint waitlist_ck_window check (window_start <= window_end)
+);
+
+create index waitlist_cafe_id_status_idx
+    on waitlist (cafe_id, status);
+
+-- refresh tokens of api clients, only sha-256 of the token is stored
+create table refresh_tokens
+(
+    id         serial      not null primary key,
+    user_id    int         not null,
+    token_hash bytea       not null
+        constraint refresh_tokens_uq_token_hash unique,
+    expires_at timestamptz not null,
+    revoked_at timestamptz,
+    created    timestamptz not null default now(),
+    constraint refresh_tokens_fk_user_id foreign key (user_id) references users (id) on delete cascade
+);
+
+create index refresh_tokens_user_id_idx
+    on refresh_tokens (user_id);
+
+alter table users
+    add column sessions_revoked_at timestamptz;
+
+-- one-time password reset links, only sha-256 of the token is stored
+create table password_resets
+(
+    id         serial      not null primary key,
+    user_id    int         not null,
+    token_hash bytea       not null
+        constraint password_resets_uq_token_hash unique,
+    expires_at timestamptz not null,
+    used_at    timestamptz,
+    created    timestamptz not null default now(),
+    constraint password_resets_fk_user_id foreign key (user_id) references users (id) on delete cascade
+);
+
+-- accounts created before verification was introduced are trusted
+alter table users
+    add column email_verified_at timestamptz;
+
+update users
+set email_verified_at = created;
+
+alter table users
+    add column totp_secret     varchar(64),
+    add column totp_enabled_at timestamptz,
+    add column totp_last_step  bigint;
+
+-- one-time codes to log in without authenticator app, only sha-256 is stored
+create table recovery_codes
+(
+    id        serial      not null primary key,
+    user_id   int         not null,
+    code_hash bytea       not null,
+    used_at   timestamptz,
+    created   timestamptz not null default now(),
+    constraint recovery_codes_fk_user_id foreign key (user_id) references users (id) on delete cascade
+);
+
+create index recovery_codes_user_id_idx
+    on recovery_codes (user_id);
+
+alter table roles
+    add column require_two_factor boolean not null default false;
+
+-- failed logins are counted per account and per client address,
+-- counters are shared by all app instances
+alter table users
+    add column failed_logins        int not null default 0,
+    add column last_failed_login_at timestamptz,
+    add column locked_until         timestamptz;
+
+create table login_ip_failures
+(
+    ip              varchar(64) not null primary key,
+    failures        int         not null,
+    last_failure_at timestamptz not null,
+    locked_until    timestamptz
+);
+
+-- sessions of browsers, the cookie holds a random token and only sha-256 of it is stored
+create table sessions
+(
+    id           serial       not null primary key,
+    token_hash   bytea        not null unique,
+    user_id      int,
+    data         bytea        not null,
+    ip           varchar(64)  not null default '',
+    user_agent   varchar(255) not null default '',
+    last_seen_at timestamptz  not null,
+    expires_at   timestamptz  not null,
+    created      timestamptz  not null default now(),
+    constraint sessions_fk_user_id foreign key (user_id) references users (id) on delete cascade
+);
+
+create index sessions_user_id_idx
+    on sessions (user_id);
+
+-- handlers check named permissions of user's role instead of role ids
+alter table roles
+    add constraint roles_uc_name unique (name);
+
+create table role_permissions
+(
+    role_id    int         not null,
+    permission varchar(64) not null,
+    constraint role_permissions_pk primary key (role_id, permission),
+    constraint role_permissions_fk_role_id foreign key (role_id) references roles (id) on delete cascade
+);
+
+insert into role_permissions (role_id, permission)
+select r.id, p
+from roles r,
+     unnest(array ['cafe.approve', 'role.manage', 'security.manage']) p
+where r.name = 'admin';
+
+insert into role_permissions (role_id, permission)
+select r.id, p
+from roles r,
+     unnest(array ['reservation.view', 'reservation.status', 'reservation.book', 'reservation.free',
+         'blacklist.manage', 'cafe.settings', 'waitlist.manage']) p
+where r.name = 'partner';
+
+-- staff of cafes, partner routes act on the cafe the user selected among cafes they work at
+create table cafe_members
+(
+    cafe_id int         not null,
+    user_id int         not null,
+    role    varchar(16) not null
+        constraint cafe_members_ck_role check (role in ('owner', 'manager', 'host')),
+    created timestamptz not null default now(),
+    constraint cafe_members_pk primary key (cafe_id, user_id),
+    constraint cafe_members_fk_cafe_id foreign key (cafe_id) references cafes (id) on delete cascade,
+    constraint cafe_members_fk_user_id foreign key (user_id) references users (id) on delete cascade
+);
+
+create index cafe_members_user_id_idx
+    on cafe_members (user_id);
+
+-- partners of approved cafes own them
+insert into cafe_members (cafe_id, user_id, role)
+select id, admin_id, 'owner'
+from cafes
+where admin_id is not null
+  and status = true;
+
+create table staff_invites
+(
+    id          serial       not null primary key,
+    cafe_id     int          not null,
+    email       varchar(255) not null,
+    role        varchar(16)  not null
+        constraint staff_invites_ck_role check (role in ('owner', 'manager', 'host')),
+    token_hash  bytea        not null
+        constraint staff_invites_uq_token_hash unique,
+    invited_by  int          not null,
+    expires_at  timestamptz  not null,
+    accepted_at timestamptz,
+    created     timestamptz  not null default now(),
+    constraint staff_invites_fk_cafe_id foreign key (cafe_id) references cafes (id) on delete cascade,
+    constraint staff_invites_fk_invited_by foreign key (invited_by) references users (id) on delete cascade
+);
+
+create index staff_invites_cafe_id_idx
+    on staff_invites (cafe_id);
+
+insert into role_permissions (role_id, permission)
+select id, 'staff.manage'
+from roles
+where name = 'partner';
+
+-- append-only log of privileged actions, entries outlive users and cafes they mention
+create table audit_log
+(
+    id          serial      not null primary key,
+    actor_id    int         not null,
+    action      varchar(32) not null,
+    target_type varchar(16) not null,
+    target_id   int         not null,
+    cafe_id     int,
+    before      jsonb,
+    after       jsonb,
+    ip          varchar(45) not null,
+    created     timestamptz not null default now()
+);
+
+create index audit_log_created_idx
+    on audit_log (created);
+
+create index audit_log_cafe_id_idx
+    on audit_log (cafe_id, created);
+
+create function audit_log_append_only() returns trigger as
+$$
+begin
+    raise exception 'audit_log is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_log_no_update
+    before update or delete
+    on audit_log
+    for each row
+execute procedure audit_log_append_only();
+
+create trigger audit_log_no_truncate
+    before truncate
+    on audit_log
+    for each statement
+execute procedure audit_log_append_only();
+
+insert into role_permissions (role_id, permission)
+select id, 'audit.view'
+from roles
+where name = 'admin';
+
+insert into role_permissions (role_id, permission)
+select id, 'cafe.audit'
+from roles
+where name = 'partner';
+
+alter table users
+    add column notify_channel varchar(16) not null default 'email';
+
+-- outbox of notifications, worker claims due jobs with skip locked, so that several instances share them
+create table notifications
+(
+    id              serial      not null primary key,
+    kind            varchar(16) not null,
+    reservation_id  int         not null references reservations (id) on delete cascade,
+    -- scheduled_for keeps the same reminder from being queued twice, rescheduled reservation gets a new one
+    scheduled_for   timestamp   not null,
+    status          varchar(16) not null default 'pending',
+    attempts        int         not null default 0,
+    next_attempt_at timestamp   not null,
+    last_error      text,
+    created         timestamp   not null default now(),
+    sent_at         timestamp,
+    unique (kind, reservation_id, scheduled_for)
+);
+
+create index notifications_due_idx
+    on notifications (next_attempt_at) where status = 'pending';
+
+insert into role_permissions (role_id, permission)
+select id, 'notification.retry'
+from roles
+where name = 'admin';
+
+alter table users
+    add column locale varchar(2) not null default 'en';
+
+-- reminders are sent at minutes before the visit every cafe chooses instead of the single notify date
+alter table cafe_policies
+    add column reminder_offsets int[] not null default '{60}';
+
+alter table reservations
+    drop column notify_date,
+    add column created            timestamptz not null default now(),
+    add column guest_confirmed_at timestamptz;
+
+-- reminder's offset is how long before reservation's date it is scheduled, so times keep time zone as dates do
+alter table notifications
+    alter column scheduled_for type timestamptz,
+    alter column next_attempt_at type timestamptz,
+    alter column created type timestamptz,
+    alter column sent_at type timestamptz;
+
+-- topics users turned on or off by channel, without a row marketing is off and the rest come by the channel user prefers
+create table notification_preferences
+(
+    user_id    int         not null references users (id) on delete cascade,
+    topic      varchar(32) not null,
+    channel    varchar(16) not null,
+    subscribed bool        not null,
+    primary key (user_id, topic, channel)
+);
+
+-- guests without account unsubscribe by email address, it is kept lower case
+create table email_unsubscribes
+(
+    email   varchar(255) not null,
+    topic   varchar(32)  not null,
+    created timestamptz  not null default now(),
+    primary key (email, topic)
+);